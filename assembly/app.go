@@ -2,88 +2,437 @@ package assembly
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
-	"os"
-	"path/filepath"
+	"time"
 
+	"github.com/dennypenta/go-api-walkthrough/auth"
+	"github.com/dennypenta/go-api-walkthrough/authz"
 	"github.com/dennypenta/go-api-walkthrough/domain"
 	"github.com/dennypenta/go-api-walkthrough/handlers"
+	"github.com/dennypenta/go-api-walkthrough/pkg/breaker"
+	"github.com/dennypenta/go-api-walkthrough/pkg/jwt"
 	"github.com/dennypenta/go-api-walkthrough/pkg/log"
-	"github.com/dennypenta/go-api-walkthrough/repository"
-	"github.com/golang-migrate/migrate/v4"
-	_ "github.com/golang-migrate/migrate/v4/database/postgres"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
-	_ "github.com/jackc/pgx/stdlib"
+	"github.com/dennypenta/go-api-walkthrough/pkg/password"
+	"github.com/dennypenta/go-api-walkthrough/pkg/rwsplit"
+	"github.com/dennypenta/go-api-walkthrough/repository/cache"
+	"github.com/dennypenta/go-api-walkthrough/repository/memory"
+	"github.com/dennypenta/go-api-walkthrough/repository/postgres"
+	"github.com/dennypenta/go-api-walkthrough/repository/resilience"
+	"github.com/dennypenta/go-api-walkthrough/repository/stale"
+	"github.com/jackc/pgx/v5/stdlib"
 	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sync/errgroup"
 )
 
+// invalidationReconnectDelay is the pause before the cache invalidation listener reconnects.
+const invalidationReconnectDelay = time.Second
+
+// Worker is a background job running along with the server.
+// It must return nil once ctx is done, an error stops the process.
+type Worker func(ctx context.Context) error
+
 type App struct {
 	Mux     http.Handler
 	Log     *slog.Logger
-	Migrate *migrate.Migrate
+	Workers []Worker
+	// Registry keeps the metrics of the app components
+	Registry *prometheus.Registry
 
-	db *sqlx.DB
+	// closers release the resources the app has created, in the reverse order
+	closers []func() error
 }
 
 func (a *App) Close(ctx context.Context) error {
-	if err := a.db.Close(); err != nil {
-		a.Log.ErrorContext(ctx, "failed to close database connection", "err", err)
-		return err
+	var errs []error
+	for i := len(a.closers) - 1; i >= 0; i-- {
+		if err := a.closers[i](); err != nil {
+			a.Log.ErrorContext(ctx, "failed to close app resource", "err", err)
+			errs = append(errs, err)
+		}
 	}
 
-	return nil
+	return errors.Join(errs...)
 }
 
-func NewApp(conf Config) (*App, error) {
-	wd, err := os.Getwd()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get working directory: %w", err)
+// RunWorkers runs the background workers until ctx is done or one of them fails.
+func (a *App) RunWorkers(ctx context.Context) error {
+	g, ctx := errgroup.WithContext(ctx)
+	for _, w := range a.Workers {
+		g.Go(func() error {
+			return w(ctx)
+		})
 	}
 
-	db, err := sqlx.Connect("pgx", conf.PostresDsn)
+	return g.Wait()
+}
+
+func NewApp(ctx context.Context, conf Config, opts ...Option) (*App, error) {
+	o := newOptions(conf, opts)
+	app := &App{Log: o.logger, Registry: o.registry}
+
+	ctx, cancel := context.WithTimeout(ctx, conf.StartupTimeout)
+	defer cancel()
+
+	var middlewares []func(http.Handler) http.Handler
+	if o.userRepo == nil && conf.Storage == StorageMemory {
+		// the rest of the memory storage is filled by the services below,
+		// the repositories given with the options stay
+		o.userRepo = memory.NewUserRepository(o.clock, o.newID)
+	}
+	if o.userRepo == nil {
+		var err error
+		middlewares, err = app.useDatabase(ctx, conf, o)
+		if err != nil {
+			return nil, errors.Join(err, app.Close(ctx))
+		}
+		if conf.StaleEnabled {
+			app.useStale(conf, o)
+		}
+	}
+	if o.txManager == nil {
+		// the injected storage has no transactions
+		o.txManager = memory.TxManager{}
+	}
+
+	keys, err := newKeySet(ctx, conf, o)
+	if err != nil {
+		return nil, errors.Join(err, app.Close(ctx))
+	}
+	hasher, err := password.NewHasher(conf.PasswordHashParams())
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to postgres: %w", err)
+		return nil, errors.Join(fmt.Errorf("failed to create password hasher: %w", err), app.Close(ctx))
+	}
+	if o.mailer == nil {
+		if o.mailer, err = newMailer(conf, o); err != nil {
+			return nil, errors.Join(err, app.Close(ctx))
+		}
+	}
+	// the credentials, the sessions, the second factor, the roles, the api keys, the email verifications
+	// and the password resets go straight to the storage, the users might be cached or stale
+	roleService := newRoleService(o)
+	sessionService := newSessionService(conf, o)
+	apiKeyService := newAPIKeyService(o)
+	twoFactor := newTwoFactor(conf, o)
+	emailVerifier := newEmailVerifier(conf, o)
+	authService := newAuthService(conf, o, hasher, keys, roleService, twoFactor)
+	resetter := newPasswordResetter(conf, o, hasher)
+	app.Workers = append(app.Workers, resetter.Run)
+	userService := domain.NewUserService(o.userRepo, o.txManager).WithAuditLogger(o.audit)
+	rbac, err := app.useAccessPolicy(conf, o, userService)
+	if err != nil {
+		return nil, errors.Join(err, app.Close(ctx))
+	}
+	r := router{
+		users:      handlers.NewHandler(userService),
+		auth:       handlers.NewAuthHandler(authService),
+		roles:      handlers.NewRoleHandler(roleService),
+		sessions:   handlers.NewSessionHandler(sessionService),
+		apiKeys:    handlers.NewAPIKeyHandler(apiKeyService),
+		twoFactor:  handlers.NewTwoFactorHandler(twoFactor),
+		email:      handlers.NewEmailHandler(emailVerifier),
+		password:   handlers.NewPasswordHandler(resetter),
+		authorizer: handlers.NewAuthorizer(rbac, o.audit),
+		keys:       keys,
+	}
+
+	// the authentication goes inside the logging, so the principal is added to the request logger
+	bearer := handlers.AuthScheme{Name: "Bearer", Authenticator: auth.NewBearerAuthenticator(keys, conf.AuthIssuer, o.sessionRepo)}
+	apiKey := handlers.AuthScheme{Name: "ApiKey", Authenticator: auth.NewAPIKeyAuthenticator(o.apiKeyRepo, o.clock, auth.NewAPIKeyMetrics(o.registry))}
+	middlewares = append(middlewares,
+		handlers.NewAuthMiddleware(conf.AuthIssuer, bearer, apiKey),
+		log.NewLoggingMiddleware(o.logger, log.WithClock(o.clock), log.WithTraceIDGenerator(o.newID)),
+	)
+	app.Mux = chain(r.mux(), middlewares...)
+
+	return app, nil
+}
+
+// useAccessPolicy makes the user service enforce the role grants or the ABAC policy file reloaded in the background.
+// It returns the RBAC guarding the routes, with the ABAC policy it leaves the user actions to the service.
+func (a *App) useAccessPolicy(conf Config, o *options, users *domain.UserService) (*authz.RBAC, error) {
+	rbac := authz.NewRBAC(authz.RoleGrants)
+	if conf.AuthzPolicyFile == "" {
+		users.WithPolicy(rbac)
+		return rbac, nil
 	}
-	db.DB.SetMaxOpenConns(conf.DbMaxOpenConns)
-	db.DB.SetMaxIdleConns(conf.DbMaxIdleConns)
-	db.DB.SetConnMaxLifetime(conf.DbConnMaxLifetime)
-	db.DB.SetConnMaxIdleTime(conf.DbConnMaxIdleTime)
 
-	migrationsDir := filepath.Join(filepath.Join("file:///", wd), conf.MigrationsDir)
-	m, err := migrate.New(
-		migrationsDir,
-		conf.PostresDsn)
+	abac, err := authz.LoadABAC(conf.AuthzPolicyFile, o.logger)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create migration instance: %w", err)
+		return nil, fmt.Errorf("failed to load AUTHZ_POLICY_FILE: %w", err)
 	}
+	users.WithPolicy(abac)
+	a.Workers = append(a.Workers, func(ctx context.Context) error {
+		return abac.Watch(ctx, conf.AuthzPolicyReloadInterval)
+	})
+	return rbac.DelegateActions(), nil
+}
 
-	userRepo := repository.NewUserRepository(db)
-	userService := domain.NewUserService(userRepo)
-	userHandlers := handlers.NewHandler(userService)
+// useDatabase builds the repository on the native pgx pool for postgres,
+// sqlite and the pool given with WithDB go through database/sql.
+// It returns the middlewares the storage needs.
+func (a *App) useDatabase(ctx context.Context, conf Config, o *options) ([]func(http.Handler) http.Handler, error) {
+	if o.db == nil && o.pool == nil {
+		dialect, err := conf.Dialect()
+		if err != nil {
+			return nil, err
+		}
+		if dialect == DialectSQLite {
+			if o.db, err = ConnectDB(ctx, conf, o.logger); err != nil {
+				return nil, err
+			}
+			a.closers = append(a.closers, o.db.Close)
+		}
+	}
 
-	mux := http.NewServeMux()
+	if o.db != nil {
+		if err := a.checkSchema(ctx, conf, o, o.db); err != nil {
+			return nil, err
+		}
+		o.userRepo = NewUserRepository(o.db, o.pgClock, o.pgNewID)
+		if o.credRepo == nil {
+			o.credRepo = NewCredentialRepository(o.db, o.clock)
+		}
+		if o.sessionRepo == nil {
+			o.sessionRepo = NewSessionRepository(o.db, o.clock)
+		}
+		if o.refreshRepo == nil {
+			o.refreshRepo = NewRefreshTokenRepository(o.db, o.clock)
+		}
+		if o.roleRepo == nil {
+			o.roleRepo = NewRoleRepository(o.db)
+		}
+		if o.apiKeyRepo == nil {
+			o.apiKeyRepo = NewAPIKeyRepository(o.db, o.clock)
+		}
+		if o.twoFactorRepo == nil {
+			o.twoFactorRepo = NewTwoFactorRepository(o.db, o.clock)
+		}
+		if o.emailRepo == nil {
+			o.emailRepo = NewEmailVerificationRepository(o.db)
+		}
+		if o.resetRepo == nil {
+			o.resetRepo = NewPasswordResetRepository(o.db)
+		}
+		if o.txManager == nil {
+			o.txManager = NewTxManager(o.db, conf, o.logger)
+		}
+		a.useResilience(conf, o)
+		if conf.CacheEnabled {
+			a.useCache(conf, o, nil)
+		}
+		return nil, nil
+	}
 
-	mux.HandleFunc("GET /v1/users", userHandlers.ListUsers)
-	mux.HandleFunc("GET /v1/users/{id}", userHandlers.GetUserByID)
-	mux.HandleFunc("POST /v1/users", userHandlers.CreateUser)
-	mux.HandleFunc("PUT /v1/users/{id}", userHandlers.UpdateUser)
-	mux.HandleFunc("DELETE /v1/users/{id}", userHandlers.DeleteUser)
+	if o.pool == nil {
+		pool, err := ConnectPool(ctx, conf, o.logger)
+		if err != nil {
+			return nil, err
+		}
+		o.pool = pool
+		a.closers = append(a.closers, func() error {
+			pool.Close()
+			return nil
+		})
+	}
+	// the schema check goes through database/sql sharing the pool
+	db := sqlx.NewDb(stdlib.OpenDBFromPool(o.pool), driverPostgres)
+	defer db.Close()
+	if err := a.checkSchema(ctx, conf, o, db); err != nil {
+		return nil, err
+	}
 
-	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(200)
+	userRepo := postgres.NewUserRepository(o.pool).WithClock(o.pgClock).WithIDGenerator(o.pgNewID)
+	o.userRepo = userRepo
+	if o.credRepo == nil {
+		o.credRepo = postgres.NewCredentialRepository(o.pool)
+	}
+	if o.sessionRepo == nil {
+		o.sessionRepo = postgres.NewSessionRepository(o.pool)
+	}
+	if o.refreshRepo == nil {
+		o.refreshRepo = postgres.NewRefreshTokenRepository(o.pool)
+	}
+	if o.roleRepo == nil {
+		o.roleRepo = postgres.NewRoleRepository(o.pool)
+	}
+	if o.apiKeyRepo == nil {
+		o.apiKeyRepo = postgres.NewAPIKeyRepository(o.pool)
+	}
+	if o.twoFactorRepo == nil {
+		o.twoFactorRepo = postgres.NewTwoFactorRepository(o.pool)
+	}
+	if o.emailRepo == nil {
+		o.emailRepo = postgres.NewEmailVerificationRepository(o.pool)
+	}
+	if o.resetRepo == nil {
+		o.resetRepo = postgres.NewPasswordResetRepository(o.pool)
+	}
+	if o.txManager == nil {
+		o.txManager = NewPoolTxManager(o.pool, conf, o.logger)
+	}
+	a.useResilience(conf, o)
+
+	var middlewares []func(http.Handler) http.Handler
+	if len(conf.PostgresReplicaDsns) > 0 {
+		stickiness, err := a.useReplicas(ctx, conf, o, userRepo)
+		if err != nil {
+			return nil, err
+		}
+		middlewares = append(middlewares, stickiness)
+	}
+	if conf.CacheEnabled {
+		var notifier *postgres.Notifier
+		if conf.PostgresSimpleProtocol {
+			o.logger.WarnContext(ctx, "LISTEN doesn't work behind PgBouncer, the cache of every replica relies on CACHE_TTL")
+		} else {
+			notifier = postgres.NewNotifier(o.pool, invalidationReconnectDelay, o.logger)
+		}
+		a.useCache(conf, o, notifier)
+	}
+
+	return middlewares, nil
+}
+
+// useCache puts the cache in front of the storage.
+// The notifier spreads the invalidations over the replicas, without it they rely on the TTL.
+func (a *App) useCache(conf Config, o *options, notifier *postgres.Notifier) {
+	cached := cache.NewUserRepository(o.userRepo, conf.CacheSize, conf.CacheTTL, o.clock, cache.NewMetrics(o.registry))
+	o.userRepo = cached
+	if notifier == nil {
+		return
+	}
+
+	cached.WithInvalidator(notifier)
+	a.Workers = append(a.Workers, func(ctx context.Context) error {
+		return notifier.Listen(ctx, cached.Forget, cached.Purge)
 	})
+}
+
+// useResilience puts the timeouts, the bulkheads and the circuit breaker right in front of the storage,
+// so the cache misses go through them and the cache hits don't.
+func (a *App) useResilience(conf Config, o *options) {
+	m := resilience.NewMetrics(o.registry)
+	b := breaker.New(conf.BreakerFailureThreshold, conf.BreakerOpenTimeout,
+		breaker.WithHalfOpenProbes(conf.BreakerHalfOpenProbes),
+		breaker.WithFailure(resilience.IsFailure),
+		breaker.WithClock(o.clock),
+		breaker.WithStateChange(func(from, to breaker.State) {
+			o.logger.Warn("storage circuit breaker state changed", "from", from, "to", to)
+			m.ObserveState(to)
+		}),
+	)
+	o.userRepo = resilience.NewUserRepository(o.userRepo, b, conf.StorageLimits(), m)
+}
+
+// useStale makes the reads serve the last known users while the storage is unavailable.
+func (a *App) useStale(conf Config, o *options) {
+	o.userRepo = stale.NewUserRepository(o.userRepo, conf.StaleSize, conf.StaleMaxAge, o.clock, stale.NewMetrics(o.registry))
+}
+
+// checkSchema makes sure the server runs against the schema it's built for,
+// the migrations are applied by the migrate subcommand.
+func (a *App) checkSchema(ctx context.Context, conf Config, o *options, db *sqlx.DB) error {
+	return verifySchema(ctx, conf.SchemaCheck, o.migrations(db), db, o.logger)
+}
+
+// useReplicas routes the reads of the repository to the replicas checked in the background.
+// It returns the middleware sending the reads of a client that has just written to the primary.
+func (a *App) useReplicas(ctx context.Context, conf Config, o *options, repo *postgres.UserRepository) (func(http.Handler) http.Handler, error) {
+	replicas, names, err := openReplicas(ctx, conf)
+	if err != nil {
+		return nil, err
+	}
+	for _, pool := range replicas {
+		a.closers = append(a.closers, func() error {
+			pool.Close()
+			return nil
+		})
+	}
 
-	// https://www.gnu.org/software/libc/manual/html_node/Standard-Streams.html
-	// errors and diagnostic messages should go to stderr
-	l := log.NewLogger(os.Stderr, conf.LogLevel)
-	loggingMiddleware := log.NewLoggingMiddleware(l)
-	return &App{
-		Mux:     loggingMiddleware(mux),
-		Log:     l,
-		Migrate: m,
-
-		db: db,
-	}, nil
+	rs := rwsplit.NewReplicaSet(o.pool, replicas, names, o.logger)
+	// the reads go to the primary until a replica passes the check
+	rs.Check(ctx, conf.ReplicaHealthTimeout)
+	a.Workers = append(a.Workers, func(ctx context.Context) error {
+		return rs.Run(ctx, conf.ReplicaHealthInterval, conf.ReplicaHealthTimeout)
+	})
+	repo.WithReplicas(rs)
+
+	return rwsplit.NewMiddleware(conf.ReadYourWritesWindow, o.clock), nil
+}
+
+type router struct {
+	users      *handlers.Handler
+	auth       *handlers.AuthHandler
+	roles      *handlers.RoleHandler
+	sessions   *handlers.SessionHandler
+	apiKeys    *handlers.APIKeyHandler
+	twoFactor  *handlers.TwoFactorHandler
+	email      *handlers.EmailHandler
+	password   *handlers.PasswordHandler
+	authorizer *handlers.Authorizer
+	keys       *jwt.KeySet
+}
+
+// route is a row of the policy table, every route declares the permission it needs.
+type route struct {
+	pattern    string
+	permission authz.Permission
+	handler    http.HandlerFunc
+}
+
+func (r router) routes() []route {
+	return []route{
+		{"GET /v1/me", authz.Authenticated, r.users.GetMe},
+		{"GET /v1/me/sessions", authz.Authenticated, r.sessions.ListSessions},
+		{"DELETE /v1/me/sessions", authz.Authenticated, r.sessions.RevokeSessions},
+		{"DELETE /v1/me/sessions/{id}", authz.Authenticated, r.sessions.RevokeSession},
+		{"POST /v1/me/2fa/totp", authz.Authenticated, r.twoFactor.EnrollTOTP},
+		{"POST /v1/me/2fa/totp/confirm", authz.Authenticated, r.twoFactor.ConfirmTOTP},
+		{"GET /v1/users", authz.ListUsers, r.users.ListUsers},
+		{"GET /v1/users/{id}", authz.ReadUser, r.users.GetUserByID},
+		{"POST /v1/users", authz.CreateUser, r.users.CreateUser},
+		{"PUT /v1/users/{id}", authz.UpdateUser, r.users.UpdateUser},
+		{"DELETE /v1/users/{id}", authz.DeleteUser, r.users.DeleteUser},
+		{"POST /v1/users/{id}/restore", authz.RestoreUser, r.users.RestoreUser},
+		{"PUT /v1/users/{id}/credentials", authz.SetCredentials, r.auth.SetCredentials},
+		{"POST /v1/users/{id}/email/verify-request", authz.VerifyEmail, r.email.RequestEmailVerification},
+		{"GET /v1/users/{id}/roles", authz.ReadRoles, r.roles.GetRoles},
+		{"PUT /v1/users/{id}/roles", authz.SetRoles, r.roles.SetRoles},
+		{"POST /v1/authz/check", authz.CheckAccess, r.users.CheckAccess},
+		{"GET /v1/api-keys", authz.ManageAPIKeys, r.apiKeys.ListAPIKeys},
+		{"POST /v1/api-keys", authz.ManageAPIKeys, r.apiKeys.CreateAPIKey},
+		{"DELETE /v1/api-keys/{id}", authz.ManageAPIKeys, r.apiKeys.RevokeAPIKey},
+
+		{"POST /v1/auth/login", authz.Public, r.auth.Login},
+		{"POST /v1/auth/2fa", authz.Public, r.auth.LoginTwoFactor},
+		{"POST /v1/auth/refresh", authz.Public, r.auth.Refresh},
+		{"POST /v1/auth/password/forgot", authz.Public, r.password.ForgotPassword},
+		{"POST /v1/auth/password/reset", authz.Public, r.password.ResetPassword},
+		{"POST /v1/email/verify", authz.Public, r.email.VerifyEmail},
+		{"GET /.well-known/jwks.json", authz.Public, handlers.JWKS(r.keys)},
+
+		{"GET /healthz", authz.Public, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(200)
+		}},
+	}
+}
+
+func (r router) mux() *http.ServeMux {
+	mux := http.NewServeMux()
+	for _, rt := range r.routes() {
+		mux.Handle(rt.pattern, r.authorizer.Require(rt.permission, rt.handler))
+	}
+	return mux
+}
+
+// chain wraps the handler with the middlewares, the last one is the outermost.
+func chain(h http.Handler, middlewares ...func(http.Handler) http.Handler) http.Handler {
+	for _, m := range middlewares {
+		h = m(h)
+	}
+	return h
 }
@@ -0,0 +1,171 @@
+package assembly_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dennypenta/go-api-walkthrough/assembly"
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/domain/mocks"
+	"github.com/dennypenta/go-api-walkthrough/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewAppWithUserRepository(t *testing.T) {
+	t.Parallel()
+
+	user := domain.User{ID: "8da80ba8-81c6-4336-bba3-ba8ea50541b0", Username: "test"}
+	repo := mocks.NewMockUserRepository(t)
+	repo.On("GetUserByID", mock.Anything, user.ID).Return(user, nil)
+
+	conf, err := assembly.NewConfig()
+	require.NoError(t, err)
+	admin := adminToken(t, &conf)
+
+	// no database is needed when the storage is replaced
+	ctx := context.Background()
+	app, err := assembly.NewApp(ctx, conf,
+		assembly.WithUserRepository(repo),
+		assembly.WithLogger(log.NewLogger(io.Discard, slog.LevelInfo)),
+	)
+	require.NoError(t, err)
+	defer app.Close(ctx)
+
+	w := httptest.NewRecorder()
+	app.Mux.ServeHTTP(w, asAdmin(httptest.NewRequest("GET", "/v1/users/"+user.ID, nil), admin))
+	assert.Equal(t, 200, w.Code)
+	assert.JSONEq(t, `{"id": "8da80ba8-81c6-4336-bba3-ba8ea50541b0", "username": "test"}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	app.Mux.ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+	assert.Equal(t, 200, w.Code)
+}
+
+func TestNewAppMemoryStorageKeepsOptions(t *testing.T) {
+	t.Parallel()
+
+	conf, err := assembly.NewConfig()
+	require.NoError(t, err)
+	conf.Storage = assembly.StorageMemory
+	creds := mocks.NewMockCredentialRepository(t)
+	creds.On("GetCredentialsByLogin", mock.Anything, "alice").Return(domain.Credentials{}, domain.ErrCredentialsNotFound)
+
+	// the memory storage fills only the repositories not given
+	ctx := context.Background()
+	app, err := assembly.NewApp(ctx, conf,
+		assembly.WithCredentialRepository(creds),
+		assembly.WithLogger(log.NewLogger(io.Discard, slog.LevelInfo)),
+	)
+	require.NoError(t, err)
+	defer app.Close(ctx)
+
+	w := httptest.NewRecorder()
+	app.Mux.ServeHTTP(w, httptest.NewRequest("POST", "/v1/auth/login", strings.NewReader(`{"login": "alice", "password": "correct horse battery staple"}`)))
+	assert.Equal(t, 401, w.Code)
+}
+
+func TestNewAppWithSQLite(t *testing.T) {
+	t.Parallel()
+
+	conf, err := assembly.NewConfig()
+	require.NoError(t, err)
+	conf.DatabaseDsn = "sqlite://" + filepath.Join(t.TempDir(), "app.db")
+	admin := adminToken(t, &conf)
+	ctx := context.Background()
+	logger := assembly.WithLogger(log.NewLogger(io.Discard, slog.LevelInfo))
+
+	// the schema check refuses to start before the migrations are applied
+	_, err = assembly.NewApp(ctx, conf, logger)
+	require.ErrorIs(t, err, assembly.ErrSchemaMismatch)
+
+	migrator, err := assembly.NewMigrator(ctx, conf, logger)
+	require.NoError(t, err)
+	require.NoError(t, migrator.Up(ctx))
+	require.NoError(t, migrator.Close())
+
+	app, err := assembly.NewApp(ctx, conf, logger)
+	require.NoError(t, err)
+	defer app.Close(ctx)
+
+	w := httptest.NewRecorder()
+	app.Mux.ServeHTTP(w, asAdmin(httptest.NewRequest("POST", "/v1/users", strings.NewReader(`{"username": "test"}`)), admin))
+	require.Equal(t, 200, w.Code, w.Body.String())
+	var created domain.User
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+
+	w = httptest.NewRecorder()
+	app.Mux.ServeHTTP(w, asAdmin(httptest.NewRequest("GET", "/v1/users/"+created.ID, nil), admin))
+	assert.Equal(t, 200, w.Code)
+	assert.JSONEq(t, `{"id": "`+created.ID+`", "username": "test"}`, w.Body.String())
+}
+
+func TestNewAppServesStaleUsers(t *testing.T) {
+	t.Parallel()
+
+	conf, err := assembly.NewConfig()
+	require.NoError(t, err)
+	conf.DatabaseDsn = "sqlite://" + filepath.Join(t.TempDir(), "app.db")
+	conf.CacheEnabled = false
+	conf.StaleEnabled = true
+	conf.BreakerFailureThreshold = 1
+	admin := adminToken(t, &conf)
+	ctx := context.Background()
+	l := log.NewLogger(io.Discard, slog.LevelInfo)
+
+	migrator, err := assembly.NewMigrator(ctx, conf, assembly.WithLogger(l))
+	require.NoError(t, err)
+	require.NoError(t, migrator.Up(ctx))
+	require.NoError(t, migrator.Close())
+	db, err := assembly.ConnectDB(ctx, conf, l)
+	require.NoError(t, err)
+
+	app, err := assembly.NewApp(ctx, conf, assembly.WithLogger(l), assembly.WithDB(db))
+	require.NoError(t, err)
+	defer app.Close(ctx)
+
+	w := httptest.NewRecorder()
+	app.Mux.ServeHTTP(w, asAdmin(httptest.NewRequest("POST", "/v1/users", strings.NewReader(`{"username": "test"}`)), admin))
+	require.Equal(t, 200, w.Code, w.Body.String())
+	var created domain.User
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	for _, target := range []string{"/v1/users/" + created.ID, "/v1/users"} {
+		w = httptest.NewRecorder()
+		app.Mux.ServeHTTP(w, asAdmin(httptest.NewRequest("GET", target, nil), admin))
+		require.Equal(t, 200, w.Code)
+	}
+
+	// the storage goes away, the reads are served from the last known values
+	require.NoError(t, db.Close())
+
+	w = httptest.NewRecorder()
+	app.Mux.ServeHTTP(w, asAdmin(httptest.NewRequest("GET", "/v1/users/"+created.ID, nil), admin))
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, `110 - "Response is Stale"`, w.Header().Get("Warning"))
+	assert.JSONEq(t, `{"id": "`+created.ID+`", "username": "test", "stale": true}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	app.Mux.ServeHTTP(w, asAdmin(httptest.NewRequest("GET", "/v1/users", nil), admin))
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, `110 - "Response is Stale"`, w.Header().Get("Warning"))
+	assert.Contains(t, w.Body.String(), `"stale":true`)
+
+	w = httptest.NewRecorder()
+	app.Mux.ServeHTTP(w, asAdmin(httptest.NewRequest("GET", "/v1/users/8da80ba8-81c6-4336-bba3-ba8ea50541b0", nil), admin))
+	assert.Equal(t, 503, w.Code)
+	assert.JSONEq(t, `{"code": "unavailable"}`, w.Body.String())
+	assert.Equal(t, "10", w.Header().Get("Retry-After"))
+}
+
+func asAdmin(r *http.Request, token string) *http.Request {
+	r.Header.Set("Authorization", "Bearer "+token)
+	return r
+}
@@ -0,0 +1,152 @@
+package assembly
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/auth"
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/pkg/jwt"
+	"github.com/dennypenta/go-api-walkthrough/pkg/mail"
+	"github.com/dennypenta/go-api-walkthrough/pkg/password"
+	"github.com/dennypenta/go-api-walkthrough/repository/cache"
+	"github.com/dennypenta/go-api-walkthrough/repository/memory"
+)
+
+// devKeyID is the id of the key generated when no signing key is configured.
+const devKeyID = "dev"
+
+// newAuthService builds the sign in on top of the storage chosen for the users,
+// it goes after newSessionService, a change of the credentials revokes the sessions through the cache of the revocations.
+func newAuthService(conf Config, o *options, hasher *password.Hasher, keys *jwt.KeySet, roles auth.RoleSource, secondFactor domain.SecondFactor) *domain.AuthService {
+	if o.credRepo == nil {
+		o.credRepo = memory.NewCredentialRepository(o.userRepo)
+	}
+	if o.refreshRepo == nil {
+		o.refreshRepo = memory.NewRefreshTokenRepository(o.userRepo, o.sessionRepo)
+	}
+
+	issuer := auth.NewTokenIssuer(keys, o.refreshRepo, o.sessionRepo, roles, o.txManager, conf.TokenConfig(), o.clock, o.newID, o.logger)
+	return domain.NewAuthService(o.credRepo, hasher, issuer, secondFactor, o.sessionRepo, o.txManager, conf.PasswordPolicy())
+}
+
+// newPasswordResetter goes after newAuthService and newSessionService,
+// a reset replaces the credentials and revokes the sessions through the cache of the revocations.
+func newPasswordResetter(conf Config, o *options, hasher *password.Hasher) *auth.PasswordResetter {
+	if o.resetRepo == nil {
+		o.resetRepo = memory.NewPasswordResetRepository(o.userRepo)
+	}
+	return auth.NewPasswordResetter(o.resetRepo, o.credRepo, o.userRepo, o.sessionRepo, hasher, conf.PasswordPolicy(),
+		o.txManager, o.mailer, conf.PasswordResetConfig(), o.clock, o.newID, o.logger)
+}
+
+// newTwoFactor keeps the second factor next to the users.
+func newTwoFactor(conf Config, o *options) *auth.TwoFactor {
+	if o.twoFactorRepo == nil {
+		o.twoFactorRepo = memory.NewTwoFactorRepository(o.userRepo)
+	}
+	return auth.NewTwoFactor(o.twoFactorRepo, o.userRepo, o.txManager, conf.TwoFactorConfig(), o.clock, o.newID)
+}
+
+// newEmailVerifier keeps the verifications next to the users.
+func newEmailVerifier(conf Config, o *options) *auth.EmailVerifier {
+	if o.emailRepo == nil {
+		o.emailRepo = memory.NewEmailVerificationRepository(o.userRepo)
+	}
+	return auth.NewEmailVerifier(o.emailRepo, o.userRepo, o.mailer, conf.EmailVerificationConfig(), o.clock, o.newID)
+}
+
+// newMailer picks the transport of MAIL_TRANSPORT.
+func newMailer(conf Config, o *options) (mail.Mailer, error) {
+	switch conf.MailTransport {
+	case MailTransportSMTP:
+		m, err := mail.NewSMTP(conf.SmtpAddr, conf.SmtpUsername, conf.SmtpPassword, conf.MailFrom, o.clock)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create smtp mailer: %w", err)
+		}
+		return m, nil
+	case MailTransportFile:
+		return mail.NewFile(conf.MailDir, conf.MailFrom, o.clock), nil
+	default:
+		o.logger.Warn("MAIL_TRANSPORT is log, the mail is written to the log and never delivered")
+		return mail.NewLog(o.logger), nil
+	}
+}
+
+// newSessionService caches the revocations in front of the storage of the sessions,
+// the issuer and the authenticator share the cache, so a session revoked here is refused at once.
+func newSessionService(conf Config, o *options) *domain.SessionService {
+	if o.sessionRepo == nil {
+		o.sessionRepo = memory.NewSessionRepository(o.userRepo)
+	}
+	if conf.AuthSessionCacheTTL > 0 {
+		o.sessionRepo = cache.NewSessionRepository(o.sessionRepo, conf.AuthSessionCacheSize, conf.AuthSessionCacheTTL, o.clock)
+	}
+	return domain.NewSessionService(o.sessionRepo)
+}
+
+// newAPIKeyService keeps the api keys apart from the users, they belong to the services.
+func newAPIKeyService(o *options) *domain.APIKeyService {
+	if o.apiKeyRepo == nil {
+		o.apiKeyRepo = memory.NewAPIKeyRepository()
+	}
+	return domain.NewAPIKeyService(o.apiKeyRepo, auth.APIKeyGenerator{}, o.clock, o.newID)
+}
+
+// newRoleService keeps the roles next to the users.
+func newRoleService(o *options) *domain.RoleService {
+	if o.roleRepo == nil {
+		o.roleRepo = memory.NewRoleRepository(o.userRepo)
+	}
+	return domain.NewRoleService(o.roleRepo, o.txManager)
+}
+
+// loadVerificationKey reads the key of an AUTH_VERIFICATION_KEY_FILES entry,
+// it's the path optionally followed by @ and the RFC 3339 time the key retires at, e.g. keys/2024-01.pem@2024-07-01T00:00:00Z.
+func loadVerificationKey(entry string) (jwt.Key, error) {
+	path, notAfter, retires := strings.Cut(entry, "@")
+	k, err := jwt.LoadKey(path)
+	if err != nil {
+		return k, err
+	}
+	if retires {
+		if k.NotAfter, err = time.Parse(time.RFC3339, notAfter); err != nil {
+			return k, fmt.Errorf("invalid retire time of %s: %w", path, err)
+		}
+	}
+	return k, nil
+}
+
+// newKeySet loads the signing and the verification keys,
+// without the signing key a random one is generated, it's fine for a single local instance only.
+func newKeySet(ctx context.Context, conf Config, o *options) (*jwt.KeySet, error) {
+	var verification []jwt.Key
+	for _, entry := range conf.AuthVerificationKeyFiles {
+		k, err := loadVerificationKey(entry)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load AUTH_VERIFICATION_KEY_FILES: %w", err)
+		}
+		verification = append(verification, k)
+	}
+
+	var signing jwt.Key
+	var err error
+	if conf.AuthSigningKeyFile != "" {
+		if signing, err = jwt.LoadKey(conf.AuthSigningKeyFile); err != nil {
+			return nil, fmt.Errorf("failed to load AUTH_SIGNING_KEY_FILE: %w", err)
+		}
+	} else {
+		o.logger.WarnContext(ctx, "AUTH_SIGNING_KEY_FILE is not set, the tokens are signed with a random key and don't survive a restart")
+		if signing, err = jwt.GenerateKey(devKeyID); err != nil {
+			return nil, err
+		}
+	}
+
+	keys, err := jwt.NewKeySet(signing, verification, o.clock)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token keys: %w", err)
+	}
+	return keys, nil
+}
@@ -0,0 +1,737 @@
+package assembly_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/assembly"
+	"github.com/dennypenta/go-api-walkthrough/auth"
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/pkg/jwt"
+	"github.com/dennypenta/go-api-walkthrough/pkg/log"
+	"github.com/dennypenta/go-api-walkthrough/pkg/mail"
+	"github.com/dennypenta/go-api-walkthrough/pkg/totp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogin(t *testing.T) {
+	t.Parallel()
+
+	conf, err := assembly.NewConfig()
+	require.NoError(t, err)
+	conf.Storage = assembly.StorageMemory
+	// the tests don't need the production cost
+	conf.PasswordHashMemory = 1024
+	conf.PasswordHashIterations = 1
+	admin := adminToken(t, &conf)
+	var audit bytes.Buffer
+	ctx := context.Background()
+	app, err := assembly.NewApp(ctx, conf,
+		assembly.WithLogger(log.NewLogger(io.Discard, slog.LevelInfo)),
+		assembly.WithAuditLogger(log.NewLogger(&audit, slog.LevelInfo)),
+	)
+	require.NoError(t, err)
+	defer app.Close(ctx)
+
+	doAs := func(token, method, target, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		app.Mux.ServeHTTP(w, r)
+		return w
+	}
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		return doAs(admin, method, target, body)
+	}
+
+	w := do("POST", "/v1/users", `{"username": "alice"}`)
+	require.Equal(t, 200, w.Code)
+	var user domain.User
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &user))
+
+	w = do("PUT", "/v1/users/"+user.ID+"/credentials", `{"login": "alice", "password": "short"}`)
+	assert.Equal(t, 400, w.Code)
+	assert.JSONEq(t, `{"code": "weak_password", "meta": {"reason": "must be at least 12 characters"}}`, w.Body.String())
+	w = do("PUT", "/v1/users/"+user.ID+"/credentials", `{"login": "Alice", "password": "correct horse battery staple"}`)
+	require.Equal(t, 204, w.Code, w.Body.String())
+
+	w = do("POST", "/v1/auth/login", `{"login": "alice", "password": "correct horse battery staple"}`)
+	require.Equal(t, 200, w.Code, w.Body.String())
+	var tokens domain.TokenPair
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &tokens))
+	assert.NotEmpty(t, tokens.AccessToken)
+	assert.NotEmpty(t, tokens.RefreshToken)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+
+	w = doAs("", "GET", "/v1/me", "")
+	assert.Equal(t, 401, w.Code)
+	assert.Equal(t, `Bearer realm="user-service"`, w.Header().Get("WWW-Authenticate"))
+	w = doAs(tokens.AccessToken, "GET", "/v1/me", "")
+	assert.Equal(t, 200, w.Code)
+	assert.JSONEq(t, `{"id": "`+user.ID+`", "username": "alice"}`, w.Body.String())
+
+	// a member works on itself only
+	assert.Equal(t, 200, doAs(tokens.AccessToken, "GET", "/v1/users/"+user.ID, "").Code)
+	w = do("POST", "/v1/users", `{"username": "bob"}`)
+	require.Equal(t, 200, w.Code)
+	var bob domain.User
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &bob))
+	w = doAs(tokens.AccessToken, "DELETE", "/v1/users/"+bob.ID, "")
+	assert.Equal(t, 403, w.Code)
+	assert.JSONEq(t, `{"code": "forbidden"}`, w.Body.String())
+	assert.Contains(t, audit.String(), `"msg":"access denied","principalID":"`+user.ID+`","roles":["member"],"permission":"users:delete","resourceID":"`+bob.ID+`"`)
+
+	// the granted role comes with the next access token
+	require.Equal(t, 204, do("PUT", "/v1/users/"+user.ID+"/roles", `{"roles": ["support"]}`).Code)
+	w = doAs(tokens.AccessToken, "GET", "/v1/users/"+user.ID+"/roles", "")
+	assert.Equal(t, 200, w.Code)
+	assert.JSONEq(t, `{"roles": ["support"]}`, w.Body.String())
+	assert.Equal(t, 403, doAs(tokens.AccessToken, "GET", "/v1/users/"+bob.ID, "").Code)
+
+	w = do("POST", "/v1/auth/refresh", `{"refresh_token": "`+tokens.RefreshToken+`"}`)
+	require.Equal(t, 200, w.Code, w.Body.String())
+	var refreshed domain.TokenPair
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &refreshed))
+	assert.NotEqual(t, tokens.RefreshToken, refreshed.RefreshToken)
+	assert.Equal(t, 200, doAs(refreshed.AccessToken, "GET", "/v1/users/"+bob.ID, "").Code)
+
+	// the exchanged token comes back, the refreshed one is revoked along with it
+	for _, token := range []string{tokens.RefreshToken, refreshed.RefreshToken} {
+		w = do("POST", "/v1/auth/refresh", `{"refresh_token": "`+token+`"}`)
+		assert.Equal(t, 401, w.Code)
+		assert.JSONEq(t, `{"code": "invalid_refresh_token"}`, w.Body.String())
+	}
+
+	// a wrong password and an unknown login look the same
+	for _, body := range []string{
+		`{"login": "alice", "password": "wrong horse battery staple"}`,
+		`{"login": "bob", "password": "correct horse battery staple"}`,
+	} {
+		w = do("POST", "/v1/auth/login", body)
+		assert.Equal(t, 401, w.Code)
+		assert.JSONEq(t, `{"code": "invalid_credentials"}`, w.Body.String())
+	}
+
+	// the deleted user can't sign in
+	require.Equal(t, 200, do("DELETE", "/v1/users/"+user.ID, "").Code)
+	w = do("POST", "/v1/auth/login", `{"login": "alice", "password": "correct horse battery staple"}`)
+	assert.Equal(t, 401, w.Code)
+}
+
+func TestSessions(t *testing.T) {
+	t.Parallel()
+
+	conf, err := assembly.NewConfig()
+	require.NoError(t, err)
+	conf.Storage = assembly.StorageMemory
+	conf.PasswordHashMemory = 1024
+	conf.PasswordHashIterations = 1
+	admin := adminToken(t, &conf)
+	ctx := context.Background()
+	app, err := assembly.NewApp(ctx, conf, assembly.WithLogger(log.NewLogger(io.Discard, slog.LevelInfo)))
+	require.NoError(t, err)
+	defer app.Close(ctx)
+
+	doAs := func(token, method, target, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		r.Header.Set("User-Agent", "test")
+		w := httptest.NewRecorder()
+		app.Mux.ServeHTTP(w, r)
+		return w
+	}
+	login := func(device string) domain.TokenPair {
+		t.Helper()
+		w := doAs("", "POST", "/v1/auth/login", `{"login": "alice", "password": "correct horse battery staple", "device": "`+device+`"}`)
+		require.Equal(t, 200, w.Code, w.Body.String())
+		var tokens domain.TokenPair
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &tokens))
+		return tokens
+	}
+	list := func(token string) []domain.Session {
+		t.Helper()
+		w := doAs(token, "GET", "/v1/me/sessions", "")
+		require.Equal(t, 200, w.Code, w.Body.String())
+		var resp struct {
+			Sessions []domain.Session `json:"sessions"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp.Sessions
+	}
+
+	w := doAs(admin, "POST", "/v1/users", `{"username": "alice"}`)
+	require.Equal(t, 200, w.Code)
+	var user domain.User
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &user))
+	w = doAs(admin, "PUT", "/v1/users/"+user.ID+"/credentials", `{"login": "alice", "password": "correct horse battery staple"}`)
+	require.Equal(t, 204, w.Code, w.Body.String())
+
+	laptop, phone, tablet := login("laptop"), login("phone"), login("tablet")
+	sessions := list(laptop.AccessToken)
+	require.Len(t, sessions, 3)
+	var phoneID string
+	for _, s := range sessions {
+		assert.Equal(t, s.Device == "laptop", s.Current, s.Device)
+		assert.Equal(t, "test", s.UserAgent)
+		assert.Equal(t, "192.0.2.1", s.IP)
+		if s.Device == "phone" {
+			phoneID = s.ID
+		}
+	}
+
+	// the phone is signed out: its access token is refused at once and its refresh token is gone
+	require.Equal(t, 204, doAs(laptop.AccessToken, "DELETE", "/v1/me/sessions/"+phoneID, "").Code)
+	assert.Equal(t, 401, doAs(phone.AccessToken, "GET", "/v1/me", "").Code)
+	w = doAs("", "POST", "/v1/auth/refresh", `{"refresh_token": "`+phone.RefreshToken+`"}`)
+	assert.Equal(t, 401, w.Code)
+	w = doAs(laptop.AccessToken, "DELETE", "/v1/me/sessions/"+phoneID, "")
+	assert.Equal(t, 400, w.Code)
+	assert.JSONEq(t, `{"code": "session_not_found"}`, w.Body.String())
+
+	// another user's sessions aren't reachable
+	w = doAs(admin, "DELETE", "/v1/me/sessions/"+sessions[0].ID, "")
+	assert.Equal(t, 400, w.Code)
+
+	require.Equal(t, 204, doAs(laptop.AccessToken, "DELETE", "/v1/me/sessions?except=current", "").Code)
+	assert.Equal(t, 401, doAs(tablet.AccessToken, "GET", "/v1/me", "").Code)
+	sessions = list(laptop.AccessToken)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, "laptop", sessions[0].Device)
+
+	w = doAs(laptop.AccessToken, "DELETE", "/v1/me/sessions?except=everything", "")
+	assert.Equal(t, 400, w.Code)
+	assert.JSONEq(t, `{"code": "invalid_except"}`, w.Body.String())
+
+	require.Equal(t, 204, doAs(laptop.AccessToken, "DELETE", "/v1/me/sessions", "").Code)
+	assert.Equal(t, 401, doAs(laptop.AccessToken, "GET", "/v1/me", "").Code)
+	// the admin token has no session and keeps working
+	assert.Equal(t, 200, doAs(admin, "GET", "/v1/users", "").Code)
+}
+
+func TestAPIKeys(t *testing.T) {
+	t.Parallel()
+
+	conf, err := assembly.NewConfig()
+	require.NoError(t, err)
+	conf.Storage = assembly.StorageMemory
+	admin := adminToken(t, &conf)
+	ctx := context.Background()
+	app, err := assembly.NewApp(ctx, conf, assembly.WithLogger(log.NewLogger(io.Discard, slog.LevelInfo)))
+	require.NoError(t, err)
+	defer app.Close(ctx)
+
+	do := func(authorization, method, target, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		r.Header.Set("Authorization", authorization)
+		w := httptest.NewRecorder()
+		app.Mux.ServeHTTP(w, r)
+		return w
+	}
+
+	w := do("Bearer "+admin, "POST", "/v1/api-keys", `{"name": "billing", "scopes": ["users:list"]}`)
+	require.Equal(t, 200, w.Code, w.Body.String())
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	var created domain.CreatedAPIKey
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	require.NotEmpty(t, created.Key)
+
+	assert.Equal(t, 200, do("ApiKey "+created.Key, "GET", "/v1/users", "").Code)
+	assert.Equal(t, 403, do("ApiKey "+created.Key, "DELETE", "/v1/users/1", "").Code)
+	assert.Equal(t, 403, do("ApiKey "+created.Key, "GET", "/v1/api-keys", "").Code)
+	assert.Equal(t, 401, do("ApiKey "+created.Key+"x", "GET", "/v1/users", "").Code)
+	count, err := testutil.GatherAndCount(app.Registry, "userService_api_keys_requests_total")
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	// the key is never shown again
+	w = do("Bearer "+admin, "GET", "/v1/api-keys", "")
+	require.Equal(t, 200, w.Code)
+	assert.NotContains(t, w.Body.String(), created.Key)
+	var list struct {
+		APIKeys []domain.APIKey `json:"api_keys"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list.APIKeys, 1)
+	assert.NotNil(t, list.APIKeys[0].LastUsedAt)
+
+	require.Equal(t, 204, do("Bearer "+admin, "DELETE", "/v1/api-keys/"+created.ID, "").Code)
+	assert.Equal(t, 401, do("ApiKey "+created.Key, "GET", "/v1/users", "").Code)
+}
+
+func TestTwoFactor(t *testing.T) {
+	t.Parallel()
+
+	conf, err := assembly.NewConfig()
+	require.NoError(t, err)
+	conf.Storage = assembly.StorageMemory
+	conf.PasswordHashMemory = 1024
+	conf.PasswordHashIterations = 1
+	admin := adminToken(t, &conf)
+	ctx := context.Background()
+	now := time.Now()
+	clock := func() time.Time { return now }
+	app, err := assembly.NewApp(ctx, conf, assembly.WithLogger(log.NewLogger(io.Discard, slog.LevelInfo)), assembly.WithClock(clock))
+	require.NoError(t, err)
+	defer app.Close(ctx)
+
+	doAs := func(token, method, target, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		app.Mux.ServeHTTP(w, r)
+		return w
+	}
+	// challenge signs in expecting the second factor
+	challenge := func() string {
+		t.Helper()
+		w := doAs("", "POST", "/v1/auth/login", `{"login": "alice", "password": "correct horse battery staple", "device": "phone"}`)
+		require.Equal(t, 401, w.Code, w.Body.String())
+		var resp struct {
+			Code string `json:"code"`
+			Meta struct {
+				ChallengeToken string `json:"challenge_token"`
+				ExpiresIn      int    `json:"expires_in"`
+			} `json:"meta"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		require.Equal(t, "two_factor_required", resp.Code)
+		assert.Equal(t, 300, resp.Meta.ExpiresIn)
+		return resp.Meta.ChallengeToken
+	}
+	code := func(secret string) string {
+		t.Helper()
+		c, err := totp.Code(secret, totp.Step(now))
+		require.NoError(t, err)
+		return c
+	}
+
+	w := doAs(admin, "POST", "/v1/users", `{"username": "alice"}`)
+	require.Equal(t, 200, w.Code)
+	var user domain.User
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &user))
+	w = doAs(admin, "PUT", "/v1/users/"+user.ID+"/credentials", `{"login": "alice", "password": "correct horse battery staple"}`)
+	require.Equal(t, 204, w.Code, w.Body.String())
+	w = doAs("", "POST", "/v1/auth/login", `{"login": "alice", "password": "correct horse battery staple"}`)
+	require.Equal(t, 200, w.Code, w.Body.String())
+	var tokens domain.TokenPair
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &tokens))
+
+	w = doAs(tokens.AccessToken, "POST", "/v1/me/2fa/totp/confirm", `{"code": "123456"}`)
+	assert.Equal(t, 400, w.Code)
+	assert.JSONEq(t, `{"code": "totp_not_found"}`, w.Body.String())
+
+	w = doAs(tokens.AccessToken, "POST", "/v1/me/2fa/totp", "")
+	require.Equal(t, 200, w.Code, w.Body.String())
+	var enrollment domain.TOTPEnrollment
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &enrollment))
+	assert.True(t, strings.HasPrefix(enrollment.URI, "otpauth://totp/user-service:alice?"), enrollment.URI)
+
+	w = doAs(tokens.AccessToken, "POST", "/v1/me/2fa/totp/confirm", `{"code": "`+code(enrollment.Secret)+`"}`)
+	require.Equal(t, 200, w.Code, w.Body.String())
+	var recovery struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &recovery))
+	require.Len(t, recovery.RecoveryCodes, 10)
+
+	// the code confirming the app can't sign in
+	w = doAs("", "POST", "/v1/auth/2fa", `{"challenge_token": "`+challenge()+`", "code": "`+code(enrollment.Secret)+`"}`)
+	assert.Equal(t, 400, w.Code)
+	assert.JSONEq(t, `{"code": "invalid_two_factor_code"}`, w.Body.String())
+
+	now = now.Add(totp.Period)
+	w = doAs("", "POST", "/v1/auth/2fa", `{"challenge_token": "`+challenge()+`", "code": "`+code(enrollment.Secret)+`"}`)
+	require.Equal(t, 200, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &tokens))
+	w = doAs(tokens.AccessToken, "GET", "/v1/me/sessions", "")
+	require.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `"device":"phone","user_agent":""`)
+
+	pending := challenge()
+	w = doAs("", "POST", "/v1/auth/2fa", `{"challenge_token": "`+pending+`", "code": "`+recovery.RecoveryCodes[0]+`"}`)
+	require.Equal(t, 200, w.Code, w.Body.String())
+	w = doAs("", "POST", "/v1/auth/2fa", `{"challenge_token": "`+pending+`", "code": "`+recovery.RecoveryCodes[1]+`"}`)
+	assert.Equal(t, 401, w.Code)
+	assert.JSONEq(t, `{"code": "invalid_challenge"}`, w.Body.String())
+
+	w = doAs(tokens.AccessToken, "POST", "/v1/me/2fa/totp", "")
+	assert.Equal(t, 409, w.Code)
+}
+
+// mailbox keeps the messages the app sends.
+type mailbox struct {
+	sent chan mail.Message
+}
+
+func (m mailbox) Send(ctx context.Context, msg mail.Message) error {
+	m.sent <- msg
+	return nil
+}
+
+func TestEmailVerification(t *testing.T) {
+	t.Parallel()
+
+	conf, err := assembly.NewConfig()
+	require.NoError(t, err)
+	conf.Storage = assembly.StorageMemory
+	conf.PasswordHashMemory = 1024
+	conf.PasswordHashIterations = 1
+	admin := adminToken(t, &conf)
+	ctx := context.Background()
+	box := mailbox{sent: make(chan mail.Message, 10)}
+	app, err := assembly.NewApp(ctx, conf, assembly.WithLogger(log.NewLogger(io.Discard, slog.LevelInfo)), assembly.WithMailer(box))
+	require.NoError(t, err)
+	defer app.Close(ctx)
+
+	doAs := func(token, method, target, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		app.Mux.ServeHTTP(w, r)
+		return w
+	}
+
+	w := doAs(admin, "POST", "/v1/users", `{"username": "alice", "email": " Alice@Example.com"}`)
+	require.Equal(t, 200, w.Code, w.Body.String())
+	var user domain.User
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &user))
+	assert.Equal(t, "alice@example.com", user.Email)
+	w = doAs(admin, "POST", "/v1/users", `{"username": "bob", "email": "alice@example.com"}`)
+	assert.Equal(t, 409, w.Code)
+	assert.JSONEq(t, `{"code": "email_taken"}`, w.Body.String())
+
+	w = doAs(admin, "PUT", "/v1/users/"+user.ID+"/credentials", `{"login": "alice", "password": "correct horse battery staple"}`)
+	require.Equal(t, 204, w.Code, w.Body.String())
+	w = doAs("", "POST", "/v1/auth/login", `{"login": "alice", "password": "correct horse battery staple"}`)
+	require.Equal(t, 200, w.Code, w.Body.String())
+	var tokens domain.TokenPair
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &tokens))
+
+	// a member asks for its own email only
+	assert.Equal(t, 403, doAs(tokens.AccessToken, "POST", "/v1/users/00000000-0000-0000-0000-000000000001/email/verify-request", "").Code)
+	require.Equal(t, 202, doAs(tokens.AccessToken, "POST", "/v1/users/"+user.ID+"/email/verify-request", "").Code)
+	w = doAs(tokens.AccessToken, "POST", "/v1/users/"+user.ID+"/email/verify-request", "")
+	assert.Equal(t, 429, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+	msg := <-box.sent
+	assert.Equal(t, "alice@example.com", msg.To)
+	token := strings.Split(msg.Body, "\n\n")[1]
+	w = doAs("", "POST", "/v1/email/verify", `{"token": "wrong"}`)
+	assert.Equal(t, 400, w.Code)
+	assert.JSONEq(t, `{"code": "invalid_verification_token"}`, w.Body.String())
+	require.Equal(t, 204, doAs("", "POST", "/v1/email/verify", `{"token": "`+token+`"}`).Code)
+
+	w = doAs(tokens.AccessToken, "GET", "/v1/me", "")
+	require.Equal(t, 200, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &user))
+	assert.NotNil(t, user.EmailVerifiedAt)
+	assert.Empty(t, box.sent)
+
+	// the clients sending the username only keep the email and its verification
+	w = doAs(admin, "PUT", "/v1/users/"+user.ID, `{"username": "alicia"}`)
+	require.Equal(t, 200, w.Code, w.Body.String())
+	var renamed domain.User
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &renamed))
+	assert.Equal(t, "alicia", renamed.Username)
+	assert.Equal(t, "alice@example.com", renamed.Email)
+	assert.NotNil(t, renamed.EmailVerifiedAt)
+
+	// an empty email clears it with its verification
+	w = doAs(admin, "PUT", "/v1/users/"+user.ID, `{"username": "alicia", "email": ""}`)
+	require.Equal(t, 200, w.Code, w.Body.String())
+	var cleared domain.User
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &cleared))
+	assert.Equal(t, domain.User{ID: user.ID, Username: "alicia"}, cleared)
+}
+
+func TestPasswordReset(t *testing.T) {
+	t.Parallel()
+
+	conf, err := assembly.NewConfig()
+	require.NoError(t, err)
+	conf.Storage = assembly.StorageMemory
+	conf.PasswordHashMemory = 1024
+	conf.PasswordHashIterations = 1
+	admin := adminToken(t, &conf)
+	ctx := context.Background()
+	box := mailbox{sent: make(chan mail.Message, 10)}
+	app, err := assembly.NewApp(ctx, conf, assembly.WithLogger(log.NewLogger(io.Discard, slog.LevelInfo)), assembly.WithMailer(box))
+	require.NoError(t, err)
+	defer app.Close(ctx)
+	// the resets are sent by a worker
+	workers, stop := context.WithCancel(ctx)
+	defer stop()
+	go app.RunWorkers(workers)
+
+	doAs := func(token, method, target, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		app.Mux.ServeHTTP(w, r)
+		return w
+	}
+	login := func(password string) *httptest.ResponseRecorder {
+		return doAs("", "POST", "/v1/auth/login", `{"login": "alice", "password": "`+password+`"}`)
+	}
+	lastToken := func() string {
+		msg := <-box.sent
+		assert.Equal(t, "alice@example.com", msg.To)
+		return strings.Split(msg.Body, "\n\n")[1]
+	}
+
+	w := doAs(admin, "POST", "/v1/users", `{"username": "alice", "email": "alice@example.com"}`)
+	require.Equal(t, 200, w.Code, w.Body.String())
+	var user domain.User
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &user))
+	w = doAs(admin, "PUT", "/v1/users/"+user.ID+"/credentials", `{"login": "alice", "password": "correct horse battery staple"}`)
+	require.Equal(t, 204, w.Code, w.Body.String())
+
+	// the email isn't verified, nothing is sent
+	assert.Equal(t, 202, doAs("", "POST", "/v1/auth/password/forgot", `{"login": "alice"}`).Code)
+	require.Equal(t, 202, doAs(admin, "POST", "/v1/users/"+user.ID+"/email/verify-request", "").Code)
+	require.Equal(t, 204, doAs("", "POST", "/v1/email/verify", `{"token": "`+lastToken()+`"}`).Code)
+
+	w = login("correct horse battery staple")
+	require.Equal(t, 200, w.Code, w.Body.String())
+	var tokens domain.TokenPair
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &tokens))
+
+	assert.Equal(t, 202, doAs("", "POST", "/v1/auth/password/forgot", `{"login": "nobody"}`).Code)
+	assert.Equal(t, 202, doAs("", "POST", "/v1/auth/password/forgot", `{"login": "alice"}`).Code)
+	token := lastToken()
+	w = doAs("", "POST", "/v1/auth/password/reset", `{"token": "`+token+`", "password": "short"}`)
+	assert.Equal(t, 400, w.Code)
+	assert.JSONEq(t, `{"code": "weak_password", "meta": {"reason": "must be at least 12 characters"}}`, w.Body.String())
+	require.Equal(t, 204, doAs("", "POST", "/v1/auth/password/reset", `{"token": "`+token+`", "password": "a brand new passphrase"}`).Code)
+	w = doAs("", "POST", "/v1/auth/password/reset", `{"token": "`+token+`", "password": "a brand new passphrase"}`)
+	assert.Equal(t, 400, w.Code)
+	assert.JSONEq(t, `{"code": "invalid_reset_token"}`, w.Body.String())
+
+	// every session is signed out
+	assert.Equal(t, 401, doAs(tokens.AccessToken, "GET", "/v1/me", "").Code)
+	assert.Equal(t, 401, doAs("", "POST", "/v1/auth/refresh", `{"refresh_token": "`+tokens.RefreshToken+`"}`).Code)
+	assert.Equal(t, 401, login("correct horse battery staple").Code)
+	assert.Equal(t, 200, login("a brand new passphrase").Code)
+	assert.Empty(t, box.sent)
+}
+
+func TestJWKS(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	writeKey(t, dir, "2024-06.pem")
+	writeKey(t, dir, "2024-01.pem")
+	writeKey(t, dir, "2023-06.pem")
+
+	conf, err := assembly.NewConfig()
+	require.NoError(t, err)
+	conf.Storage = assembly.StorageMemory
+	conf.AuthSigningKeyFile = filepath.Join(dir, "2024-06.pem")
+	ctx := context.Background()
+	conf.AuthVerificationKeyFiles = []string{filepath.Join(dir, "2024-01.pem@yesterday")}
+	_, err = assembly.NewApp(ctx, conf, assembly.WithLogger(log.NewLogger(io.Discard, slog.LevelInfo)))
+	assert.ErrorContains(t, err, "invalid retire time")
+
+	// the retired key isn't published
+	conf.AuthVerificationKeyFiles = []string{
+		filepath.Join(dir, "2024-01.pem@") + time.Now().Add(time.Hour).Format(time.RFC3339),
+		filepath.Join(dir, "2023-06.pem@2024-01-01T00:00:00Z"),
+	}
+	app, err := assembly.NewApp(ctx, conf, assembly.WithLogger(log.NewLogger(io.Discard, slog.LevelInfo)))
+	require.NoError(t, err)
+	defer app.Close(ctx)
+
+	w := httptest.NewRecorder()
+	app.Mux.ServeHTTP(w, httptest.NewRequest("GET", "/.well-known/jwks.json", nil))
+	require.Equal(t, 200, w.Code)
+	var jwks jwt.JWKS
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &jwks))
+	require.Len(t, jwks.Keys, 2)
+	assert.Equal(t, "2024-06", jwks.Keys[0].Kid)
+	assert.Equal(t, "2024-01", jwks.Keys[1].Kid)
+}
+
+// adminToken makes the app sign with a key of the test, so the test can sign an admin token itself.
+func adminToken(t *testing.T, conf *assembly.Config) string {
+	t.Helper()
+
+	k := writeKey(t, t.TempDir(), "test.pem")
+	conf.AuthSigningKeyFile = k.path
+	keys, err := jwt.NewKeySet(k.Key, nil, time.Now)
+	require.NoError(t, err)
+	token, err := keys.Sign(jwt.Claims{
+		Issuer:    conf.AuthIssuer,
+		Subject:   "00000000-0000-0000-0000-000000000001",
+		Type:      auth.TokenTypeAccess,
+		ExpiresAt: time.Now().Add(time.Hour).Unix(),
+		Roles:     []string{domain.RoleAdmin},
+	})
+	require.NoError(t, err)
+	return token
+}
+
+type keyFile struct {
+	jwt.Key
+	path string
+}
+
+func writeKey(t *testing.T, dir, name string) keyFile {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	k, err := jwt.GenerateKey(strings.TrimSuffix(name, filepath.Ext(name)))
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(k.Private)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600))
+	return keyFile{Key: k, path: path}
+}
+
+func TestAccessPolicyFile(t *testing.T) {
+	t.Parallel()
+
+	conf, err := assembly.NewConfig()
+	require.NoError(t, err)
+	conf.Storage = assembly.StorageMemory
+	conf.PasswordHashMemory = 1024
+	conf.PasswordHashIterations = 1
+	conf.AuthzPolicyFile = filepath.Join(t.TempDir(), "policy.yaml")
+	require.NoError(t, os.WriteFile(conf.AuthzPolicyFile, []byte(`
+rules:
+  - name: admins
+    effect: allow
+    actions: ["*"]
+    condition: '"admin" in subject.roles'
+  - name: users-leave
+    effect: allow
+    actions: [users:read, users:delete]
+    condition: subject.id == resource.id
+`), 0o600))
+	admin := adminToken(t, &conf)
+	ctx := context.Background()
+	app, err := assembly.NewApp(ctx, conf, assembly.WithLogger(log.NewLogger(io.Discard, slog.LevelInfo)))
+	require.NoError(t, err)
+	defer app.Close(ctx)
+
+	doAs := func(token, method, target, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		app.Mux.ServeHTTP(w, r)
+		return w
+	}
+	createUser := func(username string) string {
+		w := doAs(admin, "POST", "/v1/users", `{"username": "`+username+`"}`)
+		require.Equal(t, 200, w.Code, w.Body.String())
+		var user domain.User
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &user))
+		return user.ID
+	}
+	alice, bob := createUser("alice"), createUser("bob")
+	require.Equal(t, 204, doAs(admin, "PUT", "/v1/users/"+alice+"/credentials", `{"login": "alice", "password": "correct horse battery staple"}`).Code)
+	w := doAs("", "POST", "/v1/auth/login", `{"login": "alice", "password": "correct horse battery staple"}`)
+	require.Equal(t, 200, w.Code)
+	var tokens domain.TokenPair
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &tokens))
+
+	w = doAs(admin, "POST", "/v1/authz/check", `{"subject": {"id": "`+alice+`", "roles": ["member"]}, "action": "users:delete", "resource_id": "`+bob+`"}`)
+	assert.Equal(t, 200, w.Code)
+	assert.JSONEq(t, `{"allowed": false, "reason": "no rule allows users:delete"}`, w.Body.String())
+	w = doAs(tokens.AccessToken, "POST", "/v1/authz/check", `{"action": "users:delete", "resource_id": "`+alice+`"}`)
+	assert.Equal(t, 403, w.Code, "the dry run is for the admins")
+
+	// the roles stay with the role grants
+	assert.Equal(t, 403, doAs(tokens.AccessToken, "GET", "/v1/users/"+bob+"/roles", "").Code)
+	assert.Equal(t, 200, doAs(tokens.AccessToken, "GET", "/v1/users/"+alice+"/roles", "").Code)
+
+	// the policy replaces the role grants, a member may delete itself and not the others
+	w = doAs(tokens.AccessToken, "DELETE", "/v1/users/"+bob, "")
+	assert.Equal(t, 403, w.Code)
+	assert.JSONEq(t, `{"code": "forbidden"}`, w.Body.String())
+	assert.Equal(t, 200, doAs(tokens.AccessToken, "DELETE", "/v1/users/"+alice, "").Code)
+}
+
+func TestChangeOwnCredentials(t *testing.T) {
+	t.Parallel()
+
+	conf, err := assembly.NewConfig()
+	require.NoError(t, err)
+	conf.Storage = assembly.StorageMemory
+	conf.PasswordHashMemory = 1024
+	conf.PasswordHashIterations = 1
+	admin := adminToken(t, &conf)
+	ctx := context.Background()
+	app, err := assembly.NewApp(ctx, conf, assembly.WithLogger(log.NewLogger(io.Discard, slog.LevelInfo)))
+	require.NoError(t, err)
+	defer app.Close(ctx)
+
+	doAs := func(token, method, target, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		app.Mux.ServeHTTP(w, r)
+		return w
+	}
+	login := func(device string) domain.TokenPair {
+		t.Helper()
+		w := doAs("", "POST", "/v1/auth/login", `{"login": "alice", "password": "correct horse battery staple", "device": "`+device+`"}`)
+		require.Equal(t, 200, w.Code, w.Body.String())
+		var tokens domain.TokenPair
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &tokens))
+		return tokens
+	}
+
+	w := doAs(admin, "POST", "/v1/users", `{"username": "alice"}`)
+	require.Equal(t, 200, w.Code)
+	var user domain.User
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &user))
+	w = doAs(admin, "PUT", "/v1/users/"+user.ID+"/credentials", `{"login": "alice", "password": "correct horse battery staple"}`)
+	require.Equal(t, 204, w.Code, w.Body.String())
+	laptop, phone := login("laptop"), login("phone")
+
+	// a stolen access token alone can't take the account over
+	target := "/v1/users/" + user.ID + "/credentials"
+	w = doAs(laptop.AccessToken, "PUT", target, `{"login": "alice", "password": "a brand new passphrase"}`)
+	assert.Equal(t, 403, w.Code)
+	assert.JSONEq(t, `{"code": "wrong_password"}`, w.Body.String())
+
+	w = doAs(laptop.AccessToken, "PUT", target,
+		`{"login": "alice", "password": "a brand new passphrase", "current_password": "correct horse battery staple"}`)
+	require.Equal(t, 204, w.Code, w.Body.String())
+
+	// the other devices are signed out, the current one stays
+	assert.Equal(t, 401, doAs(phone.AccessToken, "GET", "/v1/me", "").Code)
+	w = doAs("", "POST", "/v1/auth/refresh", `{"refresh_token": "`+phone.RefreshToken+`"}`)
+	assert.Equal(t, 401, w.Code)
+	assert.Equal(t, 200, doAs(laptop.AccessToken, "GET", "/v1/me", "").Code)
+	w = doAs("", "POST", "/v1/auth/login", `{"login": "alice", "password": "a brand new passphrase"}`)
+	assert.Equal(t, 200, w.Code)
+}
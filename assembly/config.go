@@ -1,31 +1,338 @@
 package assembly
 
 import (
+	"errors"
+	"fmt"
 	"log/slog"
+	"net/url"
 	"time"
 
+	"github.com/dennypenta/go-api-walkthrough/auth"
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/pkg/password"
+	"github.com/dennypenta/go-api-walkthrough/pkg/retry"
+	"github.com/dennypenta/go-api-walkthrough/repository"
+	"github.com/dennypenta/go-api-walkthrough/repository/resilience"
 	"github.com/kelseyhightower/envconfig"
 )
 
 type Config struct {
-	PostresDsn    string `envconfig:"POSTGRES_DSN"`
-	HttpPort      string `envconfig:"HTTP_PORT"`
-	MigrationsDir string `envconfig:"MIGRATIONS_DIR"`
+	// Storage is database or memory, the memory storage loses the data on restart
+	Storage string `envconfig:"STORAGE" default:"database"`
+	// DatabaseDsn selects the database by the scheme: postgres://... or sqlite://path/to/file.db
+	DatabaseDsn string `envconfig:"DATABASE_DSN"`
+	// PostresDsn is used when DATABASE_DSN is empty
+	PostresDsn string `envconfig:"POSTGRES_DSN"`
+	// PostgresReplicaDsns is a comma separated list of the read replicas, GetUserByID and ListUsers go there
+	PostgresReplicaDsns []string `envconfig:"POSTGRES_REPLICA_DSNS"`
+	// a client reads from the primary within the window after a write, it must cover the replication lag
+	ReadYourWritesWindow  time.Duration `envconfig:"READ_YOUR_WRITES_WINDOW" default:"5s"`
+	ReplicaHealthInterval time.Duration `envconfig:"REPLICA_HEALTH_INTERVAL" default:"5s"`
+	ReplicaHealthTimeout  time.Duration `envconfig:"REPLICA_HEALTH_TIMEOUT" default:"1s"`
+
+	// CacheEnabled puts a cache in front of GetUserByID, the replicas invalidate each other with LISTEN/NOTIFY
+	CacheEnabled bool          `envconfig:"CACHE_ENABLED" default:"true"`
+	CacheSize    int           `envconfig:"CACHE_SIZE" default:"10000"`
+	CacheTTL     time.Duration `envconfig:"CACHE_TTL" default:"1m"`
+
+	// StaleEnabled serves the last known users and pages while the storage is unavailable
+	StaleEnabled bool          `envconfig:"STALE_ENABLED" default:"false"`
+	StaleSize    int           `envconfig:"STALE_SIZE" default:"10000"`
+	StaleMaxAge  time.Duration `envconfig:"STALE_MAX_AGE" default:"1h"`
+
+	// the storage calls go through a circuit breaker, it opens after the failures in a row
+	// and lets the probes through after the timeout
+	BreakerFailureThreshold int           `envconfig:"BREAKER_FAILURE_THRESHOLD" default:"5"`
+	BreakerOpenTimeout      time.Duration `envconfig:"BREAKER_OPEN_TIMEOUT" default:"10s"`
+	BreakerHalfOpenProbes   int           `envconfig:"BREAKER_HALF_OPEN_PROBES" default:"1"`
+	// a storage call taking longer fails with 503
+	DbReadTimeout  time.Duration `envconfig:"DB_READ_TIMEOUT" default:"2s"`
+	DbWriteTimeout time.Duration `envconfig:"DB_WRITE_TIMEOUT" default:"5s"`
+	// the storage calls running at once, the others wait up to BULKHEAD_WAIT for a slot and fail with 503,
+	// the reads and the writes are limited separately, so the slow reads can't block the writes
+	BulkheadReads  int           `envconfig:"BULKHEAD_READS" default:"32"`
+	BulkheadWrites int           `envconfig:"BULKHEAD_WRITES" default:"16"`
+	BulkheadWait   time.Duration `envconfig:"BULKHEAD_WAIT" default:"100ms"`
+
+	// AuthSigningKeyFile is the Ed25519 private key in PEM signing the access tokens, the file name is the key id,
+	// a random key is generated when it's empty, so the tokens don't survive a restart
+	AuthSigningKeyFile string `envconfig:"AUTH_SIGNING_KEY_FILE"`
+	// AuthVerificationKeyFiles is a comma separated list of the keys accepted along with the signing one,
+	// the next key is published there before it signs and the previous one stays there until its tokens expire;
+	// a key followed by @ and an RFC 3339 time retires at that time, e.g. keys/2024-01.pem@2024-07-01T00:00:00Z
+	AuthVerificationKeyFiles []string      `envconfig:"AUTH_VERIFICATION_KEY_FILES"`
+	AuthIssuer               string        `envconfig:"AUTH_ISSUER" default:"user-service"`
+	AuthAccessTokenTTL       time.Duration `envconfig:"AUTH_ACCESS_TOKEN_TTL" default:"15m"`
+	AuthRefreshTokenTTL      time.Duration `envconfig:"AUTH_REFRESH_TOKEN_TTL" default:"720h"`
+	// every access token of a session is checked against the revoked sessions,
+	// the answers are cached for AuthSessionCacheTTL, so a revocation on another replica takes up to that long, 0 disables the cache
+	AuthSessionCacheTTL  time.Duration `envconfig:"AUTH_SESSION_CACHE_TTL" default:"30s"`
+	AuthSessionCacheSize int           `envconfig:"AUTH_SESSION_CACHE_SIZE" default:"10000"`
+	// a login with the second factor enabled is finished within AuthTwoFactorChallengeTTL and AuthTwoFactorMaxAttempts codes
+	AuthTwoFactorChallengeTTL time.Duration `envconfig:"AUTH_TWO_FACTOR_CHALLENGE_TTL" default:"5m"`
+	AuthTwoFactorMaxAttempts  int           `envconfig:"AUTH_TWO_FACTOR_MAX_ATTEMPTS" default:"5"`
+	// a password reset token mailed to the user is valid for AuthPasswordResetTTL,
+	// a user gets one every AuthPasswordResetResendInterval at most
+	AuthPasswordResetTTL            time.Duration `envconfig:"AUTH_PASSWORD_RESET_TTL" default:"1h"`
+	AuthPasswordResetResendInterval time.Duration `envconfig:"AUTH_PASSWORD_RESET_RESEND_INTERVAL" default:"1m"`
+	// the resets are sent in the background, the requests above AuthPasswordResetQueueSize waiting for it are dropped
+	AuthPasswordResetQueueSize int `envconfig:"AUTH_PASSWORD_RESET_QUEUE_SIZE" default:"100"`
+
+	// AuthzPolicyFile is the ABAC policy the user service enforces instead of the role grants,
+	// it's checked for changes every AuthzPolicyReloadInterval
+	AuthzPolicyFile           string        `envconfig:"AUTHZ_POLICY_FILE"`
+	AuthzPolicyReloadInterval time.Duration `envconfig:"AUTHZ_POLICY_RELOAD_INTERVAL" default:"10s"`
+
+	// a verification token mailed to the user is valid for EmailVerificationTTL,
+	// a user gets one every EmailVerificationResendInterval and EmailVerificationMaxPerWindow within EmailVerificationWindow at most
+	EmailVerificationTTL            time.Duration `envconfig:"EMAIL_VERIFICATION_TTL" default:"24h"`
+	EmailVerificationResendInterval time.Duration `envconfig:"EMAIL_VERIFICATION_RESEND_INTERVAL" default:"1m"`
+	EmailVerificationMaxPerWindow   int           `envconfig:"EMAIL_VERIFICATION_MAX_PER_WINDOW" default:"5"`
+	EmailVerificationWindow         time.Duration `envconfig:"EMAIL_VERIFICATION_WINDOW" default:"1h"`
+
+	// MailTransport is one of log, file or smtp, the log one writes the messages to the app log and fits local runs only
+	MailTransport string `envconfig:"MAIL_TRANSPORT" default:"log"`
+	MailFrom      string `envconfig:"MAIL_FROM" default:"no-reply@localhost"`
+	// MailDir keeps a file per message with the file transport
+	MailDir      string `envconfig:"MAIL_DIR" default:"mail"`
+	SmtpAddr     string `envconfig:"SMTP_ADDR"`
+	SmtpUsername string `envconfig:"SMTP_USERNAME"`
+	SmtpPassword string `envconfig:"SMTP_PASSWORD"`
+
+	PasswordMinLength int `envconfig:"PASSWORD_MIN_LENGTH" default:"12"`
+	PasswordMaxLength int `envconfig:"PASSWORD_MAX_LENGTH" default:"128"`
+	// argon2id cost, the memory is in KiB, every login takes that much memory for a moment
+	PasswordHashMemory      uint32 `envconfig:"PASSWORD_HASH_MEMORY" default:"65536"`
+	PasswordHashIterations  uint32 `envconfig:"PASSWORD_HASH_ITERATIONS" default:"3"`
+	PasswordHashParallelism uint8  `envconfig:"PASSWORD_HASH_PARALLELISM" default:"2"`
+
+	HttpPort string `envconfig:"HTTP_PORT"`
+	// SchemaCheck is one of strict, warn or off, NewConfig rejects the rest
+	SchemaCheck string `envconfig:"SCHEMA_CHECK" default:"strict"`
+
+	// PostgresSimpleProtocol disables the prepared statements, it's required behind PgBouncer in the transaction pooling mode
+	PostgresSimpleProtocol bool `envconfig:"POSTGRES_SIMPLE_PROTOCOL" default:"false"`
+	// the amount of prepared statements cached per connection
+	PostgresStatementCacheCapacity int `envconfig:"POSTGRES_STATEMENT_CACHE_CAPACITY" default:"512"`
 
 	DbMaxOpenConns    int           `envconfig:"DB_MAX_OPEN_CONNS" default:"4"`
 	DbMaxIdleConns    int           `envconfig:"DB_MAX_IDLE_CONNS" default:"4"`
 	DbConnMaxLifetime time.Duration `envconfig:"DB_CONN_MAX_LIFETIME" default:"5m"`
 	DbConnMaxIdleTime time.Duration `envconfig:"DB_CONN_MAX_IDLE_TIME" default:"5m"`
 
+	// the database might be not ready yet when the app starts (docker-compose, k8s),
+	// so the connection is retried with exponential backoff within StartupTimeout
+	DbConnectAttempts       int           `envconfig:"DB_CONNECT_ATTEMPTS" default:"10"`
+	DbConnectBackoffInitial time.Duration `envconfig:"DB_CONNECT_BACKOFF_INITIAL" default:"500ms"`
+	DbConnectBackoffMax     time.Duration `envconfig:"DB_CONNECT_BACKOFF_MAX" default:"10s"`
+	DbConnectBackoffJitter  float64       `envconfig:"DB_CONNECT_BACKOFF_JITTER" default:"0.2"`
+	StartupTimeout          time.Duration `envconfig:"STARTUP_TIMEOUT" default:"1m"`
+
+	// DbTxIsolation is the isolation level of the transactions, e.g. "read committed" or "serializable",
+	// sqlite transactions are always serializable
+	DbTxIsolation string `envconfig:"DB_TX_ISOLATION" default:"read committed"`
+	// the transactions failed on serialization or a deadlock are retried
+	DbTxAttempts       int           `envconfig:"DB_TX_ATTEMPTS" default:"3"`
+	DbTxBackoffInitial time.Duration `envconfig:"DB_TX_BACKOFF_INITIAL" default:"20ms"`
+	DbTxBackoffMax     time.Duration `envconfig:"DB_TX_BACKOFF_MAX" default:"200ms"`
+
+	// how long a replica waits for another one applying the migrations
+	MigrationLockTimeout time.Duration `envconfig:"MIGRATION_LOCK_TIMEOUT" default:"5m"`
+
 	LogLevel slog.Level `envconfig:"LOG_LEVEL" default:"INFO"`
 }
 
+const (
+	StorageDatabase = "database"
+	StorageMemory   = "memory"
+)
+
+const (
+	MailTransportLog  = "log"
+	MailTransportFile = "file"
+	MailTransportSMTP = "smtp"
+)
+
+const (
+	DialectPostgres = "postgres"
+	DialectSQLite   = "sqlite"
+)
+
+// DSN returns DATABASE_DSN falling back to POSTGRES_DSN.
+func (c Config) DSN() string {
+	if c.DatabaseDsn != "" {
+		return c.DatabaseDsn
+	}
+	return c.PostresDsn
+}
+
+// Dialect tells the database by the DSN scheme.
+func (c Config) Dialect() (string, error) {
+	if c.DSN() == "" {
+		return "", errors.New("no database dsn, set DATABASE_DSN or POSTGRES_DSN")
+	}
+	u, err := url.Parse(c.DSN())
+	if err != nil {
+		return "", fmt.Errorf("failed to parse database dsn: %w", err)
+	}
+	switch u.Scheme {
+	case "postgres", "postgresql":
+		return DialectPostgres, nil
+	case "sqlite", "sqlite3":
+		return DialectSQLite, nil
+	default:
+		return "", fmt.Errorf("unsupported database dsn scheme %q, expected postgres or sqlite", u.Scheme)
+	}
+}
+
+func (c Config) ConnectRetryPolicy() retry.Policy {
+	return retry.Policy{
+		Attempts:     c.DbConnectAttempts,
+		InitialDelay: c.DbConnectBackoffInitial,
+		MaxDelay:     c.DbConnectBackoffMax,
+		Multiplier:   2,
+		Jitter:       c.DbConnectBackoffJitter,
+	}
+}
+
+func (c Config) TxRetryPolicy() retry.Policy {
+	return retry.Policy{
+		Attempts:     c.DbTxAttempts,
+		InitialDelay: c.DbTxBackoffInitial,
+		MaxDelay:     c.DbTxBackoffMax,
+		Multiplier:   2,
+		Jitter:       0.5,
+	}
+}
+
+func (c Config) StorageLimits() resilience.Limits {
+	return resilience.Limits{
+		ReadTimeout:  c.DbReadTimeout,
+		WriteTimeout: c.DbWriteTimeout,
+		MaxReads:     c.BulkheadReads,
+		MaxWrites:    c.BulkheadWrites,
+		QueueWait:    c.BulkheadWait,
+	}
+}
+
+func (c Config) PasswordPolicy() domain.PasswordPolicy {
+	return domain.PasswordPolicy{
+		MinLength: c.PasswordMinLength,
+		MaxLength: c.PasswordMaxLength,
+	}
+}
+
+func (c Config) TokenConfig() auth.TokenConfig {
+	return auth.TokenConfig{
+		Issuer:     c.AuthIssuer,
+		AccessTTL:  c.AuthAccessTokenTTL,
+		RefreshTTL: c.AuthRefreshTokenTTL,
+	}
+}
+
+func (c Config) TwoFactorConfig() auth.TwoFactorConfig {
+	return auth.TwoFactorConfig{
+		Issuer:       c.AuthIssuer,
+		ChallengeTTL: c.AuthTwoFactorChallengeTTL,
+		MaxAttempts:  c.AuthTwoFactorMaxAttempts,
+	}
+}
+
+func (c Config) PasswordResetConfig() auth.PasswordResetConfig {
+	return auth.PasswordResetConfig{
+		TTL:            c.AuthPasswordResetTTL,
+		ResendInterval: c.AuthPasswordResetResendInterval,
+		QueueSize:      c.AuthPasswordResetQueueSize,
+	}
+}
+
+func (c Config) EmailVerificationConfig() auth.EmailVerificationConfig {
+	return auth.EmailVerificationConfig{
+		TTL:            c.EmailVerificationTTL,
+		ResendInterval: c.EmailVerificationResendInterval,
+		MaxPerWindow:   c.EmailVerificationMaxPerWindow,
+		Window:         c.EmailVerificationWindow,
+	}
+}
+
+func (c Config) PasswordHashParams() password.Params {
+	params := password.DefaultParams
+	params.Memory = c.PasswordHashMemory
+	params.Iterations = c.PasswordHashIterations
+	params.Parallelism = c.PasswordHashParallelism
+	return params
+}
+
 func NewConfig() (Config, error) {
 	conf := Config{}
 
 	if err := envconfig.Process("", &conf); err != nil {
 		return conf, err
 	}
+	if conf.Storage != StorageDatabase && conf.Storage != StorageMemory {
+		return conf, fmt.Errorf("unknown STORAGE %q, expected %s or %s", conf.Storage, StorageDatabase, StorageMemory)
+	}
+	switch conf.SchemaCheck {
+	case SchemaCheckStrict, SchemaCheckWarn, SchemaCheckOff:
+	default:
+		return conf, fmt.Errorf("unknown SCHEMA_CHECK %q, expected %s, %s or %s", conf.SchemaCheck, SchemaCheckStrict, SchemaCheckWarn, SchemaCheckOff)
+	}
+	if _, err := repository.ParseIsolationLevel(conf.DbTxIsolation); err != nil {
+		return conf, fmt.Errorf("invalid DB_TX_ISOLATION: %w", err)
+	}
+	if conf.BreakerFailureThreshold < 1 || conf.BreakerHalfOpenProbes < 1 {
+		return conf, errors.New("BREAKER_FAILURE_THRESHOLD and BREAKER_HALF_OPEN_PROBES must be positive")
+	}
+	if conf.PasswordMinLength < 8 || conf.PasswordMaxLength < conf.PasswordMinLength {
+		return conf, errors.New("PASSWORD_MIN_LENGTH must be 8 at least and not above PASSWORD_MAX_LENGTH")
+	}
+	if conf.AuthAccessTokenTTL <= 0 || conf.AuthRefreshTokenTTL <= conf.AuthAccessTokenTTL {
+		return conf, errors.New("AUTH_ACCESS_TOKEN_TTL must be positive and below AUTH_REFRESH_TOKEN_TTL")
+	}
+	if conf.AuthSessionCacheTTL < 0 || conf.AuthSessionCacheSize < 1 {
+		return conf, errors.New("AUTH_SESSION_CACHE_TTL must not be negative and AUTH_SESSION_CACHE_SIZE must be positive")
+	}
+	if conf.AuthTwoFactorChallengeTTL <= 0 || conf.AuthTwoFactorMaxAttempts < 1 {
+		return conf, errors.New("AUTH_TWO_FACTOR_CHALLENGE_TTL and AUTH_TWO_FACTOR_MAX_ATTEMPTS must be positive")
+	}
+	if conf.AuthPasswordResetTTL <= 0 || conf.AuthPasswordResetResendInterval < 0 {
+		return conf, errors.New("AUTH_PASSWORD_RESET_TTL must be positive and AUTH_PASSWORD_RESET_RESEND_INTERVAL must not be negative")
+	}
+	if conf.AuthPasswordResetQueueSize < 1 {
+		return conf, errors.New("AUTH_PASSWORD_RESET_QUEUE_SIZE must be positive")
+	}
+	if conf.AuthzPolicyReloadInterval <= 0 {
+		return conf, errors.New("AUTHZ_POLICY_RELOAD_INTERVAL must be positive")
+	}
+	if conf.EmailVerificationResendInterval < 0 || conf.EmailVerificationMaxPerWindow < 1 || conf.EmailVerificationWindow <= 0 {
+		return conf, errors.New("EMAIL_VERIFICATION_RESEND_INTERVAL must not be negative, EMAIL_VERIFICATION_MAX_PER_WINDOW and EMAIL_VERIFICATION_WINDOW must be positive")
+	}
+	// the expired verifications are removed, the window counts only the kept ones
+	if conf.EmailVerificationTTL < conf.EmailVerificationWindow {
+		return conf, errors.New("EMAIL_VERIFICATION_TTL must not be below EMAIL_VERIFICATION_WINDOW")
+	}
+	switch conf.MailTransport {
+	case MailTransportLog, MailTransportFile:
+	case MailTransportSMTP:
+		if conf.SmtpAddr == "" {
+			return conf, errors.New("SMTP_ADDR is required with MAIL_TRANSPORT=smtp")
+		}
+	default:
+		return conf, fmt.Errorf("unknown MAIL_TRANSPORT %q, expected %s, %s or %s", conf.MailTransport, MailTransportLog, MailTransportFile, MailTransportSMTP)
+	}
+	if conf.BulkheadReads < 1 || conf.BulkheadWrites < 1 {
+		return conf, errors.New("BULKHEAD_READS and BULKHEAD_WRITES must be positive")
+	}
+	// the dsn might be not given when the storage is replaced with an option
+	if conf.Storage == StorageDatabase && conf.DSN() != "" {
+		dialect, err := conf.Dialect()
+		if err != nil {
+			return conf, err
+		}
+		if dialect != DialectPostgres && len(conf.PostgresReplicaDsns) > 0 {
+			return conf, fmt.Errorf("POSTGRES_REPLICA_DSNS are supported only with postgres, the database is %s", dialect)
+		}
+	}
 
 	return conf, nil
 }
@@ -0,0 +1,277 @@
+package assembly
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/pkg/retry"
+	"github.com/dennypenta/go-api-walkthrough/repository"
+	"github.com/dennypenta/go-api-walkthrough/repository/postgres"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/jmoiron/sqlx"
+	_ "modernc.org/sqlite"
+)
+
+const (
+	driverPostgres = "pgx"
+	driverSQLite   = "sqlite"
+)
+
+// sqlitePragmas are applied to every connection unless the DSN sets its own _pragma.
+// WAL lets the readers go along with a writer, busy_timeout makes the concurrent writers wait
+// instead of failing with SQLITE_BUSY.
+var sqlitePragmas = []string{"busy_timeout(5000)", "journal_mode(WAL)", "foreign_keys(1)"}
+
+// ConnectDB opens the connection pool of the database the DSN scheme points to,
+// retrying until the database is reachable.
+func ConnectDB(ctx context.Context, conf Config, l *slog.Logger) (*sqlx.DB, error) {
+	dialect, err := conf.Dialect()
+	if err != nil {
+		return nil, err
+	}
+	driver, dsn := driverPostgres, conf.DSN()
+	if dialect == DialectSQLite {
+		driver = driverSQLite
+		if dsn, err = sqliteDSN(dsn); err != nil {
+			return nil, err
+		}
+	}
+
+	var db *sqlx.DB
+	err = retry.Do(ctx, conf.ConnectRetryPolicy(), l, "connect to "+dialect, func(ctx context.Context) error {
+		var err error
+		db, err = sqlx.ConnectContext(ctx, driver, dsn)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", dialect, err)
+	}
+	setPoolLimits(db, conf)
+
+	return db, nil
+}
+
+// ConnectPool opens the native postgres pool retrying until the database is reachable.
+// The statements are prepared and cached per connection unless POSTGRES_SIMPLE_PROTOCOL is set.
+func ConnectPool(ctx context.Context, conf Config, l *slog.Logger) (*pgxpool.Pool, error) {
+	poolConf, err := poolConfig(conf, conf.DSN())
+	if err != nil {
+		return nil, err
+	}
+
+	var pool *pgxpool.Pool
+	err = retry.Do(ctx, conf.ConnectRetryPolicy(), l, "connect to postgres", func(ctx context.Context) error {
+		var err error
+		pool, err = pgxpool.NewWithConfig(ctx, poolConf)
+		if err != nil {
+			return err
+		}
+		// the pool connects lazily
+		if err := pool.Ping(ctx); err != nil {
+			pool.Close()
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to postgres: %w", err)
+	}
+
+	return pool, nil
+}
+
+func poolConfig(conf Config, dsn string) (*pgxpool.Config, error) {
+	poolConf, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse postgres dsn: %w", err)
+	}
+	poolConf.MaxConns = int32(conf.DbMaxOpenConns)
+	poolConf.MaxConnLifetime = conf.DbConnMaxLifetime
+	poolConf.MaxConnIdleTime = conf.DbConnMaxIdleTime
+	poolConf.ConnConfig.StatementCacheCapacity = conf.PostgresStatementCacheCapacity
+	if conf.PostgresSimpleProtocol {
+		// PgBouncer hands the transactions to any server connection,
+		// a statement prepared on one of them doesn't exist on the others
+		poolConf.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeSimpleProtocol
+	}
+
+	return poolConf, nil
+}
+
+// openReplicas creates the replica pools without connecting,
+// an unreachable replica doesn't block the startup, it stays ejected until the health check passes.
+// The names are the replica hosts, so the credentials don't leak to the logs.
+func openReplicas(ctx context.Context, conf Config) ([]*pgxpool.Pool, []string, error) {
+	var pools []*pgxpool.Pool
+	var names []string
+	closeAll := func() {
+		for _, pool := range pools {
+			pool.Close()
+		}
+	}
+
+	for i, dsn := range conf.PostgresReplicaDsns {
+		poolConf, err := poolConfig(conf, dsn)
+		if err != nil {
+			closeAll()
+			return nil, nil, fmt.Errorf("replica #%d: %w", i+1, err)
+		}
+		pool, err := pgxpool.NewWithConfig(ctx, poolConf)
+		if err != nil {
+			closeAll()
+			return nil, nil, fmt.Errorf("failed to open replica %s: %w", poolConf.ConnConfig.Host, err)
+		}
+		pools = append(pools, pool)
+		names = append(names, poolConf.ConnConfig.Host)
+	}
+
+	return pools, names, nil
+}
+
+func setPoolLimits(db *sqlx.DB, conf Config) {
+	db.DB.SetMaxOpenConns(conf.DbMaxOpenConns)
+	db.DB.SetMaxIdleConns(conf.DbMaxIdleConns)
+	db.DB.SetConnMaxLifetime(conf.DbConnMaxLifetime)
+	db.DB.SetConnMaxIdleTime(conf.DbConnMaxIdleTime)
+}
+
+// sqliteDSN converts sqlite://path/to/file.db to the driver DSN.
+// sqlite:///abs/path.db is an absolute path, sqlite://rel/path.db is relative to the working directory.
+func sqliteDSN(dsn string) (string, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse database dsn: %w", err)
+	}
+	path := u.Host + u.Path
+	if path == "" {
+		return "", fmt.Errorf("sqlite dsn %q has no file path", dsn)
+	}
+
+	q := u.Query()
+	if !q.Has("_pragma") {
+		q["_pragma"] = sqlitePragmas
+	}
+	if !q.Has("_txlock") {
+		// a deferred transaction fails right away if another one writes first,
+		// an immediate one waits for busy_timeout
+		q.Set("_txlock", "immediate")
+	}
+	if !q.Has("_time_format") {
+		// the timestamps are compared as text, the default go format isn't sortable
+		q.Set("_time_format", "sqlite")
+	}
+
+	return "file:" + path + "?" + q.Encode(), nil
+}
+
+// NewUserRepository builds the repository for the dialect of the given database.
+// Postgres generates the ids and the timestamps unless now and newID are given,
+// sqlite can't, time.Now and uuid.NewString stand in for the nil ones there.
+func NewUserRepository(db *sqlx.DB, now func() time.Time, newID func() string) *repository.UserRepository {
+	if dialectOf(db) == DialectSQLite {
+		if now == nil {
+			now = time.Now
+		}
+		if newID == nil {
+			newID = uuid.NewString
+		}
+		return repository.NewSQLiteUserRepository(db, now, newID)
+	}
+	return repository.NewUserRepository(db).WithClock(now).WithIDGenerator(newID)
+}
+
+// NewCredentialRepository picks the implementation of the database dialect, like NewUserRepository.
+func NewCredentialRepository(db *sqlx.DB, now func() time.Time) *repository.CredentialRepository {
+	if dialectOf(db) == DialectSQLite {
+		return repository.NewSQLiteCredentialRepository(db, now)
+	}
+	return repository.NewCredentialRepository(db)
+}
+
+// NewRefreshTokenRepository picks the implementation of the database dialect, like NewUserRepository.
+func NewRefreshTokenRepository(db *sqlx.DB, now func() time.Time) *repository.RefreshTokenRepository {
+	if dialectOf(db) == DialectSQLite {
+		return repository.NewSQLiteRefreshTokenRepository(db, now)
+	}
+	return repository.NewRefreshTokenRepository(db)
+}
+
+// NewSessionRepository picks the implementation of the database dialect, like NewUserRepository.
+func NewSessionRepository(db *sqlx.DB, now func() time.Time) *repository.SessionRepository {
+	if dialectOf(db) == DialectSQLite {
+		return repository.NewSQLiteSessionRepository(db, now)
+	}
+	return repository.NewSessionRepository(db)
+}
+
+// NewAPIKeyRepository picks the implementation of the database dialect, like NewUserRepository.
+func NewAPIKeyRepository(db *sqlx.DB, now func() time.Time) *repository.APIKeyRepository {
+	if dialectOf(db) == DialectSQLite {
+		return repository.NewSQLiteAPIKeyRepository(db, now)
+	}
+	return repository.NewAPIKeyRepository(db)
+}
+
+// NewTwoFactorRepository picks the implementation of the database dialect, like NewUserRepository.
+func NewTwoFactorRepository(db *sqlx.DB, now func() time.Time) *repository.TwoFactorRepository {
+	if dialectOf(db) == DialectSQLite {
+		return repository.NewSQLiteTwoFactorRepository(db, now)
+	}
+	return repository.NewTwoFactorRepository(db)
+}
+
+// NewEmailVerificationRepository picks the implementation of the database dialect, like NewUserRepository.
+func NewEmailVerificationRepository(db *sqlx.DB) *repository.EmailVerificationRepository {
+	if dialectOf(db) == DialectSQLite {
+		return repository.NewSQLiteEmailVerificationRepository(db)
+	}
+	return repository.NewEmailVerificationRepository(db)
+}
+
+// NewPasswordResetRepository picks the implementation of the database dialect, like NewUserRepository.
+func NewPasswordResetRepository(db *sqlx.DB) *repository.PasswordResetRepository {
+	if dialectOf(db) == DialectSQLite {
+		return repository.NewSQLitePasswordResetRepository(db)
+	}
+	return repository.NewPasswordResetRepository(db)
+}
+
+// NewRoleRepository picks the implementation of the database dialect, like NewUserRepository.
+func NewRoleRepository(db *sqlx.DB) *repository.RoleRepository {
+	if dialectOf(db) == DialectSQLite {
+		return repository.NewSQLiteRoleRepository(db)
+	}
+	return repository.NewRoleRepository(db)
+}
+
+// NewTxManager creates the transaction manager with the isolation level and retries of the config.
+func NewTxManager(db *sqlx.DB, conf Config, l *slog.Logger) *repository.TxManager {
+	// the level is validated by NewConfig
+	isolation, _ := repository.ParseIsolationLevel(conf.DbTxIsolation)
+	if dialectOf(db) == DialectSQLite {
+		// sqlite doesn't support the levels, it's always serializable
+		isolation = sql.LevelDefault
+	}
+	return repository.NewTxManager(db, isolation, conf.TxRetryPolicy(), l)
+}
+
+// NewPoolTxManager is NewTxManager for the native postgres pool.
+func NewPoolTxManager(pool *pgxpool.Pool, conf Config, l *slog.Logger) *postgres.TxManager {
+	// the level is validated by NewConfig
+	isolation, _ := repository.ParseIsolationLevel(conf.DbTxIsolation)
+	return postgres.NewTxManager(pool, isolation, conf.TxRetryPolicy(), l)
+}
+
+func dialectOf(db *sqlx.DB) string {
+	if db.DriverName() == driverSQLite {
+		return DialectSQLite
+	}
+	return DialectPostgres
+}
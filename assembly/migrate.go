@@ -0,0 +1,444 @@
+package assembly
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/pkg/retry"
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/database/sqlite"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	ErrSchemaMismatch = errors.New("schema version mismatch")
+	// ErrDirtySchema means a migration failed half way, the schema must be fixed manually and the version forced
+	ErrDirtySchema = errors.New("dirty schema")
+	// ErrMigrationLockTimeout means another replica holds the migrations lock for too long
+	ErrMigrationLockTimeout = errors.New("migration lock timeout")
+)
+
+// migrationLockKey is the advisory lock all the replicas compete for before migrating.
+// It must differ from the key golang-migrate locks internally, otherwise the winner blocks itself.
+var migrationLockKey = func() int64 {
+	h := fnv.New64a()
+	h.Write([]byte("go-api-walkthrough:migrations"))
+	return int64(h.Sum64())
+}()
+
+const migrationLockPollInterval = 500 * time.Millisecond
+
+const (
+	// SchemaCheckStrict refuses to start the server if the schema version doesn't match
+	SchemaCheckStrict = "strict"
+	// SchemaCheckWarn only logs the mismatch
+	SchemaCheckWarn = "warn"
+	// SchemaCheckOff skips the check
+	SchemaCheckOff = "off"
+)
+
+type MigrationStatus struct {
+	Version uint
+	Name    string
+	Applied bool
+	// Dirty is set on the migration failed half way, it isn't applied
+	Dirty bool
+}
+
+// Migrator applies the migrations embedded into the binary.
+// On postgres the commands changing the schema are executed holding an advisory lock,
+// so the replicas starting at once don't migrate concurrently.
+// SQLite locks the whole file on write and isn't shared between the nodes, so there is no lock.
+type Migrator struct {
+	m        *migrate.Migrate
+	src      source.Driver
+	db       *sqlx.DB
+	dialect  string
+	expected uint
+	log      *slog.Logger
+
+	lockTimeout time.Duration
+	closeDB     bool
+}
+
+// NewMigrator connects to the database unless WithDB is given,
+// WithLogger and WithMigrationsFS options are respected as well.
+func NewMigrator(ctx context.Context, conf Config, opts ...Option) (*Migrator, error) {
+	o := newOptions(conf, opts)
+
+	ctx, cancel := context.WithTimeout(ctx, conf.StartupTimeout)
+	defer cancel()
+
+	migrator := &Migrator{
+		db:  o.db,
+		log: o.logger,
+
+		lockTimeout: conf.MigrationLockTimeout,
+	}
+	if migrator.db == nil {
+		db, err := ConnectDB(ctx, conf, o.logger)
+		if err != nil {
+			return nil, err
+		}
+		migrator.db = db
+		migrator.closeDB = true
+	}
+	migrator.dialect = dialectOf(migrator.db)
+
+	fsys := o.migrations(migrator.db)
+	expected, err := ExpectedSchemaVersion(fsys)
+	if err != nil {
+		return nil, errors.Join(err, migrator.Close())
+	}
+	migrator.expected = expected
+	migrator.src, err = iofs.New(fsys, ".")
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to read migrations: %w", err), migrator.Close())
+	}
+
+	var driver database.Driver
+	err = retry.Do(ctx, conf.ConnectRetryPolicy(), o.logger, "create migration instance", func(ctx context.Context) error {
+		var err error
+		driver, err = migrator.newDriver(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to create migration driver: %w", err), migrator.Close())
+	}
+	migrator.m, err = migrate.NewWithInstance("iofs", migrator.src, migrator.dialect, driver)
+	if err != nil {
+		driver.Close()
+		return nil, errors.Join(fmt.Errorf("failed to create migration instance: %w", err), migrator.Close())
+	}
+	migrator.m.Log = migrateLogger{o.logger}
+
+	return migrator, nil
+}
+
+func (m *Migrator) newDriver(ctx context.Context) (database.Driver, error) {
+	if m.dialect == DialectSQLite {
+		// the driver closes the pool it's given, so it's shielded from Close, see Migrator.Close
+		return sqlite.WithInstance(m.db.DB, &sqlite.Config{})
+	}
+
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	driver, err := postgres.WithConnection(ctx, conn, &postgres.Config{})
+	if err != nil {
+		conn.Close()
+	}
+	return driver, err
+}
+
+// Close closes the source, the migration connection and the database if it's created by the migrator.
+func (m *Migrator) Close() error {
+	var errs []error
+	switch {
+	case m.m != nil && m.dialect != DialectSQLite:
+		srcErr, dbErr := m.m.Close()
+		errs = append(errs, srcErr, dbErr)
+	case m.src != nil:
+		// the sqlite driver works on the pool itself, closing it would close the pool
+		errs = append(errs, m.src.Close())
+	}
+	if m.closeDB {
+		errs = append(errs, m.db.Close())
+	}
+
+	return errors.Join(errs...)
+}
+
+// Up applies all the pending migrations.
+// A replica that had to wait for the lock finds the migrations already applied by the winner
+// and only verifies the resulting version.
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.withLock(ctx, func(waited bool) error {
+		version, err := m.cleanVersion()
+		if err != nil {
+			return err
+		}
+		if waited && version == m.expected {
+			m.log.InfoContext(ctx, "migrations have been applied by another replica", "version", version)
+			return nil
+		}
+
+		if err := m.checkDirty(m.m.Up()); err != nil {
+			return err
+		}
+
+		version, err = m.cleanVersion()
+		if err != nil {
+			return err
+		}
+		if version != m.expected {
+			return fmt.Errorf("%w: database is at %d after migrating, expected %d", ErrSchemaMismatch, version, m.expected)
+		}
+		return nil
+	})
+}
+
+// Down rolls back n migrations.
+func (m *Migrator) Down(ctx context.Context, n int) error {
+	return m.withLock(ctx, func(bool) error {
+		if _, err := m.cleanVersion(); err != nil {
+			return err
+		}
+		return m.checkDirty(m.m.Steps(-n))
+	})
+}
+
+// Goto migrates up or down to the given version.
+func (m *Migrator) Goto(ctx context.Context, version uint) error {
+	return m.withLock(ctx, func(bool) error {
+		if _, err := m.cleanVersion(); err != nil {
+			return err
+		}
+		return m.checkDirty(m.m.Migrate(version))
+	})
+}
+
+// Force sets the version without running the migrations, it resets the dirty state.
+func (m *Migrator) Force(ctx context.Context, version int) error {
+	return m.withLock(ctx, func(bool) error {
+		return m.m.Force(version)
+	})
+}
+
+// Version returns the current schema version, 0 means no migrations applied.
+func (m *Migrator) Version() (uint, bool, error) {
+	version, dirty, err := m.m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return 0, false, nil
+	}
+	return version, dirty, err
+}
+
+// ExpectedVersion is the latest version of the migrations the migrator applies.
+func (m *Migrator) ExpectedVersion() uint {
+	return m.expected
+}
+
+// withLock runs fn holding the migrations advisory lock, waited reports whether another replica had it first.
+// The lock is bound to the session, so it's taken on a dedicated connection
+// and released even if the process dies in the middle.
+func (m *Migrator) withLock(ctx context.Context, fn func(waited bool) error) error {
+	if m.dialect == DialectSQLite {
+		return fn(false)
+	}
+
+	lockCtx, cancel := context.WithTimeout(ctx, m.lockTimeout)
+	defer cancel()
+
+	conn, err := m.db.Conn(lockCtx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection for migration lock: %w", err)
+	}
+	defer conn.Close()
+
+	waited := false
+	for {
+		var locked bool
+		if err := conn.QueryRowContext(lockCtx, "SELECT pg_try_advisory_lock($1)", migrationLockKey).Scan(&locked); err != nil {
+			if lockCtx.Err() != nil {
+				return fmt.Errorf("%w: waited %s", ErrMigrationLockTimeout, m.lockTimeout)
+			}
+			return fmt.Errorf("failed to acquire migration lock: %w", err)
+		}
+		if locked {
+			break
+		}
+
+		if !waited {
+			m.log.InfoContext(ctx, "another replica is migrating, waiting for the lock", "timeout", m.lockTimeout.String())
+			waited = true
+		}
+		select {
+		case <-lockCtx.Done():
+			return fmt.Errorf("%w: waited %s", ErrMigrationLockTimeout, m.lockTimeout)
+		case <-time.After(migrationLockPollInterval):
+		}
+	}
+	defer func() {
+		// the lock context might be expired already
+		if _, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockKey); err != nil {
+			m.log.ErrorContext(ctx, "failed to release migration lock", "err", err)
+		}
+	}()
+
+	return fn(waited)
+}
+
+// cleanVersion returns the current version or ErrDirtySchema if the last migration failed.
+func (m *Migrator) cleanVersion() (uint, error) {
+	version, dirty, err := m.Version()
+	if err != nil {
+		return 0, err
+	}
+	if dirty {
+		return version, dirtySchemaError(version)
+	}
+	return version, nil
+}
+
+// checkDirty converts golang-migrate dirty error to ErrDirtySchema
+// and treats nothing to migrate as success.
+func (m *Migrator) checkDirty(err error) error {
+	var errDirty migrate.ErrDirty
+	if errors.As(err, &errDirty) {
+		return dirtySchemaError(uint(errDirty.Version))
+	}
+	return ignoreNoChange(err)
+}
+
+func dirtySchemaError(version uint) error {
+	return fmt.Errorf("%w: migration %d failed half way, fix the schema manually and run `migrate force V`", ErrDirtySchema, version)
+}
+
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	current, dirty, err := m.Version()
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []MigrationStatus
+	version, err := m.src.First()
+	for err == nil {
+		var name string
+		name, err = migrationName(m.src, version)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, MigrationStatus{
+			Version: version,
+			Name:    name,
+			Applied: version < current || (version == current && !dirty),
+			Dirty:   version == current && dirty,
+		})
+
+		version, err = m.src.Next(version)
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	return statuses, nil
+}
+
+// ExpectedSchemaVersion is the latest version of the given migrations.
+func ExpectedSchemaVersion(fsys fs.FS) (uint, error) {
+	src, err := iofs.New(fsys, ".")
+	if err != nil {
+		return 0, fmt.Errorf("failed to read migrations: %w", err)
+	}
+	defer src.Close()
+
+	var latest uint
+	version, err := src.First()
+	for err == nil {
+		latest = version
+		version, err = src.Next(version)
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return 0, err
+	}
+
+	return latest, nil
+}
+
+// verifySchema compares the applied schema version to the latest one of the migrations.
+func verifySchema(ctx context.Context, mode string, fsys fs.FS, db *sqlx.DB, l *slog.Logger) error {
+	if mode == SchemaCheckOff {
+		return nil
+	}
+
+	expected, err := ExpectedSchemaVersion(fsys)
+	if err != nil {
+		return err
+	}
+	version, dirty, err := schemaVersion(ctx, db)
+	if err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+	if dirty {
+		// a dirty schema is never safe to serve
+		return dirtySchemaError(version)
+	}
+	if version == expected {
+		return nil
+	}
+
+	err = fmt.Errorf("%w: database is at %d, expected %d", ErrSchemaMismatch, version, expected)
+	if mode == SchemaCheckWarn {
+		l.WarnContext(ctx, "schema version mismatch", "version", version, "expected", expected)
+		return nil
+	}
+	return err
+}
+
+func schemaVersion(ctx context.Context, db *sqlx.DB) (uint, bool, error) {
+	existsQuery := "SELECT to_regclass('schema_migrations') IS NOT NULL"
+	if dialectOf(db) == DialectSQLite {
+		existsQuery = "SELECT COUNT(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'"
+	}
+
+	var exists bool
+	if err := db.QueryRowxContext(ctx, existsQuery).Scan(&exists); err != nil {
+		return 0, false, err
+	}
+	if !exists {
+		return 0, false, nil
+	}
+
+	var version int64
+	var dirty bool
+	err := db.QueryRowxContext(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &dirty)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+
+	return uint(version), dirty, nil
+}
+
+func migrationName(src source.Driver, version uint) (string, error) {
+	r, identifier, err := src.ReadUp(version)
+	if err != nil {
+		return "", err
+	}
+	return identifier, r.Close()
+}
+
+func ignoreNoChange(err error) error {
+	if errors.Is(err, migrate.ErrNoChange) {
+		return nil
+	}
+	return err
+}
+
+// migrateLogger redirects golang-migrate logs to the app logger
+type migrateLogger struct {
+	l *slog.Logger
+}
+
+func (ml migrateLogger) Printf(format string, v ...interface{}) {
+	ml.l.Info(strings.TrimSpace(fmt.Sprintf(format, v...)))
+}
+
+func (ml migrateLogger) Verbose() bool {
+	return false
+}
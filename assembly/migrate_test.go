@@ -0,0 +1,78 @@
+package assembly
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	"github.com/dennypenta/go-api-walkthrough/migrations"
+	"github.com/dennypenta/go-api-walkthrough/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpectedSchemaVersion(t *testing.T) {
+	t.Parallel()
+
+	// the migrations are sequential, so the latest version is the amount of up migrations
+	ups, err := fs.Glob(migrations.FS, "*.up.sql")
+	require.NoError(t, err)
+	require.NotEmpty(t, ups)
+
+	version, err := ExpectedSchemaVersion(migrations.FS)
+	require.NoError(t, err)
+	assert.Equal(t, uint(len(ups)), version)
+}
+
+func TestSQLiteMigrationsFollowPostgres(t *testing.T) {
+	t.Parallel()
+
+	// a dialect lagging behind fails the schema check
+	postgres, err := ExpectedSchemaVersion(migrations.FS)
+	require.NoError(t, err)
+	sqlite, err := ExpectedSchemaVersion(migrations.SQLiteFS)
+	require.NoError(t, err)
+	assert.Equal(t, postgres, sqlite)
+}
+
+func TestSchemaCheckConfig(t *testing.T) {
+	// a typo mustn't turn into the strict check silently
+	t.Setenv("SCHEMA_CHECK", "warning")
+	_, err := NewConfig()
+	assert.ErrorContains(t, err, "SCHEMA_CHECK")
+
+	t.Setenv("SCHEMA_CHECK", SchemaCheckWarn)
+	conf, err := NewConfig()
+	require.NoError(t, err)
+	assert.Equal(t, SchemaCheckWarn, conf.SchemaCheck)
+}
+
+func TestMigrationStatusDirty(t *testing.T) {
+	t.Parallel()
+
+	conf, err := NewConfig()
+	require.NoError(t, err)
+	conf.DatabaseDsn = "sqlite://" + filepath.Join(t.TempDir(), "status.db")
+	ctx := context.Background()
+	m, err := NewMigrator(ctx, conf, WithLogger(log.NewLogger(io.Discard, slog.LevelInfo)))
+	require.NoError(t, err)
+	defer m.Close()
+
+	require.NoError(t, m.Goto(ctx, 2))
+	// the second migration has failed half way
+	_, err = m.db.ExecContext(ctx, "UPDATE schema_migrations SET dirty = 1")
+	require.NoError(t, err)
+
+	statuses, err := m.Status()
+	require.NoError(t, err)
+	require.Greater(t, len(statuses), 2)
+	assert.True(t, statuses[0].Applied)
+	assert.False(t, statuses[0].Dirty)
+	assert.False(t, statuses[1].Applied)
+	assert.True(t, statuses[1].Dirty)
+	assert.False(t, statuses[2].Applied)
+	assert.False(t, statuses[2].Dirty)
+}
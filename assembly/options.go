@@ -0,0 +1,225 @@
+package assembly
+
+import (
+	"io/fs"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/migrations"
+	"github.com/dennypenta/go-api-walkthrough/pkg/log"
+	"github.com/dennypenta/go-api-walkthrough/pkg/mail"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Option replaces a dependency NewApp builds by default,
+// so tests and the other binaries can swap any layer.
+type Option func(*options)
+
+type options struct {
+	db            *sqlx.DB
+	pool          *pgxpool.Pool
+	userRepo      domain.UserRepository
+	credRepo      domain.CredentialRepository
+	refreshRepo   domain.RefreshTokenRepository
+	sessionRepo   domain.SessionRepository
+	apiKeyRepo    domain.APIKeyRepository
+	twoFactorRepo domain.TwoFactorRepository
+	emailRepo     domain.EmailVerificationRepository
+	resetRepo     domain.PasswordResetRepository
+	mailer        mail.Mailer
+	roleRepo      domain.RoleRepository
+	txManager     domain.TxManager
+	logger        *slog.Logger
+	audit         *slog.Logger
+	registry      *prometheus.Registry
+	clock         func() time.Time
+	newID         func() string
+	// pgClock and pgNewID are the clock and the ids given with the options, postgres generates its own without them
+	pgClock      func() time.Time
+	pgNewID      func() string
+	migrationsFS fs.FS
+}
+
+func newOptions(conf Config, opts []Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	o.pgClock, o.pgNewID = o.clock, o.newID
+	if o.clock == nil {
+		o.clock = time.Now
+	}
+	if o.newID == nil {
+		o.newID = uuid.NewString
+	}
+
+	if o.registry == nil {
+		o.registry = prometheus.NewRegistry()
+	}
+	if o.logger == nil {
+		// https://www.gnu.org/software/libc/manual/html_node/Standard-Streams.html
+		// errors and diagnostic messages should go to stderr
+		o.logger = log.NewLogger(os.Stderr, conf.LogLevel)
+	}
+	if o.audit == nil {
+		o.audit = o.logger.With("log", "audit")
+	}
+
+	return o
+}
+
+// WithDB makes the app use the given database/sql pool instead of connecting to the configured DSN.
+// The pool is owned by the caller, the app doesn't close it.
+func WithDB(db *sqlx.DB) Option {
+	return func(o *options) {
+		o.db = db
+	}
+}
+
+// WithPool makes the app use the given native postgres pool instead of connecting to the configured DSN.
+// The pool is owned by the caller, the app doesn't close it.
+func WithPool(pool *pgxpool.Pool) Option {
+	return func(o *options) {
+		o.pool = pool
+	}
+}
+
+// WithUserRepository replaces the storage, the app doesn't connect to the database then.
+// The repositories not given with the options below are kept in memory next to the users.
+func WithUserRepository(repo domain.UserRepository) Option {
+	return func(o *options) {
+		o.userRepo = repo
+	}
+}
+
+// WithCredentialRepository replaces the storage of the logins and the password hashes.
+func WithCredentialRepository(repo domain.CredentialRepository) Option {
+	return func(o *options) {
+		o.credRepo = repo
+	}
+}
+
+// WithRefreshTokenRepository replaces the storage of the refresh token hashes, a refresh marks the used one there.
+func WithRefreshTokenRepository(repo domain.RefreshTokenRepository) Option {
+	return func(o *options) {
+		o.refreshRepo = repo
+	}
+}
+
+// WithSessionRepository replaces the storage of the sessions, the cache of the revocations still goes in front of it.
+func WithSessionRepository(repo domain.SessionRepository) Option {
+	return func(o *options) {
+		o.sessionRepo = repo
+	}
+}
+
+// WithAPIKeyRepository replaces the storage of the api keys of the service-to-service callers.
+func WithAPIKeyRepository(repo domain.APIKeyRepository) Option {
+	return func(o *options) {
+		o.apiKeyRepo = repo
+	}
+}
+
+// WithTwoFactorRepository replaces the storage of the TOTP secrets, the recovery codes and the login challenges.
+func WithTwoFactorRepository(repo domain.TwoFactorRepository) Option {
+	return func(o *options) {
+		o.twoFactorRepo = repo
+	}
+}
+
+// WithEmailVerificationRepository replaces the storage of the mailed verification tokens, the resends are limited by them.
+func WithEmailVerificationRepository(repo domain.EmailVerificationRepository) Option {
+	return func(o *options) {
+		o.emailRepo = repo
+	}
+}
+
+// WithPasswordResetRepository replaces the storage of the password reset tokens, a user has one at most.
+func WithPasswordResetRepository(repo domain.PasswordResetRepository) Option {
+	return func(o *options) {
+		o.resetRepo = repo
+	}
+}
+
+// WithMailer replaces the mail transport of MAIL_TRANSPORT.
+func WithMailer(m mail.Mailer) Option {
+	return func(o *options) {
+		o.mailer = m
+	}
+}
+
+// WithRoleRepository replaces the storage of the roles signed into the access tokens.
+func WithRoleRepository(repo domain.RoleRepository) Option {
+	return func(o *options) {
+		o.roleRepo = repo
+	}
+}
+
+// WithTxManager replaces the transactions of the storage, it's meant to go along with WithUserRepository.
+func WithTxManager(tx domain.TxManager) Option {
+	return func(o *options) {
+		o.txManager = tx
+	}
+}
+
+// WithLogger replaces the stderr logger of LOG_LEVEL, the requests, the workers and the migrations log there.
+func WithLogger(l *slog.Logger) Option {
+	return func(o *options) {
+		o.logger = l
+	}
+}
+
+// WithAuditLogger makes the access denials go to the given logger,
+// by default they are written by the app logger with log=audit.
+func WithAuditLogger(l *slog.Logger) Option {
+	return func(o *options) {
+		o.audit = l
+	}
+}
+
+// WithRegistry makes the app register its metrics in the given registry.
+func WithRegistry(reg *prometheus.Registry) Option {
+	return func(o *options) {
+		o.registry = reg
+	}
+}
+
+// WithClock replaces time.Now of the app, the storages stamp the users with it as well,
+// postgres takes its own clock only when the option isn't given.
+func WithClock(now func() time.Time) Option {
+	return func(o *options) {
+		o.clock = now
+	}
+}
+
+// WithIDGenerator replaces uuid.NewString for every id the app makes, the users, the sessions, the tokens and the traces,
+// postgres generates the user ids itself only when the option isn't given.
+func WithIDGenerator(newID func() string) Option {
+	return func(o *options) {
+		o.newID = newID
+	}
+}
+
+// migrations returns the migration set of the database dialect unless WithMigrationsFS is given.
+func (o *options) migrations(db *sqlx.DB) fs.FS {
+	if o.migrationsFS != nil {
+		return o.migrationsFS
+	}
+	if dialectOf(db) == DialectSQLite {
+		return migrations.SQLiteFS
+	}
+	return migrations.FS
+}
+
+// WithMigrationsFS replaces the migrations embedded into the binary.
+func WithMigrationsFS(fsys fs.FS) Option {
+	return func(o *options) {
+		o.migrationsFS = fsys
+	}
+}
@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/pkg/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// apiKeyPrefix marks the keys of the service, so a leaked one is easy to tell apart, e.g. by a secret scanner.
+const apiKeyPrefix = "usk"
+
+// apiKeyLookupSize is the amount of random bytes of the lookup prefix, apiKeySecretSize of the rest of the key.
+const (
+	apiKeyLookupSize = 6
+	apiKeySecretSize = 32
+)
+
+// lastUsedResolution limits the writes of the last used time, a key used more often is recorded once in a while.
+const lastUsedResolution = time.Minute
+
+// APIKeyGenerator makes the keys usk_<prefix>_<secret>, the prefix is stored as is to find the key by.
+type APIKeyGenerator struct{}
+
+func (APIKeyGenerator) GenerateAPIKey() (key, prefix, hash string, err error) {
+	b := make([]byte, apiKeyLookupSize+apiKeySecretSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", "", fmt.Errorf("failed to generate api key: %w", err)
+	}
+	prefix = hex.EncodeToString(b[:apiKeyLookupSize])
+
+	key = apiKeyPrefix + "_" + prefix + "_" + base64.RawURLEncoding.EncodeToString(b[apiKeyLookupSize:])
+	return key, prefix, hashToken(key), nil
+}
+
+// parseAPIKey returns the lookup prefix of a well formed key.
+func parseAPIKey(key string) (string, bool) {
+	marker, rest, ok := strings.Cut(key, "_")
+	if !ok || marker != apiKeyPrefix {
+		return "", false
+	}
+	prefix, secret, ok := strings.Cut(rest, "_")
+	if !ok || len(prefix) != 2*apiKeyLookupSize || secret == "" {
+		return "", false
+	}
+	return prefix, true
+}
+
+type APIKeyMetrics struct {
+	requests *prometheus.CounterVec
+}
+
+func NewAPIKeyMetrics(reg prometheus.Registerer) *APIKeyMetrics {
+	m := &APIKeyMetrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "userService",
+			Subsystem: "api_keys",
+			Name:      "requests_total",
+			Help:      "amount of requests authenticated with the api key",
+		}, []string{"key_id", "name"}),
+	}
+
+	reg.MustRegister(m.requests)
+
+	return m
+}
+
+// APIKeyAuthenticator accepts the keys neither revoked nor expired, the principal has the scopes of the key.
+type APIKeyAuthenticator struct {
+	repo    domain.APIKeyRepository
+	now     func() time.Time
+	metrics *APIKeyMetrics
+}
+
+func NewAPIKeyAuthenticator(repo domain.APIKeyRepository, now func() time.Time, m *APIKeyMetrics) *APIKeyAuthenticator {
+	return &APIKeyAuthenticator{
+		repo:    repo,
+		now:     now,
+		metrics: m,
+	}
+}
+
+// Authenticate returns ErrInvalidAccessToken telling the reason if the key can't be used.
+func (a *APIKeyAuthenticator) Authenticate(ctx context.Context, key string) (domain.Principal, error) {
+	prefix, ok := parseAPIKey(key)
+	if !ok {
+		return domain.Principal{}, fmt.Errorf("%w: malformed api key", domain.ErrInvalidAccessToken)
+	}
+	k, err := a.repo.GetAPIKeyByPrefix(ctx, prefix)
+	if errors.Is(err, domain.ErrAPIKeyNotFound) {
+		return domain.Principal{}, fmt.Errorf("%w: unknown api key", domain.ErrInvalidAccessToken)
+	}
+	if err != nil {
+		return domain.Principal{}, fmt.Errorf("Authenticate: failed to get api key: %w", err)
+	}
+	if subtle.ConstantTimeCompare([]byte(hashToken(key)), []byte(k.Hash)) != 1 {
+		return domain.Principal{}, fmt.Errorf("%w: unknown api key", domain.ErrInvalidAccessToken)
+	}
+	now := a.now()
+	if k.Expired(now) {
+		return domain.Principal{}, fmt.Errorf("%w: api key expired", domain.ErrInvalidAccessToken)
+	}
+
+	if k.LastUsedAt == nil || now.Sub(*k.LastUsedAt) >= lastUsedResolution {
+		// the request goes on, the time is recorded with the next one
+		if err := a.repo.TouchAPIKey(ctx, k.ID, now); err != nil {
+			log.LoggerFromContext(ctx).ErrorContext(ctx, "failed to record api key use", "keyID", k.ID, "err", err)
+		}
+	}
+	a.metrics.requests.WithLabelValues(k.ID, k.Name).Inc()
+
+	return domain.Principal{
+		ID:       k.ID,
+		Scopes:   k.Scopes,
+		APIKeyID: k.ID,
+	}, nil
+}
@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/repository/memory"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateAPIKey(t *testing.T) {
+	key, prefix, hash, err := APIKeyGenerator{}.GenerateAPIKey()
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(key, "usk_"+prefix+"_"), key)
+	assert.Equal(t, hashToken(key), hash)
+
+	parsed, ok := parseAPIKey(key)
+	assert.True(t, ok)
+	assert.Equal(t, prefix, parsed)
+
+	other, _, _, err := APIKeyGenerator{}.GenerateAPIKey()
+	require.NoError(t, err)
+	assert.NotEqual(t, key, other)
+}
+
+func TestAPIKeyAuthenticator(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	repo := memory.NewAPIKeyRepository()
+	reg := prometheus.NewRegistry()
+	m := NewAPIKeyMetrics(reg)
+	a := NewAPIKeyAuthenticator(repo, func() time.Time { return now }, m)
+
+	create := func(name string, expiresAt *time.Time) (domain.APIKey, string) {
+		t.Helper()
+		key, prefix, hash, err := APIKeyGenerator{}.GenerateAPIKey()
+		require.NoError(t, err)
+		k := domain.APIKey{ID: uuid.NewString(), Name: name, Prefix: prefix, Hash: hash,
+			Scopes: []string{domain.ActionReadUser}, CreatedAt: now, ExpiresAt: expiresAt}
+		require.NoError(t, repo.CreateAPIKey(ctx, k))
+		return k, key
+	}
+
+	k, key := create("batch", nil)
+	p, err := a.Authenticate(ctx, key)
+	require.NoError(t, err)
+	assert.Equal(t, domain.Principal{ID: k.ID, Scopes: []string{domain.ActionReadUser}, APIKeyID: k.ID}, p)
+	stored, err := repo.GetAPIKeyByPrefix(ctx, k.Prefix)
+	require.NoError(t, err)
+	assert.Equal(t, &now, stored.LastUsedAt)
+
+	// the use within the resolution isn't written again
+	require.NoError(t, repo.TouchAPIKey(ctx, k.ID, now.Add(-time.Second)))
+	_, err = a.Authenticate(ctx, key)
+	require.NoError(t, err)
+	stored, err = repo.GetAPIKeyByPrefix(ctx, k.Prefix)
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(-time.Second), *stored.LastUsedAt)
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.requests.WithLabelValues(k.ID, "batch")))
+
+	expiresAt := now
+	_, expired := create("expired", &expiresAt)
+	revokedKey, revoked := create("revoked", nil)
+	require.NoError(t, repo.RevokeAPIKey(ctx, revokedKey.ID))
+	for name, key := range map[string]string{
+		"malformed":    "garbage",
+		"other secret": key[:len(key)-4] + "AAAA",
+		"unknown":      "usk_000000000000_secret",
+		"expired":      expired,
+		"revoked":      revoked,
+	} {
+		_, err := a.Authenticate(ctx, key)
+		assert.ErrorIs(t, err, domain.ErrInvalidAccessToken, name)
+	}
+}
@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/pkg/jwt"
+)
+
+// SessionChecker tells whether the session of a token isn't revoked.
+type SessionChecker interface {
+	IsSessionActive(ctx context.Context, id string) (bool, error)
+}
+
+// BearerAuthenticator accepts the access tokens signed by any key of the set for the issuer
+// unless their session is revoked.
+type BearerAuthenticator struct {
+	keys     *jwt.KeySet
+	issuer   string
+	sessions SessionChecker
+}
+
+func NewBearerAuthenticator(keys *jwt.KeySet, issuer string, sessions SessionChecker) *BearerAuthenticator {
+	return &BearerAuthenticator{
+		keys:     keys,
+		issuer:   issuer,
+		sessions: sessions,
+	}
+}
+
+// Authenticate returns ErrInvalidAccessToken telling the reason if the token isn't a valid access token.
+func (a *BearerAuthenticator) Authenticate(ctx context.Context, token string) (domain.Principal, error) {
+	c, err := a.keys.Verify(token)
+	if err != nil {
+		return domain.Principal{}, fmt.Errorf("%w: %w", domain.ErrInvalidAccessToken, err)
+	}
+	if c.Type != TokenTypeAccess || c.Issuer != a.issuer || c.Subject == "" {
+		return domain.Principal{}, fmt.Errorf("%w: not an access token of %s", domain.ErrInvalidAccessToken, a.issuer)
+	}
+
+	// the tokens issued without a sign in, e.g. for the services, have no session to revoke
+	if c.SessionID != "" {
+		active, err := a.sessions.IsSessionActive(ctx, c.SessionID)
+		if err != nil {
+			return domain.Principal{}, fmt.Errorf("Authenticate: failed to check session: %w", err)
+		}
+		if !active {
+			return domain.Principal{}, fmt.Errorf("%w: session revoked", domain.ErrInvalidAccessToken)
+		}
+	}
+
+	return domain.Principal{
+		ID:        c.Subject,
+		Roles:     c.Roles,
+		Scopes:    strings.Fields(c.Scope),
+		TenantID:  c.Tenant,
+		SessionID: c.SessionID,
+	}, nil
+}
@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/pkg/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBearerAuthenticator(t *testing.T) {
+	ti := newTestIssuer(t)
+	ctx := context.Background()
+	a := NewBearerAuthenticator(ti.keys, "user-service", ti.sessions)
+
+	sign := func(c jwt.Claims) string {
+		t.Helper()
+		c.ExpiresAt = ti.now.Add(time.Minute).Unix()
+		token, err := ti.keys.Sign(c)
+		require.NoError(t, err)
+		return token
+	}
+
+	p, err := a.Authenticate(ctx, sign(jwt.Claims{
+		Issuer:  "user-service",
+		Subject: "1",
+		Type:    TokenTypeAccess,
+		Roles:   []string{"admin"},
+		Scope:   "users:read users:write",
+		Tenant:  "acme",
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, domain.Principal{ID: "1", Roles: []string{"admin"}, Scopes: []string{"users:read", "users:write"}, TenantID: "acme"}, p)
+
+	userID := ti.createUser(t)
+	pair, err := ti.IssueTokens(ctx, userID, testClient)
+	require.NoError(t, err)
+	p, err = a.Authenticate(ctx, pair.AccessToken)
+	require.NoError(t, err)
+	assert.NotEmpty(t, p.SessionID)
+
+	// signing out the session refuses its access tokens before they expire
+	require.NoError(t, ti.sessions.RevokeSession(ctx, userID, p.SessionID))
+	revoked := pair.AccessToken
+
+	for name, token := range map[string]string{
+		"revoked session": revoked,
+		"garbage":         "garbage",
+		"other type":      sign(jwt.Claims{Issuer: "user-service", Subject: "1", Type: "refresh"}),
+		"other issuer":    sign(jwt.Claims{Issuer: "another-service", Subject: "1", Type: TokenTypeAccess}),
+	} {
+		_, err := a.Authenticate(ctx, token)
+		assert.ErrorIs(t, err, domain.ErrInvalidAccessToken, name)
+	}
+}
@@ -0,0 +1,139 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/pkg/mail"
+)
+
+// mailTokenSize is the amount of random bytes in a token mailed to the user
+const mailTokenSize = 32
+
+type EmailVerificationConfig struct {
+	TTL time.Duration
+	// ResendInterval is the least time between two verifications of a user,
+	// and MaxPerWindow of them are sent within Window at most
+	ResendInterval time.Duration
+	MaxPerWindow   int
+	Window         time.Duration
+}
+
+// EmailVerifier proves the users own their emails: a token is mailed to the email and comes back with VerifyEmail.
+// The verifications are rate limited per user, so the service can't be used to flood a mailbox.
+type EmailVerifier struct {
+	repo   domain.EmailVerificationRepository
+	users  domain.UserRepository
+	mailer mail.Mailer
+	conf   EmailVerificationConfig
+	now    func() time.Time
+	newID  func() string
+}
+
+func NewEmailVerifier(repo domain.EmailVerificationRepository, users domain.UserRepository, mailer mail.Mailer, conf EmailVerificationConfig, now func() time.Time, newID func() string) *EmailVerifier {
+	return &EmailVerifier{
+		repo:   repo,
+		users:  users,
+		mailer: mailer,
+		conf:   conf,
+		now:    now,
+		newID:  newID,
+	}
+}
+
+// RequestEmailVerification mails a new token to the email of the user, the tokens sent before stay valid.
+// It returns VerificationRateLimitedError if the user has asked too often.
+func (v *EmailVerifier) RequestEmailVerification(ctx context.Context, userID string) error {
+	u, err := v.users.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if u.Email == "" {
+		return domain.ErrEmailNotSet
+	}
+	if u.EmailVerifiedAt != nil {
+		return domain.ErrEmailVerified
+	}
+
+	now := v.now().UTC()
+	recent, err := v.repo.RecentEmailVerifications(ctx, userID, now.Add(-v.conf.Window))
+	if err != nil {
+		return fmt.Errorf("RequestEmailVerification: failed to get recent verifications: %w", err)
+	}
+	if wait := v.retryAfter(recent, now); wait > 0 {
+		return &domain.VerificationRateLimitedError{RetryAfter: wait}
+	}
+
+	token, err := newMailToken()
+	if err != nil {
+		return fmt.Errorf("RequestEmailVerification: %w", err)
+	}
+	err = v.repo.CreateEmailVerification(ctx, domain.EmailVerification{
+		ID:        v.newID(),
+		UserID:    userID,
+		Email:     u.Email,
+		Hash:      hashToken(token),
+		CreatedAt: now,
+		ExpiresAt: now.Add(v.conf.TTL),
+	})
+	if err != nil {
+		return fmt.Errorf("RequestEmailVerification: failed to create verification: %w", err)
+	}
+
+	err = v.mailer.Send(ctx, mail.Message{
+		To:      u.Email,
+		Subject: "Verify your email",
+		Body: fmt.Sprintf("Use the token below to verify %s, it expires in %s.\n\n%s\n\nIf you haven't asked for it, ignore this email.",
+			u.Email, v.conf.TTL, token),
+	})
+	if err != nil {
+		return fmt.Errorf("RequestEmailVerification: failed to send mail: %w", err)
+	}
+
+	return nil
+}
+
+// VerifyEmail consumes the token and verifies the email it's sent to, unless the user has changed the email since.
+func (v *EmailVerifier) VerifyEmail(ctx context.Context, token string) error {
+	now := v.now()
+	ev, err := v.repo.ConsumeEmailVerification(ctx, hashToken(token), now)
+	if errors.Is(err, domain.ErrEmailVerificationNotFound) {
+		return domain.ErrInvalidVerificationToken
+	}
+	if err != nil {
+		return err
+	}
+
+	err = v.users.VerifyEmail(ctx, ev.UserID, ev.Email, now)
+	if errors.Is(err, domain.ErrUserNotFound) {
+		return domain.ErrInvalidVerificationToken
+	}
+	return err
+}
+
+// retryAfter tells how long the user waits for the next verification given the recent ones, the oldest first.
+func (v *EmailVerifier) retryAfter(recent []time.Time, now time.Time) time.Duration {
+	n := len(recent)
+	if n == 0 {
+		return 0
+	}
+	wait := recent[n-1].Add(v.conf.ResendInterval).Sub(now)
+	if n >= v.conf.MaxPerWindow {
+		// the oldest of the verifications filling the window has to leave it
+		wait = max(wait, recent[n-v.conf.MaxPerWindow].Add(v.conf.Window).Sub(now))
+	}
+	return wait
+}
+
+func newMailToken() (string, error) {
+	b := make([]byte, mailTokenSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,139 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/pkg/mail"
+	"github.com/dennypenta/go-api-walkthrough/repository/memory"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mailbox keeps the messages instead of sending them.
+type mailbox struct {
+	sent []mail.Message
+}
+
+func (m *mailbox) Send(ctx context.Context, msg mail.Message) error {
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+// lastToken is the token of the last message, it's the paragraph after the first one.
+func (m *mailbox) lastToken(t *testing.T) string {
+	t.Helper()
+
+	require.NotEmpty(t, m.sent)
+	paragraphs := strings.Split(m.sent[len(m.sent)-1].Body, "\n\n")
+	require.Len(t, paragraphs, 3)
+	return paragraphs[1]
+}
+
+type testEmailVerifier struct {
+	*EmailVerifier
+	users   *memory.UserRepository
+	mailbox *mailbox
+	now     time.Time
+}
+
+func newTestEmailVerifier(t *testing.T) *testEmailVerifier {
+	t.Helper()
+
+	v := &testEmailVerifier{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), mailbox: &mailbox{}}
+	clock := func() time.Time { return v.now }
+	v.users = memory.NewUserRepository(clock, uuid.NewString)
+	conf := EmailVerificationConfig{TTL: 24 * time.Hour, ResendInterval: time.Minute, MaxPerWindow: 3, Window: time.Hour}
+	v.EmailVerifier = NewEmailVerifier(memory.NewEmailVerificationRepository(v.users), v.users, v.mailbox, conf, clock, uuid.NewString)
+	return v
+}
+
+func TestVerifyEmail(t *testing.T) {
+	v := newTestEmailVerifier(t)
+	ctx := context.Background()
+	user, err := v.users.CreateUser(ctx, domain.User{Username: "alice", Email: "alice@example.com"})
+	require.NoError(t, err)
+
+	require.NoError(t, v.RequestEmailVerification(ctx, user.ID))
+	require.Len(t, v.mailbox.sent, 1)
+	assert.Equal(t, "alice@example.com", v.mailbox.sent[0].To)
+	token := v.mailbox.lastToken(t)
+
+	assert.ErrorIs(t, v.VerifyEmail(ctx, "unknown"), domain.ErrInvalidVerificationToken)
+	require.NoError(t, v.VerifyEmail(ctx, token))
+	got, err := v.users.GetUserByID(ctx, user.ID)
+	require.NoError(t, err)
+	require.NotNil(t, got.EmailVerifiedAt)
+	assert.Equal(t, v.now, *got.EmailVerifiedAt)
+
+	// the token is used once
+	assert.ErrorIs(t, v.VerifyEmail(ctx, token), domain.ErrInvalidVerificationToken)
+	assert.ErrorIs(t, v.RequestEmailVerification(ctx, user.ID), domain.ErrEmailVerified)
+}
+
+func TestVerifyEmailRefusesChangedEmail(t *testing.T) {
+	v := newTestEmailVerifier(t)
+	ctx := context.Background()
+	user, err := v.users.CreateUser(ctx, domain.User{Username: "alice", Email: "alice@example.com"})
+	require.NoError(t, err)
+	require.NoError(t, v.RequestEmailVerification(ctx, user.ID))
+
+	user.Email = "alicia@example.com"
+	_, err = v.users.UpdateUser(ctx, user)
+	require.NoError(t, err)
+	assert.ErrorIs(t, v.VerifyEmail(ctx, v.mailbox.lastToken(t)), domain.ErrInvalidVerificationToken)
+}
+
+func TestVerifyEmailExpires(t *testing.T) {
+	v := newTestEmailVerifier(t)
+	ctx := context.Background()
+	user, err := v.users.CreateUser(ctx, domain.User{Username: "alice", Email: "alice@example.com"})
+	require.NoError(t, err)
+	require.NoError(t, v.RequestEmailVerification(ctx, user.ID))
+
+	v.now = v.now.Add(24 * time.Hour)
+	assert.ErrorIs(t, v.VerifyEmail(ctx, v.mailbox.lastToken(t)), domain.ErrInvalidVerificationToken)
+}
+
+func TestRequestEmailVerificationRateLimits(t *testing.T) {
+	v := newTestEmailVerifier(t)
+	ctx := context.Background()
+	user, err := v.users.CreateUser(ctx, domain.User{Username: "alice", Email: "alice@example.com"})
+	require.NoError(t, err)
+	start := v.now
+
+	require.NoError(t, v.RequestEmailVerification(ctx, user.ID))
+	v.now = v.now.Add(20 * time.Second)
+	var limited *domain.VerificationRateLimitedError
+	require.ErrorAs(t, v.RequestEmailVerification(ctx, user.ID), &limited)
+	assert.Equal(t, 40*time.Second, limited.RetryAfter)
+
+	v.now = start.Add(time.Minute)
+	require.NoError(t, v.RequestEmailVerification(ctx, user.ID))
+	v.now = start.Add(2 * time.Minute)
+	require.NoError(t, v.RequestEmailVerification(ctx, user.ID))
+
+	// 3 within the hour, the first one leaves the window at 1h
+	v.now = start.Add(10 * time.Minute)
+	require.ErrorAs(t, v.RequestEmailVerification(ctx, user.ID), &limited)
+	assert.Equal(t, 50*time.Minute, limited.RetryAfter)
+	assert.Len(t, v.mailbox.sent, 3)
+
+	v.now = start.Add(time.Hour)
+	require.NoError(t, v.RequestEmailVerification(ctx, user.ID))
+}
+
+func TestRequestEmailVerificationWithoutEmail(t *testing.T) {
+	v := newTestEmailVerifier(t)
+	ctx := context.Background()
+	user, err := v.users.CreateUser(ctx, domain.User{Username: "alice"})
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, v.RequestEmailVerification(ctx, user.ID), domain.ErrEmailNotSet)
+	assert.ErrorIs(t, v.RequestEmailVerification(ctx, uuid.NewString()), domain.ErrUserNotFound)
+	assert.Empty(t, v.mailbox.sent)
+}
@@ -0,0 +1,197 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/pkg/mail"
+)
+
+var ErrPasswordResetQueueFull = errors.New("password reset queue is full")
+
+type PasswordResetConfig struct {
+	TTL time.Duration
+	// ResendInterval is the least time between two resets of a user, the requests in between are dropped
+	ResendInterval time.Duration
+	// QueueSize is the number of the requests waiting for Run, the requests above it are dropped
+	QueueSize int
+}
+
+// PasswordResetter lets the users who have forgotten the password set a new one with a token mailed to their verified email.
+// Asking for a reset tells nothing about the login: the request is queued whatever the login is and Run handles it,
+// an unknown login, a user without a verified email and a too early request are dropped there.
+type PasswordResetter struct {
+	repo     domain.PasswordResetRepository
+	creds    domain.CredentialRepository
+	users    UserSource
+	sessions domain.SessionRepository
+	hasher   domain.PasswordHasher
+	policy   domain.PasswordPolicy
+	tx       domain.TxManager
+	mailer   mail.Mailer
+	conf     PasswordResetConfig
+	now      func() time.Time
+	newID    func() string
+	log      *slog.Logger
+	queue    chan string
+}
+
+func NewPasswordResetter(repo domain.PasswordResetRepository, creds domain.CredentialRepository, users UserSource, sessions domain.SessionRepository,
+	hasher domain.PasswordHasher, policy domain.PasswordPolicy, tx domain.TxManager, mailer mail.Mailer,
+	conf PasswordResetConfig, now func() time.Time, newID func() string, l *slog.Logger) *PasswordResetter {
+	return &PasswordResetter{
+		repo:     repo,
+		creds:    creds,
+		users:    users,
+		sessions: sessions,
+		hasher:   hasher,
+		policy:   policy,
+		tx:       tx,
+		mailer:   mailer,
+		conf:     conf,
+		now:      now,
+		newID:    newID,
+		log:      l,
+		queue:    make(chan string, conf.QueueSize),
+	}
+}
+
+// ForgotPassword queues the login for Run, so the unknown logins and the known ones take the same time.
+// Only a full queue is an error.
+func (p *PasswordResetter) ForgotPassword(ctx context.Context, login string) error {
+	select {
+	case p.queue <- login:
+		return nil
+	default:
+		return ErrPasswordResetQueueFull
+	}
+}
+
+// Run sends the queued resets until ctx is done, a failed one is logged and dropped.
+func (p *PasswordResetter) Run(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case login := <-p.queue:
+			if err := p.sendReset(ctx, login); err != nil {
+				p.log.ErrorContext(ctx, "failed to send password reset", "err", err)
+			}
+		}
+	}
+}
+
+// sendReset mails a reset token to the verified email of the login replacing the token sent before.
+// It returns nil whether the token is sent or not, only a failure is an error.
+func (p *PasswordResetter) sendReset(ctx context.Context, login string) error {
+	c, err := p.creds.GetCredentialsByLogin(ctx, domain.NormalizeLogin(login))
+	if errors.Is(err, domain.ErrCredentialsNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("sendReset: failed to get credentials: %w", err)
+	}
+	u, err := p.users.GetUserByID(ctx, c.UserID)
+	if errors.Is(err, domain.ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("sendReset: failed to get user: %w", err)
+	}
+	// an unverified email might belong to someone else
+	if u.Email == "" || u.EmailVerifiedAt == nil {
+		return nil
+	}
+
+	now := p.now().UTC()
+	last, err := p.repo.GetUserPasswordReset(ctx, c.UserID)
+	switch {
+	case err == nil && now.Before(last.CreatedAt.Add(p.conf.ResendInterval)):
+		return nil
+	case err != nil && !errors.Is(err, domain.ErrPasswordResetNotFound):
+		return fmt.Errorf("sendReset: failed to get last reset: %w", err)
+	}
+
+	token, err := newMailToken()
+	if err != nil {
+		return fmt.Errorf("sendReset: %w", err)
+	}
+	err = p.repo.CreatePasswordReset(ctx, domain.PasswordReset{
+		ID:        p.newID(),
+		UserID:    c.UserID,
+		Login:     c.Login,
+		Hash:      hashToken(token),
+		CreatedAt: now,
+		ExpiresAt: now.Add(p.conf.TTL),
+	})
+	if err != nil {
+		return fmt.Errorf("sendReset: failed to create reset: %w", err)
+	}
+
+	err = p.mailer.Send(ctx, mail.Message{
+		To:      u.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Use the token below to set a new password of %s, it expires in %s.\n\n%s\n\nIf you haven't asked for it, ignore this email, the password stays.",
+			c.Login, p.conf.TTL, token),
+	})
+	if err != nil {
+		return fmt.Errorf("sendReset: failed to send mail: %w", err)
+	}
+
+	return nil
+}
+
+// ResetPassword sets the new password with the token and signs the user out of every session.
+// A password breaking the policy leaves the token, the user tries another one.
+func (p *PasswordResetter) ResetPassword(ctx context.Context, token, password string) error {
+	r, err := p.repo.GetPasswordReset(ctx, hashToken(token))
+	if errors.Is(err, domain.ErrPasswordResetNotFound) {
+		return domain.ErrInvalidResetToken
+	}
+	if err != nil {
+		return err
+	}
+	if !p.now().Before(r.ExpiresAt) {
+		return domain.ErrInvalidResetToken
+	}
+
+	// the login might have been changed or given to another user since the mail
+	c, err := p.creds.GetCredentialsByLogin(ctx, r.Login)
+	if errors.Is(err, domain.ErrCredentialsNotFound) || (err == nil && c.UserID != r.UserID) {
+		return domain.ErrInvalidResetToken
+	}
+	if err != nil {
+		return fmt.Errorf("ResetPassword: failed to get credentials: %w", err)
+	}
+	if err := p.policy.Validate(password, c.Login); err != nil {
+		return err
+	}
+	hash, err := p.hasher.Hash(password)
+	if err != nil {
+		return fmt.Errorf("ResetPassword: %w", err)
+	}
+
+	return p.tx.WithinTx(ctx, func(ctx context.Context) error {
+		err := p.repo.UsePasswordReset(ctx, r.ID)
+		if errors.Is(err, domain.ErrPasswordResetNotFound) {
+			// a concurrent reset has won
+			return domain.ErrInvalidResetToken
+		}
+		if err != nil {
+			return err
+		}
+		c.PasswordHash = hash
+		if err := p.creds.SetCredentials(ctx, c); err != nil {
+			return err
+		}
+		// the refresh tokens go along with their sessions
+		if _, err := p.sessions.RevokeOtherSessions(ctx, r.UserID, ""); err != nil {
+			return fmt.Errorf("ResetPassword: failed to revoke sessions: %w", err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,186 @@
+package auth
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/pkg/password"
+	"github.com/dennypenta/go-api-walkthrough/repository/memory"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testPassword = "correct horse battery staple"
+
+type testPasswordResetter struct {
+	*PasswordResetter
+	users    *memory.UserRepository
+	creds    *memory.CredentialRepository
+	sessions *memory.SessionRepository
+	hasher   *password.Hasher
+	mailbox  *mailbox
+	now      time.Time
+}
+
+func newTestPasswordResetter(t *testing.T) *testPasswordResetter {
+	t.Helper()
+
+	r := &testPasswordResetter{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), mailbox: &mailbox{}}
+	clock := func() time.Time { return r.now }
+	r.users = memory.NewUserRepository(clock, uuid.NewString)
+	r.creds = memory.NewCredentialRepository(r.users)
+	r.sessions = memory.NewSessionRepository(r.users)
+	var err error
+	r.hasher, err = password.NewHasher(password.Params{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+	require.NoError(t, err)
+	conf := PasswordResetConfig{TTL: time.Hour, ResendInterval: time.Minute, QueueSize: 1}
+	policy := domain.PasswordPolicy{MinLength: 12, MaxLength: 128}
+	r.PasswordResetter = NewPasswordResetter(memory.NewPasswordResetRepository(r.users), r.creds, r.users, r.sessions,
+		r.hasher, policy, memory.TxManager{}, r.mailbox, conf, clock, uuid.NewString, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	return r
+}
+
+// newUser creates alice with the login and the verified email.
+func (r *testPasswordResetter) newUser(t *testing.T) domain.User {
+	t.Helper()
+
+	ctx := context.Background()
+	user, err := r.users.CreateUser(ctx, domain.User{Username: "alice", Email: "alice@example.com"})
+	require.NoError(t, err)
+	require.NoError(t, r.users.VerifyEmail(ctx, user.ID, user.Email, r.now))
+	hash, err := r.hasher.Hash(testPassword)
+	require.NoError(t, err)
+	require.NoError(t, r.creds.SetCredentials(ctx, domain.Credentials{UserID: user.ID, Login: "alice", PasswordHash: hash}))
+	return user
+}
+
+// forgot queues the login and handles it the way Run does.
+func (r *testPasswordResetter) forgot(t *testing.T, login string) {
+	t.Helper()
+
+	require.NoError(t, r.ForgotPassword(context.Background(), login))
+	require.NoError(t, r.sendReset(context.Background(), <-r.queue))
+}
+
+func (r *testPasswordResetter) passwordIs(t *testing.T, pass string) bool {
+	t.Helper()
+
+	c, err := r.creds.GetCredentialsByLogin(context.Background(), "alice")
+	require.NoError(t, err)
+	ok, err := r.hasher.Verify(c.PasswordHash, pass)
+	require.NoError(t, err)
+	return ok
+}
+
+func TestResetPassword(t *testing.T) {
+	r := newTestPasswordResetter(t)
+	ctx := context.Background()
+	user := r.newUser(t)
+	for _, device := range []string{"laptop", "phone"} {
+		require.NoError(t, r.sessions.CreateSession(ctx, domain.Session{ID: uuid.NewString(), UserID: user.ID, Device: device, CreatedAt: r.now, LastSeenAt: r.now}))
+	}
+
+	r.forgot(t, " Alice")
+	require.Len(t, r.mailbox.sent, 1)
+	assert.Equal(t, "alice@example.com", r.mailbox.sent[0].To)
+	token := r.mailbox.lastToken(t)
+
+	assert.ErrorIs(t, r.ResetPassword(ctx, "unknown", "a brand new passphrase"), domain.ErrInvalidResetToken)
+	// the weak password leaves the token
+	assert.ErrorIs(t, r.ResetPassword(ctx, token, "short"), domain.ErrWeakPassword)
+	assert.ErrorIs(t, r.ResetPassword(ctx, token, "alice's new password"), domain.ErrWeakPassword)
+	require.NoError(t, r.ResetPassword(ctx, token, "a brand new passphrase"))
+
+	assert.True(t, r.passwordIs(t, "a brand new passphrase"))
+	sessions, err := r.sessions.ListSessions(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+
+	// the token is used once
+	assert.ErrorIs(t, r.ResetPassword(ctx, token, "another new passphrase"), domain.ErrInvalidResetToken)
+	assert.True(t, r.passwordIs(t, "a brand new passphrase"))
+}
+
+func TestResetPasswordExpires(t *testing.T) {
+	r := newTestPasswordResetter(t)
+	ctx := context.Background()
+	r.newUser(t)
+	r.forgot(t, "alice")
+
+	r.now = r.now.Add(time.Hour)
+	assert.ErrorIs(t, r.ResetPassword(ctx, r.mailbox.lastToken(t), "a brand new passphrase"), domain.ErrInvalidResetToken)
+	assert.True(t, r.passwordIs(t, testPassword))
+}
+
+func TestResetPasswordRefusesChangedLogin(t *testing.T) {
+	r := newTestPasswordResetter(t)
+	ctx := context.Background()
+	user := r.newUser(t)
+	r.forgot(t, "alice")
+
+	require.NoError(t, r.creds.SetCredentials(ctx, domain.Credentials{UserID: user.ID, Login: "alicia", PasswordHash: "hash"}))
+	assert.ErrorIs(t, r.ResetPassword(ctx, r.mailbox.lastToken(t), "a brand new passphrase"), domain.ErrInvalidResetToken)
+}
+
+func TestForgotPasswordReplacesToken(t *testing.T) {
+	r := newTestPasswordResetter(t)
+	ctx := context.Background()
+	r.newUser(t)
+
+	r.forgot(t, "alice")
+	first := r.mailbox.lastToken(t)
+	// too early, nothing is sent
+	r.now = r.now.Add(30 * time.Second)
+	r.forgot(t, "alice")
+	assert.Len(t, r.mailbox.sent, 1)
+
+	r.now = r.now.Add(30 * time.Second)
+	r.forgot(t, "alice")
+	require.Len(t, r.mailbox.sent, 2)
+	assert.ErrorIs(t, r.ResetPassword(ctx, first, "a brand new passphrase"), domain.ErrInvalidResetToken)
+	require.NoError(t, r.ResetPassword(ctx, r.mailbox.lastToken(t), "a brand new passphrase"))
+}
+
+func TestForgotPasswordSendsNothing(t *testing.T) {
+	r := newTestPasswordResetter(t)
+	ctx := context.Background()
+	user := r.newUser(t)
+
+	r.forgot(t, "bob")
+
+	user.Email = "alicia@example.com"
+	_, err := r.users.UpdateUser(ctx, user)
+	require.NoError(t, err)
+	r.forgot(t, "alice")
+
+	bob, err := r.users.CreateUser(ctx, domain.User{Username: "bob"})
+	require.NoError(t, err)
+	require.NoError(t, r.creds.SetCredentials(ctx, domain.Credentials{UserID: bob.ID, Login: "bob", PasswordHash: "hash"}))
+	r.forgot(t, "bob")
+
+	assert.Empty(t, r.mailbox.sent)
+}
+
+func TestForgotPasswordQueue(t *testing.T) {
+	r := newTestPasswordResetter(t)
+	r.newUser(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// nothing is sent on the request path, the queue of one drops the rest
+	require.NoError(t, r.ForgotPassword(ctx, "alice"))
+	assert.ErrorIs(t, r.ForgotPassword(ctx, "bob"), ErrPasswordResetQueueFull)
+	assert.Empty(t, r.mailbox.sent)
+
+	done := make(chan error)
+	go func() { done <- r.Run(ctx) }()
+	require.Eventually(t, func() bool { return len(r.queue) == 0 }, time.Second, time.Millisecond)
+	cancel()
+	require.NoError(t, <-done)
+	require.Len(t, r.mailbox.sent, 1)
+}
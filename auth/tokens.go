@@ -0,0 +1,204 @@
+// Package auth issues and checks the tokens the clients authenticate with.
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/pkg/jwt"
+)
+
+// TokenTypeAccess is signed into the access tokens, so a token of another kind can't be used as one.
+const TokenTypeAccess = "access"
+
+// refreshTokenSize is the amount of random bytes in a refresh token.
+const refreshTokenSize = 32
+
+// RoleSource gives the roles signed into the access tokens.
+type RoleSource interface {
+	GetRoles(ctx context.Context, userID string) ([]string, error)
+}
+
+type TokenConfig struct {
+	// Issuer goes to the iss claim of the access tokens
+	Issuer     string
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+}
+
+// TokenIssuer signs the short lived access tokens and keeps the long lived opaque refresh tokens.
+// Every sign in starts a session, a refresh token is exchanged once and the exchange rotates it within the session,
+// an exchanged token coming back revokes the whole session, since either the client or an attacker has a stolen copy.
+type TokenIssuer struct {
+	keys     *jwt.KeySet
+	refresh  domain.RefreshTokenRepository
+	sessions domain.SessionRepository
+	roles    RoleSource
+	tx       domain.TxManager
+	conf     TokenConfig
+	now      func() time.Time
+	newID    func() string
+	log      *slog.Logger
+}
+
+func NewTokenIssuer(keys *jwt.KeySet, refresh domain.RefreshTokenRepository, sessions domain.SessionRepository, roles RoleSource, tx domain.TxManager, conf TokenConfig, now func() time.Time, newID func() string, l *slog.Logger) *TokenIssuer {
+	return &TokenIssuer{
+		keys:     keys,
+		refresh:  refresh,
+		sessions: sessions,
+		roles:    roles,
+		tx:       tx,
+		conf:     conf,
+		now:      now,
+		newID:    newID,
+		log:      l,
+	}
+}
+
+// IssueTokens starts a new session of the client.
+func (i *TokenIssuer) IssueTokens(ctx context.Context, userID string, client domain.Client) (domain.TokenPair, error) {
+	var pair domain.TokenPair
+	err := i.tx.WithinTx(ctx, func(ctx context.Context) error {
+		now := i.now().UTC()
+		s := domain.Session{
+			ID:         i.newID(),
+			UserID:     userID,
+			Device:     client.Device,
+			UserAgent:  client.UserAgent,
+			IP:         client.IP,
+			CreatedAt:  now,
+			LastSeenAt: now,
+		}
+		if err := i.sessions.CreateSession(ctx, s); err != nil {
+			return fmt.Errorf("IssueTokens: failed to create session: %w", err)
+		}
+
+		var err error
+		pair, err = i.issue(ctx, userID, s.ID)
+		return err
+	})
+	if err != nil {
+		return domain.TokenPair{}, err
+	}
+
+	return pair, nil
+}
+
+// RefreshTokens rotates the refresh token within its session, the session is seen by the client.
+func (i *TokenIssuer) RefreshTokens(ctx context.Context, refreshToken string, client domain.Client) (domain.TokenPair, error) {
+	var pair domain.TokenPair
+	var reused domain.RefreshToken
+	err := i.tx.WithinTx(ctx, func(ctx context.Context) error {
+		t, err := i.refresh.GetRefreshToken(ctx, hashToken(refreshToken))
+		if errors.Is(err, domain.ErrRefreshTokenNotFound) {
+			return domain.ErrInvalidRefreshToken
+		}
+		if err != nil {
+			return err
+		}
+		if t.Revoked || !i.now().Before(t.ExpiresAt) {
+			return domain.ErrInvalidRefreshToken
+		}
+		if t.Used {
+			reused = t
+			return domain.ErrRefreshTokenReused
+		}
+		if err := i.refresh.UseRefreshToken(ctx, t.ID); err != nil {
+			// another exchange of the same token has just won
+			reused = t
+			return err
+		}
+		err = i.sessions.TouchSession(ctx, t.SessionID, client, i.now())
+		if errors.Is(err, domain.ErrSessionNotFound) {
+			// revoked in between
+			return domain.ErrInvalidRefreshToken
+		}
+		if err != nil {
+			return fmt.Errorf("RefreshTokens: failed to touch session: %w", err)
+		}
+
+		pair, err = i.issue(ctx, t.UserID, t.SessionID)
+		return err
+	})
+	if errors.Is(err, domain.ErrRefreshTokenReused) {
+		// the transaction is rolled back, so the session is revoked on its own
+		err := i.sessions.RevokeSession(ctx, reused.UserID, reused.SessionID)
+		if err != nil && !errors.Is(err, domain.ErrSessionNotFound) {
+			return domain.TokenPair{}, fmt.Errorf("RefreshTokens: failed to revoke session: %w", err)
+		}
+		i.log.WarnContext(ctx, "refresh token reused, the session is revoked", "userID", reused.UserID, "sessionID", reused.SessionID)
+		return domain.TokenPair{}, domain.ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return domain.TokenPair{}, err
+	}
+
+	return pair, nil
+}
+
+func (i *TokenIssuer) issue(ctx context.Context, userID, sessionID string) (domain.TokenPair, error) {
+	// the roles are read on every issue, so a change takes effect with the next refresh
+	roles, err := i.roles.GetRoles(ctx, userID)
+	if err != nil {
+		return domain.TokenPair{}, fmt.Errorf("IssueTokens: failed to get roles: %w", err)
+	}
+
+	now := i.now()
+	access, err := i.keys.Sign(jwt.Claims{
+		Issuer:    i.conf.Issuer,
+		Subject:   userID,
+		Type:      TokenTypeAccess,
+		ID:        i.newID(),
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(i.conf.AccessTTL).Unix(),
+		Roles:     roles,
+		SessionID: sessionID,
+	})
+	if err != nil {
+		return domain.TokenPair{}, fmt.Errorf("IssueTokens: %w", err)
+	}
+
+	refresh, err := newRefreshToken()
+	if err != nil {
+		return domain.TokenPair{}, fmt.Errorf("IssueTokens: %w", err)
+	}
+	err = i.refresh.CreateRefreshToken(ctx, domain.RefreshToken{
+		ID:        i.newID(),
+		SessionID: sessionID,
+		UserID:    userID,
+		Hash:      hashToken(refresh),
+		ExpiresAt: now.Add(i.conf.RefreshTTL).UTC(),
+	})
+	if err != nil {
+		return domain.TokenPair{}, err
+	}
+
+	return domain.TokenPair{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(i.conf.AccessTTL.Seconds()),
+	}, nil
+}
+
+func newRefreshToken() (string, error) {
+	b := make([]byte, refreshTokenSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken doesn't need a slow hash, the token is random unlike a password.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/pkg/jwt"
+	"github.com/dennypenta/go-api-walkthrough/repository/memory"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testIssuer struct {
+	*TokenIssuer
+	keys     *jwt.KeySet
+	users    *memory.UserRepository
+	sessions *memory.SessionRepository
+	roles    *domain.RoleService
+	now      time.Time
+}
+
+var testClient = domain.Client{Device: "laptop", UserAgent: "curl/8.0", IP: "192.0.2.1"}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+
+	ti := &testIssuer{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	clock := func() time.Time { return ti.now }
+	key, err := jwt.GenerateKey("1")
+	require.NoError(t, err)
+	ti.keys, err = jwt.NewKeySet(key, nil, clock)
+	require.NoError(t, err)
+
+	ti.users = memory.NewUserRepository(clock, uuid.NewString)
+	conf := TokenConfig{Issuer: "user-service", AccessTTL: 15 * time.Minute, RefreshTTL: 24 * time.Hour}
+	ti.roles = domain.NewRoleService(memory.NewRoleRepository(ti.users), memory.TxManager{})
+	ti.sessions = memory.NewSessionRepository(ti.users)
+	ti.TokenIssuer = NewTokenIssuer(ti.keys, memory.NewRefreshTokenRepository(ti.users, ti.sessions), ti.sessions, ti.roles, memory.TxManager{}, conf,
+		clock, uuid.NewString, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	return ti
+}
+
+func (ti *testIssuer) createUser(t *testing.T) string {
+	t.Helper()
+
+	user, err := ti.users.CreateUser(context.Background(), domain.User{Username: "alice"})
+	require.NoError(t, err)
+	return user.ID
+}
+
+func TestIssueTokens(t *testing.T) {
+	ti := newTestIssuer(t)
+	userID := ti.createUser(t)
+
+	pair, err := ti.IssueTokens(context.Background(), userID, testClient)
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer", pair.TokenType)
+	assert.Equal(t, 900, pair.ExpiresIn)
+
+	access, err := ti.keys.Verify(pair.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, "user-service", access.Issuer)
+	assert.Equal(t, userID, access.Subject)
+	assert.Equal(t, TokenTypeAccess, access.Type)
+	assert.Equal(t, ti.now.Add(15*time.Minute).Unix(), access.ExpiresAt)
+	assert.Equal(t, []string{domain.RoleMember}, access.Roles)
+
+	sessions, err := ti.sessions.ListSessions(context.Background(), userID)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, sessions[0].ID, access.SessionID)
+	assert.Equal(t, domain.Session{
+		ID:         access.SessionID,
+		UserID:     userID,
+		Device:     "laptop",
+		UserAgent:  "curl/8.0",
+		IP:         "192.0.2.1",
+		CreatedAt:  ti.now,
+		LastSeenAt: ti.now,
+	}, sessions[0])
+
+	// the refresh token is opaque
+	_, err = ti.keys.Verify(pair.RefreshToken)
+	assert.ErrorIs(t, err, jwt.ErrInvalidToken)
+}
+
+func TestRefreshTokensRotates(t *testing.T) {
+	ti := newTestIssuer(t)
+	ctx := context.Background()
+	userID := ti.createUser(t)
+
+	first, err := ti.IssueTokens(ctx, userID, testClient)
+	require.NoError(t, err)
+	ti.now = ti.now.Add(time.Hour)
+	moved := domain.Client{Device: "renamed", UserAgent: "Firefox", IP: "198.51.100.7"}
+	second, err := ti.RefreshTokens(ctx, first.RefreshToken, moved)
+	require.NoError(t, err)
+	assert.NotEqual(t, first.RefreshToken, second.RefreshToken)
+	access, err := ti.keys.Verify(second.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, userID, access.Subject)
+
+	// the session goes on and is seen from where the client is now
+	sessions, err := ti.sessions.ListSessions(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, sessions[0].ID, access.SessionID)
+	assert.Equal(t, "laptop", sessions[0].Device)
+	assert.Equal(t, "198.51.100.7", sessions[0].IP)
+	assert.Equal(t, ti.now, sessions[0].LastSeenAt)
+
+	// the granted roles come with the next refresh
+	require.NoError(t, ti.roles.SetRoles(ctx, userID, []string{domain.RoleSupport}))
+	third, err := ti.RefreshTokens(ctx, second.RefreshToken, testClient)
+	require.NoError(t, err)
+	access, err = ti.keys.Verify(third.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, []string{domain.RoleSupport}, access.Roles)
+
+	// the first token comes back, someone has a copy, the whole session is revoked
+	_, err = ti.RefreshTokens(ctx, first.RefreshToken, testClient)
+	assert.ErrorIs(t, err, domain.ErrInvalidRefreshToken)
+	_, err = ti.RefreshTokens(ctx, third.RefreshToken, testClient)
+	assert.ErrorIs(t, err, domain.ErrInvalidRefreshToken)
+	active, err := ti.sessions.IsSessionActive(ctx, access.SessionID)
+	require.NoError(t, err)
+	assert.False(t, active)
+
+	// the other sign ins go on
+	other, err := ti.IssueTokens(ctx, userID, testClient)
+	require.NoError(t, err)
+	_, err = ti.RefreshTokens(ctx, other.RefreshToken, testClient)
+	assert.NoError(t, err)
+}
+
+func TestRefreshTokensRejects(t *testing.T) {
+	ti := newTestIssuer(t)
+	ctx := context.Background()
+	userID := ti.createUser(t)
+
+	_, err := ti.RefreshTokens(ctx, "unknown", testClient)
+	assert.ErrorIs(t, err, domain.ErrInvalidRefreshToken)
+
+	pair, err := ti.IssueTokens(ctx, userID, testClient)
+	require.NoError(t, err)
+	ti.now = ti.now.Add(24 * time.Hour)
+	_, err = ti.RefreshTokens(ctx, pair.RefreshToken, testClient)
+	assert.ErrorIs(t, err, domain.ErrInvalidRefreshToken, "expired")
+
+	pair, err = ti.IssueTokens(ctx, userID, testClient)
+	require.NoError(t, err)
+	access, err := ti.keys.Verify(pair.AccessToken)
+	require.NoError(t, err)
+	require.NoError(t, ti.sessions.RevokeSession(ctx, userID, access.SessionID))
+	_, err = ti.RefreshTokens(ctx, pair.RefreshToken, testClient)
+	assert.ErrorIs(t, err, domain.ErrInvalidRefreshToken, "revoked session")
+
+	pair, err = ti.IssueTokens(ctx, userID, testClient)
+	require.NoError(t, err)
+	require.NoError(t, ti.users.DeleteUser(ctx, userID))
+	_, err = ti.RefreshTokens(ctx, pair.RefreshToken, testClient)
+	assert.ErrorIs(t, err, domain.ErrInvalidRefreshToken, "deleted user")
+}
@@ -0,0 +1,268 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/pkg/totp"
+)
+
+const (
+	// totpSkew accepts the codes of the steps next to the current one, the clocks of the phones drift
+	totpSkew = 1
+	// recoveryCodeCount is the amount of the codes given on enrollment, recoveryCodeSize is the random bytes of one
+	recoveryCodeCount = 10
+	recoveryCodeSize  = 10
+	// challengeTokenSize is the amount of random bytes in a challenge token
+	challengeTokenSize = 32
+)
+
+// recoveryCodeEncoding has no padding, the codes are written down by hand
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// UserSource gives the user the authenticator app names the account after.
+type UserSource interface {
+	GetUserByID(ctx context.Context, id string) (domain.User, error)
+}
+
+type TwoFactorConfig struct {
+	// Issuer names the service in the authenticator apps
+	Issuer       string
+	ChallengeTTL time.Duration
+	// MaxAttempts is the amount of the codes a challenge is tried with, the login starts over after that
+	MaxAttempts int
+}
+
+// TwoFactor is the TOTP second factor, https://www.rfc-editor.org/rfc/rfc6238.
+// A login of a user who has enabled it gets an opaque challenge instead of the tokens,
+// the challenge is passed once with a code of the app or a recovery code within a few attempts.
+// A code is accepted once: the step it belongs to is recorded and the codes of it and the earlier steps are refused.
+type TwoFactor struct {
+	repo  domain.TwoFactorRepository
+	users UserSource
+	tx    domain.TxManager
+	conf  TwoFactorConfig
+	now   func() time.Time
+	newID func() string
+}
+
+func NewTwoFactor(repo domain.TwoFactorRepository, users UserSource, tx domain.TxManager, conf TwoFactorConfig, now func() time.Time, newID func() string) *TwoFactor {
+	return &TwoFactor{
+		repo:  repo,
+		users: users,
+		tx:    tx,
+		conf:  conf,
+		now:   now,
+		newID: newID,
+	}
+}
+
+// EnrollTOTP starts the enrollment with a new secret replacing the one that isn't confirmed yet.
+func (f *TwoFactor) EnrollTOTP(ctx context.Context, userID string) (domain.TOTPEnrollment, error) {
+	u, err := f.users.GetUserByID(ctx, userID)
+	if err != nil {
+		return domain.TOTPEnrollment{}, err
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return domain.TOTPEnrollment{}, fmt.Errorf("EnrollTOTP: %w", err)
+	}
+	if err := f.repo.SetTOTPSecret(ctx, userID, secret); err != nil {
+		return domain.TOTPEnrollment{}, err
+	}
+
+	return domain.TOTPEnrollment{
+		Secret: secret,
+		URI:    totp.URI(f.conf.Issuer, u.Username, secret),
+	}, nil
+}
+
+// ConfirmTOTP enables the TOTP once the app shows the right code and returns the recovery codes,
+// only their hashes are stored, so they are shown this time only.
+func (f *TwoFactor) ConfirmTOTP(ctx context.Context, userID, code string) ([]string, error) {
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, fmt.Errorf("ConfirmTOTP: %w", err)
+	}
+
+	err = f.tx.WithinTx(ctx, func(ctx context.Context) error {
+		t, err := f.repo.GetTOTP(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if t.Enabled() {
+			return domain.ErrTOTPEnabled
+		}
+		if err := f.useTOTP(ctx, t, code); err != nil {
+			return err
+		}
+		return f.repo.EnableTOTP(ctx, userID, f.now(), hashes)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// RequireSecondFactor starts a challenge of the user who has the TOTP enabled.
+func (f *TwoFactor) RequireSecondFactor(ctx context.Context, userID string, client domain.Client) error {
+	t, err := f.repo.GetTOTP(ctx, userID)
+	if errors.Is(err, domain.ErrTOTPNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("RequireSecondFactor: failed to get totp: %w", err)
+	}
+	if !t.Enabled() {
+		return nil
+	}
+
+	token, err := newChallengeToken()
+	if err != nil {
+		return fmt.Errorf("RequireSecondFactor: %w", err)
+	}
+	now := f.now().UTC()
+	err = f.repo.CreateTwoFactorChallenge(ctx, domain.TwoFactorChallenge{
+		ID:        f.newID(),
+		UserID:    userID,
+		Hash:      hashToken(token),
+		Device:    client.Device,
+		CreatedAt: now,
+		ExpiresAt: now.Add(f.conf.ChallengeTTL),
+	})
+	if err != nil {
+		return fmt.Errorf("RequireSecondFactor: failed to create challenge: %w", err)
+	}
+
+	return &domain.TwoFactorRequiredError{
+		ChallengeToken: token,
+		ExpiresIn:      int(f.conf.ChallengeTTL.Seconds()),
+	}
+}
+
+// VerifySecondFactor takes a code of the app, 6 digits, or a recovery code, every try counts as an attempt.
+func (f *TwoFactor) VerifySecondFactor(ctx context.Context, challengeToken, code string) (string, string, error) {
+	c, err := f.repo.AttemptTwoFactorChallenge(ctx, hashToken(challengeToken), f.now(), f.conf.MaxAttempts)
+	if errors.Is(err, domain.ErrTwoFactorChallengeNotFound) {
+		return "", "", domain.ErrInvalidChallenge
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	t, err := f.repo.GetTOTP(ctx, c.UserID)
+	if errors.Is(err, domain.ErrTOTPNotFound) {
+		return "", "", domain.ErrInvalidTwoFactorCode
+	}
+	if err != nil {
+		return "", "", err
+	}
+	if !t.Enabled() {
+		return "", "", domain.ErrInvalidTwoFactorCode
+	}
+
+	if isTOTPCode(code) {
+		err = f.useTOTP(ctx, t, code)
+	} else {
+		err = f.useRecoveryCode(ctx, c.UserID, code)
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	// the challenge is passed once, a concurrent request with another code might have passed it already
+	err = f.repo.DeleteTwoFactorChallenge(ctx, c.ID)
+	if errors.Is(err, domain.ErrTwoFactorChallengeNotFound) {
+		return "", "", domain.ErrInvalidChallenge
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("VerifySecondFactor: failed to delete challenge: %w", err)
+	}
+
+	return c.UserID, c.Device, nil
+}
+
+// useTOTP records the step of a valid code, so neither it nor an earlier one is accepted again.
+func (f *TwoFactor) useTOTP(ctx context.Context, t domain.TOTP, code string) error {
+	step, ok, err := totp.Validate(t.Secret, code, f.now(), totpSkew)
+	if err != nil {
+		return fmt.Errorf("useTOTP: %w", err)
+	}
+	if !ok {
+		return domain.ErrInvalidTwoFactorCode
+	}
+
+	err = f.repo.UseTOTPStep(ctx, t.UserID, step)
+	if errors.Is(err, domain.ErrTOTPCodeUsed) {
+		return fmt.Errorf("%w: %w", domain.ErrInvalidTwoFactorCode, err)
+	}
+	return err
+}
+
+func (f *TwoFactor) useRecoveryCode(ctx context.Context, userID, code string) error {
+	err := f.repo.UseRecoveryCode(ctx, userID, hashToken(normalizeRecoveryCode(code)), f.now())
+	if errors.Is(err, domain.ErrRecoveryCodeNotFound) {
+		return domain.ErrInvalidTwoFactorCode
+	}
+	return err
+}
+
+func isTOTPCode(code string) bool {
+	if len(code) != totp.Digits {
+		return false
+	}
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// newRecoveryCodes returns the codes in groups of 4 characters, e.g. abcd-efgh-ijkl-mnop, and their hashes.
+func newRecoveryCodes() (codes, hashes []string, err error) {
+	b := make([]byte, recoveryCodeCount*recoveryCodeSize)
+	if _, err := rand.Read(b); err != nil {
+		return nil, nil, fmt.Errorf("failed to generate recovery codes: %w", err)
+	}
+
+	for i := 0; i < recoveryCodeCount; i++ {
+		code := strings.ToLower(recoveryCodeEncoding.EncodeToString(b[i*recoveryCodeSize : (i+1)*recoveryCodeSize]))
+		var groups []string
+		for len(code) > 0 {
+			n := min(4, len(code))
+			groups = append(groups, code[:n])
+			code = code[n:]
+		}
+		formatted := strings.Join(groups, "-")
+		codes = append(codes, formatted)
+		hashes = append(hashes, hashToken(normalizeRecoveryCode(formatted)))
+	}
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode accepts the code typed in any case and with or without the dashes.
+func normalizeRecoveryCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(code))
+}
+
+func newChallengeToken() (string, error) {
+	b := make([]byte, challengeTokenSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate challenge token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,173 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/pkg/totp"
+	"github.com/dennypenta/go-api-walkthrough/repository/memory"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testTwoFactor struct {
+	*TwoFactor
+	users *memory.UserRepository
+	now   time.Time
+}
+
+func newTestTwoFactor(t *testing.T) *testTwoFactor {
+	t.Helper()
+
+	tf := &testTwoFactor{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	clock := func() time.Time { return tf.now }
+	tf.users = memory.NewUserRepository(clock, uuid.NewString)
+	conf := TwoFactorConfig{Issuer: "user-service", ChallengeTTL: 5 * time.Minute, MaxAttempts: 3}
+	tf.TwoFactor = NewTwoFactor(memory.NewTwoFactorRepository(tf.users), tf.users, memory.TxManager{}, conf, clock, uuid.NewString)
+	return tf
+}
+
+// enroll enables the TOTP of a new user and returns the user, the secret and the recovery codes.
+func (tf *testTwoFactor) enroll(t *testing.T) (string, string, []string) {
+	t.Helper()
+
+	ctx := context.Background()
+	user, err := tf.users.CreateUser(ctx, domain.User{Username: "alice"})
+	require.NoError(t, err)
+	enrollment, err := tf.EnrollTOTP(ctx, user.ID)
+	require.NoError(t, err)
+	codes, err := tf.ConfirmTOTP(ctx, user.ID, tf.code(t, enrollment.Secret))
+	require.NoError(t, err)
+	// the next code is of another step
+	tf.now = tf.now.Add(totp.Period)
+	return user.ID, enrollment.Secret, codes
+}
+
+func (tf *testTwoFactor) code(t *testing.T, secret string) string {
+	t.Helper()
+
+	code, err := totp.Code(secret, totp.Step(tf.now))
+	require.NoError(t, err)
+	return code
+}
+
+func (tf *testTwoFactor) challenge(t *testing.T, userID string) string {
+	t.Helper()
+
+	err := tf.RequireSecondFactor(context.Background(), userID, testClient)
+	var required *domain.TwoFactorRequiredError
+	require.ErrorAs(t, err, &required)
+	assert.Equal(t, 300, required.ExpiresIn)
+	return required.ChallengeToken
+}
+
+func TestEnrollTOTP(t *testing.T) {
+	tf := newTestTwoFactor(t)
+	ctx := context.Background()
+	user, err := tf.users.CreateUser(ctx, domain.User{Username: "alice"})
+	require.NoError(t, err)
+
+	enrollment, err := tf.EnrollTOTP(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, totp.URI("user-service", "alice", enrollment.Secret), enrollment.URI)
+	// not enabled until it's confirmed
+	require.NoError(t, tf.RequireSecondFactor(ctx, user.ID, testClient))
+
+	_, err = tf.ConfirmTOTP(ctx, user.ID, "000000")
+	assert.ErrorIs(t, err, domain.ErrInvalidTwoFactorCode)
+
+	codes, err := tf.ConfirmTOTP(ctx, user.ID, tf.code(t, enrollment.Secret))
+	require.NoError(t, err)
+	require.Len(t, codes, recoveryCodeCount)
+	assert.Regexp(t, `^[a-z2-7]{4}-[a-z2-7]{4}-[a-z2-7]{4}-[a-z2-7]{4}$`, codes[0])
+	assert.NotEqual(t, codes[0], codes[1])
+
+	_, err = tf.ConfirmTOTP(ctx, user.ID, tf.code(t, enrollment.Secret))
+	assert.ErrorIs(t, err, domain.ErrTOTPEnabled)
+	_, err = tf.EnrollTOTP(ctx, user.ID)
+	assert.ErrorIs(t, err, domain.ErrTOTPEnabled)
+	_, err = tf.EnrollTOTP(ctx, uuid.NewString())
+	assert.ErrorIs(t, err, domain.ErrUserNotFound)
+}
+
+func TestVerifySecondFactor(t *testing.T) {
+	tf := newTestTwoFactor(t)
+	ctx := context.Background()
+	userID, secret, _ := tf.enroll(t)
+
+	challenge := tf.challenge(t, userID)
+	gotUser, device, err := tf.VerifySecondFactor(ctx, challenge, tf.code(t, secret))
+	require.NoError(t, err)
+	assert.Equal(t, userID, gotUser)
+	assert.Equal(t, "laptop", device)
+
+	// the challenge is passed once
+	_, _, err = tf.VerifySecondFactor(ctx, challenge, tf.code(t, secret))
+	assert.ErrorIs(t, err, domain.ErrInvalidChallenge)
+	_, _, err = tf.VerifySecondFactor(ctx, "unknown", tf.code(t, secret))
+	assert.ErrorIs(t, err, domain.ErrInvalidChallenge)
+}
+
+func TestVerifySecondFactorRefusesReplay(t *testing.T) {
+	tf := newTestTwoFactor(t)
+	ctx := context.Background()
+	userID, secret, _ := tf.enroll(t)
+	code := tf.code(t, secret)
+
+	_, _, err := tf.VerifySecondFactor(ctx, tf.challenge(t, userID), code)
+	require.NoError(t, err)
+
+	// the same code within its time window
+	_, _, err = tf.VerifySecondFactor(ctx, tf.challenge(t, userID), code)
+	assert.ErrorIs(t, err, domain.ErrInvalidTwoFactorCode)
+
+	// the code of the previous step is still in the window, but it's older than the used one
+	previous, err := totp.Code(secret, totp.Step(tf.now)-1)
+	require.NoError(t, err)
+	_, _, err = tf.VerifySecondFactor(ctx, tf.challenge(t, userID), previous)
+	assert.ErrorIs(t, err, domain.ErrInvalidTwoFactorCode)
+
+	tf.now = tf.now.Add(totp.Period)
+	_, _, err = tf.VerifySecondFactor(ctx, tf.challenge(t, userID), tf.code(t, secret))
+	require.NoError(t, err)
+}
+
+func TestVerifySecondFactorWithRecoveryCode(t *testing.T) {
+	tf := newTestTwoFactor(t)
+	ctx := context.Background()
+	userID, _, codes := tf.enroll(t)
+
+	// typed without the dashes and in upper case
+	typed := strings.ToUpper(strings.ReplaceAll(codes[0], "-", ""))
+	_, _, err := tf.VerifySecondFactor(ctx, tf.challenge(t, userID), typed)
+	require.NoError(t, err)
+
+	_, _, err = tf.VerifySecondFactor(ctx, tf.challenge(t, userID), codes[0])
+	assert.ErrorIs(t, err, domain.ErrInvalidTwoFactorCode)
+	_, _, err = tf.VerifySecondFactor(ctx, tf.challenge(t, userID), codes[1])
+	require.NoError(t, err)
+}
+
+func TestVerifySecondFactorAttempts(t *testing.T) {
+	tf := newTestTwoFactor(t)
+	ctx := context.Background()
+	userID, secret, _ := tf.enroll(t)
+
+	challenge := tf.challenge(t, userID)
+	for i := 0; i < 3; i++ {
+		_, _, err := tf.VerifySecondFactor(ctx, challenge, "000000")
+		assert.ErrorIs(t, err, domain.ErrInvalidTwoFactorCode)
+	}
+	// out of attempts even with the right code
+	_, _, err := tf.VerifySecondFactor(ctx, challenge, tf.code(t, secret))
+	assert.ErrorIs(t, err, domain.ErrInvalidChallenge)
+
+	challenge = tf.challenge(t, userID)
+	tf.now = tf.now.Add(5 * time.Minute)
+	_, _, err = tf.VerifySecondFactor(ctx, challenge, tf.code(t, secret))
+	assert.ErrorIs(t, err, domain.ErrInvalidChallenge)
+}
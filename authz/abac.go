@@ -0,0 +1,231 @@
+package authz
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+	"gopkg.in/yaml.v3"
+)
+
+// The effects of a rule, a matching deny wins over any allow.
+const (
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+)
+
+// anyAction in the actions of a rule matches every action.
+const anyAction = "*"
+
+// Rule applies to its actions when the condition holds.
+// The condition is an expr expression, https://expr-lang.org, over subject, resource and action,
+// e.g. `subject.id == resource.id` or `"support" in subject.roles && subject.tenant == "acme"`.
+type Rule struct {
+	Name    string   `yaml:"name"`
+	Effect  string   `yaml:"effect"`
+	Actions []string `yaml:"actions"`
+	// Condition is true when it's empty
+	Condition string `yaml:"condition"`
+
+	program *vm.Program
+}
+
+// Policy is a set of rules: a matching deny rule denies, otherwise a matching allow rule allows,
+// nothing is allowed by default.
+type Policy struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// env is what the conditions see.
+type env struct {
+	Subject  subject  `expr:"subject"`
+	Resource resource `expr:"resource"`
+	Action   string   `expr:"action"`
+}
+
+type subject struct {
+	ID     string   `expr:"id"`
+	Roles  []string `expr:"roles"`
+	Scopes []string `expr:"scopes"`
+	Tenant string   `expr:"tenant"`
+}
+
+// resource is the user the action is about, its fields are empty when the action isn't about a particular user.
+type resource struct {
+	ID       string `expr:"id"`
+	Username string `expr:"username"`
+}
+
+// ParsePolicy reads the yaml policy and compiles the conditions, so a broken rule fails here and not on a request.
+func ParsePolicy(data []byte) (*Policy, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	var p Policy
+	if err := dec.Decode(&p); err != nil {
+		return nil, fmt.Errorf("ParsePolicy: failed to decode policy: %w", err)
+	}
+
+	names := make(map[string]bool, len(p.Rules))
+	for i := range p.Rules {
+		r := &p.Rules[i]
+		if r.Name == "" || names[r.Name] {
+			return nil, fmt.Errorf("ParsePolicy: rule %d must have a unique name", i+1)
+		}
+		names[r.Name] = true
+		if r.Effect != EffectAllow && r.Effect != EffectDeny {
+			return nil, fmt.Errorf("ParsePolicy: rule %q: unknown effect %q, expected %s or %s", r.Name, r.Effect, EffectAllow, EffectDeny)
+		}
+		if len(r.Actions) == 0 {
+			return nil, fmt.Errorf("ParsePolicy: rule %q has no actions", r.Name)
+		}
+		for _, a := range r.Actions {
+			if a == anyAction {
+				continue
+			}
+			if err := domain.ValidateAction(a); err != nil {
+				return nil, fmt.Errorf("ParsePolicy: rule %q: %w", r.Name, err)
+			}
+		}
+
+		condition := r.Condition
+		if condition == "" {
+			condition = "true"
+		}
+		program, err := expr.Compile(condition, expr.Env(env{}), expr.AsBool())
+		if err != nil {
+			return nil, fmt.Errorf("ParsePolicy: rule %q: %w", r.Name, err)
+		}
+		r.program = program
+	}
+
+	return &p, nil
+}
+
+func (p *Policy) Decide(s domain.Principal, action string, u domain.User) domain.Decision {
+	e := env{
+		Subject:  subject{ID: s.ID, Roles: s.Roles, Scopes: s.Scopes, Tenant: s.TenantID},
+		Resource: resource{ID: u.ID, Username: u.Username},
+		Action:   action,
+	}
+
+	var allowedBy string
+	for _, r := range p.Rules {
+		if !slices.Contains(r.Actions, action) && !slices.Contains(r.Actions, anyAction) {
+			continue
+		}
+		if r.Effect == EffectAllow && allowedBy != "" {
+			continue
+		}
+
+		out, err := expr.Run(r.program, e)
+		if err != nil {
+			// a deny rule failing to evaluate denies, the policy fails closed
+			if r.Effect == EffectDeny {
+				return domain.Decision{Rule: r.Name, Reason: fmt.Sprintf("rule %q failed: %s", r.Name, err)}
+			}
+			continue
+		}
+		if !out.(bool) {
+			continue
+		}
+		if r.Effect == EffectDeny {
+			return domain.Decision{Rule: r.Name, Reason: fmt.Sprintf("denied by rule %q", r.Name)}
+		}
+		allowedBy = r.Name
+	}
+
+	if allowedBy == "" {
+		return domain.Decision{Reason: "no rule allows " + action}
+	}
+	return domain.Decision{Allowed: true, Rule: allowedBy, Reason: fmt.Sprintf("allowed by rule %q", allowedBy)}
+}
+
+// ABAC decides with the policy of a local file, Watch reloads it when the file changes.
+type ABAC struct {
+	path   string
+	policy atomic.Pointer[Policy]
+	log    *slog.Logger
+
+	// mu guards the state of the loaded file
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+}
+
+// LoadABAC reads the policy file, it fails if the policy is invalid.
+func LoadABAC(path string, l *slog.Logger) (*ABAC, error) {
+	a := &ABAC{
+		path: path,
+		log:  l,
+	}
+	if _, err := a.Reload(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *ABAC) Decide(s domain.Principal, action string, u domain.User) domain.Decision {
+	return a.policy.Load().Decide(s, action, u)
+}
+
+// Reload reads the file again if it has changed since the last load, it reports whether the policy is replaced.
+// An invalid file keeps the previous policy.
+func (a *ABAC) Reload() (bool, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	info, err := os.Stat(a.path)
+	if err != nil {
+		return false, fmt.Errorf("Reload: %w", err)
+	}
+	if a.policy.Load() != nil && info.ModTime().Equal(a.modTime) && info.Size() == a.size {
+		return false, nil
+	}
+
+	data, err := os.ReadFile(a.path)
+	if err != nil {
+		return false, fmt.Errorf("Reload: %w", err)
+	}
+	p, err := ParsePolicy(data)
+	if err != nil {
+		return false, fmt.Errorf("Reload: %s: %w", a.path, err)
+	}
+
+	a.policy.Store(p)
+	a.modTime = info.ModTime()
+	a.size = info.Size()
+	return true, nil
+}
+
+// Watch checks the file every interval until ctx is done.
+// A failed reload is logged and retried, the requests go on with the previous policy meanwhile.
+func (a *ABAC) Watch(ctx context.Context, interval time.Duration) error {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+		}
+
+		reloaded, err := a.Reload()
+		if err != nil {
+			a.log.ErrorContext(ctx, "failed to reload authorization policy, the previous one is kept", "err", err)
+			continue
+		}
+		if reloaded {
+			a.log.InfoContext(ctx, "authorization policy reloaded", "path", a.path, "rules", len(a.policy.Load().Rules))
+		}
+	}
+}
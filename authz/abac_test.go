@@ -0,0 +1,108 @@
+package authz
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicyDecide(t *testing.T) {
+	data, err := os.ReadFile("testdata/policy.yaml")
+	require.NoError(t, err)
+	p, err := ParsePolicy(data)
+	require.NoError(t, err)
+
+	alice := domain.User{ID: "1", Username: "alice"}
+	system := domain.User{ID: "2", Username: "system-mailer"}
+	admin := domain.Principal{ID: "3", Roles: []string{domain.RoleAdmin}}
+	support := func(tenant string) domain.Principal {
+		return domain.Principal{ID: "4", Roles: []string{domain.RoleSupport}, TenantID: tenant}
+	}
+
+	type testCase struct {
+		name     string
+		subject  domain.Principal
+		action   string
+		resource domain.User
+		expected domain.Decision
+	}
+	for _, tt := range []testCase{
+		{"admin deletes", admin, domain.ActionDeleteUser, alice,
+			domain.Decision{Allowed: true, Rule: "admins-do-everything", Reason: `allowed by rule "admins-do-everything"`}},
+		{"deny wins over allow", admin, domain.ActionDeleteUser, system,
+			domain.Decision{Rule: "system-users-are-protected", Reason: `denied by rule "system-users-are-protected"`}},
+		{"support of the tenant", support("acme"), domain.ActionListUsers, domain.User{},
+			domain.Decision{Allowed: true, Rule: "support-reads-own-tenant", Reason: `allowed by rule "support-reads-own-tenant"`}},
+		{"support of another tenant", support("globex"), domain.ActionListUsers, domain.User{},
+			domain.Decision{Reason: "no rule allows users:list"}},
+		{"user updates itself", domain.Principal{ID: "1"}, domain.ActionUpdateUser, alice,
+			domain.Decision{Allowed: true, Rule: "users-read-themselves", Reason: `allowed by rule "users-read-themselves"`}},
+		{"user deletes itself", domain.Principal{ID: "1"}, domain.ActionDeleteUser, alice,
+			domain.Decision{Reason: "no rule allows users:delete"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, p.Decide(tt.subject, tt.action, tt.resource))
+		})
+	}
+}
+
+func TestParsePolicyRejects(t *testing.T) {
+	for name, policy := range map[string]string{
+		"unknown effect":  `rules: [{name: a, effect: permit, actions: [users:read]}]`,
+		"unknown action":  `rules: [{name: a, effect: allow, actions: [users:drop]}]`,
+		"no actions":      `rules: [{name: a, effect: allow}]`,
+		"duplicate name":  `rules: [{name: a, effect: allow, actions: ["*"]}, {name: a, effect: deny, actions: ["*"]}]`,
+		"unknown field":   `rules: [{name: a, effect: allow, actions: ["*"], when: "true"}]`,
+		"syntax error":    `rules: [{name: a, effect: allow, actions: ["*"], condition: "subject.id =="}]`,
+		"not a boolean":   `rules: [{name: a, effect: allow, actions: ["*"], condition: "subject.id"}]`,
+		"unknown subject": `rules: [{name: a, effect: allow, actions: ["*"], condition: "subject.email == ''"}]`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParsePolicy([]byte(policy))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestABACReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	write := func(policy string, modTime time.Time) {
+		require.NoError(t, os.WriteFile(path, []byte(policy), 0o600))
+		require.NoError(t, os.Chtimes(path, modTime, modTime))
+	}
+	now := time.Now()
+	write(`rules: [{name: read, effect: allow, actions: [users:read]}]`, now)
+
+	a, err := LoadABAC(path, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.NoError(t, err)
+	assert.True(t, a.Decide(domain.Principal{}, domain.ActionReadUser, domain.User{}).Allowed)
+
+	reloaded, err := a.Reload()
+	require.NoError(t, err)
+	assert.False(t, reloaded, "the file hasn't changed")
+
+	// a broken file keeps the previous policy
+	write(`rules: [{name: read, effect: allow, actions: [users:read], condition: "subject."}]`, now.Add(time.Second))
+	_, err = a.Reload()
+	assert.Error(t, err)
+	assert.True(t, a.Decide(domain.Principal{}, domain.ActionReadUser, domain.User{}).Allowed)
+
+	write(`rules: [{name: list, effect: allow, actions: [users:list]}]`, now.Add(2*time.Second))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- a.Watch(ctx, time.Millisecond) }()
+	assert.Eventually(t, func() bool {
+		return !a.Decide(domain.Principal{}, domain.ActionReadUser, domain.User{}).Allowed
+	}, time.Second, time.Millisecond)
+	assert.True(t, a.Decide(domain.Principal{}, domain.ActionListUsers, domain.User{}).Allowed)
+	cancel()
+	assert.NoError(t, <-done)
+}
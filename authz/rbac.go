@@ -0,0 +1,138 @@
+// Package authz decides what the authenticated callers may do.
+package authz
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+)
+
+// Permission is an operation a route needs.
+type Permission string
+
+const (
+	// Public routes are open to the anonymous requests.
+	Public Permission = ""
+	// Authenticated routes are open to any principal, e.g. the ones working on the principal itself.
+	Authenticated Permission = "authenticated"
+
+	ReadUser       Permission = domain.ActionReadUser
+	ListUsers      Permission = domain.ActionListUsers
+	CreateUser     Permission = domain.ActionCreateUser
+	UpdateUser     Permission = domain.ActionUpdateUser
+	DeleteUser     Permission = domain.ActionDeleteUser
+	RestoreUser    Permission = domain.ActionRestoreUser
+	SetCredentials Permission = "users:credentials"
+	SetRoles       Permission = "users:roles"
+	// ReadRoles isn't an action of domain.UserService, the role grants decide it even with the ABAC policy.
+	ReadRoles Permission = "users:roles:read"
+	// VerifyEmail mails a verification token to the email of the user.
+	VerifyEmail Permission = "users:email"
+	// CheckAccess is the dry run of the policy for any subject.
+	CheckAccess Permission = "authz:check"
+	// ManageAPIKeys creates, lists and revokes the api keys.
+	ManageAPIKeys Permission = "apikeys:manage"
+)
+
+// Grant gives a permission, Own limits it to the principal's own user.
+type Grant struct {
+	Permission Permission
+	Own        bool
+}
+
+// RoleGrants is the RBAC policy, a principal has the grants of all its roles.
+var RoleGrants = map[string][]Grant{
+	domain.RoleMember: {
+		{Permission: ReadUser, Own: true},
+		{Permission: ReadRoles, Own: true},
+		{Permission: UpdateUser, Own: true},
+		{Permission: SetCredentials, Own: true},
+		{Permission: VerifyEmail, Own: true},
+	},
+	domain.RoleSupport: {
+		{Permission: ReadUser},
+		{Permission: ReadRoles},
+		{Permission: ListUsers},
+		{Permission: RestoreUser},
+		{Permission: UpdateUser, Own: true},
+		{Permission: SetCredentials, Own: true},
+		{Permission: VerifyEmail, Own: true},
+	},
+	domain.RoleAdmin: {
+		{Permission: ReadUser},
+		{Permission: ListUsers},
+		{Permission: CreateUser},
+		{Permission: UpdateUser},
+		{Permission: DeleteUser},
+		{Permission: RestoreUser},
+		{Permission: SetCredentials},
+		{Permission: VerifyEmail},
+		{Permission: ReadRoles},
+		{Permission: SetRoles},
+		{Permission: CheckAccess},
+		{Permission: ManageAPIKeys},
+	},
+}
+
+// RBAC checks the permissions against the grants of the roles,
+// an api key has no roles and is granted the actions of its scopes instead.
+type RBAC struct {
+	grants map[string][]Grant
+	// delegate lets the domain actions through, the user service decides them
+	delegate bool
+}
+
+func NewRBAC(grants map[string][]Grant) *RBAC {
+	return &RBAC{
+		grants: grants,
+	}
+}
+
+// DelegateActions makes Allowed let any principal through on the actions of domain.UserService,
+// it's used when the service enforces another policy, e.g. ABAC, the roles don't limit it then.
+func (a *RBAC) DelegateActions() *RBAC {
+	a.delegate = true
+	return a
+}
+
+// Allowed tells whether the principal may use the permission on the user with the resource id,
+// the id is empty when the operation isn't about a particular user.
+func (a *RBAC) Allowed(p domain.Principal, perm Permission, resourceID string) bool {
+	if perm == Public || perm == Authenticated {
+		return true
+	}
+	if a.delegate && domain.ValidateAction(string(perm)) == nil {
+		return true
+	}
+	return a.granted(p, perm, resourceID)
+}
+
+// Decide makes the grants the policy of domain.UserService, the service enforces it unless there is the ABAC one.
+func (a *RBAC) Decide(p domain.Principal, action string, resource domain.User) domain.Decision {
+	holder := fmt.Sprintf("the roles %v", p.Roles)
+	if p.APIKeyID != "" {
+		holder = fmt.Sprintf("the scopes %v", p.Scopes)
+	}
+	if a.granted(p, Permission(action), resource.ID) {
+		return domain.Decision{Allowed: true, Reason: "granted to " + holder}
+	}
+	return domain.Decision{Reason: fmt.Sprintf("%s aren't granted %s", holder, action)}
+}
+
+func (a *RBAC) granted(p domain.Principal, perm Permission, resourceID string) bool {
+	if p.APIKeyID != "" {
+		return slices.Contains(p.Scopes, string(perm))
+	}
+	for _, role := range p.Roles {
+		for _, g := range a.grants[role] {
+			if g.Permission != perm {
+				continue
+			}
+			if !g.Own || (resourceID != "" && resourceID == p.ID) {
+				return true
+			}
+		}
+	}
+	return false
+}
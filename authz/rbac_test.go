@@ -0,0 +1,89 @@
+package authz
+
+import (
+	"testing"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRBAC(t *testing.T) {
+	const self, other = "1", "2"
+	rbac := NewRBAC(RoleGrants)
+	principal := func(roles ...string) domain.Principal {
+		return domain.Principal{ID: self, Roles: roles}
+	}
+	apiKey := func(scopes ...Permission) domain.Principal {
+		p := domain.Principal{ID: "key", APIKeyID: "key"}
+		for _, s := range scopes {
+			p.Scopes = append(p.Scopes, string(s))
+		}
+		return p
+	}
+
+	type testCase struct {
+		name       string
+		principal  domain.Principal
+		permission Permission
+		resourceID string
+		expected   bool
+	}
+	for _, tt := range []testCase{
+		{"member reads itself", principal(domain.RoleMember), ReadUser, self, true},
+		{"member reads another user", principal(domain.RoleMember), ReadUser, other, false},
+		{"member updates itself", principal(domain.RoleMember), UpdateUser, self, true},
+		{"member lists users", principal(domain.RoleMember), ListUsers, "", false},
+		{"member deletes itself", principal(domain.RoleMember), DeleteUser, self, false},
+		{"member verifies its email", principal(domain.RoleMember), VerifyEmail, self, true},
+		{"member verifies another email", principal(domain.RoleMember), VerifyEmail, other, false},
+		{"support reads another user", principal(domain.RoleSupport), ReadUser, other, true},
+		{"member reads its roles", principal(domain.RoleMember), ReadRoles, self, true},
+		{"member reads roles of another user", principal(domain.RoleMember), ReadRoles, other, false},
+		{"support restores", principal(domain.RoleSupport), RestoreUser, other, true},
+		{"support updates another user", principal(domain.RoleSupport), UpdateUser, other, false},
+		{"support deletes", principal(domain.RoleSupport), DeleteUser, other, false},
+		{"admin deletes", principal(domain.RoleAdmin), DeleteUser, other, true},
+		{"admin sets roles", principal(domain.RoleAdmin), SetRoles, self, true},
+		{"roles add up", principal(domain.RoleMember, domain.RoleSupport), ListUsers, "", true},
+		{"no roles", principal(), ReadUser, self, false},
+		{"unknown role", principal("root"), ReadUser, self, false},
+		{"authenticated", principal(), Authenticated, "", true},
+		{"key scope", apiKey(ListUsers), ListUsers, "", true},
+		{"key scope on any user", apiKey(ReadUser), ReadUser, other, true},
+		{"key without scope", apiKey(ReadUser), DeleteUser, other, false},
+		{"key manages keys", apiKey(ReadUser), ManageAPIKeys, "", false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, rbac.Allowed(tt.principal, tt.permission, tt.resourceID))
+		})
+	}
+}
+
+func TestRBACDecide(t *testing.T) {
+	rbac := NewRBAC(RoleGrants)
+	member := domain.Principal{ID: "1", Roles: []string{domain.RoleMember}}
+
+	assert.Equal(t, domain.Decision{Allowed: true, Reason: "granted to the roles [member]"},
+		rbac.Decide(member, domain.ActionUpdateUser, domain.User{ID: "1"}))
+	assert.Equal(t, domain.Decision{Reason: "the roles [member] aren't granted users:update"},
+		rbac.Decide(member, domain.ActionUpdateUser, domain.User{ID: "2"}))
+
+	key := domain.Principal{ID: "key", APIKeyID: "key", Scopes: []string{domain.ActionReadUser}}
+	assert.Equal(t, domain.Decision{Allowed: true, Reason: "granted to the scopes [users:read]"},
+		rbac.Decide(key, domain.ActionReadUser, domain.User{ID: "2"}))
+	assert.Equal(t, domain.Decision{Reason: "the scopes [users:read] aren't granted users:delete"},
+		rbac.Decide(key, domain.ActionDeleteUser, domain.User{ID: "2"}))
+}
+
+func TestRBACDelegateActions(t *testing.T) {
+	rbac := NewRBAC(RoleGrants).DelegateActions()
+	member := domain.Principal{ID: "1", Roles: []string{domain.RoleMember}}
+
+	// the user service decides its actions
+	assert.True(t, rbac.Allowed(member, DeleteUser, "2"))
+	assert.False(t, rbac.Allowed(member, SetRoles, "1"))
+	// the roles aren't the service's, a member reads its own only
+	assert.False(t, rbac.Allowed(member, ReadRoles, "2"))
+	assert.True(t, rbac.Allowed(member, ReadRoles, "1"))
+	assert.False(t, rbac.Allowed(member, CheckAccess, ""))
+}
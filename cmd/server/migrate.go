@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/dennypenta/go-api-walkthrough/assembly"
+	"github.com/dennypenta/go-api-walkthrough/pkg/log"
+)
+
+const (
+	exitOK      = 0
+	exitFailure = 1
+	exitUsage   = 2
+	// the schema must be fixed manually and forced to a version
+	exitDirtySchema = 3
+	// another replica holds the migration lock for too long
+	exitLockTimeout = 4
+)
+
+func runMigrate(conf assembly.Config, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return exitUsage
+	}
+	cmd, args := args[0], args[1:]
+
+	// every command except up, version and status expects a number argument
+	var num int
+	switch cmd {
+	case "up", "version", "status":
+		if len(args) != 0 {
+			fmt.Fprint(os.Stderr, usage)
+			return exitUsage
+		}
+	case "down", "goto", "force":
+		if len(args) != 1 {
+			fmt.Fprint(os.Stderr, usage)
+			return exitUsage
+		}
+		var err error
+		num, err = strconv.Atoi(args[0])
+		if err != nil || num < 0 || (cmd == "down" && num == 0) {
+			fmt.Fprintf(os.Stderr, "invalid %s argument: %q\n", cmd, args[0])
+			return exitUsage
+		}
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return exitUsage
+	}
+
+	ctx := context.Background()
+	l := log.NewLogger(os.Stderr, conf.LogLevel)
+	m, err := assembly.NewMigrator(ctx, conf, assembly.WithLogger(l))
+	if err != nil {
+		l.ErrorContext(ctx, "failed to create migrator", "err", err)
+		return exitCode(err)
+	}
+	defer func() {
+		if err := m.Close(); err != nil {
+			l.ErrorContext(ctx, "failed to close migrator", "err", err)
+		}
+	}()
+
+	switch cmd {
+	case "up":
+		err = m.Up(ctx)
+	case "down":
+		err = m.Down(ctx, num)
+	case "goto":
+		err = m.Goto(ctx, uint(num))
+	case "force":
+		err = m.Force(ctx, num)
+	case "version":
+		err = printVersion(m)
+	case "status":
+		err = printStatus(m)
+	}
+	if err != nil {
+		l.ErrorContext(ctx, "migrate command failed", "cmd", cmd, "err", err)
+		return exitCode(err)
+	}
+
+	return exitOK
+}
+
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, assembly.ErrDirtySchema):
+		return exitDirtySchema
+	case errors.Is(err, assembly.ErrMigrationLockTimeout):
+		return exitLockTimeout
+	default:
+		return exitFailure
+	}
+}
+
+func printVersion(m *assembly.Migrator) error {
+	version, dirty, err := m.Version()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("version: %d, dirty: %t\n", version, dirty)
+	return nil
+}
+
+func printStatus(m *assembly.Migrator) error {
+	if err := printVersion(m); err != nil {
+		return err
+	}
+	fmt.Printf("expected version: %d\n", m.ExpectedVersion())
+
+	statuses, err := m.Status()
+	if err != nil {
+		return err
+	}
+	for _, s := range statuses {
+		state := "pending"
+		switch {
+		case s.Dirty:
+			state = "dirty"
+		case s.Applied:
+			state = "applied"
+		}
+		fmt.Printf("%04d %-40s %s\n", s.Version, s.Name, state)
+	}
+
+	return nil
+}
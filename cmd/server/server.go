@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/dennypenta/go-api-walkthrough/assembly"
+	"github.com/dennypenta/go-api-walkthrough/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"golang.org/x/sync/errgroup"
+)
+
+func runServer(conf assembly.Config) {
+	ctx := context.Background()
+	ctx, cancel := context.WithCancel(ctx)
+
+	app, err := assembly.NewApp(ctx, conf)
+	if err != nil {
+		log.Println("failed to create app:", err)
+		os.Exit(exitCode(err))
+	}
+
+	metricsObj := metrics.NewMetrics(app.Registry)
+	metricsHandler := promhttp.HandlerFor(app.Registry, promhttp.HandlerOpts{})
+	metricsMux := http.NewServeMux()
+	metricsMux.Handle("/metrics", metricsHandler)
+	metircsServer := &http.Server{Addr: ":8081", Handler: metricsMux}
+	metricsMiddleware := metrics.NewMetricsMiddleware(metricsObj)
+
+	server := &http.Server{Addr: ":" + conf.HttpPort, Handler: metricsMiddleware(app.Mux)}
+
+	g, ctx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		// a signal or any failing member of the group shuts the servers down
+		ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+		<-ctx.Done()
+		cancel()
+
+		app.Log.InfoContext(ctx, "shutting down server")
+		if err := server.Shutdown(ctx); err != nil {
+			app.Log.ErrorContext(ctx, "failed to shutdown server", "err", err)
+		}
+		// make sure the metrics are collected
+		if err := metircsServer.Shutdown(ctx); err != nil {
+			app.Log.ErrorContext(ctx, "failed to shutdown metrics server", "err", err)
+		}
+		return app.Close(ctx)
+	})
+	g.Go(func() error {
+		app.Log.InfoContext(ctx, "server has been started", "port", conf.HttpPort)
+		if err := server.ListenAndServe(); err != nil {
+			if errors.Is(err, http.ErrServerClosed) {
+				app.Log.InfoContext(ctx, "server closed")
+				return nil
+			}
+			app.Log.ErrorContext(ctx, "server error", "err", err)
+
+			return err
+		}
+
+		return nil
+	})
+	g.Go(func() error {
+		return app.RunWorkers(ctx)
+	})
+	g.Go(func() error {
+		app.Log.InfoContext(ctx, "metrics server has been started", "port", "8081")
+		if err := metircsServer.ListenAndServe(); err != nil {
+			if errors.Is(err, http.ErrServerClosed) {
+				app.Log.InfoContext(ctx, "metrics server closed")
+				return nil
+			}
+			app.Log.ErrorContext(ctx, "metrics server error", "err", err)
+
+			return err
+		}
+
+		return nil
+	})
+	if err := g.Wait(); err != nil {
+		app.Log.ErrorContext(ctx, "server stopped", "err", err)
+		os.Exit(1)
+	}
+
+	app.Log.InfoContext(ctx, "server stopped")
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/fixtures"
+)
+
+// errDryRun rolls back the transaction a dry run tries the command in.
+var errDryRun = errors.New("dry run")
+
+type cli struct {
+	service *domain.UserService
+	roles   *domain.RoleService
+	auth    *domain.AuthService
+	seeder  fixtures.Seeder
+	tx      domain.TxManager
+	in      io.Reader
+	out     io.Writer
+	format  string
+	dryRun  bool
+
+	limit  int
+	offset int
+}
+
+func (c *cli) run(ctx context.Context, cmd string, args []string) error {
+	switch cmd {
+	case "create":
+		if len(args) != 1 {
+			return errUsage
+		}
+		return c.create(ctx, args[0])
+	case "get":
+		if len(args) != 1 {
+			return errUsage
+		}
+		return c.get(ctx, args[0])
+	case "list":
+		if len(args) != 0 || c.limit <= 0 || c.offset < 0 {
+			return errUsage
+		}
+		return c.list(ctx)
+	case "rename":
+		if len(args) != 2 {
+			return errUsage
+		}
+		return c.rename(ctx, args[0], args[1])
+	case "delete":
+		if len(args) != 1 {
+			return errUsage
+		}
+		return c.delete(ctx, args[0])
+	case "restore":
+		if len(args) != 1 {
+			return errUsage
+		}
+		return c.restore(ctx, args[0])
+	case "import":
+		if len(args) != 1 {
+			return errUsage
+		}
+		return c.importFile(ctx, args[0])
+	case "seed":
+		if len(args) == 0 {
+			return errUsage
+		}
+		return c.seed(ctx, args)
+	case "roles":
+		if len(args) == 0 {
+			return errUsage
+		}
+		if len(args) == 1 {
+			return c.getRoles(ctx, args[0])
+		}
+		return c.setRoles(ctx, args[0], args[1:])
+	case "credentials":
+		if len(args) != 2 {
+			return errUsage
+		}
+		return c.credentials(ctx, args[0], args[1])
+	default:
+		return errUsage
+	}
+}
+
+func (c *cli) create(ctx context.Context, username string) error {
+	user := domain.User{Username: username}
+	if c.dryRun {
+		if err := user.Validate(); err != nil {
+			return err
+		}
+		return c.note("would create user %q", username)
+	}
+
+	user, err := c.service.CreateUser(ctx, user)
+	if err != nil {
+		return err
+	}
+	return writeUsers(c.out, c.format, []domain.User{user})
+}
+
+func (c *cli) get(ctx context.Context, id string) error {
+	user, err := c.service.GetUserByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	return writeUsers(c.out, c.format, []domain.User{user})
+}
+
+func (c *cli) list(ctx context.Context) error {
+	list, err := c.service.ListUsers(ctx, domain.UserFilter{Limit: c.limit, Offset: c.offset})
+	if err != nil {
+		return err
+	}
+	if c.format == formatJSON {
+		// keep the pagination details the same as the http api returns
+		return writeJSON(c.out, list)
+	}
+	return writeUsers(c.out, c.format, list.Users)
+}
+
+func (c *cli) rename(ctx context.Context, id, username string) error {
+	if c.dryRun {
+		user, err := c.service.GetUserByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		user.Username = username
+		if err := user.Validate(); err != nil {
+			return err
+		}
+		return c.note("would rename user %s to %q", id, username)
+	}
+
+	// the email and its verification stay
+	user, err := c.service.RenameUser(ctx, id, username)
+	if err != nil {
+		return err
+	}
+	return writeUsers(c.out, c.format, []domain.User{user})
+}
+
+func (c *cli) delete(ctx context.Context, id string) error {
+	if c.dryRun {
+		if _, err := c.service.GetUserByID(ctx, id); err != nil {
+			return err
+		}
+		return c.note("would delete user %s", id)
+	}
+
+	if err := c.service.DeleteUser(ctx, id); err != nil {
+		return err
+	}
+	return c.note("user %s deleted", id)
+}
+
+func (c *cli) restore(ctx context.Context, id string) error {
+	if c.dryRun {
+		// the deleted users can't be read, so the restore is tried and rolled back,
+		// an unknown user, a user that isn't deleted and a taken email fail as they would
+		err := c.tx.WithinTx(ctx, func(ctx context.Context) error {
+			if err := c.service.RestoreUser(ctx, id); err != nil {
+				return err
+			}
+			return errDryRun
+		})
+		if !errors.Is(err, errDryRun) {
+			return err
+		}
+		return c.note("would restore user %s", id)
+	}
+
+	if err := c.service.RestoreUser(ctx, id); err != nil {
+		return err
+	}
+	return c.note("user %s restored", id)
+}
+
+// importFile creates the users in one transaction, an invalid or failed record leaves nothing imported.
+func (c *cli) importFile(ctx context.Context, path string) error {
+	users, err := readImportFile(path)
+	if err != nil {
+		return err
+	}
+
+	if c.dryRun {
+		if err := domain.ValidateUsers(users); err != nil {
+			return err
+		}
+		return c.note("would import %d users", len(users))
+	}
+
+	created, err := c.service.ImportUsers(ctx, users)
+	if err != nil {
+		return fmt.Errorf("nothing imported: %w", err)
+	}
+
+	return writeUsers(c.out, c.format, created)
+}
+
+// seed loads the fixture files as is, unlike import it keeps the ids and timestamps
+// and overwrites the users with the same ids, so it can be run again.
+func (c *cli) seed(ctx context.Context, paths []string) error {
+	for _, p := range paths {
+		fsys, name := os.DirFS(filepath.Dir(p)), filepath.Base(p)
+		if c.dryRun {
+			set, err := fixtures.Read(fsys, name)
+			if err != nil {
+				return err
+			}
+			if err := c.note("would seed %d users from %s", len(set.Users), p); err != nil {
+				return err
+			}
+			continue
+		}
+
+		set, err := fixtures.NewLoader(c.seeder, fsys).Load(ctx, name)
+		if err != nil {
+			return err
+		}
+		if err := c.note("seeded %d users from %s", len(set.Users), p); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *cli) getRoles(ctx context.Context, id string) error {
+	roles, err := c.roles.GetRoles(ctx, id)
+	if err != nil {
+		return err
+	}
+	return c.note("%s", strings.Join(roles, " "))
+}
+
+// setRoles goes around the authorization of the http api, it's how the first admin is granted.
+func (c *cli) setRoles(ctx context.Context, id string, roles []string) error {
+	if c.dryRun {
+		if err := domain.ValidateRoles(roles); err != nil {
+			return err
+		}
+		if _, err := c.service.GetUserByID(ctx, id); err != nil {
+			return err
+		}
+		return c.note("would set roles of user %s to %s", id, strings.Join(roles, " "))
+	}
+
+	if err := c.roles.SetRoles(ctx, id, roles); err != nil {
+		return err
+	}
+	return c.note("roles of user %s set to %s", id, strings.Join(roles, " "))
+}
+
+// credentials reads the password from stdin, so it doesn't end up in the shell history.
+func (c *cli) credentials(ctx context.Context, id, login string) error {
+	password, err := bufio.NewReader(c.in).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to read password: %w", err)
+	}
+	password = strings.TrimRight(password, "\r\n")
+
+	if c.dryRun {
+		if err := domain.ValidateLogin(domain.NormalizeLogin(login)); err != nil {
+			return err
+		}
+		if _, err := c.service.GetUserByID(ctx, id); err != nil {
+			return err
+		}
+		return c.note("would set login %q for user %s", login, id)
+	}
+
+	// the operator isn't the user, no current password is asked
+	if err := c.auth.SetCredentials(ctx, id, login, password, ""); err != nil {
+		return err
+	}
+	return c.note("login %q set for user %s", login, id)
+}
+
+func (c *cli) note(format string, args ...interface{}) error {
+	_, err := fmt.Fprintf(c.out, format+"\n", args...)
+	return err
+}
+
+// readImportFile reads a json array of users or a csv file with a username column and an optional email one.
+func readImportFile(path string) ([]domain.User, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext != ".json" && ext != ".csv" {
+		return nil, fmt.Errorf("%w: unsupported import file %s, expected .json or .csv", errUsage, path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if ext == ".csv" {
+		return readCSVUsers(f)
+	}
+
+	var users []domain.User
+	if err := json.NewDecoder(f).Decode(&users); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+	return users, nil
+}
+
+func readCSVUsers(r io.Reader) ([]domain.User, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read csv: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	column, emailColumn := -1, -1
+	for i, name := range records[0] {
+		switch strings.TrimSpace(name) {
+		case "username":
+			column = i
+		case "email":
+			emailColumn = i
+		}
+	}
+	if column == -1 {
+		return nil, errors.New("csv header must contain username column")
+	}
+
+	users := make([]domain.User, 0, len(records)-1)
+	for _, record := range records[1:] {
+		user := domain.User{Username: record[column]}
+		if emailColumn != -1 {
+			user.Email = record[emailColumn]
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
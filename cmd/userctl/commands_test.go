@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/domain/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadImportFile(t *testing.T) {
+	t.Parallel()
+
+	expected := []domain.User{{Username: "alice", Email: "alice@example.com"}, {Username: "bob"}}
+	for _, path := range []string{"testdata/users.json", "testdata/users.csv"} {
+		t.Run(path, func(t *testing.T) {
+			users, err := readImportFile(path)
+			require.NoError(t, err)
+			assert.Equal(t, expected, users)
+		})
+	}
+
+	_, err := readImportFile("testdata/users.txt")
+	assert.ErrorIs(t, err, errUsage)
+}
+
+func TestExitCode(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, exitOK, exitCode(nil))
+	assert.Equal(t, exitUsage, exitCode(errUsage))
+	assert.Equal(t, exitNotFound, exitCode(fmt.Errorf("get: %w", domain.ErrUserNotFound)))
+	assert.Equal(t, exitValidation, exitCode(errors.Join(domain.ErrInvalidUsername, domain.ErrInvalidUsername)))
+	assert.Equal(t, exitValidation, exitCode(domain.ErrEmailTaken))
+	assert.Equal(t, exitInternal, exitCode(errors.New("connection refused")))
+}
+
+func TestRun(t *testing.T) {
+	type testCase struct {
+		name       string
+		cmd        string
+		args       []string
+		format     string
+		dryRun     bool
+		setupMocks func(repo *mocks.MockUserRepository)
+
+		expectedOut string
+		expectedErr error
+	}
+	const id = "8da80ba8-81c6-4336-bba3-ba8ea50541b0"
+	alice := domain.User{ID: id, Username: "alice", Email: "alice@example.com"}
+
+	for _, tt := range []testCase{
+		{
+			name: "create",
+			cmd:  "create",
+			args: []string{"alice"},
+			setupMocks: func(repo *mocks.MockUserRepository) {
+				repo.On("CreateUser", mock.Anything, domain.User{Username: "alice"}).Return(domain.User{ID: id, Username: "alice"}, nil)
+			},
+			expectedOut: "ID                                    USERNAME  EMAIL\n" + id + "  alice     \n",
+		},
+		{
+			name:        "create dry run writes nothing",
+			cmd:         "create",
+			args:        []string{"alice"},
+			dryRun:      true,
+			setupMocks:  func(repo *mocks.MockUserRepository) {},
+			expectedOut: "would create user \"alice\"\n",
+		},
+		{
+			name:        "create dry run validates",
+			cmd:         "create",
+			args:        []string{"al"},
+			dryRun:      true,
+			setupMocks:  func(repo *mocks.MockUserRepository) {},
+			expectedErr: domain.ErrInvalidUsername,
+		},
+		{
+			name:   "get as json",
+			cmd:    "get",
+			args:   []string{id},
+			format: formatJSON,
+			setupMocks: func(repo *mocks.MockUserRepository) {
+				repo.On("GetUserByID", mock.Anything, id).Return(alice, nil)
+			},
+			expectedOut: "[\n  {\n    \"id\": \"" + id + "\",\n    \"username\": \"alice\",\n    \"email\": \"alice@example.com\"\n  }\n]\n",
+		},
+		{
+			name:   "get as csv",
+			cmd:    "get",
+			args:   []string{id},
+			format: formatCSV,
+			setupMocks: func(repo *mocks.MockUserRepository) {
+				repo.On("GetUserByID", mock.Anything, id).Return(alice, nil)
+			},
+			expectedOut: "id,username,email\n" + id + ",alice,alice@example.com\n",
+		},
+		{
+			name: "get unknown",
+			cmd:  "get",
+			args: []string{id},
+			setupMocks: func(repo *mocks.MockUserRepository) {
+				repo.On("GetUserByID", mock.Anything, id).Return(domain.User{}, domain.ErrUserNotFound)
+			},
+			expectedErr: domain.ErrUserNotFound,
+		},
+		{
+			name:   "list as csv",
+			cmd:    "list",
+			format: formatCSV,
+			setupMocks: func(repo *mocks.MockUserRepository) {
+				repo.On("ListUsers", mock.Anything, domain.UserFilter{Limit: 10}).Return([]domain.User{alice}, 1, nil)
+			},
+			expectedOut: "id,username,email\n" + id + ",alice,alice@example.com\n",
+		},
+		{
+			name:   "rename",
+			cmd:    "rename",
+			args:   []string{id, "alicia"},
+			format: formatCSV,
+			setupMocks: func(repo *mocks.MockUserRepository) {
+				repo.On("UpdateUsername", mock.Anything, id, "alicia").Return(domain.User{ID: id, Username: "alicia", Email: alice.Email}, nil)
+			},
+			expectedOut: "id,username,email\n" + id + ",alicia,alice@example.com\n",
+		},
+		{
+			name:   "rename dry run writes nothing",
+			cmd:    "rename",
+			args:   []string{id, "alicia"},
+			dryRun: true,
+			setupMocks: func(repo *mocks.MockUserRepository) {
+				repo.On("GetUserByID", mock.Anything, id).Return(alice, nil)
+			},
+			expectedOut: "would rename user " + id + " to \"alicia\"\n",
+		},
+		{
+			name: "delete",
+			cmd:  "delete",
+			args: []string{id},
+			setupMocks: func(repo *mocks.MockUserRepository) {
+				repo.On("DeleteUser", mock.Anything, id).Return(nil)
+			},
+			expectedOut: "user " + id + " deleted\n",
+		},
+		{
+			name:   "delete dry run of an unknown user",
+			cmd:    "delete",
+			args:   []string{id},
+			dryRun: true,
+			setupMocks: func(repo *mocks.MockUserRepository) {
+				repo.On("GetUserByID", mock.Anything, id).Return(domain.User{}, domain.ErrUserNotFound)
+			},
+			expectedErr: domain.ErrUserNotFound,
+		},
+		{
+			name: "restore",
+			cmd:  "restore",
+			args: []string{id},
+			setupMocks: func(repo *mocks.MockUserRepository) {
+				repo.On("RestoreUser", mock.Anything, id).Return(nil)
+			},
+			expectedOut: "user " + id + " restored\n",
+		},
+		{
+			name:   "restore dry run",
+			cmd:    "restore",
+			args:   []string{id},
+			dryRun: true,
+			setupMocks: func(repo *mocks.MockUserRepository) {
+				repo.On("RestoreUser", mock.Anything, id).Return(nil)
+			},
+			expectedOut: "would restore user " + id + "\n",
+		},
+		{
+			name:   "restore dry run of a user that isn't deleted",
+			cmd:    "restore",
+			args:   []string{id},
+			dryRun: true,
+			setupMocks: func(repo *mocks.MockUserRepository) {
+				repo.On("RestoreUser", mock.Anything, id).Return(domain.ErrUserNotFound)
+			},
+			expectedErr: domain.ErrUserNotFound,
+		},
+		{
+			name:        "unknown command",
+			cmd:         "purge",
+			setupMocks:  func(repo *mocks.MockUserRepository) {},
+			expectedErr: errUsage,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := mocks.NewMockUserRepository(t)
+			tt.setupMocks(repo)
+			tx := mocks.NewMockTxManager(t)
+			tx.On("WithinTx", mock.Anything, mock.Anything).Return(func(ctx context.Context, fn func(ctx context.Context) error) error {
+				return fn(ctx)
+			}).Maybe()
+			out := &bytes.Buffer{}
+			format := tt.format
+			if format == "" {
+				format = formatTable
+			}
+			c := &cli{
+				service: domain.NewUserService(repo, tx),
+				tx:      tx,
+				out:     out,
+				format:  format,
+				dryRun:  tt.dryRun,
+				limit:   10,
+			}
+
+			err := c.run(context.Background(), tt.cmd, tt.args)
+
+			assert.ErrorIs(t, err, tt.expectedErr)
+			assert.Equal(t, tt.expectedOut, out.String())
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/dennypenta/go-api-walkthrough/assembly"
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/pkg/log"
+	"github.com/dennypenta/go-api-walkthrough/pkg/password"
+)
+
+const (
+	exitOK         = 0
+	exitInternal   = 1
+	exitUsage      = 2
+	exitNotFound   = 3
+	exitValidation = 4
+)
+
+const usage = `usage: userctl [flags] <command> [args]
+
+commands:
+  create USERNAME       create a user
+  get ID                print a user
+  list                  print the users page, see -limit and -offset
+  rename ID USERNAME    change the username
+  delete ID             soft delete a user
+  restore ID            restore a soft deleted user
+  import FILE           create the users from a .json or .csv file, all of them or none
+  seed FILE...          load the fixture files (.yaml or .json) keeping ids and timestamps
+  roles ID [ROLE...]    print the roles of a user or replace them, e.g. to bootstrap the first admin
+  credentials ID LOGIN  set the login of a user, the password is read from the first line of stdin
+
+flags:
+`
+
+var errUsage = errors.New("invalid usage")
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	fs := flag.NewFlagSet("userctl", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), usage)
+		fs.PrintDefaults()
+	}
+	dryRun := fs.Bool("dry-run", false, "validate the input and print what would be done without writing anything")
+	output := fs.String("output", formatTable, "output format: table, json or csv")
+	limit := fs.Int("limit", 10, "list page size")
+	offset := fs.Int("offset", 0, "list offset")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() == 0 || !validFormat(*output) {
+		fs.Usage()
+		return exitUsage
+	}
+
+	conf, err := assembly.NewConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to load config:", err)
+		return exitInternal
+	}
+
+	ctx := context.Background()
+	l := log.NewLogger(os.Stderr, conf.LogLevel)
+	store, err := openStorage(ctx, conf, l)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitInternal
+	}
+	defer store.close()
+
+	hasher, err := password.NewHasher(conf.PasswordHashParams())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to create password hasher:", err)
+		return exitInternal
+	}
+
+	c := &cli{
+		// no access policy, the operator may do everything
+		service: domain.NewUserService(store.users, store.tx),
+		roles:   domain.NewRoleService(store.roles, store.tx),
+		// the tokens aren't issued here, only the credentials are set and the sessions are revoked
+		auth:   domain.NewAuthService(store.creds, hasher, nil, nil, store.sessions, store.tx, conf.PasswordPolicy()),
+		seeder: store.users,
+		tx:     store.tx,
+		in:     os.Stdin,
+		out:    os.Stdout,
+		format: *output,
+		dryRun: *dryRun,
+		limit:  *limit,
+		offset: *offset,
+	}
+	err = c.run(ctx, fs.Arg(0), fs.Args()[1:])
+	if errors.Is(err, errUsage) {
+		fs.Usage()
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+	}
+
+	return exitCode(err)
+}
+
+func exitCode(err error) int {
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, errUsage):
+		return exitUsage
+	case errors.Is(err, domain.ErrUserNotFound):
+		return exitNotFound
+	case errors.Is(err, domain.ErrInvalidUsername), errors.Is(err, domain.ErrInvalidRole),
+		errors.Is(err, domain.ErrInvalidLogin), errors.Is(err, domain.ErrWeakPassword), errors.Is(err, domain.ErrLoginTaken),
+		errors.Is(err, domain.ErrInvalidEmail), errors.Is(err, domain.ErrEmailTaken):
+		return exitValidation
+	default:
+		return exitInternal
+	}
+}
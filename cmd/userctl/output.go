@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+)
+
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+	formatCSV   = "csv"
+)
+
+func validFormat(format string) bool {
+	return format == formatTable || format == formatJSON || format == formatCSV
+}
+
+func writeUsers(w io.Writer, format string, users []domain.User) error {
+	switch format {
+	case formatJSON:
+		return writeJSON(w, users)
+	case formatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write([]string{"id", "username", "email"}); err != nil {
+			return err
+		}
+		for _, u := range users {
+			if err := cw.Write([]string{u.ID, u.Username, u.Email}); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tUSERNAME\tEMAIL")
+		for _, u := range users {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", u.ID, u.Username, u.Email)
+		}
+		return tw.Flush()
+	}
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
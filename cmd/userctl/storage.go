@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/assembly"
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/fixtures"
+	"github.com/dennypenta/go-api-walkthrough/repository/postgres"
+	"github.com/google/uuid"
+)
+
+type userStore interface {
+	domain.UserRepository
+	fixtures.Seeder
+}
+
+// storage is the repository the commands work on, the same one the server uses.
+type storage struct {
+	users    userStore
+	creds    domain.CredentialRepository
+	sessions domain.SessionRepository
+	roles    domain.RoleRepository
+	tx       domain.TxManager
+	close    func()
+}
+
+func openStorage(ctx context.Context, conf assembly.Config, l *slog.Logger) (storage, error) {
+	dialect, err := conf.Dialect()
+	if err != nil {
+		return storage{}, err
+	}
+
+	if dialect == assembly.DialectSQLite {
+		db, err := assembly.ConnectDB(ctx, conf, l)
+		if err != nil {
+			return storage{}, err
+		}
+		return storage{
+			users:    assembly.NewUserRepository(db, time.Now, uuid.NewString),
+			creds:    assembly.NewCredentialRepository(db, time.Now),
+			sessions: assembly.NewSessionRepository(db, time.Now),
+			roles:    assembly.NewRoleRepository(db),
+			tx:       assembly.NewTxManager(db, conf, l),
+			close:    func() { db.Close() },
+		}, nil
+	}
+
+	pool, err := assembly.ConnectPool(ctx, conf, l)
+	if err != nil {
+		return storage{}, err
+	}
+	return storage{
+		users:    postgres.NewUserRepository(pool),
+		creds:    postgres.NewCredentialRepository(pool),
+		sessions: postgres.NewSessionRepository(pool),
+		roles:    postgres.NewRoleRepository(pool),
+		tx:       assembly.NewPoolTxManager(pool, conf, l),
+		close:    pool.Close,
+	}, nil
+}
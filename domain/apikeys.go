@@ -0,0 +1,146 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	ErrInvalidAPIKey  = errors.New("invalid api key")
+)
+
+// InvalidAPIKeyError is ErrInvalidAPIKey telling what is wrong with the requested key.
+type InvalidAPIKeyError struct {
+	Reason string
+}
+
+func (e *InvalidAPIKeyError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrInvalidAPIKey, e.Reason)
+}
+
+func (e *InvalidAPIKeyError) Unwrap() error {
+	return ErrInvalidAPIKey
+}
+
+// APIKey lets a service call the API without signing in, only the hash of the key is stored.
+// The prefix is the public part of the key the stored one is found by.
+type APIKey struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Prefix string `json:"prefix"`
+	Hash   string `json:"-"`
+	// Scopes are the actions the key is granted, e.g. users:read
+	Scopes []string `json:"scopes"`
+	// the times are UTC, a key without ExpiresAt doesn't expire
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// Expired tells whether the key can't be used at the time.
+func (k APIKey) Expired(at time.Time) bool {
+	return k.ExpiresAt != nil && !at.Before(*k.ExpiresAt)
+}
+
+// CreatedAPIKey is the only time the key itself is shown.
+type CreatedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+//go:generate mockery --name=APIKeyRepository --dir=. --outpkg=mocks --filename=mock_api_key_repository.go --output=./mocks --structname MockAPIKeyRepository
+type APIKeyRepository interface {
+	CreateAPIKey(ctx context.Context, k APIKey) error
+	// GetAPIKeyByPrefix returns ErrAPIKeyNotFound if there is no such key or it's revoked.
+	GetAPIKeyByPrefix(ctx context.Context, prefix string) (APIKey, error)
+	// ListAPIKeys returns the keys not revoked, the expired ones included, the newest first.
+	ListAPIKeys(ctx context.Context) ([]APIKey, error)
+	// RevokeAPIKey returns ErrAPIKeyNotFound if there is no such key not revoked.
+	RevokeAPIKey(ctx context.Context, id string) error
+	// TouchAPIKey records the time the key is used at.
+	TouchAPIKey(ctx context.Context, id string, at time.Time) error
+}
+
+//go:generate mockery --name=APIKeyGenerator --dir=. --outpkg=mocks --filename=mock_api_key_generator.go --output=./mocks --structname MockAPIKeyGenerator
+type APIKeyGenerator interface {
+	// GenerateAPIKey returns a new random key, its lookup prefix and the hash to store.
+	GenerateAPIKey() (key, prefix, hash string, err error)
+}
+
+type APIKeyService struct {
+	repo  APIKeyRepository
+	gen   APIKeyGenerator
+	now   func() time.Time
+	newID func() string
+}
+
+func NewAPIKeyService(repo APIKeyRepository, gen APIKeyGenerator, now func() time.Time, newID func() string) *APIKeyService {
+	return &APIKeyService{
+		repo:  repo,
+		gen:   gen,
+		now:   now,
+		newID: newID,
+	}
+}
+
+// CreateAPIKey grants the key the scopes, every scope is a UserService action.
+// It returns InvalidAPIKeyError if the name, the scopes or the expiry are wrong.
+func (s *APIKeyService) CreateAPIKey(ctx context.Context, name string, scopes []string, expiresAt *time.Time) (CreatedAPIKey, error) {
+	now := s.now().UTC()
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > 100 {
+		return CreatedAPIKey{}, &InvalidAPIKeyError{Reason: "the name must be 1 to 100 characters"}
+	}
+	if len(scopes) == 0 {
+		return CreatedAPIKey{}, &InvalidAPIKeyError{Reason: "at least one scope is required"}
+	}
+	for _, scope := range scopes {
+		if err := ValidateAction(scope); err != nil {
+			return CreatedAPIKey{}, &InvalidAPIKeyError{Reason: fmt.Sprintf("unknown scope %q", scope)}
+		}
+	}
+	scopes = slices.Clone(scopes)
+	slices.Sort(scopes)
+	scopes = slices.Compact(scopes)
+	if expiresAt != nil {
+		if !now.Before(*expiresAt) {
+			return CreatedAPIKey{}, &InvalidAPIKeyError{Reason: "the expiry must be in the future"}
+		}
+		utc := expiresAt.UTC()
+		expiresAt = &utc
+	}
+
+	key, prefix, hash, err := s.gen.GenerateAPIKey()
+	if err != nil {
+		return CreatedAPIKey{}, fmt.Errorf("CreateAPIKey: %w", err)
+	}
+	k := APIKey{
+		ID:        s.newID(),
+		Name:      name,
+		Prefix:    prefix,
+		Hash:      hash,
+		Scopes:    scopes,
+		CreatedAt: now,
+		ExpiresAt: expiresAt,
+	}
+	if err := s.repo.CreateAPIKey(ctx, k); err != nil {
+		return CreatedAPIKey{}, err
+	}
+
+	return CreatedAPIKey{APIKey: k, Key: key}, nil
+}
+
+func (s *APIKeyService) ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	return s.repo.ListAPIKeys(ctx)
+}
+
+// RevokeAPIKey makes the key refused at once.
+func (s *APIKeyService) RevokeAPIKey(ctx context.Context, id string) error {
+	return s.repo.RevokeAPIKey(ctx, id)
+}
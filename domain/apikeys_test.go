@@ -0,0 +1,61 @@
+package domain_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/domain/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateAPIKey(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	newID := func() string { return "1" }
+
+	t.Run("the key is shown once and stored hashed", func(t *testing.T) {
+		repo := mocks.NewMockAPIKeyRepository(t)
+		gen := mocks.NewMockAPIKeyGenerator(t)
+		gen.On("GenerateAPIKey").Return("usk_abc_secret", "abc", "hash", nil)
+		expiresAt := now.Add(time.Hour)
+		stored := domain.APIKey{
+			ID:        "1",
+			Name:      "batch",
+			Prefix:    "abc",
+			Hash:      "hash",
+			Scopes:    []string{domain.ActionListUsers, domain.ActionReadUser},
+			CreatedAt: now,
+			ExpiresAt: &expiresAt,
+		}
+		repo.On("CreateAPIKey", mock.Anything, stored).Return(nil)
+
+		created, err := domain.NewAPIKeyService(repo, gen, clock, newID).CreateAPIKey(context.Background(), " batch ",
+			[]string{domain.ActionReadUser, domain.ActionListUsers, domain.ActionReadUser}, &expiresAt)
+		require.NoError(t, err)
+		assert.Equal(t, domain.CreatedAPIKey{APIKey: stored, Key: "usk_abc_secret"}, created)
+	})
+
+	past := now.Add(-time.Second)
+	for name, tt := range map[string]struct {
+		name      string
+		scopes    []string
+		expiresAt *time.Time
+	}{
+		"no name":       {name: " ", scopes: []string{domain.ActionReadUser}},
+		"long name":     {name: strings.Repeat("a", 101), scopes: []string{domain.ActionReadUser}},
+		"no scopes":     {name: "batch"},
+		"unknown scope": {name: "batch", scopes: []string{"users:everything"}},
+		"expired":       {name: "batch", scopes: []string{domain.ActionReadUser}, expiresAt: &past},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s := domain.NewAPIKeyService(mocks.NewMockAPIKeyRepository(t), mocks.NewMockAPIKeyGenerator(t), clock, newID)
+			_, err := s.CreateAPIKey(context.Background(), tt.name, tt.scopes, tt.expiresAt)
+			assert.ErrorIs(t, err, domain.ErrInvalidAPIKey)
+		})
+	}
+}
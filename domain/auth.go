@@ -0,0 +1,171 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// CredentialRepository keeps the logins and the password hashes.
+//
+//go:generate mockery --name=CredentialRepository --dir=. --outpkg=mocks --filename=mock_credential_repository.go --output=./mocks --structname MockCredentialRepository
+type CredentialRepository interface {
+	// SetCredentials creates or replaces the credentials of a not deleted user,
+	// it returns ErrUserNotFound if there is no such user and ErrLoginTaken if another user has the login.
+	SetCredentials(ctx context.Context, c Credentials) error
+	// GetCredentialsByLogin returns ErrCredentialsNotFound if there is no such login or the user is deleted.
+	GetCredentialsByLogin(ctx context.Context, login string) (Credentials, error)
+	// GetCredentials returns ErrCredentialsNotFound if the user has no credentials or is deleted.
+	GetCredentials(ctx context.Context, userID string) (Credentials, error)
+}
+
+//go:generate mockery --name=PasswordHasher --dir=. --outpkg=mocks --filename=mock_password_hasher.go --output=./mocks --structname MockPasswordHasher
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	// Verify compares the password in constant time
+	Verify(hash, password string) (bool, error)
+	// VerifyDummy takes as long as Verify, so an unknown login can't be told by the response time
+	VerifyDummy(password string)
+}
+
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	// ExpiresIn is the access token lifetime in seconds
+	ExpiresIn int `json:"expires_in"`
+}
+
+//go:generate mockery --name=TokenIssuer --dir=. --outpkg=mocks --filename=mock_token_issuer.go --output=./mocks --structname MockTokenIssuer
+type TokenIssuer interface {
+	// IssueTokens starts a new session of the client.
+	IssueTokens(ctx context.Context, userID string, client Client) (TokenPair, error)
+	// RefreshTokens exchanges the refresh token for a new pair, it returns ErrInvalidRefreshToken if it can't be exchanged.
+	RefreshTokens(ctx context.Context, refreshToken string, client Client) (TokenPair, error)
+}
+
+type AuthService struct {
+	creds        CredentialRepository
+	hasher       PasswordHasher
+	tokens       TokenIssuer
+	secondFactor SecondFactor
+	sessions     SessionRepository
+	tx           TxManager
+	policy       PasswordPolicy
+}
+
+func NewAuthService(creds CredentialRepository, hasher PasswordHasher, tokens TokenIssuer, secondFactor SecondFactor,
+	sessions SessionRepository, tx TxManager, policy PasswordPolicy) *AuthService {
+	return &AuthService{
+		creds:        creds,
+		hasher:       hasher,
+		tokens:       tokens,
+		secondFactor: secondFactor,
+		sessions:     sessions,
+		tx:           tx,
+		policy:       policy,
+	}
+}
+
+// SetCredentials sets the login and the password of the user replacing the previous ones
+// and signs the user out of every other session, the refresh tokens go along with them.
+// The user changing the own credentials proves the current password, otherwise a stolen access token
+// would take the account over, it returns ErrWrongPassword if the password doesn't match.
+// The others, e.g. an admin, change the credentials without it and every session of the user is signed out.
+func (s *AuthService) SetCredentials(ctx context.Context, userID, login, password, currentPassword string) error {
+	login = NormalizeLogin(login)
+	if err := ValidateLogin(login); err != nil {
+		return err
+	}
+	if err := s.policy.Validate(password, login); err != nil {
+		return err
+	}
+
+	keep := ""
+	if p, ok := PrincipalFromContext(ctx); ok && p.ID == userID {
+		if err := s.verifyPassword(ctx, userID, currentPassword); err != nil {
+			return err
+		}
+		keep = p.SessionID
+	}
+
+	hash, err := s.hasher.Hash(password)
+	if err != nil {
+		return fmt.Errorf("SetCredentials: %w", err)
+	}
+	return s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.creds.SetCredentials(ctx, Credentials{UserID: userID, Login: login, PasswordHash: hash}); err != nil {
+			return err
+		}
+		if _, err := s.sessions.RevokeOtherSessions(ctx, userID, keep); err != nil {
+			return fmt.Errorf("SetCredentials: failed to revoke sessions: %w", err)
+		}
+		return nil
+	})
+}
+
+// verifyPassword returns ErrWrongPassword if the password isn't the one of the user,
+// a user without credentials has no password to match.
+func (s *AuthService) verifyPassword(ctx context.Context, userID, password string) error {
+	c, err := s.creds.GetCredentials(ctx, userID)
+	if errors.Is(err, ErrCredentialsNotFound) {
+		s.hasher.VerifyDummy(password)
+		return ErrWrongPassword
+	}
+	if err != nil {
+		return err
+	}
+
+	ok, err := s.hasher.Verify(c.PasswordHash, password)
+	if err != nil {
+		return fmt.Errorf("SetCredentials: %w", err)
+	}
+	if !ok {
+		return ErrWrongPassword
+	}
+	return nil
+}
+
+// Login issues the tokens of a new session of the client if the password matches.
+// An unknown login and a wrong password are the same ErrInvalidCredentials taking the same time.
+// A user with the second factor enabled gets TwoFactorRequiredError instead, the login is finished with LoginTwoFactor.
+func (s *AuthService) Login(ctx context.Context, login, password string, client Client) (TokenPair, error) {
+	c, err := s.creds.GetCredentialsByLogin(ctx, NormalizeLogin(login))
+	if errors.Is(err, ErrCredentialsNotFound) {
+		s.hasher.VerifyDummy(password)
+		return TokenPair{}, ErrInvalidCredentials
+	}
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	ok, err := s.hasher.Verify(c.PasswordHash, password)
+	if err != nil {
+		return TokenPair{}, fmt.Errorf("Login: %w", err)
+	}
+	if !ok {
+		return TokenPair{}, ErrInvalidCredentials
+	}
+	if err := s.secondFactor.RequireSecondFactor(ctx, c.UserID, client); err != nil {
+		return TokenPair{}, err
+	}
+
+	return s.tokens.IssueTokens(ctx, c.UserID, client)
+}
+
+// LoginTwoFactor finishes the login passing the challenge with a code of the second factor,
+// the session is of the device named on the login.
+func (s *AuthService) LoginTwoFactor(ctx context.Context, challengeToken, code string, client Client) (TokenPair, error) {
+	userID, device, err := s.secondFactor.VerifySecondFactor(ctx, challengeToken, code)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	client.Device = device
+
+	return s.tokens.IssueTokens(ctx, userID, client)
+}
+
+// Refresh exchanges the refresh token for a new pair, the given one can't be used again.
+func (s *AuthService) Refresh(ctx context.Context, refreshToken string, client Client) (TokenPair, error) {
+	return s.tokens.RefreshTokens(ctx, refreshToken, client)
+}
@@ -0,0 +1,244 @@
+package domain_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/domain/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+var policy = domain.PasswordPolicy{MinLength: 12, MaxLength: 128}
+
+func TestLogin(t *testing.T) {
+	type testCase struct {
+		name       string
+		login      string
+		password   string
+		setupMocks func(creds *mocks.MockCredentialRepository, hasher *mocks.MockPasswordHasher, tokens *mocks.MockTokenIssuer, secondFactor *mocks.MockSecondFactor)
+
+		expectedResp domain.TokenPair
+		expectedErr  error
+	}
+	cred := domain.Credentials{UserID: "8da80ba8-81c6-4336-bba3-ba8ea50541b0", Login: "alice", PasswordHash: "hash"}
+	pair := domain.TokenPair{AccessToken: "access", RefreshToken: "refresh", TokenType: "Bearer", ExpiresIn: 900}
+	client := domain.Client{Device: "phone", UserAgent: "curl/8.0", IP: "192.0.2.1"}
+
+	for _, tt := range []testCase{
+		{
+			name:     "valid credentials",
+			login:    " Alice ",
+			password: "correct horse battery staple",
+			setupMocks: func(creds *mocks.MockCredentialRepository, hasher *mocks.MockPasswordHasher, tokens *mocks.MockTokenIssuer, secondFactor *mocks.MockSecondFactor) {
+				creds.On("GetCredentialsByLogin", mock.Anything, "alice").Return(cred, nil)
+				hasher.On("Verify", "hash", "correct horse battery staple").Return(true, nil)
+				secondFactor.On("RequireSecondFactor", mock.Anything, cred.UserID, client).Return(nil)
+				tokens.On("IssueTokens", mock.Anything, cred.UserID, client).Return(pair, nil)
+			},
+			expectedResp: pair,
+		},
+		{
+			name:     "second factor required",
+			login:    "alice",
+			password: "correct horse battery staple",
+			setupMocks: func(creds *mocks.MockCredentialRepository, hasher *mocks.MockPasswordHasher, tokens *mocks.MockTokenIssuer, secondFactor *mocks.MockSecondFactor) {
+				creds.On("GetCredentialsByLogin", mock.Anything, "alice").Return(cred, nil)
+				hasher.On("Verify", "hash", "correct horse battery staple").Return(true, nil)
+				secondFactor.On("RequireSecondFactor", mock.Anything, cred.UserID, client).
+					Return(&domain.TwoFactorRequiredError{ChallengeToken: "challenge", ExpiresIn: 300})
+			},
+			expectedErr: domain.ErrTwoFactorRequired,
+		},
+		{
+			name:     "wrong password",
+			login:    "alice",
+			password: "wrong password",
+			setupMocks: func(creds *mocks.MockCredentialRepository, hasher *mocks.MockPasswordHasher, tokens *mocks.MockTokenIssuer, secondFactor *mocks.MockSecondFactor) {
+				creds.On("GetCredentialsByLogin", mock.Anything, "alice").Return(cred, nil)
+				hasher.On("Verify", "hash", "wrong password").Return(false, nil)
+			},
+			expectedErr: domain.ErrInvalidCredentials,
+		},
+		{
+			name:     "unknown login spends the same time",
+			login:    "bob",
+			password: "correct horse battery staple",
+			setupMocks: func(creds *mocks.MockCredentialRepository, hasher *mocks.MockPasswordHasher, tokens *mocks.MockTokenIssuer, secondFactor *mocks.MockSecondFactor) {
+				creds.On("GetCredentialsByLogin", mock.Anything, "bob").Return(domain.Credentials{}, domain.ErrCredentialsNotFound)
+				hasher.On("VerifyDummy", "correct horse battery staple").Return()
+			},
+			expectedErr: domain.ErrInvalidCredentials,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			creds := mocks.NewMockCredentialRepository(t)
+			hasher := mocks.NewMockPasswordHasher(t)
+			tokens := mocks.NewMockTokenIssuer(t)
+			secondFactor := mocks.NewMockSecondFactor(t)
+			tt.setupMocks(creds, hasher, tokens, secondFactor)
+			service := domain.NewAuthService(creds, hasher, tokens, secondFactor, mocks.NewMockSessionRepository(t), mocks.NewMockTxManager(t), policy)
+
+			res, err := service.Login(context.Background(), tt.login, tt.password, client)
+
+			assert.ErrorIs(t, err, tt.expectedErr)
+			assert.Equal(t, tt.expectedResp, res)
+		})
+	}
+}
+
+func TestLoginTwoFactor(t *testing.T) {
+	userID := "8da80ba8-81c6-4336-bba3-ba8ea50541b0"
+	pair := domain.TokenPair{AccessToken: "access", RefreshToken: "refresh", TokenType: "Bearer", ExpiresIn: 900}
+	client := domain.Client{UserAgent: "curl/8.0", IP: "192.0.2.1"}
+
+	t.Run("the session is of the device of the login", func(t *testing.T) {
+		secondFactor := mocks.NewMockSecondFactor(t)
+		tokens := mocks.NewMockTokenIssuer(t)
+		secondFactor.On("VerifySecondFactor", mock.Anything, "challenge", "123456").Return(userID, "phone", nil)
+		withDevice := client
+		withDevice.Device = "phone"
+		tokens.On("IssueTokens", mock.Anything, userID, withDevice).Return(pair, nil)
+		service := domain.NewAuthService(mocks.NewMockCredentialRepository(t), mocks.NewMockPasswordHasher(t), tokens, secondFactor, mocks.NewMockSessionRepository(t), mocks.NewMockTxManager(t), policy)
+
+		res, err := service.LoginTwoFactor(context.Background(), "challenge", "123456", client)
+
+		assert.NoError(t, err)
+		assert.Equal(t, pair, res)
+	})
+
+	t.Run("invalid code", func(t *testing.T) {
+		secondFactor := mocks.NewMockSecondFactor(t)
+		secondFactor.On("VerifySecondFactor", mock.Anything, "challenge", "000000").Return("", "", domain.ErrInvalidTwoFactorCode)
+		service := domain.NewAuthService(mocks.NewMockCredentialRepository(t), mocks.NewMockPasswordHasher(t), mocks.NewMockTokenIssuer(t), secondFactor, mocks.NewMockSessionRepository(t), mocks.NewMockTxManager(t), policy)
+
+		_, err := service.LoginTwoFactor(context.Background(), "challenge", "000000", client)
+
+		assert.ErrorIs(t, err, domain.ErrInvalidTwoFactorCode)
+	})
+}
+
+func TestSetCredentials(t *testing.T) {
+	type testCase struct {
+		name       string
+		principal  *domain.Principal
+		login      string
+		password   string
+		current    string
+		setupMocks func(creds *mocks.MockCredentialRepository, hasher *mocks.MockPasswordHasher, sessions *mocks.MockSessionRepository)
+
+		expectedErr error
+	}
+	userID := "8da80ba8-81c6-4336-bba3-ba8ea50541b0"
+	alice := &domain.Principal{ID: userID, SessionID: "laptop"}
+	admin := &domain.Principal{ID: "4b4c2b0e-3c43-4c8f-9a41-7a57b9a1f6f0", SessionID: "admin"}
+	inTx := func(ctx context.Context, fn func(ctx context.Context) error) error {
+		return fn(ctx)
+	}
+
+	for _, tt := range []testCase{
+		{
+			name:     "valid credentials",
+			login:    "Alice",
+			password: "correct horse battery staple",
+			setupMocks: func(creds *mocks.MockCredentialRepository, hasher *mocks.MockPasswordHasher, sessions *mocks.MockSessionRepository) {
+				hasher.On("Hash", "correct horse battery staple").Return("hash", nil)
+				creds.On("SetCredentials", mock.Anything, domain.Credentials{UserID: userID, Login: "alice", PasswordHash: "hash"}).Return(nil)
+				sessions.On("RevokeOtherSessions", mock.Anything, userID, "").Return([]string{"phone"}, nil)
+			},
+		},
+		{
+			name:      "admin signs out every session",
+			principal: admin,
+			login:     "alice",
+			password:  "correct horse battery staple",
+			setupMocks: func(creds *mocks.MockCredentialRepository, hasher *mocks.MockPasswordHasher, sessions *mocks.MockSessionRepository) {
+				hasher.On("Hash", "correct horse battery staple").Return("hash", nil)
+				creds.On("SetCredentials", mock.Anything, mock.Anything).Return(nil)
+				sessions.On("RevokeOtherSessions", mock.Anything, userID, "").Return([]string{"laptop", "phone"}, nil)
+			},
+		},
+		{
+			name:      "own change keeps the current session",
+			principal: alice,
+			login:     "alice",
+			password:  "correct horse battery staple",
+			current:   "old password",
+			setupMocks: func(creds *mocks.MockCredentialRepository, hasher *mocks.MockPasswordHasher, sessions *mocks.MockSessionRepository) {
+				creds.On("GetCredentials", mock.Anything, userID).Return(domain.Credentials{UserID: userID, Login: "alice", PasswordHash: "old"}, nil)
+				hasher.On("Verify", "old", "old password").Return(true, nil)
+				hasher.On("Hash", "correct horse battery staple").Return("hash", nil)
+				creds.On("SetCredentials", mock.Anything, domain.Credentials{UserID: userID, Login: "alice", PasswordHash: "hash"}).Return(nil)
+				sessions.On("RevokeOtherSessions", mock.Anything, userID, "laptop").Return([]string{"phone"}, nil)
+			},
+		},
+		{
+			name:      "own change with a wrong password",
+			principal: alice,
+			login:     "alice",
+			password:  "correct horse battery staple",
+			current:   "guess",
+			setupMocks: func(creds *mocks.MockCredentialRepository, hasher *mocks.MockPasswordHasher, sessions *mocks.MockSessionRepository) {
+				creds.On("GetCredentials", mock.Anything, userID).Return(domain.Credentials{UserID: userID, Login: "alice", PasswordHash: "old"}, nil)
+				hasher.On("Verify", "old", "guess").Return(false, nil)
+			},
+			expectedErr: domain.ErrWrongPassword,
+		},
+		{
+			name:      "own change without credentials",
+			principal: alice,
+			login:     "alice",
+			password:  "correct horse battery staple",
+			setupMocks: func(creds *mocks.MockCredentialRepository, hasher *mocks.MockPasswordHasher, sessions *mocks.MockSessionRepository) {
+				creds.On("GetCredentials", mock.Anything, userID).Return(domain.Credentials{}, domain.ErrCredentialsNotFound)
+				hasher.On("VerifyDummy", "").Return()
+			},
+			expectedErr: domain.ErrWrongPassword,
+		},
+		{
+			name:     "invalid login",
+			login:    "al ice",
+			password: "correct horse battery staple",
+			setupMocks: func(creds *mocks.MockCredentialRepository, hasher *mocks.MockPasswordHasher, sessions *mocks.MockSessionRepository) {
+			},
+			expectedErr: domain.ErrInvalidLogin,
+		},
+		{
+			name:     "weak password",
+			login:    "alice",
+			password: "short",
+			setupMocks: func(creds *mocks.MockCredentialRepository, hasher *mocks.MockPasswordHasher, sessions *mocks.MockSessionRepository) {
+			},
+			expectedErr: domain.ErrWeakPassword,
+		},
+		{
+			name:     "login taken",
+			login:    "alice",
+			password: "correct horse battery staple",
+			setupMocks: func(creds *mocks.MockCredentialRepository, hasher *mocks.MockPasswordHasher, sessions *mocks.MockSessionRepository) {
+				hasher.On("Hash", mock.Anything).Return("hash", nil)
+				creds.On("SetCredentials", mock.Anything, mock.Anything).Return(domain.ErrLoginTaken)
+			},
+			expectedErr: domain.ErrLoginTaken,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			creds := mocks.NewMockCredentialRepository(t)
+			hasher := mocks.NewMockPasswordHasher(t)
+			sessions := mocks.NewMockSessionRepository(t)
+			tt.setupMocks(creds, hasher, sessions)
+			tx := mocks.NewMockTxManager(t)
+			tx.On("WithinTx", mock.Anything, mock.Anything).Return(inTx).Maybe()
+			service := domain.NewAuthService(creds, hasher, mocks.NewMockTokenIssuer(t), mocks.NewMockSecondFactor(t), sessions, tx, policy)
+			ctx := context.Background()
+			if tt.principal != nil {
+				ctx = domain.ContextWithPrincipal(ctx, *tt.principal)
+			}
+
+			err := service.SetCredentials(ctx, userID, tt.login, tt.password, tt.current)
+
+			assert.ErrorIs(t, err, tt.expectedErr)
+		})
+	}
+}
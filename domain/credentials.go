@@ -0,0 +1,74 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	ErrInvalidCredentials  = errors.New("invalid credentials")
+	ErrCredentialsNotFound = errors.New("credentials not found")
+	ErrInvalidLogin        = errors.New("invalid login")
+	ErrLoginTaken          = errors.New("login taken")
+	ErrWeakPassword        = errors.New("weak password")
+	// ErrWrongPassword is the current password not matching on a change of the own credentials.
+	ErrWrongPassword = errors.New("wrong password")
+)
+
+// WeakPasswordError is ErrWeakPassword telling the rule the password breaks.
+type WeakPasswordError struct {
+	Reason string
+}
+
+func (e *WeakPasswordError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrWeakPassword, e.Reason)
+}
+
+func (e *WeakPasswordError) Unwrap() error {
+	return ErrWeakPassword
+}
+
+// Credentials let a user sign in, the usernames aren't unique, so the login is a separate unique one.
+type Credentials struct {
+	UserID       string
+	Login        string
+	PasswordHash string
+}
+
+// NormalizeLogin makes the logins differing only in case and surrounding spaces the same.
+func NormalizeLogin(login string) string {
+	return strings.ToLower(strings.TrimSpace(login))
+}
+
+// ValidateLogin expects a normalized login.
+func ValidateLogin(login string) error {
+	n := utf8.RuneCountInString(login)
+	if n < 3 || n > 55 || strings.ContainsFunc(login, unicode.IsSpace) {
+		return ErrInvalidLogin
+	}
+	return nil
+}
+
+// PasswordPolicy follows https://pages.nist.gov/800-63-3/sp800-63b.html#memsecret:
+// the length matters, the composition rules don't.
+type PasswordPolicy struct {
+	MinLength int
+	// MaxLength keeps the hashing cost bounded
+	MaxLength int
+}
+
+func (p PasswordPolicy) Validate(password, login string) error {
+	n := utf8.RuneCountInString(password)
+	switch {
+	case n < p.MinLength:
+		return &WeakPasswordError{Reason: fmt.Sprintf("must be at least %d characters", p.MinLength)}
+	case n > p.MaxLength:
+		return &WeakPasswordError{Reason: fmt.Sprintf("must be at most %d characters", p.MaxLength)}
+	case login != "" && strings.Contains(strings.ToLower(password), login):
+		return &WeakPasswordError{Reason: "must not contain the login"}
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	policy := PasswordPolicy{MinLength: 12, MaxLength: 16}
+
+	for _, tt := range []struct {
+		password string
+		reason   string
+	}{
+		{password: "correct horse", reason: ""},
+		// the length is counted in characters, not bytes
+		{password: "пароль пароль", reason: ""},
+		{password: "short", reason: "must be at least 12 characters"},
+		{password: "correct horse battery staple", reason: "must be at most 16 characters"},
+		{password: "alice's password", reason: "must not contain the login"},
+		{password: "ALICE's password", reason: "must not contain the login"},
+	} {
+		err := policy.Validate(tt.password, "alice")
+		if tt.reason == "" {
+			assert.NoError(t, err, tt.password)
+			continue
+		}
+		var weak *WeakPasswordError
+		if assert.ErrorAs(t, err, &weak, tt.password) {
+			assert.Equal(t, tt.reason, weak.Reason)
+		}
+		assert.ErrorIs(t, err, ErrWeakPassword)
+	}
+}
+
+func TestValidateLogin(t *testing.T) {
+	assert.NoError(t, ValidateLogin(NormalizeLogin("  Alice@Example.com ")))
+	assert.ErrorIs(t, ValidateLogin("al"), ErrInvalidLogin)
+	assert.ErrorIs(t, ValidateLogin("al ice"), ErrInvalidLogin)
+}
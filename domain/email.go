@@ -0,0 +1,79 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidEmail = errors.New("invalid email")
+	ErrEmailTaken   = errors.New("email taken")
+	// ErrEmailNotSet means the user has no email to verify
+	ErrEmailNotSet               = errors.New("email not set")
+	ErrEmailVerified             = errors.New("email verified")
+	ErrEmailVerificationNotFound = errors.New("email verification not found")
+	ErrInvalidVerificationToken  = errors.New("invalid verification token")
+	ErrVerificationRateLimited   = errors.New("verification rate limited")
+)
+
+// VerificationRateLimitedError is ErrVerificationRateLimited telling when the next request is accepted.
+type VerificationRateLimitedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *VerificationRateLimitedError) Error() string {
+	return fmt.Sprintf("%s: retry after %s", ErrVerificationRateLimited, e.RetryAfter)
+}
+
+func (e *VerificationRateLimitedError) Unwrap() error {
+	return ErrVerificationRateLimited
+}
+
+// maxEmailLength is the limit of the forward-path, https://www.rfc-editor.org/rfc/rfc5321#section-4.5.3.1.3
+const maxEmailLength = 254
+
+// NormalizeEmail makes the emails differing only in case and surrounding spaces the same.
+// The local part is case sensitive by the RFC, but no mail provider in use treats it so.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// ValidateEmail expects a normalized email, a bare address without the display name.
+func ValidateEmail(email string) error {
+	if len(email) > maxEmailLength {
+		return ErrInvalidEmail
+	}
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Name != "" || addr.Address != email {
+		return ErrInvalidEmail
+	}
+	return nil
+}
+
+// EmailVerification is a token mailed to the email of the user, only the hash of the token is stored.
+// It verifies the email it's sent to, the user might have changed the email since.
+type EmailVerification struct {
+	ID     string
+	UserID string
+	Email  string
+	Hash   string
+	// the times are UTC
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+//go:generate mockery --name=EmailVerificationRepository --dir=. --outpkg=mocks --filename=mock_email_verification_repository.go --output=./mocks --structname MockEmailVerificationRepository
+type EmailVerificationRepository interface {
+	// CreateEmailVerification deletes the expired verifications of the user along the way.
+	CreateEmailVerification(ctx context.Context, v EmailVerification) error
+	// RecentEmailVerifications returns the creation times of the verifications of the user created after since,
+	// the oldest first, the verifications are rate limited by them.
+	RecentEmailVerifications(ctx context.Context, userID string, since time.Time) ([]time.Time, error)
+	// ConsumeEmailVerification deletes the verification of the hash and returns it,
+	// it returns ErrEmailVerificationNotFound if there is none or it has expired by the time.
+	ConsumeEmailVerification(ctx context.Context, hash string, at time.Time) (EmailVerification, error)
+}
@@ -0,0 +1,26 @@
+package domain
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateEmail(t *testing.T) {
+	assert.NoError(t, ValidateEmail(NormalizeEmail("  Alice@Example.com ")))
+	assert.NoError(t, ValidateEmail("alice+tag@mail.example.com"))
+
+	for _, email := range []string{
+		"",
+		"alice",
+		"alice@",
+		"@example.com",
+		"Alice <alice@example.com>",
+		"<alice@example.com>",
+		"alice@example.com, bob@example.com",
+		strings.Repeat("a", 250) + "@example.com",
+	} {
+		assert.ErrorIs(t, ValidateEmail(email), ErrInvalidEmail, email)
+	}
+}
@@ -0,0 +1,45 @@
+// Code generated by mockery v2.53.7. DO NOT EDIT.
+
+package mocks
+
+import (
+	domain "github.com/dennypenta/go-api-walkthrough/domain"
+	mock "github.com/stretchr/testify/mock"
+)
+
+// MockAccessPolicy is an autogenerated mock type for the AccessPolicy type
+type MockAccessPolicy struct {
+	mock.Mock
+}
+
+// Decide provides a mock function with given fields: subject, action, resource
+func (_m *MockAccessPolicy) Decide(subject domain.Principal, action string, resource domain.User) domain.Decision {
+	ret := _m.Called(subject, action, resource)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Decide")
+	}
+
+	var r0 domain.Decision
+	if rf, ok := ret.Get(0).(func(domain.Principal, string, domain.User) domain.Decision); ok {
+		r0 = rf(subject, action, resource)
+	} else {
+		r0 = ret.Get(0).(domain.Decision)
+	}
+
+	return r0
+}
+
+// NewMockAccessPolicy creates a new instance of MockAccessPolicy. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewMockAccessPolicy(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *MockAccessPolicy {
+	mock := &MockAccessPolicy{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
@@ -0,0 +1,66 @@
+// Code generated by mockery v2.53.7. DO NOT EDIT.
+
+package mocks
+
+import mock "github.com/stretchr/testify/mock"
+
+// MockAPIKeyGenerator is an autogenerated mock type for the APIKeyGenerator type
+type MockAPIKeyGenerator struct {
+	mock.Mock
+}
+
+// GenerateAPIKey provides a mock function with no fields
+func (_m *MockAPIKeyGenerator) GenerateAPIKey() (string, string, string, error) {
+	ret := _m.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for GenerateAPIKey")
+	}
+
+	var r0 string
+	var r1 string
+	var r2 string
+	var r3 error
+	if rf, ok := ret.Get(0).(func() (string, string, string, error)); ok {
+		return rf()
+	}
+	if rf, ok := ret.Get(0).(func() string); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	if rf, ok := ret.Get(1).(func() string); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Get(1).(string)
+	}
+
+	if rf, ok := ret.Get(2).(func() string); ok {
+		r2 = rf()
+	} else {
+		r2 = ret.Get(2).(string)
+	}
+
+	if rf, ok := ret.Get(3).(func() error); ok {
+		r3 = rf()
+	} else {
+		r3 = ret.Error(3)
+	}
+
+	return r0, r1, r2, r3
+}
+
+// NewMockAPIKeyGenerator creates a new instance of MockAPIKeyGenerator. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewMockAPIKeyGenerator(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *MockAPIKeyGenerator {
+	mock := &MockAPIKeyGenerator{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
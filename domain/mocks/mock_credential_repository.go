@@ -0,0 +1,103 @@
+// Code generated by mockery v2.53.7. DO NOT EDIT.
+
+package mocks
+
+import (
+	context "context"
+
+	domain "github.com/dennypenta/go-api-walkthrough/domain"
+	mock "github.com/stretchr/testify/mock"
+)
+
+// MockCredentialRepository is an autogenerated mock type for the CredentialRepository type
+type MockCredentialRepository struct {
+	mock.Mock
+}
+
+// GetCredentials provides a mock function with given fields: ctx, userID
+func (_m *MockCredentialRepository) GetCredentials(ctx context.Context, userID string) (domain.Credentials, error) {
+	ret := _m.Called(ctx, userID)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetCredentials")
+	}
+
+	var r0 domain.Credentials
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (domain.Credentials, error)); ok {
+		return rf(ctx, userID)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) domain.Credentials); ok {
+		r0 = rf(ctx, userID)
+	} else {
+		r0 = ret.Get(0).(domain.Credentials)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, userID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetCredentialsByLogin provides a mock function with given fields: ctx, login
+func (_m *MockCredentialRepository) GetCredentialsByLogin(ctx context.Context, login string) (domain.Credentials, error) {
+	ret := _m.Called(ctx, login)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetCredentialsByLogin")
+	}
+
+	var r0 domain.Credentials
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (domain.Credentials, error)); ok {
+		return rf(ctx, login)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) domain.Credentials); ok {
+		r0 = rf(ctx, login)
+	} else {
+		r0 = ret.Get(0).(domain.Credentials)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, login)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SetCredentials provides a mock function with given fields: ctx, c
+func (_m *MockCredentialRepository) SetCredentials(ctx context.Context, c domain.Credentials) error {
+	ret := _m.Called(ctx, c)
+
+	if len(ret) == 0 {
+		panic("no return value specified for SetCredentials")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, domain.Credentials) error); ok {
+		r0 = rf(ctx, c)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// NewMockCredentialRepository creates a new instance of MockCredentialRepository. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewMockCredentialRepository(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *MockCredentialRepository {
+	mock := &MockCredentialRepository{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
@@ -0,0 +1,107 @@
+// Code generated by mockery v2.53.7. DO NOT EDIT.
+
+package mocks
+
+import (
+	context "context"
+
+	domain "github.com/dennypenta/go-api-walkthrough/domain"
+	mock "github.com/stretchr/testify/mock"
+
+	time "time"
+)
+
+// MockEmailVerificationRepository is an autogenerated mock type for the EmailVerificationRepository type
+type MockEmailVerificationRepository struct {
+	mock.Mock
+}
+
+// ConsumeEmailVerification provides a mock function with given fields: ctx, hash, at
+func (_m *MockEmailVerificationRepository) ConsumeEmailVerification(ctx context.Context, hash string, at time.Time) (domain.EmailVerification, error) {
+	ret := _m.Called(ctx, hash, at)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ConsumeEmailVerification")
+	}
+
+	var r0 domain.EmailVerification
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, time.Time) (domain.EmailVerification, error)); ok {
+		return rf(ctx, hash, at)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, time.Time) domain.EmailVerification); ok {
+		r0 = rf(ctx, hash, at)
+	} else {
+		r0 = ret.Get(0).(domain.EmailVerification)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, time.Time) error); ok {
+		r1 = rf(ctx, hash, at)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CreateEmailVerification provides a mock function with given fields: ctx, v
+func (_m *MockEmailVerificationRepository) CreateEmailVerification(ctx context.Context, v domain.EmailVerification) error {
+	ret := _m.Called(ctx, v)
+
+	if len(ret) == 0 {
+		panic("no return value specified for CreateEmailVerification")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, domain.EmailVerification) error); ok {
+		r0 = rf(ctx, v)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RecentEmailVerifications provides a mock function with given fields: ctx, userID, since
+func (_m *MockEmailVerificationRepository) RecentEmailVerifications(ctx context.Context, userID string, since time.Time) ([]time.Time, error) {
+	ret := _m.Called(ctx, userID, since)
+
+	if len(ret) == 0 {
+		panic("no return value specified for RecentEmailVerifications")
+	}
+
+	var r0 []time.Time
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, time.Time) ([]time.Time, error)); ok {
+		return rf(ctx, userID, since)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, time.Time) []time.Time); ok {
+		r0 = rf(ctx, userID, since)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]time.Time)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, time.Time) error); ok {
+		r1 = rf(ctx, userID, since)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// NewMockEmailVerificationRepository creates a new instance of MockEmailVerificationRepository. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewMockEmailVerificationRepository(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *MockEmailVerificationRepository {
+	mock := &MockEmailVerificationRepository{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
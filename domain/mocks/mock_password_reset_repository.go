@@ -0,0 +1,121 @@
+// Code generated by mockery v2.53.7. DO NOT EDIT.
+
+package mocks
+
+import (
+	context "context"
+
+	domain "github.com/dennypenta/go-api-walkthrough/domain"
+	mock "github.com/stretchr/testify/mock"
+)
+
+// MockPasswordResetRepository is an autogenerated mock type for the PasswordResetRepository type
+type MockPasswordResetRepository struct {
+	mock.Mock
+}
+
+// CreatePasswordReset provides a mock function with given fields: ctx, r
+func (_m *MockPasswordResetRepository) CreatePasswordReset(ctx context.Context, r domain.PasswordReset) error {
+	ret := _m.Called(ctx, r)
+
+	if len(ret) == 0 {
+		panic("no return value specified for CreatePasswordReset")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, domain.PasswordReset) error); ok {
+		r0 = rf(ctx, r)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// GetPasswordReset provides a mock function with given fields: ctx, hash
+func (_m *MockPasswordResetRepository) GetPasswordReset(ctx context.Context, hash string) (domain.PasswordReset, error) {
+	ret := _m.Called(ctx, hash)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetPasswordReset")
+	}
+
+	var r0 domain.PasswordReset
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (domain.PasswordReset, error)); ok {
+		return rf(ctx, hash)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) domain.PasswordReset); ok {
+		r0 = rf(ctx, hash)
+	} else {
+		r0 = ret.Get(0).(domain.PasswordReset)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, hash)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetUserPasswordReset provides a mock function with given fields: ctx, userID
+func (_m *MockPasswordResetRepository) GetUserPasswordReset(ctx context.Context, userID string) (domain.PasswordReset, error) {
+	ret := _m.Called(ctx, userID)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetUserPasswordReset")
+	}
+
+	var r0 domain.PasswordReset
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (domain.PasswordReset, error)); ok {
+		return rf(ctx, userID)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) domain.PasswordReset); ok {
+		r0 = rf(ctx, userID)
+	} else {
+		r0 = ret.Get(0).(domain.PasswordReset)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, userID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UsePasswordReset provides a mock function with given fields: ctx, id
+func (_m *MockPasswordResetRepository) UsePasswordReset(ctx context.Context, id string) error {
+	ret := _m.Called(ctx, id)
+
+	if len(ret) == 0 {
+		panic("no return value specified for UsePasswordReset")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// NewMockPasswordResetRepository creates a new instance of MockPasswordResetRepository. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewMockPasswordResetRepository(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *MockPasswordResetRepository {
+	mock := &MockPasswordResetRepository{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
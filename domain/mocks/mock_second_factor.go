@@ -0,0 +1,82 @@
+// Code generated by mockery v2.53.7. DO NOT EDIT.
+
+package mocks
+
+import (
+	context "context"
+
+	domain "github.com/dennypenta/go-api-walkthrough/domain"
+	mock "github.com/stretchr/testify/mock"
+)
+
+// MockSecondFactor is an autogenerated mock type for the SecondFactor type
+type MockSecondFactor struct {
+	mock.Mock
+}
+
+// RequireSecondFactor provides a mock function with given fields: ctx, userID, client
+func (_m *MockSecondFactor) RequireSecondFactor(ctx context.Context, userID string, client domain.Client) error {
+	ret := _m.Called(ctx, userID, client)
+
+	if len(ret) == 0 {
+		panic("no return value specified for RequireSecondFactor")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, domain.Client) error); ok {
+		r0 = rf(ctx, userID, client)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// VerifySecondFactor provides a mock function with given fields: ctx, challengeToken, code
+func (_m *MockSecondFactor) VerifySecondFactor(ctx context.Context, challengeToken string, code string) (string, string, error) {
+	ret := _m.Called(ctx, challengeToken, code)
+
+	if len(ret) == 0 {
+		panic("no return value specified for VerifySecondFactor")
+	}
+
+	var r0 string
+	var r1 string
+	var r2 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) (string, string, error)); ok {
+		return rf(ctx, challengeToken, code)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) string); ok {
+		r0 = rf(ctx, challengeToken, code)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) string); ok {
+		r1 = rf(ctx, challengeToken, code)
+	} else {
+		r1 = ret.Get(1).(string)
+	}
+
+	if rf, ok := ret.Get(2).(func(context.Context, string, string) error); ok {
+		r2 = rf(ctx, challengeToken, code)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// NewMockSecondFactor creates a new instance of MockSecondFactor. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewMockSecondFactor(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *MockSecondFactor {
+	mock := &MockSecondFactor{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
@@ -0,0 +1,85 @@
+// Code generated by mockery v2.53.7. DO NOT EDIT.
+
+package mocks
+
+import (
+	context "context"
+
+	domain "github.com/dennypenta/go-api-walkthrough/domain"
+	mock "github.com/stretchr/testify/mock"
+)
+
+// MockTokenIssuer is an autogenerated mock type for the TokenIssuer type
+type MockTokenIssuer struct {
+	mock.Mock
+}
+
+// IssueTokens provides a mock function with given fields: ctx, userID, client
+func (_m *MockTokenIssuer) IssueTokens(ctx context.Context, userID string, client domain.Client) (domain.TokenPair, error) {
+	ret := _m.Called(ctx, userID, client)
+
+	if len(ret) == 0 {
+		panic("no return value specified for IssueTokens")
+	}
+
+	var r0 domain.TokenPair
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, domain.Client) (domain.TokenPair, error)); ok {
+		return rf(ctx, userID, client)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, domain.Client) domain.TokenPair); ok {
+		r0 = rf(ctx, userID, client)
+	} else {
+		r0 = ret.Get(0).(domain.TokenPair)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, domain.Client) error); ok {
+		r1 = rf(ctx, userID, client)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RefreshTokens provides a mock function with given fields: ctx, refreshToken, client
+func (_m *MockTokenIssuer) RefreshTokens(ctx context.Context, refreshToken string, client domain.Client) (domain.TokenPair, error) {
+	ret := _m.Called(ctx, refreshToken, client)
+
+	if len(ret) == 0 {
+		panic("no return value specified for RefreshTokens")
+	}
+
+	var r0 domain.TokenPair
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, domain.Client) (domain.TokenPair, error)); ok {
+		return rf(ctx, refreshToken, client)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, domain.Client) domain.TokenPair); ok {
+		r0 = rf(ctx, refreshToken, client)
+	} else {
+		r0 = ret.Get(0).(domain.TokenPair)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, domain.Client) error); ok {
+		r1 = rf(ctx, refreshToken, client)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// NewMockTokenIssuer creates a new instance of MockTokenIssuer. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewMockTokenIssuer(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *MockTokenIssuer {
+	mock := &MockTokenIssuer{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
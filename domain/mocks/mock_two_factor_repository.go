@@ -0,0 +1,195 @@
+// Code generated by mockery v2.53.7. DO NOT EDIT.
+
+package mocks
+
+import (
+	context "context"
+
+	domain "github.com/dennypenta/go-api-walkthrough/domain"
+	mock "github.com/stretchr/testify/mock"
+
+	time "time"
+)
+
+// MockTwoFactorRepository is an autogenerated mock type for the TwoFactorRepository type
+type MockTwoFactorRepository struct {
+	mock.Mock
+}
+
+// AttemptTwoFactorChallenge provides a mock function with given fields: ctx, hash, at, maxAttempts
+func (_m *MockTwoFactorRepository) AttemptTwoFactorChallenge(ctx context.Context, hash string, at time.Time, maxAttempts int) (domain.TwoFactorChallenge, error) {
+	ret := _m.Called(ctx, hash, at, maxAttempts)
+
+	if len(ret) == 0 {
+		panic("no return value specified for AttemptTwoFactorChallenge")
+	}
+
+	var r0 domain.TwoFactorChallenge
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, time.Time, int) (domain.TwoFactorChallenge, error)); ok {
+		return rf(ctx, hash, at, maxAttempts)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, time.Time, int) domain.TwoFactorChallenge); ok {
+		r0 = rf(ctx, hash, at, maxAttempts)
+	} else {
+		r0 = ret.Get(0).(domain.TwoFactorChallenge)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, time.Time, int) error); ok {
+		r1 = rf(ctx, hash, at, maxAttempts)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CreateTwoFactorChallenge provides a mock function with given fields: ctx, c
+func (_m *MockTwoFactorRepository) CreateTwoFactorChallenge(ctx context.Context, c domain.TwoFactorChallenge) error {
+	ret := _m.Called(ctx, c)
+
+	if len(ret) == 0 {
+		panic("no return value specified for CreateTwoFactorChallenge")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, domain.TwoFactorChallenge) error); ok {
+		r0 = rf(ctx, c)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteTwoFactorChallenge provides a mock function with given fields: ctx, id
+func (_m *MockTwoFactorRepository) DeleteTwoFactorChallenge(ctx context.Context, id string) error {
+	ret := _m.Called(ctx, id)
+
+	if len(ret) == 0 {
+		panic("no return value specified for DeleteTwoFactorChallenge")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// EnableTOTP provides a mock function with given fields: ctx, userID, at, recoveryCodeHashes
+func (_m *MockTwoFactorRepository) EnableTOTP(ctx context.Context, userID string, at time.Time, recoveryCodeHashes []string) error {
+	ret := _m.Called(ctx, userID, at, recoveryCodeHashes)
+
+	if len(ret) == 0 {
+		panic("no return value specified for EnableTOTP")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, time.Time, []string) error); ok {
+		r0 = rf(ctx, userID, at, recoveryCodeHashes)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// GetTOTP provides a mock function with given fields: ctx, userID
+func (_m *MockTwoFactorRepository) GetTOTP(ctx context.Context, userID string) (domain.TOTP, error) {
+	ret := _m.Called(ctx, userID)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetTOTP")
+	}
+
+	var r0 domain.TOTP
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (domain.TOTP, error)); ok {
+		return rf(ctx, userID)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) domain.TOTP); ok {
+		r0 = rf(ctx, userID)
+	} else {
+		r0 = ret.Get(0).(domain.TOTP)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, userID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SetTOTPSecret provides a mock function with given fields: ctx, userID, secret
+func (_m *MockTwoFactorRepository) SetTOTPSecret(ctx context.Context, userID string, secret string) error {
+	ret := _m.Called(ctx, userID, secret)
+
+	if len(ret) == 0 {
+		panic("no return value specified for SetTOTPSecret")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) error); ok {
+		r0 = rf(ctx, userID, secret)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// UseRecoveryCode provides a mock function with given fields: ctx, userID, hash, at
+func (_m *MockTwoFactorRepository) UseRecoveryCode(ctx context.Context, userID string, hash string, at time.Time) error {
+	ret := _m.Called(ctx, userID, hash, at)
+
+	if len(ret) == 0 {
+		panic("no return value specified for UseRecoveryCode")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, time.Time) error); ok {
+		r0 = rf(ctx, userID, hash, at)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// UseTOTPStep provides a mock function with given fields: ctx, userID, step
+func (_m *MockTwoFactorRepository) UseTOTPStep(ctx context.Context, userID string, step int64) error {
+	ret := _m.Called(ctx, userID, step)
+
+	if len(ret) == 0 {
+		panic("no return value specified for UseTOTPStep")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64) error); ok {
+		r0 = rf(ctx, userID, step)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// NewMockTwoFactorRepository creates a new instance of MockTwoFactorRepository. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewMockTwoFactorRepository(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *MockTwoFactorRepository {
+	mock := &MockTwoFactorRepository{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
@@ -1,4 +1,4 @@
-// Code generated by mockery v2.43.2. DO NOT EDIT.
+// Code generated by mockery v2.53.7. DO NOT EDIT.
 
 package mocks
 
@@ -7,6 +7,8 @@ import (
 
 	domain "github.com/dennypenta/go-api-walkthrough/domain"
 	mock "github.com/stretchr/testify/mock"
+
+	time "time"
 )
 
 // MockUserRepository is an autogenerated mock type for the UserRepository type
@@ -125,6 +127,24 @@ func (_m *MockUserRepository) ListUsers(ctx context.Context, filter domain.UserF
 	return r0, r1, r2
 }
 
+// RestoreUser provides a mock function with given fields: ctx, id
+func (_m *MockUserRepository) RestoreUser(ctx context.Context, id string) error {
+	ret := _m.Called(ctx, id)
+
+	if len(ret) == 0 {
+		panic("no return value specified for RestoreUser")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // UpdateUser provides a mock function with given fields: ctx, user
 func (_m *MockUserRepository) UpdateUser(ctx context.Context, user domain.User) (domain.User, error) {
 	ret := _m.Called(ctx, user)
@@ -153,6 +173,52 @@ func (_m *MockUserRepository) UpdateUser(ctx context.Context, user domain.User)
 	return r0, r1
 }
 
+// UpdateUsername provides a mock function with given fields: ctx, id, username
+func (_m *MockUserRepository) UpdateUsername(ctx context.Context, id string, username string) (domain.User, error) {
+	ret := _m.Called(ctx, id, username)
+
+	if len(ret) == 0 {
+		panic("no return value specified for UpdateUsername")
+	}
+
+	var r0 domain.User
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) (domain.User, error)); ok {
+		return rf(ctx, id, username)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) domain.User); ok {
+		r0 = rf(ctx, id, username)
+	} else {
+		r0 = ret.Get(0).(domain.User)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, id, username)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// VerifyEmail provides a mock function with given fields: ctx, id, email, at
+func (_m *MockUserRepository) VerifyEmail(ctx context.Context, id string, email string, at time.Time) error {
+	ret := _m.Called(ctx, id, email, at)
+
+	if len(ret) == 0 {
+		panic("no return value specified for VerifyEmail")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, time.Time) error); ok {
+		r0 = rf(ctx, id, email, at)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // NewMockUserRepository creates a new instance of MockUserRepository. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
 // The first argument is typically a *testing.T value.
 func NewMockUserRepository(t interface {
@@ -4,25 +4,61 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"time"
 )
 
 var (
 	ErrUserNotFound    = errors.New("user not found")
 	ErrInvalidUsername = errors.New("invalid username")
+	// ErrUnavailable means the storage is overloaded or down, the call might succeed later
+	ErrUnavailable = errors.New("storage unavailable")
 )
 
+// UnavailableError is ErrUnavailable telling when the storage is expected back.
+type UnavailableError struct {
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *UnavailableError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrUnavailable, e.Err)
+}
+
+func (e *UnavailableError) Unwrap() []error {
+	return []error{ErrUnavailable, e.Err}
+}
+
 type User struct {
 	ID       string `json:"id"`
 	Username string `json:"username"`
+	// Email is optional, no two users have the same one
+	Email string `json:"email,omitempty"`
+	// EmailVerifiedAt is set once the user has proven the email is theirs, a changed email isn't verified
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+	// Stale is set when the storage is unavailable and the user is the last known one
+	Stale bool `json:"stale,omitempty"`
 }
 
 func (u User) Validate() error {
 	if len(u.Username) < 3 {
 		return ErrInvalidUsername
 	}
+	if u.Email != "" {
+		return ValidateEmail(NormalizeEmail(u.Email))
+	}
 	return nil
 }
 
+// UserRecord is a user with the storage state that is not exposed to the api.
+// It's used to load fixtures with the known ids and timestamps.
+type UserRecord struct {
+	User
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt *time.Time
+}
+
 type UserFilter struct {
 	Limit  int
 	Offset int
@@ -39,6 +75,9 @@ type PaginatedUserList struct {
 	Pages int    `json:"pages"`
 	Prev  string `json:"prev"`
 	Next  string `json:"next"`
+
+	// Stale is set when the storage is unavailable and the page is the last known one
+	Stale bool `json:"stale,omitempty"`
 }
 
 func (l *PaginatedUserList) EnrichHttpQueryLinks() {
@@ -0,0 +1,39 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	ErrPasswordResetNotFound = errors.New("password reset not found")
+	// ErrInvalidResetToken is any reset token that can't be used: unknown, expired, used or replaced.
+	ErrInvalidResetToken = errors.New("invalid reset token")
+)
+
+// PasswordReset is a token mailed to the verified email of the user to set a new password, only its hash is stored.
+// A user has one reset at most, a new one replaces the previous.
+type PasswordReset struct {
+	ID     string
+	UserID string
+	// Login is the login the reset is asked for, the reset is refused if the credentials have changed since
+	Login string
+	Hash  string
+	// the times are UTC
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+//go:generate mockery --name=PasswordResetRepository --dir=. --outpkg=mocks --filename=mock_password_reset_repository.go --output=./mocks --structname MockPasswordResetRepository
+type PasswordResetRepository interface {
+	// CreatePasswordReset replaces the reset of a not deleted user, it returns ErrUserNotFound if there is no such user.
+	CreatePasswordReset(ctx context.Context, r PasswordReset) error
+	// GetPasswordReset returns ErrPasswordResetNotFound if there is no such hash or the user is deleted.
+	GetPasswordReset(ctx context.Context, hash string) (PasswordReset, error)
+	// GetUserPasswordReset returns ErrPasswordResetNotFound if the user has no reset.
+	GetUserPasswordReset(ctx context.Context, userID string) (PasswordReset, error)
+	// UsePasswordReset deletes the reset, it returns ErrPasswordResetNotFound if it's used or replaced already,
+	// so only one of the concurrent resets wins.
+	UsePasswordReset(ctx context.Context, id string) error
+}
@@ -0,0 +1,136 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+)
+
+// The actions UserService authorizes, the policies grant them by these names.
+const (
+	ActionReadUser    = "users:read"
+	ActionListUsers   = "users:list"
+	ActionCreateUser  = "users:create"
+	ActionUpdateUser  = "users:update"
+	ActionDeleteUser  = "users:delete"
+	ActionRestoreUser = "users:restore"
+)
+
+// Actions lists every action of UserService.
+var Actions = []string{ActionReadUser, ActionListUsers, ActionCreateUser, ActionUpdateUser, ActionDeleteUser, ActionRestoreUser}
+
+var ErrInvalidAction = errors.New("invalid action")
+
+func ValidateAction(action string) error {
+	if !slices.Contains(Actions, action) {
+		return fmt.Errorf("%w: %q", ErrInvalidAction, action)
+	}
+	return nil
+}
+
+// Decision is the outcome of a policy check.
+type Decision struct {
+	Allowed bool `json:"allowed"`
+	// Rule names the rule that has decided, it's empty when no rule matched
+	Rule   string `json:"rule,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// AccessPolicy decides whether the subject may do the action with the user.
+//
+//go:generate mockery --name=AccessPolicy --dir=. --outpkg=mocks --filename=mock_access_policy.go --output=./mocks --structname MockAccessPolicy
+type AccessPolicy interface {
+	Decide(subject Principal, action string, resource User) Decision
+}
+
+// WithPolicy makes the service check every call against the policy for the principal of the ctx.
+// Without a policy nothing is checked, e.g. userctl acts as the operator.
+func (s *UserService) WithPolicy(p AccessPolicy) *UserService {
+	s.policy = p
+	return s
+}
+
+// WithAuditLogger makes the service write the denials of its policy to the audit log,
+// the dry runs of CheckAccess aren't written.
+func (s *UserService) WithAuditLogger(l *slog.Logger) *UserService {
+	s.audit = l
+	return s
+}
+
+// CheckAccess tells what the policy decides for the subject without doing the action.
+// The resource id is empty for the actions not about a particular user.
+func (s *UserService) CheckAccess(ctx context.Context, subject Principal, action, resourceID string) (Decision, error) {
+	if err := ValidateAction(action); err != nil {
+		return Decision{}, err
+	}
+	if s.policy == nil {
+		return Decision{Allowed: true, Reason: "no policy is enforced"}, nil
+	}
+
+	resource, err := s.resource(ctx, action, resourceID)
+	if err != nil {
+		return Decision{}, err
+	}
+	return s.policy.Decide(subject, action, resource), nil
+}
+
+// authorize returns ErrForbidden telling the reason if the principal of the ctx isn't allowed the action.
+func (s *UserService) authorize(ctx context.Context, action string, resource User) error {
+	if s.policy == nil {
+		return nil
+	}
+	p, ok := PrincipalFromContext(ctx)
+	if !ok {
+		return ErrUnauthenticated
+	}
+
+	d := s.policy.Decide(p, action, resource)
+	if !d.Allowed {
+		if s.audit != nil {
+			s.audit.WarnContext(ctx, "access denied",
+				"principalID", p.ID,
+				"roles", p.Roles,
+				"permission", action,
+				"resourceID", resource.ID,
+				"rule", d.Rule,
+				"reason", d.Reason,
+			)
+		}
+		return fmt.Errorf("%w: %s", ErrForbidden, d.Reason)
+	}
+	return nil
+}
+
+// authorizeID loads the user the action is about, so the policy sees its attributes.
+func (s *UserService) authorizeID(ctx context.Context, action, id string) error {
+	if s.policy == nil {
+		return nil
+	}
+	resource, err := s.resource(ctx, action, id)
+	if err != nil {
+		return s.authorizeMissing(ctx, action, id, err)
+	}
+	return s.authorize(ctx, action, resource)
+}
+
+// authorizeMissing decides the action on the user failed to load by the id only,
+// so a principal not allowed the action gets ErrForbidden and doesn't learn whether the user exists.
+func (s *UserService) authorizeMissing(ctx context.Context, action, id string, err error) error {
+	if !errors.Is(err, ErrUserNotFound) {
+		return err
+	}
+	if err := s.authorize(ctx, action, User{ID: id}); err != nil {
+		return err
+	}
+	return err
+}
+
+func (s *UserService) resource(ctx context.Context, action, id string) (User, error) {
+	// a deleted user can't be loaded, the restore is decided by the id only
+	if id == "" || action == ActionRestoreUser {
+		return User{ID: id}, nil
+	}
+	return s.repo.GetUserByID(ctx, id)
+}
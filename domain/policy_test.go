@@ -0,0 +1,79 @@
+package domain_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/domain/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestUserServicePolicy(t *testing.T) {
+	user := domain.User{ID: "8da80ba8-81c6-4336-bba3-ba8ea50541b0", Username: "alice"}
+	principal := domain.Principal{ID: "1", Roles: []string{domain.RoleMember}}
+	ctx := domain.ContextWithPrincipal(context.Background(), principal)
+
+	t.Run("denied action isn't done", func(t *testing.T) {
+		repo := mocks.NewMockUserRepository(t)
+		policy := mocks.NewMockAccessPolicy(t)
+		repo.On("GetUserByID", mock.Anything, user.ID).Return(user, nil)
+		policy.On("Decide", principal, domain.ActionDeleteUser, user).Return(domain.Decision{Reason: "no rule allows users:delete"})
+
+		var audit bytes.Buffer
+		err := domain.NewUserService(repo, mocks.NewMockTxManager(t)).WithPolicy(policy).
+			WithAuditLogger(slog.New(slog.NewTextHandler(&audit, nil))).DeleteUser(ctx, user.ID)
+		assert.ErrorIs(t, err, domain.ErrForbidden)
+		assert.ErrorContains(t, err, "no rule allows users:delete")
+		assert.Contains(t, audit.String(), `msg="access denied" principalID=1`)
+		assert.Contains(t, audit.String(), "permission=users:delete resourceID="+user.ID)
+	})
+
+	t.Run("denied action doesn't tell the user is missing", func(t *testing.T) {
+		repo := mocks.NewMockUserRepository(t)
+		policy := mocks.NewMockAccessPolicy(t)
+		repo.On("GetUserByID", mock.Anything, user.ID).Return(domain.User{}, domain.ErrUserNotFound)
+		policy.On("Decide", principal, domain.ActionDeleteUser, domain.User{ID: user.ID}).Return(domain.Decision{Reason: "no rule allows users:delete"}).Once()
+		policy.On("Decide", principal, domain.ActionReadUser, domain.User{ID: user.ID}).Return(domain.Decision{Allowed: true}).Once()
+
+		service := domain.NewUserService(repo, mocks.NewMockTxManager(t)).WithPolicy(policy)
+		assert.ErrorIs(t, service.DeleteUser(ctx, user.ID), domain.ErrForbidden)
+		_, err := service.GetUserByID(ctx, user.ID)
+		assert.ErrorIs(t, err, domain.ErrUserNotFound)
+	})
+
+	t.Run("allowed action is done", func(t *testing.T) {
+		repo := mocks.NewMockUserRepository(t)
+		policy := mocks.NewMockAccessPolicy(t)
+		repo.On("GetUserByID", mock.Anything, user.ID).Return(user, nil)
+		repo.On("DeleteUser", mock.Anything, user.ID).Return(nil)
+		policy.On("Decide", principal, domain.ActionDeleteUser, user).Return(domain.Decision{Allowed: true})
+
+		err := domain.NewUserService(repo, mocks.NewMockTxManager(t)).WithPolicy(policy).DeleteUser(ctx, user.ID)
+		assert.NoError(t, err)
+	})
+
+	t.Run("anonymous call", func(t *testing.T) {
+		service := domain.NewUserService(mocks.NewMockUserRepository(t), mocks.NewMockTxManager(t)).WithPolicy(mocks.NewMockAccessPolicy(t))
+		_, err := service.ListUsers(context.Background(), domain.UserFilter{Limit: 10})
+		assert.ErrorIs(t, err, domain.ErrUnauthenticated)
+	})
+
+	t.Run("check access is a dry run", func(t *testing.T) {
+		repo := mocks.NewMockUserRepository(t)
+		policy := mocks.NewMockAccessPolicy(t)
+		repo.On("GetUserByID", mock.Anything, user.ID).Return(user, nil)
+		policy.On("Decide", principal, domain.ActionUpdateUser, user).Return(domain.Decision{Allowed: true, Rule: "self"})
+
+		d, err := domain.NewUserService(repo, mocks.NewMockTxManager(t)).WithPolicy(policy).
+			CheckAccess(context.Background(), principal, domain.ActionUpdateUser, user.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, domain.Decision{Allowed: true, Rule: "self"}, d)
+
+		_, err = domain.NewUserService(repo, mocks.NewMockTxManager(t)).CheckAccess(context.Background(), principal, "users:drop", "")
+		assert.ErrorIs(t, err, domain.ErrInvalidAction)
+	})
+}
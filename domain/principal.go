@@ -0,0 +1,49 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"slices"
+)
+
+var (
+	// ErrUnauthenticated means the request has no credentials and the operation needs them.
+	ErrUnauthenticated = errors.New("unauthenticated")
+	// ErrInvalidAccessToken is a token that is malformed, expired or signed with an unknown key.
+	ErrInvalidAccessToken = errors.New("invalid access token")
+	// ErrForbidden means the principal isn't allowed the operation.
+	ErrForbidden = errors.New("forbidden")
+)
+
+// Principal is the authenticated caller.
+type Principal struct {
+	// ID is the user id
+	ID       string
+	Roles    []string
+	Scopes   []string
+	TenantID string
+	// SessionID is empty unless the caller has signed in
+	SessionID string
+	// APIKeyID is set when the caller is an API key, ID is the key id then
+	APIKeyID string
+}
+
+func (p Principal) HasRole(role string) bool {
+	return slices.Contains(p.Roles, role)
+}
+
+func (p Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope)
+}
+
+type principalKey struct{}
+
+func ContextWithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext returns false for an anonymous request.
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
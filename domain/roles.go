@@ -0,0 +1,76 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// The roles a user is granted, every user is a member unless the other roles are stored.
+const (
+	RoleAdmin   = "admin"
+	RoleSupport = "support"
+	RoleMember  = "member"
+)
+
+var ErrInvalidRole = errors.New("invalid role")
+
+// ValidateRoles expects at least one known role.
+func ValidateRoles(roles []string) error {
+	if len(roles) == 0 {
+		return fmt.Errorf("%w: at least one role is required", ErrInvalidRole)
+	}
+	for _, role := range roles {
+		if role != RoleAdmin && role != RoleSupport && role != RoleMember {
+			return fmt.Errorf("%w: %q", ErrInvalidRole, role)
+		}
+	}
+	return nil
+}
+
+//go:generate mockery --name=RoleRepository --dir=. --outpkg=mocks --filename=mock_role_repository.go --output=./mocks --structname MockRoleRepository
+type RoleRepository interface {
+	// GetRoles returns the stored roles sorted, it's empty if there are none.
+	GetRoles(ctx context.Context, userID string) ([]string, error)
+	// SetRoles replaces the roles of a not deleted user, it returns ErrUserNotFound if there is no such user.
+	SetRoles(ctx context.Context, userID string, roles []string) error
+}
+
+type RoleService struct {
+	repo RoleRepository
+	tx   TxManager
+}
+
+func NewRoleService(repo RoleRepository, tx TxManager) *RoleService {
+	return &RoleService{
+		repo: repo,
+		tx:   tx,
+	}
+}
+
+// GetRoles returns the member role for a user without the stored ones.
+func (s *RoleService) GetRoles(ctx context.Context, userID string) ([]string, error) {
+	roles, err := s.repo.GetRoles(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(roles) == 0 {
+		return []string{RoleMember}, nil
+	}
+	return roles, nil
+}
+
+// SetRoles replaces the roles of the user, they take effect with the next access token.
+func (s *RoleService) SetRoles(ctx context.Context, userID string, roles []string) error {
+	if err := ValidateRoles(roles); err != nil {
+		return err
+	}
+	roles = slices.Clone(roles)
+	slices.Sort(roles)
+	roles = slices.Compact(roles)
+
+	return s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		return s.repo.SetRoles(ctx, userID, roles)
+	})
+}
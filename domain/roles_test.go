@@ -0,0 +1,47 @@
+package domain_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/domain/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestRoleService(t *testing.T) {
+	inTx := func(ctx context.Context, fn func(ctx context.Context) error) error {
+		return fn(ctx)
+	}
+	const id = "8da80ba8-81c6-4336-bba3-ba8ea50541b0"
+
+	t.Run("a user without roles is a member", func(t *testing.T) {
+		repo := mocks.NewMockRoleRepository(t)
+		repo.On("GetRoles", mock.Anything, id).Return([]string{}, nil)
+
+		roles, err := domain.NewRoleService(repo, mocks.NewMockTxManager(t)).GetRoles(context.Background(), id)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{domain.RoleMember}, roles)
+	})
+
+	t.Run("roles are stored sorted without duplicates", func(t *testing.T) {
+		repo := mocks.NewMockRoleRepository(t)
+		tx := mocks.NewMockTxManager(t)
+		tx.On("WithinTx", mock.Anything, mock.Anything).Return(inTx).Once()
+		repo.On("SetRoles", mock.Anything, id, []string{domain.RoleAdmin, domain.RoleSupport}).Return(nil)
+
+		err := domain.NewRoleService(repo, tx).SetRoles(context.Background(), id, []string{"support", "admin", "support"})
+		assert.NoError(t, err)
+	})
+
+	for name, roles := range map[string][]string{
+		"no roles":     nil,
+		"unknown role": {"member", "root"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := domain.NewRoleService(mocks.NewMockRoleRepository(t), mocks.NewMockTxManager(t)).SetRoles(context.Background(), id, roles)
+			assert.ErrorIs(t, err, domain.ErrInvalidRole)
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// Client describes the device a request comes from.
+type Client struct {
+	// Device is the name the client gives itself on sign in, e.g. "Alice's phone"
+	Device    string
+	UserAgent string
+	IP        string
+}
+
+// Session is a signed in device, its refresh tokens are rotated within it.
+// Revoking the session signs the device out: its refresh tokens can't be exchanged and its access tokens are refused.
+type Session struct {
+	ID        string `json:"id"`
+	UserID    string `json:"-"`
+	Device    string `json:"device"`
+	UserAgent string `json:"user_agent"`
+	IP        string `json:"ip"`
+	// CreatedAt and LastSeenAt are UTC, the session is seen on every refresh
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	// Current is the session of the request listing the sessions
+	Current bool `json:"current"`
+}
+
+//go:generate mockery --name=SessionRepository --dir=. --outpkg=mocks --filename=mock_session_repository.go --output=./mocks --structname MockSessionRepository
+type SessionRepository interface {
+	CreateSession(ctx context.Context, s Session) error
+	// TouchSession records the user agent and the ip of the active session seen at the time, the device stays.
+	// It returns ErrSessionNotFound if the session is revoked or unknown.
+	TouchSession(ctx context.Context, id string, client Client, at time.Time) error
+	// IsSessionActive tells whether the session exists, isn't revoked and its user isn't deleted.
+	IsSessionActive(ctx context.Context, id string) (bool, error)
+	// ListSessions returns the active sessions of the user, the last seen first.
+	ListSessions(ctx context.Context, userID string) ([]Session, error)
+	// RevokeSession returns ErrSessionNotFound if the user has no such active session.
+	RevokeSession(ctx context.Context, userID, id string) error
+	// RevokeOtherSessions revokes every active session of the user but the given one and returns their ids.
+	RevokeOtherSessions(ctx context.Context, userID, exceptID string) ([]string, error)
+}
+
+type SessionService struct {
+	repo SessionRepository
+}
+
+func NewSessionService(repo SessionRepository) *SessionService {
+	return &SessionService{
+		repo: repo,
+	}
+}
+
+// ListSessions marks the current session of the caller.
+func (s *SessionService) ListSessions(ctx context.Context, userID, currentID string) ([]Session, error) {
+	sessions, err := s.repo.ListSessions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentID
+	}
+	return sessions, nil
+}
+
+// RevokeSession signs the device out, the current one included.
+func (s *SessionService) RevokeSession(ctx context.Context, userID, id string) error {
+	return s.repo.RevokeSession(ctx, userID, id)
+}
+
+// RevokeOtherSessions signs out every device of the user but the current one,
+// all of them when there is no current session.
+func (s *SessionService) RevokeOtherSessions(ctx context.Context, userID, currentID string) error {
+	_, err := s.repo.RevokeOtherSessions(ctx, userID, currentID)
+	return err
+}
@@ -0,0 +1,31 @@
+package domain_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/domain/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestSessionService(t *testing.T) {
+	const userID = "8da80ba8-81c6-4336-bba3-ba8ea50541b0"
+
+	t.Run("the current session is marked", func(t *testing.T) {
+		repo := mocks.NewMockSessionRepository(t)
+		repo.On("ListSessions", mock.Anything, userID).Return([]domain.Session{{ID: "1"}, {ID: "2"}}, nil)
+
+		sessions, err := domain.NewSessionService(repo).ListSessions(context.Background(), userID, "2")
+		assert.NoError(t, err)
+		assert.Equal(t, []domain.Session{{ID: "1"}, {ID: "2", Current: true}}, sessions)
+	})
+
+	t.Run("the current session is kept", func(t *testing.T) {
+		repo := mocks.NewMockSessionRepository(t)
+		repo.On("RevokeOtherSessions", mock.Anything, userID, "2").Return([]string{"1"}, nil)
+
+		assert.NoError(t, domain.NewSessionService(repo).RevokeOtherSessions(context.Background(), userID, "2"))
+	})
+}
@@ -0,0 +1,22 @@
+package domain
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+type staleKey struct{}
+
+// MarkStale tells the service the repository has served the last known value
+// because the storage is unavailable, the response is marked as stale then.
+func MarkStale(ctx context.Context) {
+	if stale, ok := ctx.Value(staleKey{}).(*atomic.Bool); ok {
+		stale.Store(true)
+	}
+}
+
+// trackStale returns the ctx the repository can mark stale and the mark.
+func trackStale(ctx context.Context) (context.Context, *atomic.Bool) {
+	stale := &atomic.Bool{}
+	return context.WithValue(ctx, staleKey{}, stale), stale
+}
@@ -0,0 +1,39 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrInvalidRefreshToken is any refresh token that can't be exchanged: unknown, expired, revoked or reused.
+	ErrInvalidRefreshToken  = errors.New("invalid refresh token")
+	ErrRefreshTokenNotFound = errors.New("refresh token not found")
+	// ErrRefreshTokenReused means the token was exchanged already, it might be stolen.
+	ErrRefreshTokenReused = errors.New("refresh token reused")
+)
+
+// RefreshToken is an opaque token the client exchanges for a new pair, only its hash is stored.
+// Every exchange issues the next token of the same session, the session is revoked once an exchanged token comes back.
+type RefreshToken struct {
+	ID        string
+	SessionID string
+	UserID    string
+	Hash      string
+	// ExpiresAt is UTC
+	ExpiresAt time.Time
+	Used      bool
+	// Revoked is set when the session is revoked
+	Revoked bool
+}
+
+//go:generate mockery --name=RefreshTokenRepository --dir=. --outpkg=mocks --filename=mock_refresh_token_repository.go --output=./mocks --structname MockRefreshTokenRepository
+type RefreshTokenRepository interface {
+	CreateRefreshToken(ctx context.Context, t RefreshToken) error
+	// GetRefreshToken returns ErrRefreshTokenNotFound if there is no such hash or the user is deleted.
+	GetRefreshToken(ctx context.Context, hash string) (RefreshToken, error)
+	// UseRefreshToken marks the token exchanged, it returns ErrRefreshTokenReused if it's exchanged or revoked already,
+	// so only one of the concurrent exchanges wins.
+	UseRefreshToken(ctx context.Context, id string) error
+}
@@ -0,0 +1,108 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	ErrTOTPNotFound = errors.New("totp not found")
+	// ErrTOTPEnabled means the enrollment is confirmed already, it can't be started again.
+	ErrTOTPEnabled = errors.New("totp enabled")
+	// ErrTOTPCodeUsed means a code of the same or a later time step is accepted already.
+	ErrTOTPCodeUsed               = errors.New("totp code used")
+	ErrRecoveryCodeNotFound       = errors.New("recovery code not found")
+	ErrTwoFactorChallengeNotFound = errors.New("two-factor challenge not found")
+	// ErrInvalidTwoFactorCode is a code that doesn't pass the challenge: wrong, used or of a TOTP that isn't enabled.
+	ErrInvalidTwoFactorCode = errors.New("invalid two-factor code")
+	// ErrInvalidChallenge is a challenge token that can't be passed: unknown, expired, passed or out of attempts.
+	ErrInvalidChallenge  = errors.New("invalid two-factor challenge")
+	ErrTwoFactorRequired = errors.New("two-factor authentication required")
+)
+
+// TwoFactorRequiredError is ErrTwoFactorRequired carrying the challenge the login is finished with.
+type TwoFactorRequiredError struct {
+	ChallengeToken string
+	// ExpiresIn is the challenge lifetime in seconds
+	ExpiresIn int
+}
+
+func (e *TwoFactorRequiredError) Error() string {
+	return ErrTwoFactorRequired.Error()
+}
+
+func (e *TwoFactorRequiredError) Unwrap() error {
+	return ErrTwoFactorRequired
+}
+
+// TOTP is the authenticator app of the user, https://www.rfc-editor.org/rfc/rfc6238.
+// The secret has to be kept as is to generate the codes, so the storage must be protected like the signing keys.
+type TOTP struct {
+	UserID string
+	Secret string
+	// EnabledAt is set once the enrollment is confirmed with a code, UTC
+	EnabledAt *time.Time
+	// LastUsedStep is the time step of the last accepted code, a code of it or an earlier one isn't accepted again
+	LastUsedStep int64
+}
+
+func (t TOTP) Enabled() bool {
+	return t.EnabledAt != nil
+}
+
+// TOTPEnrollment is shown once to be added to an authenticator app.
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	// URI is the otpauth key URI, it's usually shown as a QR code
+	URI string `json:"uri"`
+}
+
+// TwoFactorChallenge is the step between the password and the second factor, only the hash of its token is stored.
+type TwoFactorChallenge struct {
+	ID     string
+	UserID string
+	Hash   string
+	// Device is the one the login names, the session is started with it
+	Device string
+	// the times are UTC
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	// Attempts is the amount of the codes tried
+	Attempts int
+}
+
+//go:generate mockery --name=TwoFactorRepository --dir=. --outpkg=mocks --filename=mock_two_factor_repository.go --output=./mocks --structname MockTwoFactorRepository
+type TwoFactorRepository interface {
+	// SetTOTPSecret starts the enrollment of the user or starts it again while it isn't confirmed.
+	// It returns ErrUserNotFound if there is no such user and ErrTOTPEnabled if the user has confirmed one already.
+	SetTOTPSecret(ctx context.Context, userID, secret string) error
+	// GetTOTP returns ErrTOTPNotFound if the user hasn't started the enrollment or is deleted.
+	GetTOTP(ctx context.Context, userID string) (TOTP, error)
+	// EnableTOTP confirms the enrollment at the time and stores the hashes of the recovery codes,
+	// it returns ErrTOTPEnabled unless there is an enrollment to confirm.
+	EnableTOTP(ctx context.Context, userID string, at time.Time, recoveryCodeHashes []string) error
+	// UseTOTPStep records the time step of an accepted code, it returns ErrTOTPCodeUsed unless the step is later
+	// than the last used one, so a code is accepted once and only one of the concurrent logins wins.
+	UseTOTPStep(ctx context.Context, userID string, step int64) error
+	// UseRecoveryCode returns ErrRecoveryCodeNotFound if the user has no such unused code.
+	UseRecoveryCode(ctx context.Context, userID, hash string, at time.Time) error
+	// CreateTwoFactorChallenge deletes the challenges of the user expired by the time it's created.
+	CreateTwoFactorChallenge(ctx context.Context, c TwoFactorChallenge) error
+	// AttemptTwoFactorChallenge counts an attempt and returns the challenge with it,
+	// it returns ErrTwoFactorChallengeNotFound if there is no such hash, it's expired at the time or has maxAttempts already.
+	AttemptTwoFactorChallenge(ctx context.Context, hash string, at time.Time, maxAttempts int) (TwoFactorChallenge, error)
+	// DeleteTwoFactorChallenge returns ErrTwoFactorChallengeNotFound if it's deleted already.
+	DeleteTwoFactorChallenge(ctx context.Context, id string) error
+}
+
+// SecondFactor stands between the password and the tokens of the users who have enabled it.
+//
+//go:generate mockery --name=SecondFactor --dir=. --outpkg=mocks --filename=mock_second_factor.go --output=./mocks --structname MockSecondFactor
+type SecondFactor interface {
+	// RequireSecondFactor returns TwoFactorRequiredError with a new challenge if the user has the second factor enabled, nil otherwise.
+	RequireSecondFactor(ctx context.Context, userID string, client Client) error
+	// VerifySecondFactor passes the challenge with a TOTP or a recovery code,
+	// it returns the user and the device the challenge is issued for.
+	VerifySecondFactor(ctx context.Context, challengeToken, code string) (userID, device string, err error)
+}
@@ -0,0 +1,52 @@
+package domain
+
+import (
+	"context"
+	"sync"
+)
+
+type txContextKey struct{}
+
+// txHooks is what the caches see of the transaction, the storage keeps the transaction itself.
+type txHooks struct {
+	mu          sync.Mutex
+	afterCommit []func()
+}
+
+// ContextWithTx marks ctx as running in a transaction, a TxManager calls it when it begins one.
+// The TxManager calls the returned commit once the transaction is committed, it runs the AfterCommit callbacks.
+func ContextWithTx(ctx context.Context) (context.Context, func()) {
+	hooks := &txHooks{}
+	return context.WithValue(ctx, txContextKey{}, hooks), hooks.commit
+}
+
+// InTx reports whether ctx runs in a transaction, its reads might see the rows not committed yet.
+func InTx(ctx context.Context) bool {
+	_, ok := ctx.Value(txContextKey{}).(*txHooks)
+	return ok
+}
+
+// AfterCommit runs fn once the transaction of ctx is committed, a rolled back one drops it.
+// Without a transaction fn runs right away.
+func AfterCommit(ctx context.Context, fn func()) {
+	hooks, ok := ctx.Value(txContextKey{}).(*txHooks)
+	if !ok {
+		fn()
+		return
+	}
+
+	hooks.mu.Lock()
+	defer hooks.mu.Unlock()
+	hooks.afterCommit = append(hooks.afterCommit, fn)
+}
+
+func (h *txHooks) commit() {
+	h.mu.Lock()
+	fns := h.afterCommit
+	h.afterCommit = nil
+	h.mu.Unlock()
+
+	for _, fn := range fns {
+		fn()
+	}
+}
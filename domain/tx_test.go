@@ -0,0 +1,30 @@
+package domain_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAfterCommit(t *testing.T) {
+	var calls []string
+	domain.AfterCommit(context.Background(), func() { calls = append(calls, "no tx") })
+	assert.Equal(t, []string{"no tx"}, calls)
+	assert.False(t, domain.InTx(context.Background()))
+
+	ctx, commit := domain.ContextWithTx(context.Background())
+	assert.True(t, domain.InTx(ctx))
+	domain.AfterCommit(ctx, func() { calls = append(calls, "first") })
+	domain.AfterCommit(ctx, func() { calls = append(calls, "second") })
+	assert.Equal(t, []string{"no tx"}, calls)
+
+	commit()
+	assert.Equal(t, []string{"no tx", "first", "second"}, calls)
+
+	// a rolled back transaction never commits, its callbacks are dropped
+	ctx, _ = domain.ContextWithTx(context.Background())
+	domain.AfterCommit(ctx, func() { calls = append(calls, "rolled back") })
+	assert.Len(t, calls, 3)
+}
@@ -2,50 +2,175 @@ package domain
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
 )
 
 //go:generate mockery --name=UserRepository --dir=. --outpkg=mocks --filename=mock_user_repository.go --output=./mocks --structname MockUserRepository
 type UserRepository interface {
+	// CreateUser and UpdateUser return ErrEmailTaken if another user has the email
 	CreateUser(ctx context.Context, user User) (User, error)
 	GetUserByID(ctx context.Context, id string) (User, error)
+	// UpdateUser replaces the username and the email, an empty email clears it,
+	// the email stays verified unless it's changed
 	UpdateUser(ctx context.Context, user User) (User, error)
+	// UpdateUsername changes only the username, the email and its verification stay
+	UpdateUsername(ctx context.Context, id, username string) (User, error)
 	DeleteUser(ctx context.Context, id string) error
+	// RestoreUser reverts the soft delete, a user that isn't deleted is not found,
+	// it returns ErrEmailTaken if another user has taken the email meanwhile
+	RestoreUser(ctx context.Context, id string) error
+	// ListUsers returns the page and the total of the not deleted users,
+	// the total counts every not deleted user, a page past the last one has no rows but the same total
 	ListUsers(ctx context.Context, filter UserFilter) ([]User, int, error)
+	// VerifyEmail marks the email of the user verified at the time, a verified one keeps the first time.
+	// It returns ErrUserNotFound unless the user has the email, e.g. it has been changed since the verification is sent.
+	VerifyEmail(ctx context.Context, id, email string, at time.Time) error
+}
+
+// TxManager makes several repository calls atomic.
+// The repositories called with the ctx given to fn take part in the transaction.
+// fn might be called again on a serialization failure, so it must not have side effects outside the storage.
+//
+//go:generate mockery --name=TxManager --dir=. --outpkg=mocks --filename=mock_tx_manager.go --output=./mocks --structname MockTxManager
+type TxManager interface {
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
 }
 
 type UserService struct {
-	repo UserRepository
+	repo   UserRepository
+	tx     TxManager
+	policy AccessPolicy
+	audit  *slog.Logger
 }
 
-func NewUserService(repo UserRepository) *UserService {
+func NewUserService(repo UserRepository, tx TxManager) *UserService {
 	return &UserService{
 		repo: repo,
+		tx:   tx,
 	}
 }
 
+// writable clears the state only the storage sets and normalizes the rest.
+func writable(user User) User {
+	user.Stale = false
+	user.EmailVerifiedAt = nil
+	user.Email = NormalizeEmail(user.Email)
+	return user
+}
+
 func (s *UserService) CreateUser(ctx context.Context, user User) (User, error) {
+	user = writable(user)
 	if err := user.Validate(); err != nil {
 		return user, err
 	}
+	if err := s.authorize(ctx, ActionCreateUser, user); err != nil {
+		return user, err
+	}
 	return s.repo.CreateUser(ctx, user)
 }
 
+// ValidateUsers validates every user, the errors name the invalid records.
+func ValidateUsers(users []User) error {
+	var errs []error
+	for i, user := range users {
+		if err := user.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("record %d (%q): %w", i+1, user.Username, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ImportUsers creates all the users or none of them.
+// Every user is validated before anything is written.
+func (s *UserService) ImportUsers(ctx context.Context, users []User) ([]User, error) {
+	if err := ValidateUsers(users); err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		if err := s.authorize(ctx, ActionCreateUser, user); err != nil {
+			return nil, err
+		}
+	}
+
+	var created []User
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		// the transaction might be retried, the users of a failed attempt are gone
+		created = make([]User, 0, len(users))
+		for i, user := range users {
+			user, err := s.repo.CreateUser(ctx, writable(user))
+			if err != nil {
+				return fmt.Errorf("record %d: %w", i+1, err)
+			}
+			created = append(created, user)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
 func (s *UserService) GetUserByID(ctx context.Context, id string) (User, error) {
-	return s.repo.GetUserByID(ctx, id)
+	ctx, stale := trackStale(ctx)
+	user, err := s.repo.GetUserByID(ctx, id)
+	if err != nil {
+		return user, s.authorizeMissing(ctx, ActionReadUser, id, err)
+	}
+	if err := s.authorize(ctx, ActionReadUser, user); err != nil {
+		return User{}, err
+	}
+
+	user.Stale = stale.Load()
+	return user, nil
 }
 
 func (s *UserService) UpdateUser(ctx context.Context, user User) (User, error) {
+	user = writable(user)
 	if err := user.Validate(); err != nil {
 		return user, err
 	}
+	if err := s.authorizeID(ctx, ActionUpdateUser, user.ID); err != nil {
+		return user, err
+	}
 	return s.repo.UpdateUser(ctx, user)
 }
 
+// RenameUser changes the username only, the email and its verification stay.
+func (s *UserService) RenameUser(ctx context.Context, id, username string) (User, error) {
+	user := User{ID: id, Username: username}
+	if err := user.Validate(); err != nil {
+		return user, err
+	}
+	if err := s.authorizeID(ctx, ActionUpdateUser, id); err != nil {
+		return user, err
+	}
+	return s.repo.UpdateUsername(ctx, id, username)
+}
+
 func (s *UserService) DeleteUser(ctx context.Context, id string) error {
+	if err := s.authorizeID(ctx, ActionDeleteUser, id); err != nil {
+		return err
+	}
 	return s.repo.DeleteUser(ctx, id)
 }
 
+func (s *UserService) RestoreUser(ctx context.Context, id string) error {
+	if err := s.authorizeID(ctx, ActionRestoreUser, id); err != nil {
+		return err
+	}
+	return s.repo.RestoreUser(ctx, id)
+}
+
 func (s *UserService) ListUsers(ctx context.Context, filter UserFilter) (PaginatedUserList, error) {
+	if err := s.authorize(ctx, ActionListUsers, User{}); err != nil {
+		return PaginatedUserList{}, err
+	}
+	ctx, stale := trackStale(ctx)
 	users, count, err := s.repo.ListUsers(ctx, filter)
 	if err != nil {
 		return PaginatedUserList{}, err
@@ -56,6 +181,7 @@ func (s *UserService) ListUsers(ctx context.Context, filter UserFilter) (Paginat
 		Total:  count,
 		Limit:  filter.Limit,
 		Offset: filter.Offset,
+		Stale:  stale.Load(),
 	}
 	paginatedList.EnrichHttpQueryLinks()
 	return paginatedList, nil
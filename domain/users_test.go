@@ -4,6 +4,7 @@ import (
 	"context"
 	_ "embed"
 	"testing"
+	"time"
 
 	"github.com/dennypenta/go-api-walkthrough/domain"
 	"github.com/dennypenta/go-api-walkthrough/domain/mocks"
@@ -24,6 +25,7 @@ func TestCreateUserHandler(t *testing.T) {
 
 	user := domain.User{Username: "test"}
 	outputUser := domain.User{ID: "8da80ba8-81c6-4336-bba3-ba8ea50541b0", Username: "test"}
+	verifiedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
 
 	for _, tt := range []testCase{
 		{
@@ -40,11 +42,27 @@ func TestCreateUserHandler(t *testing.T) {
 			},
 			expectedErr: domain.ErrInvalidUsername,
 		},
+		{
+			name:  "email is normalized and not verified by the caller",
+			input: domain.User{Username: "test", Email: " Test@Example.COM ", EmailVerifiedAt: &verifiedAt},
+			setupMocks: func(m *mocks.MockUserRepository) {
+				m.On("CreateUser", mock.Anything, domain.User{Username: "test", Email: "test@example.com"}).Return(outputUser, nil)
+			},
+			expectedResp: outputUser,
+		},
+		{
+			name:  "invalid email",
+			input: domain.User{Username: "test", Email: "Test <test@example.com>"},
+			setupMocks: func(m *mocks.MockUserRepository) {
+			},
+			expectedResp: domain.User{Username: "test", Email: "test <test@example.com>"},
+			expectedErr:  domain.ErrInvalidEmail,
+		},
 	} {
 		t.Run(tt.name, func(t *testing.T) {
 			m := mocks.NewMockUserRepository(t)
 			tt.setupMocks(m)
-			service := domain.NewUserService(m)
+			service := domain.NewUserService(m, mocks.NewMockTxManager(t))
 
 			ctx := context.Background()
 			res, err := service.CreateUser(ctx, tt.input)
@@ -54,3 +72,58 @@ func TestCreateUserHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestImportUsers(t *testing.T) {
+	inTx := func(ctx context.Context, fn func(ctx context.Context) error) error {
+		return fn(ctx)
+	}
+
+	t.Run("all users are created in one transaction", func(t *testing.T) {
+		repo := mocks.NewMockUserRepository(t)
+		tx := mocks.NewMockTxManager(t)
+		tx.On("WithinTx", mock.Anything, mock.Anything).Return(inTx).Once()
+		repo.On("CreateUser", mock.Anything, domain.User{Username: "alice"}).Return(domain.User{ID: "1", Username: "alice"}, nil)
+		repo.On("CreateUser", mock.Anything, domain.User{Username: "bob"}).Return(domain.User{ID: "2", Username: "bob"}, nil)
+
+		users, err := domain.NewUserService(repo, tx).ImportUsers(context.Background(), []domain.User{{Username: "alice"}, {Username: "bob"}})
+		assert.NoError(t, err)
+		assert.Equal(t, []domain.User{{ID: "1", Username: "alice"}, {ID: "2", Username: "bob"}}, users)
+	})
+
+	t.Run("invalid user stops the import before writing", func(t *testing.T) {
+		service := domain.NewUserService(mocks.NewMockUserRepository(t), mocks.NewMockTxManager(t))
+
+		_, err := service.ImportUsers(context.Background(), []domain.User{{Username: "alice"}, {}})
+		assert.ErrorIs(t, err, domain.ErrInvalidUsername)
+		assert.ErrorContains(t, err, "record 2")
+	})
+
+	t.Run("failed write fails the transaction", func(t *testing.T) {
+		repo := mocks.NewMockUserRepository(t)
+		tx := mocks.NewMockTxManager(t)
+		tx.On("WithinTx", mock.Anything, mock.Anything).Return(inTx).Once()
+		repo.On("CreateUser", mock.Anything, domain.User{Username: "alice"}).Return(domain.User{}, assert.AnError)
+
+		users, err := domain.NewUserService(repo, tx).ImportUsers(context.Background(), []domain.User{{Username: "alice"}, {Username: "bob"}})
+		assert.ErrorIs(t, err, assert.AnError)
+		assert.Nil(t, users)
+	})
+}
+
+func TestGetUserByIDStale(t *testing.T) {
+	user := domain.User{ID: "8da80ba8-81c6-4336-bba3-ba8ea50541b0", Username: "test"}
+	m := mocks.NewMockUserRepository(t)
+	m.On("GetUserByID", mock.Anything, user.ID).Return(user, nil).Once()
+	m.On("GetUserByID", mock.Anything, user.ID).Run(func(args mock.Arguments) {
+		domain.MarkStale(args.Get(0).(context.Context))
+	}).Return(user, nil).Once()
+	service := domain.NewUserService(m, mocks.NewMockTxManager(t))
+
+	res, err := service.GetUserByID(context.Background(), user.ID)
+	assert.NoError(t, err)
+	assert.False(t, res.Stale)
+
+	res, err = service.GetUserByID(context.Background(), user.ID)
+	assert.NoError(t, err)
+	assert.True(t, res.Stale)
+}
@@ -0,0 +1,131 @@
+package fixtures
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+)
+
+// BaseTime is the creation time of the first fixture record without an explicit timestamp,
+// every next record is created a second later, so the order by createdAt follows the file order.
+var BaseTime = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// namespace for the ids generated from the fixture records
+var namespace = uuid.MustParse("5f8a1b8e-9f0e-4a53-9d8e-5a8d3c1f2b7a")
+
+//go:generate mockery --name=Seeder --dir=. --outpkg=mocks --filename=mock_seeder.go --output=./mocks --structname MockSeeder
+type Seeder interface {
+	SeedUsers(ctx context.Context, records []domain.UserRecord) error
+}
+
+// Set is the content of a fixture file.
+type Set struct {
+	Users []domain.UserRecord
+}
+
+type userFixture struct {
+	ID       string `json:"id" yaml:"id"`
+	Username string `json:"username" yaml:"username"`
+	Email    string `json:"email" yaml:"email"`
+	// EmailVerifiedAt is nil for an unverified email
+	EmailVerifiedAt *time.Time `json:"emailVerifiedAt" yaml:"emailVerifiedAt"`
+	CreatedAt       *time.Time `json:"createdAt" yaml:"createdAt"`
+	UpdatedAt       *time.Time `json:"updatedAt" yaml:"updatedAt"`
+	DeletedAt       *time.Time `json:"deletedAt" yaml:"deletedAt"`
+}
+
+type setFixture struct {
+	Users []userFixture `json:"users" yaml:"users"`
+}
+
+// Loader reads the fixture files and stores them through the repository.
+type Loader struct {
+	seeder Seeder
+	fsys   fs.FS
+}
+
+func NewLoader(seeder Seeder, fsys fs.FS) *Loader {
+	return &Loader{
+		seeder: seeder,
+		fsys:   fsys,
+	}
+}
+
+// Load seeds the given fixture files (.yaml, .yml or .json) and returns the loaded records,
+// so a test can refer to the generated ids.
+func (l *Loader) Load(ctx context.Context, names ...string) (Set, error) {
+	var res Set
+	for _, name := range names {
+		set, err := Read(l.fsys, name)
+		if err != nil {
+			return res, err
+		}
+		if err := l.seeder.SeedUsers(ctx, set.Users); err != nil {
+			return res, fmt.Errorf("failed to seed %s: %w", name, err)
+		}
+		res.Users = append(res.Users, set.Users...)
+	}
+
+	return res, nil
+}
+
+// Read parses a fixture file filling the missing ids and timestamps deterministically:
+// the same file always produces the same records.
+func Read(fsys fs.FS, name string) (Set, error) {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return Set{}, err
+	}
+
+	var raw setFixture
+	switch strings.ToLower(path.Ext(name)) {
+	case ".json":
+		err = json.Unmarshal(data, &raw)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	default:
+		return Set{}, fmt.Errorf("unsupported fixture file %s, expected .yaml, .yml or .json", name)
+	}
+	if err != nil {
+		return Set{}, fmt.Errorf("failed to decode %s: %w", name, err)
+	}
+
+	set := Set{Users: make([]domain.UserRecord, 0, len(raw.Users))}
+	for i, u := range raw.Users {
+		rec := domain.UserRecord{
+			User: domain.User{
+				ID:       u.ID,
+				Username: u.Username,
+				Email:    u.Email,
+			},
+			CreatedAt: BaseTime.Add(time.Duration(i) * time.Second),
+			DeletedAt: u.DeletedAt,
+		}
+		if rec.ID == "" {
+			rec.ID = uuid.NewSHA1(namespace, []byte(fmt.Sprintf("%s:%d:%s", path.Base(name), i, u.Username))).String()
+		}
+		if u.CreatedAt != nil {
+			rec.CreatedAt = u.CreatedAt.UTC()
+		}
+		if u.EmailVerifiedAt != nil {
+			verifiedAt := u.EmailVerifiedAt.UTC()
+			rec.EmailVerifiedAt = &verifiedAt
+		}
+		rec.UpdatedAt = rec.CreatedAt
+		if u.UpdatedAt != nil {
+			rec.UpdatedAt = u.UpdatedAt.UTC()
+		}
+
+		set.Users = append(set.Users, rec)
+	}
+
+	return set, nil
+}
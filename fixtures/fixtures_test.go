@@ -0,0 +1,66 @@
+package fixtures_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/fixtures"
+	"github.com/dennypenta/go-api-walkthrough/fixtures/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRead(t *testing.T) {
+	t.Parallel()
+
+	for _, name := range []string{"users.yaml", "users.json"} {
+		t.Run(name, func(t *testing.T) {
+			set, err := fixtures.Read(os.DirFS("testdata"), name)
+			require.NoError(t, err)
+			require.Len(t, set.Users, 3)
+
+			alice, bob, carol := set.Users[0], set.Users[1], set.Users[2]
+
+			// generated values are stable between loads
+			again, err := fixtures.Read(os.DirFS("testdata"), name)
+			require.NoError(t, err)
+			assert.Equal(t, set, again)
+
+			assert.Len(t, alice.ID, 36)
+			assert.Equal(t, fixtures.BaseTime, alice.CreatedAt)
+			assert.Equal(t, alice.CreatedAt, alice.UpdatedAt)
+			assert.Nil(t, alice.DeletedAt)
+
+			assert.Equal(t, "2f1d3c4e-6b7a-4c8d-9e0f-1a2b3c4d5e6f", bob.ID)
+			assert.Equal(t, time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC), bob.CreatedAt)
+			assert.Equal(t, "bob@example.com", bob.Email)
+			require.NotNil(t, bob.EmailVerifiedAt)
+			assert.Equal(t, time.Date(2023, 6, 2, 12, 0, 0, 0, time.UTC), *bob.EmailVerifiedAt)
+			assert.Empty(t, alice.Email)
+			assert.Nil(t, alice.EmailVerifiedAt)
+
+			assert.Equal(t, fixtures.BaseTime.Add(2*time.Second), carol.CreatedAt)
+			require.NotNil(t, carol.DeletedAt)
+			assert.True(t, carol.DeletedAt.Equal(time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)))
+			assert.NotEqual(t, alice.ID, carol.ID)
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	t.Parallel()
+
+	expected, err := fixtures.Read(os.DirFS("testdata"), "users.yaml")
+	require.NoError(t, err)
+
+	m := mocks.NewMockSeeder(t)
+	m.On("SeedUsers", mock.Anything, expected.Users).Return(nil)
+
+	l := fixtures.NewLoader(m, os.DirFS("testdata"))
+	set, err := l.Load(context.Background(), "users.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, expected, set)
+}
@@ -0,0 +1,48 @@
+// Code generated by mockery v2.53.7. DO NOT EDIT.
+
+package mocks
+
+import (
+	context "context"
+
+	domain "github.com/dennypenta/go-api-walkthrough/domain"
+
+	mock "github.com/stretchr/testify/mock"
+)
+
+// MockSeeder is an autogenerated mock type for the Seeder type
+type MockSeeder struct {
+	mock.Mock
+}
+
+// SeedUsers provides a mock function with given fields: ctx, records
+func (_m *MockSeeder) SeedUsers(ctx context.Context, records []domain.UserRecord) error {
+	ret := _m.Called(ctx, records)
+
+	if len(ret) == 0 {
+		panic("no return value specified for SeedUsers")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, []domain.UserRecord) error); ok {
+		r0 = rf(ctx, records)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// NewMockSeeder creates a new instance of MockSeeder. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewMockSeeder(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *MockSeeder {
+	mock := &MockSeeder{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+)
+
+//go:generate mockery --name=APIKeyService --dir=. --outpkg=mocks --filename=mock_api_key_service.go --output=./mocks --structname MockAPIKeyService
+type APIKeyService interface {
+	CreateAPIKey(ctx context.Context, name string, scopes []string, expiresAt *time.Time) (domain.CreatedAPIKey, error)
+	ListAPIKeys(ctx context.Context) ([]domain.APIKey, error)
+	RevokeAPIKey(ctx context.Context, id string) error
+}
+
+type APIKeyHandler struct {
+	service APIKeyService
+}
+
+func NewAPIKeyHandler(service APIKeyService) *APIKeyHandler {
+	return &APIKeyHandler{
+		service: service,
+	}
+}
+
+type createAPIKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// ExpiresAt is RFC 3339, the key doesn't expire without it
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type apiKeysBody struct {
+	APIKeys []domain.APIKey `json:"api_keys"`
+}
+
+// CreateAPIKey responds with the key itself, it's the only time the key is shown.
+func (h *APIKeyHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req createAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJson(w, ErrFailedMarshal, 400)
+		return
+	}
+
+	key, err := h.service.CreateAPIKey(r.Context(), req.Name, req.Scopes, req.ExpiresAt)
+	if err != nil {
+		handleError(r.Context(), err, w)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJson(w, key, 200)
+}
+
+func (h *APIKeyHandler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.service.ListAPIKeys(r.Context())
+	if err != nil {
+		handleError(r.Context(), err, w)
+		return
+	}
+
+	writeJson(w, apiKeysBody{APIKeys: keys}, 200)
+}
+
+// RevokeAPIKey makes the key refused with the next request.
+func (h *APIKeyHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	if err := h.service.RevokeAPIKey(r.Context(), r.PathValue("id")); err != nil {
+		handleError(r.Context(), err, w)
+		return
+	}
+
+	w.WriteHeader(204)
+}
@@ -0,0 +1,85 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/handlers"
+	"github.com/dennypenta/go-api-walkthrough/handlers/mocks"
+	"github.com/dennypenta/go-api-walkthrough/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCreateAPIKeyHandler(t *testing.T) {
+	type testCase struct {
+		name       string
+		reqBody    string
+		setupMocks func(m *mocks.MockAPIKeyService)
+
+		expectedResp   string
+		expectedStatus int
+	}
+	createdAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	expiresAt := createdAt.Add(24 * time.Hour)
+
+	for _, tt := range []testCase{
+		{
+			name:    "valid key",
+			reqBody: `{"name": "batch", "scopes": ["users:list"], "expires_at": "2024-01-02T00:00:00Z"}`,
+			setupMocks: func(m *mocks.MockAPIKeyService) {
+				m.On("CreateAPIKey", mock.Anything, "batch", []string{"users:list"}, &expiresAt).Return(domain.CreatedAPIKey{
+					APIKey: domain.APIKey{ID: "1", Name: "batch", Prefix: "abc", Hash: "hash", Scopes: []string{"users:list"},
+						CreatedAt: createdAt, ExpiresAt: &expiresAt},
+					Key: "usk_abc_secret",
+				}, nil)
+			},
+			expectedResp: `{"id": "1", "name": "batch", "prefix": "abc", "scopes": ["users:list"], "key": "usk_abc_secret",
+				"created_at": "2024-01-01T00:00:00Z", "expires_at": "2024-01-02T00:00:00Z"}`,
+			expectedStatus: 200,
+		},
+		{
+			name:    "unknown scope",
+			reqBody: `{"name": "batch", "scopes": ["users:everything"]}`,
+			setupMocks: func(m *mocks.MockAPIKeyService) {
+				m.On("CreateAPIKey", mock.Anything, "batch", []string{"users:everything"}, (*time.Time)(nil)).
+					Return(domain.CreatedAPIKey{}, &domain.InvalidAPIKeyError{Reason: `unknown scope "users:everything"`})
+			},
+			expectedResp:   `{"code": "invalid_api_key", "meta": {"reason": "unknown scope \"users:everything\""}}`,
+			expectedStatus: 400,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			m := mocks.NewMockAPIKeyService(t)
+			tt.setupMocks(m)
+			ctx := log.LoggerToContext(context.Background(), log.NewLogger(io.Discard, slog.LevelInfo))
+
+			req := httptest.NewRequest("POST", "/v1/api-keys", bytes.NewBufferString(tt.reqBody)).WithContext(ctx)
+			w := httptest.NewRecorder()
+			handlers.NewAPIKeyHandler(m).CreateAPIKey(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.JSONEq(t, tt.expectedResp, w.Body.String())
+		})
+	}
+}
+
+func TestRevokeAPIKeyHandler(t *testing.T) {
+	m := mocks.NewMockAPIKeyService(t)
+	m.On("RevokeAPIKey", mock.Anything, "1").Return(domain.ErrAPIKeyNotFound)
+	ctx := log.LoggerToContext(context.Background(), log.NewLogger(io.Discard, slog.LevelInfo))
+
+	req := httptest.NewRequest("DELETE", "/v1/api-keys/1", nil).WithContext(ctx)
+	req.SetPathValue("id", "1")
+	w := httptest.NewRecorder()
+	handlers.NewAPIKeyHandler(m).RevokeAPIKey(w, req)
+
+	assert.Equal(t, 400, w.Code)
+	assert.JSONEq(t, `{"code": "api_key_not_found"}`, w.Body.String())
+}
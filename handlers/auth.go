@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/pkg/jwt"
+)
+
+//go:generate mockery --name=AuthService --dir=. --outpkg=mocks --filename=mock_auth_service.go --output=./mocks --structname MockAuthService
+type AuthService interface {
+	SetCredentials(ctx context.Context, userID, login, password, currentPassword string) error
+	Login(ctx context.Context, login, password string, client domain.Client) (domain.TokenPair, error)
+	Refresh(ctx context.Context, refreshToken string, client domain.Client) (domain.TokenPair, error)
+	LoginTwoFactor(ctx context.Context, challengeToken, code string, client domain.Client) (domain.TokenPair, error)
+}
+
+type AuthHandler struct {
+	service AuthService
+}
+
+func NewAuthHandler(service AuthService) *AuthHandler {
+	return &AuthHandler{
+		service: service,
+	}
+}
+
+type credentialsRequest struct {
+	Login    string `json:"login"`
+	Password string `json:"password"`
+}
+
+type setCredentialsRequest struct {
+	credentialsRequest
+	// CurrentPassword is required when the users change their own credentials
+	CurrentPassword string `json:"current_password"`
+}
+
+// SetCredentials sets the login and the password of the user and signs the user out of the other sessions.
+func (h *AuthHandler) SetCredentials(w http.ResponseWriter, r *http.Request) {
+	var req setCredentialsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJson(w, ErrFailedMarshal, 400)
+		return
+	}
+
+	if err := h.service.SetCredentials(r.Context(), r.PathValue("id"), req.Login, req.Password, req.CurrentPassword); err != nil {
+		handleError(r.Context(), err, w)
+		return
+	}
+
+	w.WriteHeader(204)
+}
+
+type loginRequest struct {
+	credentialsRequest
+	// Device names the session, e.g. "Alice's phone"
+	Device string `json:"device"`
+}
+
+// Login starts a session of the device the request comes from,
+// a user with the second factor enabled gets a challenge to finish the login with at LoginTwoFactor.
+func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
+	var req loginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJson(w, ErrFailedMarshal, 400)
+		return
+	}
+
+	tokens, err := h.service.Login(r.Context(), req.Login, req.Password, clientOf(r, req.Device))
+	if err != nil {
+		handleError(r.Context(), err, w)
+		return
+	}
+
+	writeTokens(w, tokens)
+}
+
+type twoFactorRequest struct {
+	ChallengeToken string `json:"challenge_token"`
+	// Code is the one the authenticator app shows or a recovery code
+	Code string `json:"code"`
+}
+
+// LoginTwoFactor passes the challenge of the login with the second factor and starts the session.
+func (h *AuthHandler) LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req twoFactorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJson(w, ErrFailedMarshal, 400)
+		return
+	}
+
+	tokens, err := h.service.LoginTwoFactor(r.Context(), req.ChallengeToken, req.Code, clientOf(r, ""))
+	if err != nil {
+		handleError(r.Context(), err, w)
+		return
+	}
+
+	writeTokens(w, tokens)
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Refresh exchanges the refresh token for a new pair, the given one can't be used again.
+func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var req refreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJson(w, ErrFailedMarshal, 400)
+		return
+	}
+
+	tokens, err := h.service.Refresh(r.Context(), req.RefreshToken, clientOf(r, ""))
+	if err != nil {
+		handleError(r.Context(), err, w)
+		return
+	}
+
+	writeTokens(w, tokens)
+}
+
+// clientOf describes the device of the request, the ip is the peer one, the proxy headers aren't trusted.
+func clientOf(r *http.Request, device string) domain.Client {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	return domain.Client{
+		Device:    device,
+		UserAgent: r.UserAgent(),
+		IP:        ip,
+	}
+}
+
+func writeTokens(w http.ResponseWriter, tokens domain.TokenPair) {
+	// the tokens must not be kept by the proxies, https://www.rfc-editor.org/rfc/rfc6749#section-5.1
+	w.Header().Set("Cache-Control", "no-store")
+	writeJson(w, tokens, 200)
+}
+
+// jwksMaxAge is how long the clients may cache the keys,
+// a new key must be published at least that long before it signs.
+const jwksMaxAge = "max-age=300"
+
+// JWKS serves the public keys the access tokens are verified with.
+// The document is built on every request, so a retired key is gone once its time comes.
+func JWKS(keys *jwt.KeySet) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", jwksMaxAge)
+		writeJson(w, keys.JWKS(), 200)
+	}
+}
@@ -0,0 +1,283 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/handlers"
+	"github.com/dennypenta/go-api-walkthrough/handlers/mocks"
+	"github.com/dennypenta/go-api-walkthrough/pkg/jwt"
+	"github.com/dennypenta/go-api-walkthrough/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoginHandler(t *testing.T) {
+	type testCase struct {
+		name       string
+		reqBody    []byte
+		setupMocks func(m *mocks.MockAuthService)
+
+		expectedResp   string
+		expectedStatus int
+	}
+
+	for _, tt := range []testCase{
+		{
+			name:    "valid credentials",
+			reqBody: []byte(`{"login": "alice", "password": "correct horse battery staple", "device": "laptop"}`),
+			setupMocks: func(m *mocks.MockAuthService) {
+				client := domain.Client{Device: "laptop", UserAgent: "curl/8.0", IP: "192.0.2.1"}
+				m.On("Login", mock.Anything, "alice", "correct horse battery staple", client).
+					Return(domain.TokenPair{AccessToken: "access", RefreshToken: "refresh", TokenType: "Bearer", ExpiresIn: 900}, nil)
+			},
+			expectedResp:   `{"access_token":"access","refresh_token":"refresh","token_type":"Bearer","expires_in":900}`,
+			expectedStatus: 200,
+		},
+		{
+			name:    "invalid credentials",
+			reqBody: []byte(`{"login": "alice", "password": "wrong"}`),
+			setupMocks: func(m *mocks.MockAuthService) {
+				m.On("Login", mock.Anything, "alice", "wrong", mock.Anything).Return(domain.TokenPair{}, domain.ErrInvalidCredentials)
+			},
+			expectedResp:   `{"code":"invalid_credentials"}`,
+			expectedStatus: 401,
+		},
+		{
+			name:    "second factor required",
+			reqBody: []byte(`{"login": "alice", "password": "correct horse battery staple"}`),
+			setupMocks: func(m *mocks.MockAuthService) {
+				m.On("Login", mock.Anything, "alice", "correct horse battery staple", mock.Anything).
+					Return(domain.TokenPair{}, &domain.TwoFactorRequiredError{ChallengeToken: "challenge", ExpiresIn: 300})
+			},
+			expectedResp:   `{"code":"two_factor_required","meta":{"challenge_token":"challenge","expires_in":300}}`,
+			expectedStatus: 401,
+		},
+		{
+			name:           "failed marshal",
+			reqBody:        []byte(`{`),
+			setupMocks:     func(m *mocks.MockAuthService) {},
+			expectedResp:   `{"code":"failed_marshal"}`,
+			expectedStatus: 400,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			m := mocks.NewMockAuthService(t)
+			tt.setupMocks(m)
+			l := log.NewLogger(io.Discard, slog.LevelInfo)
+			ctx := log.LoggerToContext(context.Background(), l)
+
+			h := handlers.NewAuthHandler(m)
+			req := httptest.NewRequest("POST", "/v1/auth/login", bytes.NewBuffer(tt.reqBody)).WithContext(ctx)
+			req.Header.Set("User-Agent", "curl/8.0")
+			w := httptest.NewRecorder()
+			h.Login(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.JSONEq(t, tt.expectedResp, w.Body.String())
+		})
+	}
+}
+
+func TestLoginTwoFactorHandler(t *testing.T) {
+	type testCase struct {
+		name       string
+		reqBody    []byte
+		setupMocks func(m *mocks.MockAuthService)
+
+		expectedResp   string
+		expectedStatus int
+	}
+
+	for _, tt := range []testCase{
+		{
+			name:    "valid code",
+			reqBody: []byte(`{"challenge_token": "challenge", "code": "123456"}`),
+			setupMocks: func(m *mocks.MockAuthService) {
+				client := domain.Client{UserAgent: "curl/8.0", IP: "192.0.2.1"}
+				m.On("LoginTwoFactor", mock.Anything, "challenge", "123456", client).
+					Return(domain.TokenPair{AccessToken: "access", RefreshToken: "refresh", TokenType: "Bearer", ExpiresIn: 900}, nil)
+			},
+			expectedResp:   `{"access_token":"access","refresh_token":"refresh","token_type":"Bearer","expires_in":900}`,
+			expectedStatus: 200,
+		},
+		{
+			name:    "invalid code",
+			reqBody: []byte(`{"challenge_token": "challenge", "code": "000000"}`),
+			setupMocks: func(m *mocks.MockAuthService) {
+				m.On("LoginTwoFactor", mock.Anything, "challenge", "000000", mock.Anything).Return(domain.TokenPair{}, domain.ErrInvalidTwoFactorCode)
+			},
+			expectedResp:   `{"code":"invalid_two_factor_code"}`,
+			expectedStatus: 400,
+		},
+		{
+			name:    "invalid challenge",
+			reqBody: []byte(`{"challenge_token": "expired", "code": "123456"}`),
+			setupMocks: func(m *mocks.MockAuthService) {
+				m.On("LoginTwoFactor", mock.Anything, "expired", "123456", mock.Anything).Return(domain.TokenPair{}, domain.ErrInvalidChallenge)
+			},
+			expectedResp:   `{"code":"invalid_challenge"}`,
+			expectedStatus: 401,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			m := mocks.NewMockAuthService(t)
+			tt.setupMocks(m)
+			ctx := log.LoggerToContext(context.Background(), log.NewLogger(io.Discard, slog.LevelInfo))
+
+			req := httptest.NewRequest("POST", "/v1/auth/2fa", bytes.NewBuffer(tt.reqBody)).WithContext(ctx)
+			req.Header.Set("User-Agent", "curl/8.0")
+			w := httptest.NewRecorder()
+			handlers.NewAuthHandler(m).LoginTwoFactor(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.JSONEq(t, tt.expectedResp, w.Body.String())
+		})
+	}
+}
+
+func TestSetCredentialsHandler(t *testing.T) {
+	type testCase struct {
+		name       string
+		setupMocks func(m *mocks.MockAuthService)
+
+		expectedResp   string
+		expectedStatus int
+	}
+	id := "8da80ba8-81c6-4336-bba3-ba8ea50541b0"
+
+	for _, tt := range []testCase{
+		{
+			name: "valid credentials",
+			setupMocks: func(m *mocks.MockAuthService) {
+				m.On("SetCredentials", mock.Anything, id, "alice", "password", "old password").Return(nil)
+			},
+			expectedStatus: 204,
+		},
+		{
+			name: "weak password",
+			setupMocks: func(m *mocks.MockAuthService) {
+				m.On("SetCredentials", mock.Anything, id, "alice", "password", "old password").
+					Return(&domain.WeakPasswordError{Reason: "must be at least 12 characters"})
+			},
+			expectedResp:   `{"code":"weak_password","meta":{"reason":"must be at least 12 characters"}}`,
+			expectedStatus: 400,
+		},
+		{
+			name: "wrong current password",
+			setupMocks: func(m *mocks.MockAuthService) {
+				m.On("SetCredentials", mock.Anything, id, "alice", "password", "old password").Return(domain.ErrWrongPassword)
+			},
+			expectedResp:   `{"code":"wrong_password"}`,
+			expectedStatus: 403,
+		},
+		{
+			name: "login taken",
+			setupMocks: func(m *mocks.MockAuthService) {
+				m.On("SetCredentials", mock.Anything, id, "alice", "password", "old password").Return(domain.ErrLoginTaken)
+			},
+			expectedResp:   `{"code":"login_taken"}`,
+			expectedStatus: 409,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			m := mocks.NewMockAuthService(t)
+			tt.setupMocks(m)
+			l := log.NewLogger(io.Discard, slog.LevelInfo)
+			ctx := log.LoggerToContext(context.Background(), l)
+
+			h := handlers.NewAuthHandler(m)
+			req := httptest.NewRequest("PUT", "/v1/users/"+id+"/credentials", bytes.NewBufferString(`{"login": "alice", "password": "password", "current_password": "old password"}`)).WithContext(ctx)
+			req.SetPathValue("id", id)
+			w := httptest.NewRecorder()
+			h.SetCredentials(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedResp != "" {
+				assert.JSONEq(t, tt.expectedResp, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestRefreshHandler(t *testing.T) {
+	type testCase struct {
+		name       string
+		setupMocks func(m *mocks.MockAuthService)
+
+		expectedResp   string
+		expectedStatus int
+	}
+
+	for _, tt := range []testCase{
+		{
+			name: "valid token",
+			setupMocks: func(m *mocks.MockAuthService) {
+				m.On("Refresh", mock.Anything, "refresh", mock.Anything).
+					Return(domain.TokenPair{AccessToken: "access2", RefreshToken: "refresh2", TokenType: "Bearer", ExpiresIn: 900}, nil)
+			},
+			expectedResp:   `{"access_token":"access2","refresh_token":"refresh2","token_type":"Bearer","expires_in":900}`,
+			expectedStatus: 200,
+		},
+		{
+			name: "reused token",
+			setupMocks: func(m *mocks.MockAuthService) {
+				m.On("Refresh", mock.Anything, "refresh", mock.Anything).Return(domain.TokenPair{}, domain.ErrInvalidRefreshToken)
+			},
+			expectedResp:   `{"code":"invalid_refresh_token"}`,
+			expectedStatus: 401,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			m := mocks.NewMockAuthService(t)
+			tt.setupMocks(m)
+			l := log.NewLogger(io.Discard, slog.LevelInfo)
+			ctx := log.LoggerToContext(context.Background(), l)
+
+			h := handlers.NewAuthHandler(m)
+			req := httptest.NewRequest("POST", "/v1/auth/refresh", bytes.NewBufferString(`{"refresh_token": "refresh"}`)).WithContext(ctx)
+			w := httptest.NewRecorder()
+			h.Refresh(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.JSONEq(t, tt.expectedResp, w.Body.String())
+		})
+	}
+}
+
+func TestJWKSHandler(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	signing, err := jwt.GenerateKey("2024-06")
+	require.NoError(t, err)
+	old, err := jwt.GenerateKey("2024-01")
+	require.NoError(t, err)
+	keys, err := jwt.NewKeySet(signing, []jwt.Key{{ID: old.ID, Public: old.Public, NotAfter: now.Add(time.Hour)}},
+		func() time.Time { return now })
+	require.NoError(t, err)
+
+	kids := func() []string {
+		w := httptest.NewRecorder()
+		handlers.JWKS(keys)(w, httptest.NewRequest("GET", "/.well-known/jwks.json", nil))
+		require.Equal(t, 200, w.Code)
+		var jwks jwt.JWKS
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &jwks))
+		var kids []string
+		for _, k := range jwks.Keys {
+			kids = append(kids, k.Kid)
+		}
+		return kids
+	}
+
+	assert.Equal(t, []string{"2024-06", "2024-01"}, kids())
+	// the retired key leaves the document without a restart
+	now = now.Add(time.Hour)
+	assert.Equal(t, []string{"2024-06"}, kids())
+}
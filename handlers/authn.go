@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/pkg/log"
+)
+
+// Authenticator checks the credentials of an Authorization scheme,
+// it returns ErrInvalidAccessToken if they are wrong.
+//
+//go:generate mockery --name=Authenticator --dir=. --outpkg=mocks --filename=mock_authenticator.go --output=./mocks --structname MockAuthenticator
+type Authenticator interface {
+	Authenticate(ctx context.Context, credentials string) (domain.Principal, error)
+}
+
+// AuthScheme is an Authorization header scheme, e.g. Bearer, https://www.rfc-editor.org/rfc/rfc7235#section-2.1.
+type AuthScheme struct {
+	Name          string
+	Authenticator Authenticator
+}
+
+// challenges are the schemes a 401 response offers, they are kept in the request context,
+// so any handler refusing an anonymous request responds the same way.
+type challenges struct {
+	realm   string
+	schemes []AuthScheme
+}
+
+type challengesKey struct{}
+
+// NewAuthMiddleware puts the principal of the request credentials into the context,
+// the request without the Authorization header goes on anonymous and the handlers decide whether it's allowed.
+// The wrong credentials are rejected with 401 right away.
+func NewAuthMiddleware(realm string, schemes ...AuthScheme) func(http.Handler) http.Handler {
+	c := challenges{realm: realm, schemes: schemes}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), challengesKey{}, c)
+			header := r.Header.Get("Authorization")
+			if header == "" {
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+
+			name, credentials, _ := strings.Cut(header, " ")
+			credentials = strings.TrimSpace(credentials)
+			scheme, ok := c.find(name)
+			if !ok || credentials == "" {
+				writeUnauthorized(ctx, w, "", ErrUnauthorized)
+				return
+			}
+
+			p, err := scheme.Authenticator.Authenticate(ctx, credentials)
+			if errors.Is(err, domain.ErrInvalidAccessToken) {
+				writeUnauthorized(ctx, w, scheme.Name, ErrInvalidToken)
+				return
+			}
+			if err != nil {
+				handleError(ctx, err, w)
+				return
+			}
+
+			ctx = domain.ContextWithPrincipal(ctx, p)
+			ctx = log.LoggerToContext(ctx, log.LoggerFromContext(ctx).With("principalID", p.ID))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// find matches the scheme case insensitive.
+func (c challenges) find(name string) (AuthScheme, bool) {
+	for _, s := range c.schemes {
+		if strings.EqualFold(s.Name, name) {
+			return s, true
+		}
+	}
+	return AuthScheme{}, false
+}
+
+// writeUnauthorized offers every scheme, the failed one tells the token is invalid,
+// https://www.rfc-editor.org/rfc/rfc6750#section-3.
+func writeUnauthorized(ctx context.Context, w http.ResponseWriter, failed string, resp Error) {
+	c, _ := ctx.Value(challengesKey{}).(challenges)
+	for _, s := range c.schemes {
+		challenge := fmt.Sprintf("%s realm=%q", s.Name, c.realm)
+		if s.Name == failed {
+			challenge += `, error="invalid_token"`
+		}
+		w.Header().Add("WWW-Authenticate", challenge)
+	}
+
+	writeJson(w, resp, 401)
+}
@@ -0,0 +1,125 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/handlers"
+	"github.com/dennypenta/go-api-walkthrough/handlers/mocks"
+	"github.com/dennypenta/go-api-walkthrough/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthMiddleware(t *testing.T) {
+	type testCase struct {
+		name          string
+		authorization string
+		setupMocks    func(m *mocks.MockAuthenticator)
+
+		expectedPrincipal *domain.Principal
+		expectedStatus    int
+		expectedResp      string
+		expectedChallenge string
+	}
+	principal := domain.Principal{ID: "8da80ba8-81c6-4336-bba3-ba8ea50541b0", Roles: []string{"member"}}
+
+	for _, tt := range []testCase{
+		{
+			name:           "anonymous",
+			setupMocks:     func(m *mocks.MockAuthenticator) {},
+			expectedStatus: 200,
+		},
+		{
+			name:          "valid token",
+			authorization: "bearer token",
+			setupMocks: func(m *mocks.MockAuthenticator) {
+				m.On("Authenticate", mock.Anything, "token").Return(principal, nil)
+			},
+			expectedPrincipal: &principal,
+			expectedStatus:    200,
+		},
+		{
+			name:          "invalid token",
+			authorization: "Bearer token",
+			setupMocks: func(m *mocks.MockAuthenticator) {
+				m.On("Authenticate", mock.Anything, "token").Return(domain.Principal{}, domain.ErrInvalidAccessToken)
+			},
+			expectedStatus:    401,
+			expectedResp:      `{"code":"invalid_token"}`,
+			expectedChallenge: `Bearer realm="user-service", error="invalid_token"`,
+		},
+		{
+			name:              "unknown scheme",
+			authorization:     "Basic YWxpY2U6cGFzc3dvcmQ=",
+			setupMocks:        func(m *mocks.MockAuthenticator) {},
+			expectedStatus:    401,
+			expectedResp:      `{"code":"unauthorized"}`,
+			expectedChallenge: `Bearer realm="user-service"`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			m := mocks.NewMockAuthenticator(t)
+			tt.setupMocks(m)
+			var logs bytes.Buffer
+			ctx := log.LoggerToContext(context.Background(), log.NewLogger(&logs, slog.LevelInfo))
+
+			var got *domain.Principal
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if p, ok := domain.PrincipalFromContext(r.Context()); ok {
+					got = &p
+				}
+				log.LoggerFromContext(r.Context()).InfoContext(r.Context(), "handled")
+			})
+			h := handlers.NewAuthMiddleware("user-service", handlers.AuthScheme{Name: "Bearer", Authenticator: m})(next)
+
+			req := httptest.NewRequest("GET", "/v1/me", nil).WithContext(ctx)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Equal(t, tt.expectedPrincipal, got)
+			if tt.expectedPrincipal != nil {
+				assert.Contains(t, logs.String(), `"principalID":"`+tt.expectedPrincipal.ID+`"`)
+			}
+			if tt.expectedResp != "" {
+				assert.JSONEq(t, tt.expectedResp, w.Body.String())
+			}
+			assert.Equal(t, tt.expectedChallenge, w.Header().Get("WWW-Authenticate"))
+		})
+	}
+}
+
+func TestGetMeHandler(t *testing.T) {
+	user := domain.User{ID: "8da80ba8-81c6-4336-bba3-ba8ea50541b0", Username: "test"}
+	m := mocks.NewMockUserService(t)
+	m.On("GetUserByID", mock.Anything, user.ID).Return(user, nil)
+	authenticator := mocks.NewMockAuthenticator(t)
+	authenticator.On("Authenticate", mock.Anything, "token").Return(domain.Principal{ID: user.ID}, nil)
+	ctx := log.LoggerToContext(context.Background(), log.NewLogger(&bytes.Buffer{}, slog.LevelInfo))
+	h := handlers.NewAuthMiddleware("user-service", handlers.AuthScheme{Name: "Bearer", Authenticator: authenticator})(
+		http.HandlerFunc(handlers.NewHandler(m).GetMe))
+
+	// the anonymous request gets the same challenge as a rejected one
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/v1/me", nil).WithContext(ctx))
+	assert.Equal(t, 401, w.Code)
+	assert.Equal(t, `Bearer realm="user-service"`, w.Header().Get("WWW-Authenticate"))
+	assert.JSONEq(t, `{"code":"unauthorized"}`, w.Body.String())
+
+	req := httptest.NewRequest("GET", "/v1/me", nil).WithContext(ctx)
+	req.Header.Set("Authorization", "Bearer token")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, 200, w.Code)
+	assert.JSONEq(t, `{"id": "8da80ba8-81c6-4336-bba3-ba8ea50541b0", "username": "test"}`, w.Body.String())
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/dennypenta/go-api-walkthrough/authz"
+	"github.com/dennypenta/go-api-walkthrough/domain"
+)
+
+//go:generate mockery --name=Policy --dir=. --outpkg=mocks --filename=mock_policy.go --output=./mocks --structname MockPolicy
+type Policy interface {
+	// Allowed tells whether the principal may use the permission on the user with the resource id.
+	Allowed(p domain.Principal, perm authz.Permission, resourceID string) bool
+}
+
+// Authorizer guards the routes with the permissions they declare, the denials go to the audit log.
+type Authorizer struct {
+	policy Policy
+	audit  *slog.Logger
+}
+
+func NewAuthorizer(policy Policy, audit *slog.Logger) *Authorizer {
+	return &Authorizer{
+		policy: policy,
+		audit:  audit,
+	}
+}
+
+// Require serves the route to the principals allowed the permission,
+// the id path value is the user the permission is checked on.
+// An anonymous request is refused with 401 and a denied one with 403.
+func (a *Authorizer) Require(perm authz.Permission, next http.Handler) http.Handler {
+	if perm == authz.Public {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		p, ok := domain.PrincipalFromContext(ctx)
+		if !ok {
+			handleError(ctx, domain.ErrUnauthenticated, w)
+			return
+		}
+
+		resourceID := r.PathValue("id")
+		if !a.policy.Allowed(p, perm, resourceID) {
+			a.audit.WarnContext(ctx, "access denied",
+				"principalID", p.ID,
+				"roles", p.Roles,
+				"permission", perm,
+				"resourceID", resourceID,
+				"method", r.Method,
+				"uri", r.RequestURI,
+			)
+			handleError(ctx, domain.ErrForbidden, w)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+type checkAccessRequest struct {
+	// Subject is the caller when it's not given
+	Subject *struct {
+		ID     string   `json:"id"`
+		Roles  []string `json:"roles"`
+		Scopes []string `json:"scopes"`
+		Tenant string   `json:"tenant"`
+	} `json:"subject"`
+	Action     string `json:"action"`
+	ResourceID string `json:"resource_id"`
+}
+
+// CheckAccess is a dry run of the policy the user service enforces, it tells the decision and the rule behind it.
+func (h *Handler) CheckAccess(w http.ResponseWriter, r *http.Request) {
+	var req checkAccessRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJson(w, ErrFailedMarshal, 400)
+		return
+	}
+
+	subject, _ := domain.PrincipalFromContext(r.Context())
+	if req.Subject != nil {
+		subject = domain.Principal{ID: req.Subject.ID, Roles: req.Subject.Roles, Scopes: req.Subject.Scopes, TenantID: req.Subject.Tenant}
+	}
+	d, err := h.service.CheckAccess(r.Context(), subject, req.Action, req.ResourceID)
+	if err != nil {
+		handleError(r.Context(), err, w)
+		return
+	}
+
+	writeJson(w, d, 200)
+}
@@ -0,0 +1,144 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dennypenta/go-api-walkthrough/authz"
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/handlers"
+	"github.com/dennypenta/go-api-walkthrough/handlers/mocks"
+	"github.com/dennypenta/go-api-walkthrough/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestAuthorizer(t *testing.T) {
+	type testCase struct {
+		name       string
+		principal  *domain.Principal
+		setupMocks func(m *mocks.MockPolicy)
+
+		expectedStatus int
+		expectedResp   string
+		expectedAudit  bool
+	}
+	const id = "8da80ba8-81c6-4336-bba3-ba8ea50541b0"
+	member := domain.Principal{ID: "1", Roles: []string{domain.RoleMember}}
+
+	for _, tt := range []testCase{
+		{
+			name:           "anonymous",
+			setupMocks:     func(m *mocks.MockPolicy) {},
+			expectedStatus: 401,
+			expectedResp:   `{"code":"unauthorized"}`,
+		},
+		{
+			name:      "allowed",
+			principal: &member,
+			setupMocks: func(m *mocks.MockPolicy) {
+				m.On("Allowed", member, authz.DeleteUser, id).Return(true)
+			},
+			expectedStatus: 200,
+		},
+		{
+			name:      "denied",
+			principal: &member,
+			setupMocks: func(m *mocks.MockPolicy) {
+				m.On("Allowed", member, authz.DeleteUser, id).Return(false)
+			},
+			expectedStatus: 403,
+			expectedResp:   `{"code":"forbidden"}`,
+			expectedAudit:  true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			m := mocks.NewMockPolicy(t)
+			tt.setupMocks(m)
+			var audit bytes.Buffer
+			ctx := log.LoggerToContext(context.Background(), log.NewLogger(&bytes.Buffer{}, slog.LevelInfo))
+			if tt.principal != nil {
+				ctx = domain.ContextWithPrincipal(ctx, *tt.principal)
+			}
+
+			a := handlers.NewAuthorizer(m, log.NewLogger(&audit, slog.LevelInfo))
+			mux := http.NewServeMux()
+			mux.Handle("DELETE /v1/users/{id}", a.Require(authz.DeleteUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest("DELETE", "/v1/users/"+id, nil).WithContext(ctx))
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedResp != "" {
+				assert.JSONEq(t, tt.expectedResp, w.Body.String())
+			}
+			if tt.expectedAudit {
+				assert.Contains(t, audit.String(), `"msg":"access denied","principalID":"1","roles":["member"],"permission":"users:delete","resourceID":"`+id+`"`)
+			} else {
+				assert.Empty(t, audit.String())
+			}
+		})
+	}
+}
+
+func TestCheckAccessHandler(t *testing.T) {
+	type testCase struct {
+		name       string
+		body       string
+		setupMocks func(m *mocks.MockUserService)
+
+		expectedStatus int
+		expectedResp   string
+	}
+	caller := domain.Principal{ID: "1", Roles: []string{domain.RoleAdmin}}
+	const id = "8da80ba8-81c6-4336-bba3-ba8ea50541b0"
+
+	for _, tt := range []testCase{
+		{
+			name: "the caller is the subject by default",
+			body: `{"action": "users:delete", "resource_id": "` + id + `"}`,
+			setupMocks: func(m *mocks.MockUserService) {
+				m.On("CheckAccess", mock.Anything, caller, "users:delete", id).
+					Return(domain.Decision{Allowed: true, Rule: "admins", Reason: `allowed by rule "admins"`}, nil)
+			},
+			expectedStatus: 200,
+			expectedResp:   `{"allowed": true, "rule": "admins", "reason": "allowed by rule \"admins\""}`,
+		},
+		{
+			name: "given subject",
+			body: `{"subject": {"id": "2", "roles": ["member"], "tenant": "acme"}, "action": "users:list"}`,
+			setupMocks: func(m *mocks.MockUserService) {
+				subject := domain.Principal{ID: "2", Roles: []string{"member"}, TenantID: "acme"}
+				m.On("CheckAccess", mock.Anything, subject, "users:list", "").
+					Return(domain.Decision{Reason: "no rule allows users:list"}, nil)
+			},
+			expectedStatus: 200,
+			expectedResp:   `{"allowed": false, "reason": "no rule allows users:list"}`,
+		},
+		{
+			name: "unknown action",
+			body: `{"action": "users:drop"}`,
+			setupMocks: func(m *mocks.MockUserService) {
+				m.On("CheckAccess", mock.Anything, caller, "users:drop", "").Return(domain.Decision{}, domain.ErrInvalidAction)
+			},
+			expectedStatus: 400,
+			expectedResp:   `{"code": "invalid_action"}`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			m := mocks.NewMockUserService(t)
+			tt.setupMocks(m)
+			ctx := log.LoggerToContext(context.Background(), log.NewLogger(&bytes.Buffer{}, slog.LevelInfo))
+			ctx = domain.ContextWithPrincipal(ctx, caller)
+
+			w := httptest.NewRecorder()
+			handlers.NewHandler(m).CheckAccess(w, httptest.NewRequest("POST", "/v1/authz/check", bytes.NewBufferString(tt.body)).WithContext(ctx))
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.JSONEq(t, tt.expectedResp, w.Body.String())
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+//go:generate mockery --name=EmailVerificationService --dir=. --outpkg=mocks --filename=mock_email_verification_service.go --output=./mocks --structname MockEmailVerificationService
+type EmailVerificationService interface {
+	RequestEmailVerification(ctx context.Context, userID string) error
+	VerifyEmail(ctx context.Context, token string) error
+}
+
+// EmailHandler verifies the emails of the users with the tokens mailed to them.
+type EmailHandler struct {
+	service EmailVerificationService
+}
+
+func NewEmailHandler(service EmailVerificationService) *EmailHandler {
+	return &EmailHandler{
+		service: service,
+	}
+}
+
+// RequestEmailVerification mails a verification token to the email of the user,
+// it's accepted once the mail is handed over, the delivery is up to the mail relay.
+func (h *EmailHandler) RequestEmailVerification(w http.ResponseWriter, r *http.Request) {
+	if err := h.service.RequestEmailVerification(r.Context(), r.PathValue("id")); err != nil {
+		handleError(r.Context(), err, w)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+type verifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+// VerifyEmail takes the token from the mail, the token is the proof, so the route is public.
+func (h *EmailHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req verifyEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJson(w, ErrFailedMarshal, 400)
+		return
+	}
+
+	if err := h.service.VerifyEmail(r.Context(), req.Token); err != nil {
+		handleError(r.Context(), err, w)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
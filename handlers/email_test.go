@@ -0,0 +1,135 @@
+package handlers_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/handlers"
+	"github.com/dennypenta/go-api-walkthrough/handlers/mocks"
+	"github.com/dennypenta/go-api-walkthrough/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestRequestEmailVerificationHandler(t *testing.T) {
+	type testCase struct {
+		name       string
+		setupMocks func(m *mocks.MockEmailVerificationService)
+
+		expectedResp       string
+		expectedStatus     int
+		expectedRetryAfter string
+	}
+
+	for _, tt := range []testCase{
+		{
+			name: "sent",
+			setupMocks: func(m *mocks.MockEmailVerificationService) {
+				m.On("RequestEmailVerification", mock.Anything, "1").Return(nil)
+			},
+			expectedStatus: 202,
+		},
+		{
+			name: "rate limited",
+			setupMocks: func(m *mocks.MockEmailVerificationService) {
+				m.On("RequestEmailVerification", mock.Anything, "1").
+					Return(&domain.VerificationRateLimitedError{RetryAfter: 1500 * time.Millisecond})
+			},
+			expectedResp:       `{"code":"verification_rate_limited"}`,
+			expectedStatus:     429,
+			expectedRetryAfter: "2",
+		},
+		{
+			name: "no email",
+			setupMocks: func(m *mocks.MockEmailVerificationService) {
+				m.On("RequestEmailVerification", mock.Anything, "1").Return(domain.ErrEmailNotSet)
+			},
+			expectedResp:   `{"code":"email_not_set"}`,
+			expectedStatus: 400,
+		},
+		{
+			name: "verified already",
+			setupMocks: func(m *mocks.MockEmailVerificationService) {
+				m.On("RequestEmailVerification", mock.Anything, "1").Return(domain.ErrEmailVerified)
+			},
+			expectedResp:   `{"code":"email_verified"}`,
+			expectedStatus: 409,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			m := mocks.NewMockEmailVerificationService(t)
+			tt.setupMocks(m)
+			ctx := log.LoggerToContext(context.Background(), log.NewLogger(io.Discard, slog.LevelInfo))
+
+			req := httptest.NewRequest("POST", "/v1/users/1/email/verify-request", nil).WithContext(ctx)
+			req.SetPathValue("id", "1")
+			w := httptest.NewRecorder()
+			handlers.NewEmailHandler(m).RequestEmailVerification(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Equal(t, tt.expectedRetryAfter, w.Header().Get("Retry-After"))
+			if tt.expectedResp != "" {
+				assert.JSONEq(t, tt.expectedResp, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestVerifyEmailHandler(t *testing.T) {
+	type testCase struct {
+		name       string
+		reqBody    string
+		setupMocks func(m *mocks.MockEmailVerificationService)
+
+		expectedResp   string
+		expectedStatus int
+	}
+
+	for _, tt := range []testCase{
+		{
+			name:    "verified",
+			reqBody: `{"token": "token"}`,
+			setupMocks: func(m *mocks.MockEmailVerificationService) {
+				m.On("VerifyEmail", mock.Anything, "token").Return(nil)
+			},
+			expectedStatus: 204,
+		},
+		{
+			name:    "invalid token",
+			reqBody: `{"token": "unknown"}`,
+			setupMocks: func(m *mocks.MockEmailVerificationService) {
+				m.On("VerifyEmail", mock.Anything, "unknown").Return(domain.ErrInvalidVerificationToken)
+			},
+			expectedResp:   `{"code":"invalid_verification_token"}`,
+			expectedStatus: 400,
+		},
+		{
+			name:           "failed marshal",
+			reqBody:        `{`,
+			setupMocks:     func(m *mocks.MockEmailVerificationService) {},
+			expectedResp:   `{"code":"failed_marshal"}`,
+			expectedStatus: 400,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			m := mocks.NewMockEmailVerificationService(t)
+			tt.setupMocks(m)
+			ctx := log.LoggerToContext(context.Background(), log.NewLogger(io.Discard, slog.LevelInfo))
+
+			req := httptest.NewRequest("POST", "/v1/email/verify", strings.NewReader(tt.reqBody)).WithContext(ctx)
+			w := httptest.NewRecorder()
+			handlers.NewEmailHandler(m).VerifyEmail(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedResp != "" {
+				assert.JSONEq(t, tt.expectedResp, w.Body.String())
+			}
+		})
+	}
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"math"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/dennypenta/go-api-walkthrough/domain"
 	"github.com/dennypenta/go-api-walkthrough/pkg/log"
@@ -16,8 +18,11 @@ type UserService interface {
 	CreateUser(ctx context.Context, user domain.User) (domain.User, error)
 	GetUserByID(ctx context.Context, id string) (domain.User, error)
 	UpdateUser(ctx context.Context, user domain.User) (domain.User, error)
+	RenameUser(ctx context.Context, id, username string) (domain.User, error)
 	DeleteUser(ctx context.Context, id string) error
+	RestoreUser(ctx context.Context, id string) error
 	ListUsers(ctx context.Context, filter domain.UserFilter) (domain.PaginatedUserList, error)
+	CheckAccess(ctx context.Context, subject domain.Principal, action, resourceID string) (domain.Decision, error)
 }
 
 type Handler struct {
@@ -36,6 +41,9 @@ func NewHandler(service UserService) *Handler {
 	}
 }
 
+// staleWarning marks the last known data served while the storage is unavailable, see RFC 7234 5.5.1.
+const staleWarning = `110 - "Response is Stale"`
+
 type Error struct {
 	Code string                 `json:"code"`
 	Meta map[string]interface{} `json:"meta,omitempty"`
@@ -55,6 +63,81 @@ var (
 	ErrUserNotFound = Error{
 		Code: "user_not_found",
 	}
+	ErrUnavailable = Error{
+		Code: "unavailable",
+	}
+	ErrInvalidCredentials = Error{
+		Code: "invalid_credentials",
+	}
+	ErrInvalidLogin = Error{
+		Code: "invalid_login",
+	}
+	ErrWrongPassword = Error{
+		Code: "wrong_password",
+	}
+	ErrLoginTaken = Error{
+		Code: "login_taken",
+	}
+	ErrInvalidRefreshToken = Error{
+		Code: "invalid_refresh_token",
+	}
+	ErrUnauthorized = Error{
+		Code: "unauthorized",
+	}
+	ErrInvalidToken = Error{
+		Code: "invalid_token",
+	}
+	ErrForbidden = Error{
+		Code: "forbidden",
+	}
+	ErrInvalidRole = Error{
+		Code: "invalid_role",
+	}
+	ErrInvalidAction = Error{
+		Code: "invalid_action",
+	}
+	ErrSessionNotFound = Error{
+		Code: "session_not_found",
+	}
+	ErrInvalidExcept = Error{
+		Code: "invalid_except",
+	}
+	ErrAPIKeyNotFound = Error{
+		Code: "api_key_not_found",
+	}
+	ErrInvalidTwoFactorCode = Error{
+		Code: "invalid_two_factor_code",
+	}
+	ErrInvalidChallenge = Error{
+		Code: "invalid_challenge",
+	}
+	ErrTOTPNotFound = Error{
+		Code: "totp_not_found",
+	}
+	ErrTOTPEnabled = Error{
+		Code: "totp_enabled",
+	}
+	ErrInvalidEmail = Error{
+		Code: "invalid_email",
+	}
+	ErrEmailTaken = Error{
+		Code: "email_taken",
+	}
+	ErrEmailNotSet = Error{
+		Code: "email_not_set",
+	}
+	ErrEmailVerified = Error{
+		Code: "email_verified",
+	}
+	ErrInvalidVerificationToken = Error{
+		Code: "invalid_verification_token",
+	}
+	ErrVerificationRateLimited = Error{
+		Code: "verification_rate_limited",
+	}
+	ErrInvalidResetToken = Error{
+		Code: "invalid_reset_token",
+	}
 )
 
 func (h *Handler) CreateUser(w http.ResponseWriter, r *http.Request) {
@@ -74,25 +157,55 @@ func (h *Handler) CreateUser(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) GetUserByID(w http.ResponseWriter, r *http.Request) {
-	id := r.PathValue("id")
+	h.getUser(w, r, r.PathValue("id"))
+}
+
+// GetMe returns the user the request is authenticated as.
+func (h *Handler) GetMe(w http.ResponseWriter, r *http.Request) {
+	p, ok := domain.PrincipalFromContext(r.Context())
+	if !ok {
+		handleError(r.Context(), domain.ErrUnauthenticated, w)
+		return
+	}
+
+	h.getUser(w, r, p.ID)
+}
+
+func (h *Handler) getUser(w http.ResponseWriter, r *http.Request, id string) {
 	user, err := h.service.GetUserByID(r.Context(), id)
 	if err != nil {
 		handleError(r.Context(), err, w)
 		return
 	}
+	if user.Stale {
+		w.Header().Set("Warning", staleWarning)
+	}
 
 	writeJson(w, user, 200)
 }
 
+type updateUserRequest struct {
+	Username string `json:"username"`
+	// Email is nil when it's omitted, the stored one stays then, an empty one clears it
+	Email *string `json:"email"`
+}
+
+// UpdateUser replaces the username and the email, an omitted email stays as it is.
 func (h *Handler) UpdateUser(w http.ResponseWriter, r *http.Request) {
-	var user domain.User
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+	var req updateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeJson(w, ErrFailedMarshal, 400)
 		return
 	}
-	user.ID = r.PathValue("id")
+	id := r.PathValue("id")
 
-	user, err := h.service.UpdateUser(r.Context(), user)
+	var user domain.User
+	var err error
+	if req.Email == nil {
+		user, err = h.service.RenameUser(r.Context(), id, req.Username)
+	} else {
+		user, err = h.service.UpdateUser(r.Context(), domain.User{ID: id, Username: req.Username, Email: *req.Email})
+	}
 	if err != nil {
 		handleError(r.Context(), err, w)
 		return
@@ -111,6 +224,17 @@ func (h *Handler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(200)
 }
 
+// RestoreUser reverts the soft delete.
+func (h *Handler) RestoreUser(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := h.service.RestoreUser(r.Context(), id); err != nil {
+		handleError(r.Context(), err, w)
+		return
+	}
+
+	w.WriteHeader(204)
+}
+
 func (h *Handler) ListUsers(w http.ResponseWriter, r *http.Request) {
 	limitStr := r.URL.Query().Get("limit")
 	offsetStr := r.URL.Query().Get("offset")
@@ -140,6 +264,9 @@ func (h *Handler) ListUsers(w http.ResponseWriter, r *http.Request) {
 		handleError(r.Context(), err, w)
 		return
 	}
+	if users.Stale {
+		w.Header().Set("Warning", staleWarning)
+	}
 
 	writeJson(w, users, 200)
 }
@@ -160,9 +287,111 @@ func handleError(ctx context.Context, err error, w http.ResponseWriter) {
 		writeJson(w, ErrUserNotFound, 400)
 	case errors.Is(err, domain.ErrInvalidUsername):
 		writeJson(w, ErrInvalidUsername, 400)
+	case errors.Is(err, domain.ErrInvalidCredentials):
+		writeJson(w, ErrInvalidCredentials, 401)
+	case errors.Is(err, domain.ErrInvalidLogin):
+		writeJson(w, ErrInvalidLogin, 400)
+	case errors.Is(err, domain.ErrWrongPassword):
+		// not 401, the caller is authenticated and mustn't drop the tokens
+		writeJson(w, ErrWrongPassword, 403)
+	case errors.Is(err, domain.ErrLoginTaken):
+		writeJson(w, ErrLoginTaken, 409)
+	case errors.Is(err, domain.ErrInvalidRefreshToken):
+		writeJson(w, ErrInvalidRefreshToken, 401)
+	case errors.Is(err, domain.ErrUnauthenticated):
+		writeUnauthorized(ctx, w, "", ErrUnauthorized)
+	case errors.Is(err, domain.ErrForbidden):
+		writeJson(w, ErrForbidden, 403)
+	case errors.Is(err, domain.ErrInvalidRole):
+		writeJson(w, ErrInvalidRole, 400)
+	case errors.Is(err, domain.ErrInvalidAction):
+		writeJson(w, ErrInvalidAction, 400)
+	case errors.Is(err, domain.ErrSessionNotFound):
+		writeJson(w, ErrSessionNotFound, 400)
+	case errors.Is(err, domain.ErrAPIKeyNotFound):
+		writeJson(w, ErrAPIKeyNotFound, 400)
+	case errors.Is(err, domain.ErrInvalidAPIKey):
+		writeJson(w, invalidAPIKey(err), 400)
+	case errors.Is(err, domain.ErrTwoFactorRequired):
+		// the challenge token is a credential like the tokens
+		w.Header().Set("Cache-Control", "no-store")
+		writeJson(w, twoFactorRequired(err), 401)
+	case errors.Is(err, domain.ErrInvalidTwoFactorCode):
+		writeJson(w, ErrInvalidTwoFactorCode, 400)
+	case errors.Is(err, domain.ErrInvalidChallenge):
+		writeJson(w, ErrInvalidChallenge, 401)
+	case errors.Is(err, domain.ErrTOTPNotFound):
+		writeJson(w, ErrTOTPNotFound, 400)
+	case errors.Is(err, domain.ErrTOTPEnabled):
+		writeJson(w, ErrTOTPEnabled, 409)
+	case errors.Is(err, domain.ErrWeakPassword):
+		writeJson(w, weakPassword(err), 400)
+	case errors.Is(err, domain.ErrInvalidEmail):
+		writeJson(w, ErrInvalidEmail, 400)
+	case errors.Is(err, domain.ErrEmailTaken):
+		writeJson(w, ErrEmailTaken, 409)
+	case errors.Is(err, domain.ErrEmailNotSet):
+		writeJson(w, ErrEmailNotSet, 400)
+	case errors.Is(err, domain.ErrEmailVerified):
+		writeJson(w, ErrEmailVerified, 409)
+	case errors.Is(err, domain.ErrInvalidVerificationToken):
+		writeJson(w, ErrInvalidVerificationToken, 400)
+	case errors.Is(err, domain.ErrInvalidResetToken):
+		writeJson(w, ErrInvalidResetToken, 400)
+	case errors.Is(err, domain.ErrVerificationRateLimited):
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(err)))
+		writeJson(w, ErrVerificationRateLimited, 429)
+	case errors.Is(err, domain.ErrUnavailable):
+		l.WarnContext(ctx, "storage unavailable", "err", err)
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(err)))
+		writeJson(w, ErrUnavailable, 503)
 
 	default:
 		l.ErrorContext(ctx, "unhandled error", "err", err)
 		writeJson(w, ErrUnknown, 500)
 	}
 }
+
+// retryAfterSeconds rounds the delay the storage or the rate limit has suggested up to the whole seconds, it's 1 at least.
+func retryAfterSeconds(err error) int {
+	var after time.Duration
+	var unavailable *domain.UnavailableError
+	var limited *domain.VerificationRateLimitedError
+	switch {
+	case errors.As(err, &unavailable):
+		after = unavailable.RetryAfter
+	case errors.As(err, &limited):
+		after = limited.RetryAfter
+	}
+	return max(int(math.Ceil(after.Seconds())), 1)
+}
+
+// invalidAPIKey tells the client what is wrong with the requested key.
+func invalidAPIKey(err error) Error {
+	resp := Error{Code: "invalid_api_key"}
+	var invalid *domain.InvalidAPIKeyError
+	if errors.As(err, &invalid) {
+		resp.Meta = map[string]interface{}{"reason": invalid.Reason}
+	}
+	return resp
+}
+
+// twoFactorRequired gives the client the challenge to finish the login with.
+func twoFactorRequired(err error) Error {
+	resp := Error{Code: "two_factor_required"}
+	var required *domain.TwoFactorRequiredError
+	if errors.As(err, &required) {
+		resp.Meta = map[string]interface{}{"challenge_token": required.ChallengeToken, "expires_in": required.ExpiresIn}
+	}
+	return resp
+}
+
+// weakPassword tells the client the rule the password breaks.
+func weakPassword(err error) Error {
+	resp := Error{Code: "weak_password"}
+	var weak *domain.WeakPasswordError
+	if errors.As(err, &weak) {
+		resp.Meta = map[string]interface{}{"reason": weak.Reason}
+	}
+	return resp
+}
@@ -4,9 +4,12 @@ import (
 	"bytes"
 	"context"
 	_ "embed"
+	"errors"
 	"io"
+	"log/slog"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/dennypenta/go-api-walkthrough/domain"
 	"github.com/dennypenta/go-api-walkthrough/handlers"
@@ -49,6 +52,24 @@ func TestCreateUserHandler(t *testing.T) {
 			expectedResp:   `{"code":"invalid_username"}`,
 			expectedStatus: 400,
 		},
+		{
+			name:    "invalid email",
+			reqBody: []byte(`{"username": "test", "email": "test"}`),
+			setupMocks: func(m *mocks.MockUserService) {
+				m.On("CreateUser", mock.Anything, domain.User{Username: "test", Email: "test"}).Return(domain.User{}, domain.ErrInvalidEmail)
+			},
+			expectedResp:   `{"code":"invalid_email"}`,
+			expectedStatus: 400,
+		},
+		{
+			name:    "email taken",
+			reqBody: []byte(`{"username": "test", "email": "test@example.com"}`),
+			setupMocks: func(m *mocks.MockUserService) {
+				m.On("CreateUser", mock.Anything, domain.User{Username: "test", Email: "test@example.com"}).Return(domain.User{}, domain.ErrEmailTaken)
+			},
+			expectedResp:   `{"code":"email_taken"}`,
+			expectedStatus: 409,
+		},
 		{
 			name:    "failed marshal",
 			reqBody: []byte(`{`),
@@ -61,7 +82,7 @@ func TestCreateUserHandler(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			m := mocks.NewMockUserService(t)
 			tt.setupMocks(m)
-			l := log.NewLogger(io.Discard)
+			l := log.NewLogger(io.Discard, slog.LevelInfo)
 			ctx := log.LoggerToContext(context.Background(), l)
 
 			h := handlers.NewHandler(m)
@@ -75,3 +96,135 @@ func TestCreateUserHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestUpdateUserHandler(t *testing.T) {
+	type testCase struct {
+		name       string
+		reqBody    []byte
+		setupMocks func(m *mocks.MockUserService)
+
+		expectedResp   string
+		expectedStatus int
+	}
+	id := "8da80ba8-81c6-4336-bba3-ba8ea50541b0"
+	user := domain.User{ID: id, Username: "test"}
+
+	for _, tt := range []testCase{
+		{
+			name:    "omitted email stays",
+			reqBody: []byte(`{"username": "test"}`),
+			setupMocks: func(m *mocks.MockUserService) {
+				m.On("RenameUser", mock.Anything, id, "test").Return(user, nil)
+			},
+			expectedResp:   userJson,
+			expectedStatus: 200,
+		},
+		{
+			name:    "empty email clears it",
+			reqBody: []byte(`{"username": "test", "email": ""}`),
+			setupMocks: func(m *mocks.MockUserService) {
+				m.On("UpdateUser", mock.Anything, domain.User{ID: id, Username: "test"}).Return(user, nil)
+			},
+			expectedResp:   userJson,
+			expectedStatus: 200,
+		},
+		{
+			name:    "email taken",
+			reqBody: []byte(`{"username": "test", "email": "test@example.com"}`),
+			setupMocks: func(m *mocks.MockUserService) {
+				m.On("UpdateUser", mock.Anything, domain.User{ID: id, Username: "test", Email: "test@example.com"}).Return(domain.User{}, domain.ErrEmailTaken)
+			},
+			expectedResp:   `{"code":"email_taken"}`,
+			expectedStatus: 409,
+		},
+		{
+			name:    "invalid username",
+			reqBody: []byte(`{"username": ""}`),
+			setupMocks: func(m *mocks.MockUserService) {
+				m.On("RenameUser", mock.Anything, id, "").Return(domain.User{}, domain.ErrInvalidUsername)
+			},
+			expectedResp:   `{"code":"invalid_username"}`,
+			expectedStatus: 400,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			m := mocks.NewMockUserService(t)
+			tt.setupMocks(m)
+			l := log.NewLogger(io.Discard, slog.LevelInfo)
+			ctx := log.LoggerToContext(context.Background(), l)
+
+			h := handlers.NewHandler(m)
+			req := httptest.NewRequest("PUT", "/users/"+id, bytes.NewBuffer(tt.reqBody)).WithContext(ctx)
+			req.SetPathValue("id", id)
+			w := httptest.NewRecorder()
+			h.UpdateUser(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.JSONEq(t, tt.expectedResp, w.Body.String())
+		})
+	}
+}
+
+func TestGetUserByIDHandler(t *testing.T) {
+	type testCase struct {
+		name       string
+		setupMocks func(m *mocks.MockUserService)
+
+		expectedStatus     int
+		expectedResp       string
+		expectedWarning    string
+		expectedRetryAfter string
+	}
+	user := domain.User{ID: "8da80ba8-81c6-4336-bba3-ba8ea50541b0", Username: "test"}
+	staleUser := user
+	staleUser.Stale = true
+
+	for _, tt := range []testCase{
+		{
+			name: "unavailable storage",
+			setupMocks: func(m *mocks.MockUserService) {
+				m.On("GetUserByID", mock.Anything, user.ID).Return(domain.User{}, &domain.UnavailableError{RetryAfter: 2500 * time.Millisecond, Err: errors.New("circuit breaker is open")})
+			},
+			expectedStatus:     503,
+			expectedResp:       `{"code":"unavailable"}`,
+			expectedRetryAfter: "3",
+		},
+		{
+			name: "fresh user",
+			setupMocks: func(m *mocks.MockUserService) {
+				m.On("GetUserByID", mock.Anything, user.ID).Return(user, nil)
+			},
+			expectedResp: userJson,
+		},
+		{
+			name: "stale user",
+			setupMocks: func(m *mocks.MockUserService) {
+				m.On("GetUserByID", mock.Anything, user.ID).Return(staleUser, nil)
+			},
+			expectedResp:    `{"id":"8da80ba8-81c6-4336-bba3-ba8ea50541b0","username":"test","stale":true}`,
+			expectedWarning: `110 - "Response is Stale"`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			m := mocks.NewMockUserService(t)
+			tt.setupMocks(m)
+
+			l := log.NewLogger(io.Discard, slog.LevelInfo)
+			ctx := log.LoggerToContext(context.Background(), l)
+
+			h := handlers.NewHandler(m)
+			req := httptest.NewRequest("GET", "/v1/users/"+user.ID, nil).WithContext(ctx)
+			req.SetPathValue("id", user.ID)
+			w := httptest.NewRecorder()
+			h.GetUserByID(w, req)
+
+			if tt.expectedStatus == 0 {
+				tt.expectedStatus = 200
+			}
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.JSONEq(t, tt.expectedResp, w.Body.String())
+			assert.Equal(t, tt.expectedWarning, w.Header().Get("Warning"))
+			assert.Equal(t, tt.expectedRetryAfter, w.Header().Get("Retry-After"))
+		})
+	}
+}
@@ -0,0 +1,132 @@
+// Code generated by mockery v2.53.7. DO NOT EDIT.
+
+package mocks
+
+import (
+	context "context"
+
+	domain "github.com/dennypenta/go-api-walkthrough/domain"
+
+	mock "github.com/stretchr/testify/mock"
+)
+
+// MockAuthService is an autogenerated mock type for the AuthService type
+type MockAuthService struct {
+	mock.Mock
+}
+
+// Login provides a mock function with given fields: ctx, login, password, client
+func (_m *MockAuthService) Login(ctx context.Context, login string, password string, client domain.Client) (domain.TokenPair, error) {
+	ret := _m.Called(ctx, login, password, client)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Login")
+	}
+
+	var r0 domain.TokenPair
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, domain.Client) (domain.TokenPair, error)); ok {
+		return rf(ctx, login, password, client)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, domain.Client) domain.TokenPair); ok {
+		r0 = rf(ctx, login, password, client)
+	} else {
+		r0 = ret.Get(0).(domain.TokenPair)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, domain.Client) error); ok {
+		r1 = rf(ctx, login, password, client)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// LoginTwoFactor provides a mock function with given fields: ctx, challengeToken, code, client
+func (_m *MockAuthService) LoginTwoFactor(ctx context.Context, challengeToken string, code string, client domain.Client) (domain.TokenPair, error) {
+	ret := _m.Called(ctx, challengeToken, code, client)
+
+	if len(ret) == 0 {
+		panic("no return value specified for LoginTwoFactor")
+	}
+
+	var r0 domain.TokenPair
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, domain.Client) (domain.TokenPair, error)); ok {
+		return rf(ctx, challengeToken, code, client)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, domain.Client) domain.TokenPair); ok {
+		r0 = rf(ctx, challengeToken, code, client)
+	} else {
+		r0 = ret.Get(0).(domain.TokenPair)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, domain.Client) error); ok {
+		r1 = rf(ctx, challengeToken, code, client)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Refresh provides a mock function with given fields: ctx, refreshToken, client
+func (_m *MockAuthService) Refresh(ctx context.Context, refreshToken string, client domain.Client) (domain.TokenPair, error) {
+	ret := _m.Called(ctx, refreshToken, client)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Refresh")
+	}
+
+	var r0 domain.TokenPair
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, domain.Client) (domain.TokenPair, error)); ok {
+		return rf(ctx, refreshToken, client)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, domain.Client) domain.TokenPair); ok {
+		r0 = rf(ctx, refreshToken, client)
+	} else {
+		r0 = ret.Get(0).(domain.TokenPair)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, domain.Client) error); ok {
+		r1 = rf(ctx, refreshToken, client)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SetCredentials provides a mock function with given fields: ctx, userID, login, password, currentPassword
+func (_m *MockAuthService) SetCredentials(ctx context.Context, userID string, login string, password string, currentPassword string) error {
+	ret := _m.Called(ctx, userID, login, password, currentPassword)
+
+	if len(ret) == 0 {
+		panic("no return value specified for SetCredentials")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string, string) error); ok {
+		r0 = rf(ctx, userID, login, password, currentPassword)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// NewMockAuthService creates a new instance of MockAuthService. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewMockAuthService(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *MockAuthService {
+	mock := &MockAuthService{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
@@ -0,0 +1,58 @@
+// Code generated by mockery v2.53.7. DO NOT EDIT.
+
+package mocks
+
+import (
+	context "context"
+
+	domain "github.com/dennypenta/go-api-walkthrough/domain"
+
+	mock "github.com/stretchr/testify/mock"
+)
+
+// MockAuthenticator is an autogenerated mock type for the Authenticator type
+type MockAuthenticator struct {
+	mock.Mock
+}
+
+// Authenticate provides a mock function with given fields: ctx, credentials
+func (_m *MockAuthenticator) Authenticate(ctx context.Context, credentials string) (domain.Principal, error) {
+	ret := _m.Called(ctx, credentials)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Authenticate")
+	}
+
+	var r0 domain.Principal
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (domain.Principal, error)); ok {
+		return rf(ctx, credentials)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) domain.Principal); ok {
+		r0 = rf(ctx, credentials)
+	} else {
+		r0 = ret.Get(0).(domain.Principal)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, credentials)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// NewMockAuthenticator creates a new instance of MockAuthenticator. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewMockAuthenticator(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *MockAuthenticator {
+	mock := &MockAuthenticator{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
@@ -0,0 +1,47 @@
+// Code generated by mockery v2.53.7. DO NOT EDIT.
+
+package mocks
+
+import (
+	authz "github.com/dennypenta/go-api-walkthrough/authz"
+	domain "github.com/dennypenta/go-api-walkthrough/domain"
+
+	mock "github.com/stretchr/testify/mock"
+)
+
+// MockPolicy is an autogenerated mock type for the Policy type
+type MockPolicy struct {
+	mock.Mock
+}
+
+// Allowed provides a mock function with given fields: p, perm, resourceID
+func (_m *MockPolicy) Allowed(p domain.Principal, perm authz.Permission, resourceID string) bool {
+	ret := _m.Called(p, perm, resourceID)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Allowed")
+	}
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(domain.Principal, authz.Permission, string) bool); ok {
+		r0 = rf(p, perm, resourceID)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	return r0
+}
+
+// NewMockPolicy creates a new instance of MockPolicy. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewMockPolicy(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *MockPolicy {
+	mock := &MockPolicy{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
@@ -1,4 +1,4 @@
-// Code generated by mockery v2.43.2. DO NOT EDIT.
+// Code generated by mockery v2.53.7. DO NOT EDIT.
 
 package mocks
 
@@ -15,6 +15,34 @@ type MockUserService struct {
 	mock.Mock
 }
 
+// CheckAccess provides a mock function with given fields: ctx, subject, action, resourceID
+func (_m *MockUserService) CheckAccess(ctx context.Context, subject domain.Principal, action string, resourceID string) (domain.Decision, error) {
+	ret := _m.Called(ctx, subject, action, resourceID)
+
+	if len(ret) == 0 {
+		panic("no return value specified for CheckAccess")
+	}
+
+	var r0 domain.Decision
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, domain.Principal, string, string) (domain.Decision, error)); ok {
+		return rf(ctx, subject, action, resourceID)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, domain.Principal, string, string) domain.Decision); ok {
+		r0 = rf(ctx, subject, action, resourceID)
+	} else {
+		r0 = ret.Get(0).(domain.Decision)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, domain.Principal, string, string) error); ok {
+		r1 = rf(ctx, subject, action, resourceID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // CreateUser provides a mock function with given fields: ctx, user
 func (_m *MockUserService) CreateUser(ctx context.Context, user domain.User) (domain.User, error) {
 	ret := _m.Called(ctx, user)
@@ -117,6 +145,52 @@ func (_m *MockUserService) ListUsers(ctx context.Context, filter domain.UserFilt
 	return r0, r1
 }
 
+// RenameUser provides a mock function with given fields: ctx, id, username
+func (_m *MockUserService) RenameUser(ctx context.Context, id string, username string) (domain.User, error) {
+	ret := _m.Called(ctx, id, username)
+
+	if len(ret) == 0 {
+		panic("no return value specified for RenameUser")
+	}
+
+	var r0 domain.User
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) (domain.User, error)); ok {
+		return rf(ctx, id, username)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) domain.User); ok {
+		r0 = rf(ctx, id, username)
+	} else {
+		r0 = ret.Get(0).(domain.User)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, id, username)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RestoreUser provides a mock function with given fields: ctx, id
+func (_m *MockUserService) RestoreUser(ctx context.Context, id string) error {
+	ret := _m.Called(ctx, id)
+
+	if len(ret) == 0 {
+		panic("no return value specified for RestoreUser")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // UpdateUser provides a mock function with given fields: ctx, user
 func (_m *MockUserService) UpdateUser(ctx context.Context, user domain.User) (domain.User, error) {
 	ret := _m.Called(ctx, user)
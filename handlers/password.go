@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/dennypenta/go-api-walkthrough/pkg/log"
+)
+
+//go:generate mockery --name=PasswordResetService --dir=. --outpkg=mocks --filename=mock_password_reset_service.go --output=./mocks --structname MockPasswordResetService
+type PasswordResetService interface {
+	ForgotPassword(ctx context.Context, login string) error
+	ResetPassword(ctx context.Context, token, password string) error
+}
+
+// PasswordHandler lets the users who have forgotten the password set a new one.
+type PasswordHandler struct {
+	service PasswordResetService
+}
+
+func NewPasswordHandler(service PasswordResetService) *PasswordHandler {
+	return &PasswordHandler{
+		service: service,
+	}
+}
+
+type forgotPasswordRequest struct {
+	Login string `json:"login"`
+}
+
+// ForgotPassword is accepted whatever the login is, a failure is logged only,
+// so the response can't tell the logins having a verified email from the others.
+func (h *PasswordHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req forgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJson(w, ErrFailedMarshal, 400)
+		return
+	}
+
+	if err := h.service.ForgotPassword(r.Context(), req.Login); err != nil {
+		log.LoggerFromContext(r.Context()).ErrorContext(r.Context(), "failed to queue password reset", "err", err)
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+type resetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// ResetPassword takes the token from the mail, the token is the proof, so the route is public.
+func (h *PasswordHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req resetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJson(w, ErrFailedMarshal, 400)
+		return
+	}
+
+	if err := h.service.ResetPassword(r.Context(), req.Token, req.Password); err != nil {
+		handleError(r.Context(), err, w)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
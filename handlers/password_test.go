@@ -0,0 +1,126 @@
+package handlers_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/handlers"
+	"github.com/dennypenta/go-api-walkthrough/handlers/mocks"
+	"github.com/dennypenta/go-api-walkthrough/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestForgotPasswordHandler(t *testing.T) {
+	type testCase struct {
+		name       string
+		reqBody    string
+		setupMocks func(m *mocks.MockPasswordResetService)
+
+		expectedResp   string
+		expectedStatus int
+	}
+
+	for _, tt := range []testCase{
+		{
+			name:    "accepted",
+			reqBody: `{"login": "alice"}`,
+			setupMocks: func(m *mocks.MockPasswordResetService) {
+				m.On("ForgotPassword", mock.Anything, "alice").Return(nil)
+			},
+			expectedStatus: 202,
+		},
+		{
+			name:    "failure is accepted",
+			reqBody: `{"login": "alice"}`,
+			setupMocks: func(m *mocks.MockPasswordResetService) {
+				m.On("ForgotPassword", mock.Anything, "alice").Return(errors.New("connection refused"))
+			},
+			expectedStatus: 202,
+		},
+		{
+			name:           "failed marshal",
+			reqBody:        `{`,
+			setupMocks:     func(m *mocks.MockPasswordResetService) {},
+			expectedResp:   `{"code":"failed_marshal"}`,
+			expectedStatus: 400,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			m := mocks.NewMockPasswordResetService(t)
+			tt.setupMocks(m)
+			ctx := log.LoggerToContext(context.Background(), log.NewLogger(io.Discard, slog.LevelInfo))
+
+			req := httptest.NewRequest("POST", "/v1/auth/password/forgot", strings.NewReader(tt.reqBody)).WithContext(ctx)
+			w := httptest.NewRecorder()
+			handlers.NewPasswordHandler(m).ForgotPassword(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedResp != "" {
+				assert.JSONEq(t, tt.expectedResp, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestResetPasswordHandler(t *testing.T) {
+	type testCase struct {
+		name       string
+		reqBody    string
+		setupMocks func(m *mocks.MockPasswordResetService)
+
+		expectedResp   string
+		expectedStatus int
+	}
+
+	for _, tt := range []testCase{
+		{
+			name:    "reset",
+			reqBody: `{"token": "token", "password": "a brand new passphrase"}`,
+			setupMocks: func(m *mocks.MockPasswordResetService) {
+				m.On("ResetPassword", mock.Anything, "token", "a brand new passphrase").Return(nil)
+			},
+			expectedStatus: 204,
+		},
+		{
+			name:    "invalid token",
+			reqBody: `{"token": "unknown", "password": "a brand new passphrase"}`,
+			setupMocks: func(m *mocks.MockPasswordResetService) {
+				m.On("ResetPassword", mock.Anything, "unknown", "a brand new passphrase").Return(domain.ErrInvalidResetToken)
+			},
+			expectedResp:   `{"code":"invalid_reset_token"}`,
+			expectedStatus: 400,
+		},
+		{
+			name:    "weak password",
+			reqBody: `{"token": "token", "password": "short"}`,
+			setupMocks: func(m *mocks.MockPasswordResetService) {
+				m.On("ResetPassword", mock.Anything, "token", "short").
+					Return(&domain.WeakPasswordError{Reason: "must be at least 12 characters"})
+			},
+			expectedResp:   `{"code":"weak_password","meta":{"reason":"must be at least 12 characters"}}`,
+			expectedStatus: 400,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			m := mocks.NewMockPasswordResetService(t)
+			tt.setupMocks(m)
+			ctx := log.LoggerToContext(context.Background(), log.NewLogger(io.Discard, slog.LevelInfo))
+
+			req := httptest.NewRequest("POST", "/v1/auth/password/reset", strings.NewReader(tt.reqBody)).WithContext(ctx)
+			w := httptest.NewRecorder()
+			handlers.NewPasswordHandler(m).ResetPassword(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedResp != "" {
+				assert.JSONEq(t, tt.expectedResp, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+//go:generate mockery --name=RoleService --dir=. --outpkg=mocks --filename=mock_role_service.go --output=./mocks --structname MockRoleService
+type RoleService interface {
+	GetRoles(ctx context.Context, userID string) ([]string, error)
+	SetRoles(ctx context.Context, userID string, roles []string) error
+}
+
+type RoleHandler struct {
+	service RoleService
+}
+
+func NewRoleHandler(service RoleService) *RoleHandler {
+	return &RoleHandler{
+		service: service,
+	}
+}
+
+type rolesBody struct {
+	Roles []string `json:"roles"`
+}
+
+func (h *RoleHandler) GetRoles(w http.ResponseWriter, r *http.Request) {
+	roles, err := h.service.GetRoles(r.Context(), r.PathValue("id"))
+	if err != nil {
+		handleError(r.Context(), err, w)
+		return
+	}
+
+	writeJson(w, rolesBody{Roles: roles}, 200)
+}
+
+// SetRoles replaces the roles of the user, they take effect with the next access token.
+func (h *RoleHandler) SetRoles(w http.ResponseWriter, r *http.Request) {
+	var req rolesBody
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJson(w, ErrFailedMarshal, 400)
+		return
+	}
+
+	if err := h.service.SetRoles(r.Context(), r.PathValue("id"), req.Roles); err != nil {
+		handleError(r.Context(), err, w)
+		return
+	}
+
+	w.WriteHeader(204)
+}
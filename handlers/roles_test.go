@@ -0,0 +1,62 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/handlers"
+	"github.com/dennypenta/go-api-walkthrough/handlers/mocks"
+	"github.com/dennypenta/go-api-walkthrough/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestSetRolesHandler(t *testing.T) {
+	type testCase struct {
+		name       string
+		setupMocks func(m *mocks.MockRoleService)
+
+		expectedResp   string
+		expectedStatus int
+	}
+	id := "8da80ba8-81c6-4336-bba3-ba8ea50541b0"
+
+	for _, tt := range []testCase{
+		{
+			name: "valid roles",
+			setupMocks: func(m *mocks.MockRoleService) {
+				m.On("SetRoles", mock.Anything, id, []string{"support"}).Return(nil)
+			},
+			expectedStatus: 204,
+		},
+		{
+			name: "invalid role",
+			setupMocks: func(m *mocks.MockRoleService) {
+				m.On("SetRoles", mock.Anything, id, []string{"support"}).Return(domain.ErrInvalidRole)
+			},
+			expectedResp:   `{"code":"invalid_role"}`,
+			expectedStatus: 400,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			m := mocks.NewMockRoleService(t)
+			tt.setupMocks(m)
+			ctx := log.LoggerToContext(context.Background(), log.NewLogger(io.Discard, slog.LevelInfo))
+
+			req := httptest.NewRequest("PUT", "/v1/users/"+id+"/roles", bytes.NewBufferString(`{"roles": ["support"]}`)).WithContext(ctx)
+			req.SetPathValue("id", id)
+			w := httptest.NewRecorder()
+			handlers.NewRoleHandler(m).SetRoles(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedResp != "" {
+				assert.JSONEq(t, tt.expectedResp, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+)
+
+//go:generate mockery --name=SessionService --dir=. --outpkg=mocks --filename=mock_session_service.go --output=./mocks --structname MockSessionService
+type SessionService interface {
+	ListSessions(ctx context.Context, userID, currentID string) ([]domain.Session, error)
+	RevokeSession(ctx context.Context, userID, id string) error
+	RevokeOtherSessions(ctx context.Context, userID, currentID string) error
+}
+
+// SessionHandler serves the sessions of the caller, the routes require a signed in principal.
+type SessionHandler struct {
+	service SessionService
+}
+
+func NewSessionHandler(service SessionService) *SessionHandler {
+	return &SessionHandler{
+		service: service,
+	}
+}
+
+type sessionsBody struct {
+	Sessions []domain.Session `json:"sessions"`
+}
+
+func (h *SessionHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	p, ok := domain.PrincipalFromContext(r.Context())
+	if !ok {
+		handleError(r.Context(), domain.ErrUnauthenticated, w)
+		return
+	}
+
+	sessions, err := h.service.ListSessions(r.Context(), p.ID, p.SessionID)
+	if err != nil {
+		handleError(r.Context(), err, w)
+		return
+	}
+
+	writeJson(w, sessionsBody{Sessions: sessions}, 200)
+}
+
+// RevokeSession signs the device out, its access tokens are refused within the session cache TTL.
+func (h *SessionHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	p, ok := domain.PrincipalFromContext(r.Context())
+	if !ok {
+		handleError(r.Context(), domain.ErrUnauthenticated, w)
+		return
+	}
+
+	if err := h.service.RevokeSession(r.Context(), p.ID, r.PathValue("id")); err != nil {
+		handleError(r.Context(), err, w)
+		return
+	}
+
+	w.WriteHeader(204)
+}
+
+// RevokeSessions signs out every device of the caller, except=current keeps the one of the request.
+func (h *SessionHandler) RevokeSessions(w http.ResponseWriter, r *http.Request) {
+	p, ok := domain.PrincipalFromContext(r.Context())
+	if !ok {
+		handleError(r.Context(), domain.ErrUnauthenticated, w)
+		return
+	}
+
+	var keep string
+	switch r.URL.Query().Get("except") {
+	case "":
+	case "current":
+		keep = p.SessionID
+	default:
+		writeJson(w, ErrInvalidExcept, 400)
+		return
+	}
+
+	if err := h.service.RevokeOtherSessions(r.Context(), p.ID, keep); err != nil {
+		handleError(r.Context(), err, w)
+		return
+	}
+
+	w.WriteHeader(204)
+}
@@ -0,0 +1,117 @@
+package handlers_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/handlers"
+	"github.com/dennypenta/go-api-walkthrough/handlers/mocks"
+	"github.com/dennypenta/go-api-walkthrough/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestListSessionsHandler(t *testing.T) {
+	m := mocks.NewMockSessionService(t)
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	m.On("ListSessions", mock.Anything, "1", "s1").Return([]domain.Session{
+		{ID: "s1", UserID: "1", Device: "laptop", UserAgent: "curl/8.0", IP: "192.0.2.1", CreatedAt: at, LastSeenAt: at, Current: true},
+	}, nil)
+	ctx := log.LoggerToContext(context.Background(), log.NewLogger(io.Discard, slog.LevelInfo))
+	ctx = domain.ContextWithPrincipal(ctx, domain.Principal{ID: "1", SessionID: "s1"})
+
+	req := httptest.NewRequest("GET", "/v1/me/sessions", nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+	handlers.NewSessionHandler(m).ListSessions(w, req)
+
+	assert.Equal(t, 200, w.Code)
+	assert.JSONEq(t, `{"sessions":[{"id":"s1","device":"laptop","user_agent":"curl/8.0","ip":"192.0.2.1",
+		"created_at":"2024-01-01T00:00:00Z","last_seen_at":"2024-01-01T00:00:00Z","current":true}]}`, w.Body.String())
+}
+
+func TestRevokeSessionsHandler(t *testing.T) {
+	type testCase struct {
+		name       string
+		target     string
+		principal  *domain.Principal
+		setupMocks func(m *mocks.MockSessionService)
+
+		expectedResp   string
+		expectedStatus int
+	}
+	signedIn := domain.Principal{ID: "1", SessionID: "s1"}
+
+	for _, tt := range []testCase{
+		{
+			name:      "all",
+			target:    "/v1/me/sessions",
+			principal: &signedIn,
+			setupMocks: func(m *mocks.MockSessionService) {
+				m.On("RevokeOtherSessions", mock.Anything, "1", "").Return(nil)
+			},
+			expectedStatus: 204,
+		},
+		{
+			name:      "except current",
+			target:    "/v1/me/sessions?except=current",
+			principal: &signedIn,
+			setupMocks: func(m *mocks.MockSessionService) {
+				m.On("RevokeOtherSessions", mock.Anything, "1", "s1").Return(nil)
+			},
+			expectedStatus: 204,
+		},
+		{
+			name:           "unknown except",
+			target:         "/v1/me/sessions?except=others",
+			principal:      &signedIn,
+			setupMocks:     func(m *mocks.MockSessionService) {},
+			expectedResp:   `{"code":"invalid_except"}`,
+			expectedStatus: 400,
+		},
+		{
+			name:           "anonymous",
+			target:         "/v1/me/sessions",
+			setupMocks:     func(m *mocks.MockSessionService) {},
+			expectedResp:   `{"code":"unauthorized"}`,
+			expectedStatus: 401,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			m := mocks.NewMockSessionService(t)
+			tt.setupMocks(m)
+			ctx := log.LoggerToContext(context.Background(), log.NewLogger(io.Discard, slog.LevelInfo))
+			if tt.principal != nil {
+				ctx = domain.ContextWithPrincipal(ctx, *tt.principal)
+			}
+
+			req := httptest.NewRequest("DELETE", tt.target, nil).WithContext(ctx)
+			w := httptest.NewRecorder()
+			handlers.NewSessionHandler(m).RevokeSessions(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedResp != "" {
+				assert.JSONEq(t, tt.expectedResp, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestRevokeSessionHandler(t *testing.T) {
+	m := mocks.NewMockSessionService(t)
+	m.On("RevokeSession", mock.Anything, "1", "s2").Return(domain.ErrSessionNotFound)
+	ctx := log.LoggerToContext(context.Background(), log.NewLogger(io.Discard, slog.LevelInfo))
+	ctx = domain.ContextWithPrincipal(ctx, domain.Principal{ID: "1", SessionID: "s1"})
+
+	req := httptest.NewRequest("DELETE", "/v1/me/sessions/s2", nil).WithContext(ctx)
+	req.SetPathValue("id", "s2")
+	w := httptest.NewRecorder()
+	handlers.NewSessionHandler(m).RevokeSession(w, req)
+
+	assert.Equal(t, 400, w.Code)
+	assert.JSONEq(t, `{"code":"session_not_found"}`, w.Body.String())
+}
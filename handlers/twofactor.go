@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+)
+
+//go:generate mockery --name=TwoFactorService --dir=. --outpkg=mocks --filename=mock_two_factor_service.go --output=./mocks --structname MockTwoFactorService
+type TwoFactorService interface {
+	EnrollTOTP(ctx context.Context, userID string) (domain.TOTPEnrollment, error)
+	ConfirmTOTP(ctx context.Context, userID, code string) ([]string, error)
+}
+
+// TwoFactorHandler enrolls the second factor of the caller, the routes require a signed in principal.
+type TwoFactorHandler struct {
+	service TwoFactorService
+}
+
+func NewTwoFactorHandler(service TwoFactorService) *TwoFactorHandler {
+	return &TwoFactorHandler{
+		service: service,
+	}
+}
+
+// EnrollTOTP returns a new secret for the authenticator app, it's enabled once ConfirmTOTP gets a code of it.
+func (h *TwoFactorHandler) EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	p, ok := domain.PrincipalFromContext(r.Context())
+	if !ok {
+		handleError(r.Context(), domain.ErrUnauthenticated, w)
+		return
+	}
+
+	enrollment, err := h.service.EnrollTOTP(r.Context(), p.ID)
+	if err != nil {
+		handleError(r.Context(), err, w)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJson(w, enrollment, 200)
+}
+
+type confirmTOTPRequest struct {
+	Code string `json:"code"`
+}
+
+type recoveryCodesBody struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// ConfirmTOTP enables the second factor and returns the recovery codes, they aren't shown again.
+func (h *TwoFactorHandler) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	p, ok := domain.PrincipalFromContext(r.Context())
+	if !ok {
+		handleError(r.Context(), domain.ErrUnauthenticated, w)
+		return
+	}
+
+	var req confirmTOTPRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJson(w, ErrFailedMarshal, 400)
+		return
+	}
+
+	codes, err := h.service.ConfirmTOTP(r.Context(), p.ID, req.Code)
+	if err != nil {
+		handleError(r.Context(), err, w)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJson(w, recoveryCodesBody{RecoveryCodes: codes}, 200)
+}
@@ -0,0 +1,104 @@
+package handlers_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/handlers"
+	"github.com/dennypenta/go-api-walkthrough/handlers/mocks"
+	"github.com/dennypenta/go-api-walkthrough/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestEnrollTOTPHandler(t *testing.T) {
+	m := mocks.NewMockTwoFactorService(t)
+	m.On("EnrollTOTP", mock.Anything, "1").
+		Return(domain.TOTPEnrollment{Secret: "JBSWY3DPEHPK3PXP", URI: "otpauth://totp/user-service:alice?secret=JBSWY3DPEHPK3PXP"}, nil)
+	ctx := log.LoggerToContext(context.Background(), log.NewLogger(io.Discard, slog.LevelInfo))
+	ctx = domain.ContextWithPrincipal(ctx, domain.Principal{ID: "1"})
+
+	req := httptest.NewRequest("POST", "/v1/me/2fa/totp", nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+	handlers.NewTwoFactorHandler(m).EnrollTOTP(w, req)
+
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	assert.JSONEq(t, `{"secret":"JBSWY3DPEHPK3PXP","uri":"otpauth://totp/user-service:alice?secret=JBSWY3DPEHPK3PXP"}`, w.Body.String())
+}
+
+func TestConfirmTOTPHandler(t *testing.T) {
+	type testCase struct {
+		name       string
+		reqBody    string
+		setupMocks func(m *mocks.MockTwoFactorService)
+
+		expectedResp   string
+		expectedStatus int
+	}
+
+	for _, tt := range []testCase{
+		{
+			name:    "valid code",
+			reqBody: `{"code": "123456"}`,
+			setupMocks: func(m *mocks.MockTwoFactorService) {
+				m.On("ConfirmTOTP", mock.Anything, "1", "123456").Return([]string{"abcd-efgh-ijkl-mnop"}, nil)
+			},
+			expectedResp:   `{"recovery_codes":["abcd-efgh-ijkl-mnop"]}`,
+			expectedStatus: 200,
+		},
+		{
+			name:    "invalid code",
+			reqBody: `{"code": "000000"}`,
+			setupMocks: func(m *mocks.MockTwoFactorService) {
+				m.On("ConfirmTOTP", mock.Anything, "1", "000000").Return(nil, domain.ErrInvalidTwoFactorCode)
+			},
+			expectedResp:   `{"code":"invalid_two_factor_code"}`,
+			expectedStatus: 400,
+		},
+		{
+			name:    "not enrolled",
+			reqBody: `{"code": "123456"}`,
+			setupMocks: func(m *mocks.MockTwoFactorService) {
+				m.On("ConfirmTOTP", mock.Anything, "1", "123456").Return(nil, domain.ErrTOTPNotFound)
+			},
+			expectedResp:   `{"code":"totp_not_found"}`,
+			expectedStatus: 400,
+		},
+		{
+			name:    "enabled already",
+			reqBody: `{"code": "123456"}`,
+			setupMocks: func(m *mocks.MockTwoFactorService) {
+				m.On("ConfirmTOTP", mock.Anything, "1", "123456").Return(nil, domain.ErrTOTPEnabled)
+			},
+			expectedResp:   `{"code":"totp_enabled"}`,
+			expectedStatus: 409,
+		},
+		{
+			name:           "failed marshal",
+			reqBody:        `{`,
+			setupMocks:     func(m *mocks.MockTwoFactorService) {},
+			expectedResp:   `{"code":"failed_marshal"}`,
+			expectedStatus: 400,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			m := mocks.NewMockTwoFactorService(t)
+			tt.setupMocks(m)
+			ctx := log.LoggerToContext(context.Background(), log.NewLogger(io.Discard, slog.LevelInfo))
+			ctx = domain.ContextWithPrincipal(ctx, domain.Principal{ID: "1"})
+
+			req := httptest.NewRequest("POST", "/v1/me/2fa/totp/confirm", strings.NewReader(tt.reqBody)).WithContext(ctx)
+			w := httptest.NewRecorder()
+			handlers.NewTwoFactorHandler(m).ConfirmTOTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.JSONEq(t, tt.expectedResp, w.Body.String())
+		})
+	}
+}
@@ -0,0 +1,12 @@
+-- the usernames aren't unique, so a user signs in with a separate login
+CREATE TABLE IF NOT EXISTS user_credentials (
+    user_id uuid PRIMARY KEY REFERENCES users (id) NOT NULL,
+    login varchar(55) NOT NULL,
+    -- argon2id in the PHC string format, it keeps the parameters and the salt
+    password_hash TEXT NOT NULL,
+
+    createdAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    updatedAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+CREATE UNIQUE INDEX idx_user_credentials_login ON user_credentials (login);
@@ -0,0 +1,7 @@
+-- a user without rows here is a member
+CREATE TABLE IF NOT EXISTS user_roles (
+    user_id uuid REFERENCES users (id) NOT NULL,
+    role varchar(32) NOT NULL,
+
+    PRIMARY KEY (user_id, role)
+);
@@ -0,0 +1,9 @@
+ALTER TABLE refresh_tokens ADD COLUMN revokedAt TIMESTAMP;
+UPDATE refresh_tokens t SET revokedAt = s.revokedAt FROM sessions s WHERE s.id = t.session_id;
+ALTER TABLE refresh_tokens DROP CONSTRAINT refresh_tokens_session_id_fkey;
+ALTER INDEX idx_refresh_tokens_session_id RENAME TO idx_refresh_tokens_family_id;
+ALTER TABLE refresh_tokens RENAME COLUMN session_id TO family_id;
+
+DROP INDEX idx_sessions_user_id;
+
+DROP TABLE IF EXISTS sessions;
@@ -0,0 +1,26 @@
+-- a session is a signed in device, its refresh tokens are rotated within it
+CREATE TABLE IF NOT EXISTS sessions (
+    id uuid PRIMARY KEY NOT NULL,
+    user_id uuid REFERENCES users (id) NOT NULL,
+    device varchar(128) DEFAULT '' NOT NULL,
+    user_agent varchar(512) DEFAULT '' NOT NULL,
+    ip varchar(45) DEFAULT '' NOT NULL,
+
+    createdAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    lastSeenAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    revokedAt TIMESTAMP
+);
+
+CREATE INDEX idx_sessions_user_id ON sessions (user_id);
+
+-- the token families issued before are the sessions of unknown devices, a revoked family is a revoked session
+INSERT INTO sessions (id, user_id, createdAt, lastSeenAt, revokedAt)
+SELECT family_id, user_id, min(createdAt), max(createdAt), max(revokedAt)
+FROM refresh_tokens
+GROUP BY family_id, user_id;
+
+ALTER TABLE refresh_tokens RENAME COLUMN family_id TO session_id;
+ALTER INDEX idx_refresh_tokens_family_id RENAME TO idx_refresh_tokens_session_id;
+ALTER TABLE refresh_tokens ADD CONSTRAINT refresh_tokens_session_id_fkey FOREIGN KEY (session_id) REFERENCES sessions (id);
+-- the session is revoked instead
+ALTER TABLE refresh_tokens DROP COLUMN revokedAt;
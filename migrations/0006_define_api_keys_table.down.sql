@@ -0,0 +1,3 @@
+DROP INDEX idx_api_keys_prefix;
+
+DROP TABLE IF EXISTS api_keys;
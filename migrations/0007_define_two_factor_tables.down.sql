@@ -0,0 +1,6 @@
+DROP INDEX idx_two_factor_challenges_user_id;
+DROP INDEX idx_two_factor_challenges_token_hash;
+
+DROP TABLE IF EXISTS two_factor_challenges;
+DROP TABLE IF EXISTS recovery_codes;
+DROP TABLE IF EXISTS totp_secrets;
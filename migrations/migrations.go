@@ -0,0 +1,24 @@
+package migrations
+
+import (
+	"embed"
+	"io/fs"
+)
+
+// FS keeps the migrations inside the binary,
+// so it doesn't depend on the working directory or the files shipped next to it.
+//
+//go:embed *.sql
+var FS embed.FS
+
+//go:embed sqlite/*.sql
+var sqliteFS embed.FS
+
+// SQLiteFS is the migration set of the sqlite backend, it must keep the same versions as FS.
+var SQLiteFS = func() fs.FS {
+	sub, err := fs.Sub(sqliteFS, "sqlite")
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}()
@@ -0,0 +1,3 @@
+DROP INDEX idx_users_deletedat_createdat;
+
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,12 @@
+-- sqlite has no uuid type and generator, the ids and timestamps are set by the app
+CREATE TABLE IF NOT EXISTS users (
+    id TEXT PRIMARY KEY NOT NULL,
+    username varchar(55) NOT NULL,
+
+    createdAt TIMESTAMP NOT NULL,
+    updatedAt TIMESTAMP NOT NULL,
+
+    deletedAt TIMESTAMP
+);
+
+CREATE INDEX idx_users_deletedat_createdat ON users (deletedAt, createdAt DESC);
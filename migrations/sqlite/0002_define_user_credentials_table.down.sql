@@ -0,0 +1,3 @@
+DROP INDEX idx_user_credentials_login;
+
+DROP TABLE IF EXISTS user_credentials;
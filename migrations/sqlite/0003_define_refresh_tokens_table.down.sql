@@ -0,0 +1,4 @@
+DROP INDEX idx_refresh_tokens_family_id;
+DROP INDEX idx_refresh_tokens_token_hash;
+
+DROP TABLE IF EXISTS refresh_tokens;
@@ -0,0 +1,16 @@
+-- only the hashes of the opaque refresh tokens are kept,
+-- an exchange marks the token used and issues the next one of the same family
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id TEXT PRIMARY KEY NOT NULL,
+    family_id TEXT NOT NULL,
+    user_id TEXT REFERENCES users (id) NOT NULL,
+    token_hash TEXT NOT NULL,
+    expiresAt TIMESTAMP NOT NULL,
+
+    createdAt TIMESTAMP NOT NULL,
+    usedAt TIMESTAMP,
+    revokedAt TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_refresh_tokens_token_hash ON refresh_tokens (token_hash);
+CREATE INDEX idx_refresh_tokens_family_id ON refresh_tokens (family_id);
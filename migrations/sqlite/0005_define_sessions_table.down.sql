@@ -0,0 +1,25 @@
+CREATE TABLE refresh_tokens_old (
+    id TEXT PRIMARY KEY NOT NULL,
+    family_id TEXT NOT NULL,
+    user_id TEXT REFERENCES users (id) NOT NULL,
+    token_hash TEXT NOT NULL,
+    expiresAt TIMESTAMP NOT NULL,
+
+    createdAt TIMESTAMP NOT NULL,
+    usedAt TIMESTAMP,
+    revokedAt TIMESTAMP
+);
+
+INSERT INTO refresh_tokens_old (id, family_id, user_id, token_hash, expiresAt, createdAt, usedAt, revokedAt)
+SELECT t.id, t.session_id, t.user_id, t.token_hash, t.expiresAt, t.createdAt, t.usedAt, s.revokedAt
+FROM refresh_tokens t JOIN sessions s ON s.id = t.session_id;
+
+DROP TABLE refresh_tokens;
+ALTER TABLE refresh_tokens_old RENAME TO refresh_tokens;
+
+CREATE UNIQUE INDEX idx_refresh_tokens_token_hash ON refresh_tokens (token_hash);
+CREATE INDEX idx_refresh_tokens_family_id ON refresh_tokens (family_id);
+
+DROP INDEX idx_sessions_user_id;
+
+DROP TABLE IF EXISTS sessions;
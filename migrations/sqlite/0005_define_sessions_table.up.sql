@@ -0,0 +1,41 @@
+-- a session is a signed in device, its refresh tokens are rotated within it
+CREATE TABLE IF NOT EXISTS sessions (
+    id TEXT PRIMARY KEY NOT NULL,
+    user_id TEXT REFERENCES users (id) NOT NULL,
+    device TEXT DEFAULT '' NOT NULL,
+    user_agent TEXT DEFAULT '' NOT NULL,
+    ip TEXT DEFAULT '' NOT NULL,
+
+    createdAt TIMESTAMP NOT NULL,
+    lastSeenAt TIMESTAMP NOT NULL,
+    revokedAt TIMESTAMP
+);
+
+CREATE INDEX idx_sessions_user_id ON sessions (user_id);
+
+-- the token families issued before are the sessions of unknown devices, a revoked family is a revoked session
+INSERT INTO sessions (id, user_id, createdAt, lastSeenAt, revokedAt)
+SELECT family_id, user_id, min(createdAt), max(createdAt), max(revokedAt)
+FROM refresh_tokens
+GROUP BY family_id, user_id;
+
+-- sqlite can't add a foreign key to a table, it's built again
+CREATE TABLE refresh_tokens_new (
+    id TEXT PRIMARY KEY NOT NULL,
+    session_id TEXT REFERENCES sessions (id) NOT NULL,
+    user_id TEXT REFERENCES users (id) NOT NULL,
+    token_hash TEXT NOT NULL,
+    expiresAt TIMESTAMP NOT NULL,
+
+    createdAt TIMESTAMP NOT NULL,
+    usedAt TIMESTAMP
+);
+
+INSERT INTO refresh_tokens_new (id, session_id, user_id, token_hash, expiresAt, createdAt, usedAt)
+SELECT id, family_id, user_id, token_hash, expiresAt, createdAt, usedAt FROM refresh_tokens;
+
+DROP TABLE refresh_tokens;
+ALTER TABLE refresh_tokens_new RENAME TO refresh_tokens;
+
+CREATE UNIQUE INDEX idx_refresh_tokens_token_hash ON refresh_tokens (token_hash);
+CREATE INDEX idx_refresh_tokens_session_id ON refresh_tokens (session_id);
@@ -0,0 +1,17 @@
+-- the keys of the services calling the API, only their hashes are kept,
+-- the prefix is the public part of a key it's found by
+CREATE TABLE IF NOT EXISTS api_keys (
+    id TEXT PRIMARY KEY NOT NULL,
+    name TEXT NOT NULL,
+    prefix TEXT NOT NULL,
+    key_hash TEXT NOT NULL,
+    -- space separated like the scope claim of the tokens
+    scopes TEXT NOT NULL,
+
+    createdAt TIMESTAMP NOT NULL,
+    expiresAt TIMESTAMP,
+    lastUsedAt TIMESTAMP,
+    revokedAt TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_api_keys_prefix ON api_keys (prefix);
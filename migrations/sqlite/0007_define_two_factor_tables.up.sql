@@ -0,0 +1,36 @@
+-- the authenticator apps of the users, the secret generates the codes, so it's kept as is
+CREATE TABLE IF NOT EXISTS totp_secrets (
+    user_id TEXT PRIMARY KEY REFERENCES users (id) NOT NULL,
+    secret TEXT NOT NULL,
+    -- the time step of the last accepted code, a code of it or an earlier step is refused
+    last_used_step INTEGER DEFAULT 0 NOT NULL,
+
+    createdAt TIMESTAMP NOT NULL,
+    -- the enrollment is confirmed with the first code
+    enabledAt TIMESTAMP
+);
+
+-- the one-time codes signing in without the app, only their hashes are kept
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    user_id TEXT REFERENCES users (id) NOT NULL,
+    code_hash TEXT NOT NULL,
+
+    createdAt TIMESTAMP NOT NULL,
+    usedAt TIMESTAMP,
+    PRIMARY KEY (user_id, code_hash)
+);
+
+-- the logins waiting for the second factor, only the hashes of the tokens are kept
+CREATE TABLE IF NOT EXISTS two_factor_challenges (
+    id TEXT PRIMARY KEY NOT NULL,
+    user_id TEXT REFERENCES users (id) NOT NULL,
+    token_hash TEXT NOT NULL,
+    device TEXT DEFAULT '' NOT NULL,
+    attempts INTEGER DEFAULT 0 NOT NULL,
+
+    createdAt TIMESTAMP NOT NULL,
+    expiresAt TIMESTAMP NOT NULL
+);
+
+CREATE UNIQUE INDEX idx_two_factor_challenges_token_hash ON two_factor_challenges (token_hash);
+CREATE INDEX idx_two_factor_challenges_user_id ON two_factor_challenges (user_id);
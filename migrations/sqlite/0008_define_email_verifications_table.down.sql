@@ -0,0 +1,9 @@
+DROP INDEX idx_email_verifications_user_id_createdat;
+DROP INDEX idx_email_verifications_token_hash;
+
+DROP TABLE IF EXISTS email_verifications;
+
+DROP INDEX idx_users_email;
+
+ALTER TABLE users DROP COLUMN emailVerifiedAt;
+ALTER TABLE users DROP COLUMN email;
@@ -0,0 +1,23 @@
+-- the emails are stored normalized, so the unique index takes the ones differing in case as the same,
+-- the users without an email keep NULL there, the NULLs don't collide;
+-- a deleted user gives its email up, restoring it fails while another user has the email
+ALTER TABLE users ADD COLUMN email varchar(254);
+ALTER TABLE users ADD COLUMN emailVerifiedAt TIMESTAMP;
+
+CREATE UNIQUE INDEX idx_users_email ON users (email) WHERE deletedAt IS NULL;
+
+-- the tokens mailed to verify the emails, only their hashes are kept
+CREATE TABLE IF NOT EXISTS email_verifications (
+    id TEXT PRIMARY KEY NOT NULL,
+    user_id TEXT REFERENCES users (id) NOT NULL,
+    -- the email the token is sent to, the user might change it meanwhile
+    email varchar(254) NOT NULL,
+    token_hash TEXT NOT NULL,
+
+    createdAt TIMESTAMP NOT NULL,
+    expiresAt TIMESTAMP NOT NULL
+);
+
+CREATE UNIQUE INDEX idx_email_verifications_token_hash ON email_verifications (token_hash);
+-- the resends are rate limited by the recent verifications of the user
+CREATE INDEX idx_email_verifications_user_id_createdat ON email_verifications (user_id, createdAt);
@@ -0,0 +1,3 @@
+DROP INDEX idx_password_resets_token_hash;
+
+DROP TABLE IF EXISTS password_resets;
@@ -0,0 +1,13 @@
+-- the tokens mailed to set a new password, a user has one at most and only its hash is kept
+CREATE TABLE IF NOT EXISTS password_resets (
+    id TEXT PRIMARY KEY NOT NULL,
+    user_id TEXT UNIQUE REFERENCES users (id) NOT NULL,
+    -- the login the reset is asked for, the credentials might change meanwhile
+    login varchar(55) NOT NULL,
+    token_hash TEXT NOT NULL,
+
+    createdAt TIMESTAMP NOT NULL,
+    expiresAt TIMESTAMP NOT NULL
+);
+
+CREATE UNIQUE INDEX idx_password_resets_token_hash ON password_resets (token_hash);
@@ -0,0 +1,201 @@
+// Package breaker is a circuit breaker, it stops calling a dependency that keeps failing
+// and lets a few probe calls through once in a while to find out it's back.
+package breaker
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrOpen is returned instead of calling the dependency while the breaker is open.
+var ErrOpen = errors.New("circuit breaker is open")
+
+type State int
+
+const (
+	// Closed lets every call through and counts the consecutive failures.
+	Closed State = iota
+	// Open rejects every call until the open timeout passes.
+	Open
+	// HalfOpen lets a limited amount of probe calls through,
+	// they close the breaker on success and open it again on a failure.
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// Breaker is safe for concurrent use.
+type Breaker struct {
+	mu    sync.Mutex
+	state State
+	// gen changes on every state change, the result of a call started in another state is ignored
+	gen      uint64
+	failures int
+	openedAt time.Time
+	// the probes in flight and the succeeded ones in the half-open state
+	probes    int
+	successes int
+
+	threshold   int
+	openTimeout time.Duration
+	maxProbes   int
+	isFailure   func(err error) bool
+	now         func() time.Time
+	onChange    func(from, to State)
+}
+
+type Option func(*Breaker)
+
+func WithClock(now func() time.Time) Option {
+	return func(b *Breaker) {
+		b.now = now
+	}
+}
+
+// WithHalfOpenProbes sets how many probe calls run at once in the half-open state,
+// all of them must succeed to close the breaker. It's 1 by default.
+func WithHalfOpenProbes(n int) Option {
+	return func(b *Breaker) {
+		b.maxProbes = n
+	}
+}
+
+// WithFailure decides which errors count as failures, e.g. a not found user means the database is fine.
+// Every error is a failure by default.
+func WithFailure(isFailure func(err error) bool) Option {
+	return func(b *Breaker) {
+		b.isFailure = isFailure
+	}
+}
+
+// WithStateChange is called on every state change, it's called holding the lock, so it must not use the breaker.
+func WithStateChange(onChange func(from, to State)) Option {
+	return func(b *Breaker) {
+		b.onChange = onChange
+	}
+}
+
+// New creates the breaker opening after threshold consecutive failures,
+// it stays open for openTimeout before letting the probes through.
+func New(threshold int, openTimeout time.Duration, opts ...Option) *Breaker {
+	b := &Breaker{
+		threshold:   threshold,
+		openTimeout: openTimeout,
+		maxProbes:   1,
+		isFailure:   func(err error) bool { return err != nil },
+		now:         time.Now,
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	return b
+}
+
+// Do calls fn unless the breaker is open and records the result, ErrOpen is returned without calling fn.
+func (b *Breaker) Do(fn func() error) error {
+	gen, err := b.allow()
+	if err != nil {
+		return err
+	}
+
+	err = fn()
+	b.record(gen, err)
+	return err
+}
+
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state
+}
+
+// Remaining tells how long the breaker stays open, it's 0 when it lets the calls through.
+func (b *Breaker) Remaining() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != Open {
+		return 0
+	}
+	return max(b.openTimeout-b.now().Sub(b.openedAt), 0)
+}
+
+func (b *Breaker) allow() (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == Open {
+		if b.now().Sub(b.openedAt) < b.openTimeout {
+			return 0, ErrOpen
+		}
+		b.setState(HalfOpen)
+	}
+	if b.state == HalfOpen {
+		if b.probes >= b.maxProbes {
+			return 0, ErrOpen
+		}
+		b.probes++
+	}
+
+	return b.gen, nil
+}
+
+func (b *Breaker) record(gen uint64, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if gen != b.gen {
+		return
+	}
+	failed := err != nil && b.isFailure(err)
+
+	switch b.state {
+	case Closed:
+		if !failed {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.failures >= b.threshold {
+			b.setState(Open)
+		}
+	case HalfOpen:
+		if failed {
+			b.setState(Open)
+			return
+		}
+		b.successes++
+		if b.successes >= b.maxProbes {
+			b.setState(Closed)
+		}
+	}
+}
+
+func (b *Breaker) setState(to State) {
+	from := b.state
+	b.state = to
+	b.gen++
+	b.failures = 0
+	b.probes = 0
+	b.successes = 0
+	if to == Open {
+		b.openedAt = b.now()
+	}
+	if b.onChange != nil {
+		b.onChange(from, to)
+	}
+}
@@ -0,0 +1,97 @@
+package breaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errDown = errors.New("down")
+
+func TestBreaker(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var changes []string
+	b := New(3, time.Minute,
+		WithClock(func() time.Time { return now }),
+		WithStateChange(func(from, to State) { changes = append(changes, from.String()+"->"+to.String()) }),
+	)
+	fail := func() error { return errDown }
+	ok := func() error { return nil }
+
+	// a success resets the consecutive failures
+	assert.ErrorIs(t, b.Do(fail), errDown)
+	assert.ErrorIs(t, b.Do(fail), errDown)
+	assert.NoError(t, b.Do(ok))
+	assert.ErrorIs(t, b.Do(fail), errDown)
+	assert.ErrorIs(t, b.Do(fail), errDown)
+	assert.Equal(t, Closed, b.State())
+
+	assert.ErrorIs(t, b.Do(fail), errDown)
+	assert.Equal(t, Open, b.State())
+
+	called := false
+	err := b.Do(func() error {
+		called = true
+		return nil
+	})
+	assert.ErrorIs(t, err, ErrOpen)
+	assert.False(t, called)
+
+	// a failed probe opens it again for another timeout
+	now = now.Add(time.Minute)
+	assert.ErrorIs(t, b.Do(fail), errDown)
+	assert.Equal(t, Open, b.State())
+	now = now.Add(30 * time.Second)
+	assert.ErrorIs(t, b.Do(ok), ErrOpen)
+	assert.Equal(t, 30*time.Second, b.Remaining())
+
+	now = now.Add(30 * time.Second)
+	assert.NoError(t, b.Do(ok))
+	assert.Equal(t, Closed, b.State())
+
+	assert.Equal(t, []string{"closed->open", "open->half-open", "half-open->open", "open->half-open", "half-open->closed"}, changes)
+}
+
+func TestBreakerHalfOpenProbes(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := New(1, time.Minute, WithClock(func() time.Time { return now }), WithHalfOpenProbes(2))
+	assert.ErrorIs(t, b.Do(func() error { return errDown }), errDown)
+	now = now.Add(time.Minute)
+
+	// the probes are in flight, the other calls are rejected
+	release := make(chan struct{})
+	results := make(chan error, 2)
+	for range 2 {
+		go func() {
+			results <- b.Do(func() error {
+				<-release
+				return nil
+			})
+		}()
+	}
+	assert.Eventually(t, func() bool {
+		return b.Do(func() error { return nil }) == ErrOpen && b.probesInFlight() == 2
+	}, time.Second, time.Millisecond)
+
+	close(release)
+	assert.NoError(t, <-results)
+	assert.NoError(t, <-results)
+	assert.Equal(t, Closed, b.State())
+}
+
+func TestBreakerIgnoresNonFailures(t *testing.T) {
+	errNotFound := errors.New("not found")
+	b := New(1, time.Minute, WithFailure(func(err error) bool { return !errors.Is(err, errNotFound) }))
+
+	assert.ErrorIs(t, b.Do(func() error { return errNotFound }), errNotFound)
+	assert.Equal(t, Closed, b.State())
+}
+
+func (b *Breaker) probesInFlight() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.probes
+}
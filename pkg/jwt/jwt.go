@@ -0,0 +1,154 @@
+// Package jwt signs and verifies the compact JSON web tokens, https://www.rfc-editor.org/rfc/rfc7519.
+// Only the registered claims the service needs and the EdDSA signatures are supported.
+package jwt
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// alg is the only algorithm the tokens are signed and verified with, https://www.rfc-editor.org/rfc/rfc8037.
+const alg = "EdDSA"
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrExpired      = errors.New("token expired")
+)
+
+type Claims struct {
+	Issuer  string `json:"iss,omitempty"`
+	Subject string `json:"sub"`
+	// Type tells the token kinds apart, so one can't be used as another
+	Type      string `json:"typ"`
+	ID        string `json:"jti,omitempty"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+
+	Roles []string `json:"roles,omitempty"`
+	// Scope is space separated, https://www.rfc-editor.org/rfc/rfc8693#section-4.2
+	Scope  string `json:"scope,omitempty"`
+	Tenant string `json:"tenant,omitempty"`
+	// SessionID is the sign in the token is issued within
+	SessionID string `json:"sid,omitempty"`
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+	Kid string `json:"kid"`
+}
+
+// KeySet signs the tokens with one key and verifies them with any key of the set,
+// so the tokens signed with the previous key stay valid while the keys are rotated and until the key retires.
+type KeySet struct {
+	signing Key
+	// by the key id, the signing key included
+	keys map[string]Key
+	// ids keeps the order the keys are published in
+	ids []string
+	now func() time.Time
+}
+
+// NewKeySet creates the set signing with the given private key and accepting the verification keys as well.
+func NewKeySet(signing Key, verification []Key, now func() time.Time) (*KeySet, error) {
+	if signing.Private == nil {
+		return nil, fmt.Errorf("NewKeySet: signing key %q has no private part", signing.ID)
+	}
+	if !signing.NotAfter.IsZero() {
+		return nil, fmt.Errorf("NewKeySet: signing key %q can't retire", signing.ID)
+	}
+
+	s := &KeySet{
+		signing: signing,
+		keys:    make(map[string]Key, len(verification)+1),
+		now:     now,
+	}
+	for _, k := range append([]Key{signing}, verification...) {
+		if k.ID == "" {
+			return nil, errors.New("NewKeySet: key id is empty")
+		}
+		if _, ok := s.keys[k.ID]; ok {
+			return nil, fmt.Errorf("NewKeySet: duplicate key id %q", k.ID)
+		}
+		s.keys[k.ID] = k
+		s.ids = append(s.ids, k.ID)
+	}
+
+	return s, nil
+}
+
+func (s *KeySet) Sign(c Claims) (string, error) {
+	h, err := json.Marshal(header{Alg: alg, Typ: "JWT", Kid: s.signing.ID})
+	if err != nil {
+		return "", fmt.Errorf("Sign: failed to marshal header: %w", err)
+	}
+	payload, err := json.Marshal(c)
+	if err != nil {
+		return "", fmt.Errorf("Sign: failed to marshal claims: %w", err)
+	}
+
+	signingInput := encode(h) + "." + encode(payload)
+	return signingInput + "." + encode(ed25519.Sign(s.signing.Private, []byte(signingInput))), nil
+}
+
+// Verify checks the signature with the key the token names and the expiration,
+// the token type is checked by the caller.
+func (s *KeySet) Verify(token string) (Claims, error) {
+	var c Claims
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return c, ErrInvalidToken
+	}
+
+	var h header
+	if err := decodeJSON(parts[0], &h); err != nil {
+		return c, err
+	}
+	// the algorithm is fixed, the header must not choose it, e.g. "none"
+	if h.Alg != alg {
+		return c, fmt.Errorf("%w: unexpected algorithm %q", ErrInvalidToken, h.Alg)
+	}
+	k, ok := s.keys[h.Kid]
+	if !ok {
+		return c, fmt.Errorf("%w: unknown key %q", ErrInvalidToken, h.Kid)
+	}
+	if k.retired(s.now()) {
+		return c, fmt.Errorf("%w: key %q is retired", ErrInvalidToken, h.Kid)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return c, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	if !ed25519.Verify(k.Public, []byte(parts[0]+"."+parts[1]), sig) {
+		return c, fmt.Errorf("%w: signature mismatch", ErrInvalidToken)
+	}
+
+	if err := decodeJSON(parts[1], &c); err != nil {
+		return c, err
+	}
+	if !s.now().Before(time.Unix(c.ExpiresAt, 0)) {
+		return c, ErrExpired
+	}
+
+	return c, nil
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeJSON(part string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package jwt
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newKeySet(t *testing.T, now func() time.Time, signing Key, verification ...Key) *KeySet {
+	t.Helper()
+
+	s, err := NewKeySet(signing, verification, now)
+	require.NoError(t, err)
+	return s
+}
+
+func generateKey(t *testing.T, id string) Key {
+	t.Helper()
+
+	k, err := GenerateKey(id)
+	require.NoError(t, err)
+	return k
+}
+
+func TestKeySet(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	s := newKeySet(t, clock, generateKey(t, "1"))
+	claims := Claims{Subject: "1", Type: "access", IssuedAt: now.Unix(), ExpiresAt: now.Add(time.Minute).Unix()}
+
+	token, err := s.Sign(claims)
+	require.NoError(t, err)
+	got, err := s.Verify(token)
+	require.NoError(t, err)
+	assert.Equal(t, claims, got)
+
+	// another key with the same id
+	_, err = newKeySet(t, clock, generateKey(t, "1")).Verify(token)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	// the payload can't be changed
+	parts := strings.Split(token, ".")
+	forged, err := s.Sign(Claims{Subject: "2", Type: "access", ExpiresAt: claims.ExpiresAt})
+	require.NoError(t, err)
+	_, err = s.Verify(parts[0] + "." + strings.Split(forged, ".")[1] + "." + parts[2])
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	now = now.Add(time.Minute)
+	_, err = s.Verify(token)
+	assert.ErrorIs(t, err, ErrExpired)
+}
+
+func TestKeySetRotation(t *testing.T) {
+	old, next := generateKey(t, "old"), generateKey(t, "next")
+	claims := Claims{Subject: "1", Type: "access", ExpiresAt: time.Now().Add(time.Minute).Unix()}
+
+	signedWithOld, err := newKeySet(t, time.Now, old).Sign(claims)
+	require.NoError(t, err)
+
+	// the new key is published first, the replicas accept it before any of them signs with it
+	s := newKeySet(t, time.Now, old, next)
+	_, err = s.Verify(signedWithOld)
+	assert.NoError(t, err)
+
+	// then it signs and the old one is still accepted until the tokens signed with it expire
+	s = newKeySet(t, time.Now, next, Key{ID: old.ID, Public: old.Public})
+	_, err = s.Verify(signedWithOld)
+	assert.NoError(t, err)
+	signedWithNext, err := s.Sign(claims)
+	require.NoError(t, err)
+	_, err = s.Verify(signedWithNext)
+	assert.NoError(t, err)
+
+	// and the old key goes away
+	_, err = newKeySet(t, time.Now, next).Verify(signedWithOld)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	kids := []string{}
+	for _, k := range s.JWKS().Keys {
+		assert.Equal(t, "OKP", k.Kty)
+		assert.Equal(t, "EdDSA", k.Alg)
+		kids = append(kids, k.Kid)
+	}
+	assert.Equal(t, []string{"next", "old"}, kids)
+}
+
+func TestKeySetRetire(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	old, next := generateKey(t, "old"), generateKey(t, "next")
+	claims := Claims{Subject: "1", Type: "access", ExpiresAt: now.Add(time.Hour).Unix()}
+	signedWithOld, err := newKeySet(t, clock, old).Sign(claims)
+	require.NoError(t, err)
+
+	// the old key retires on its own, nobody has to edit the config once its tokens expire
+	s := newKeySet(t, clock, next, Key{ID: old.ID, Public: old.Public, NotAfter: now.Add(time.Minute)})
+	_, err = s.Verify(signedWithOld)
+	assert.NoError(t, err)
+	assert.Len(t, s.JWKS().Keys, 2)
+
+	now = now.Add(time.Minute)
+	_, err = s.Verify(signedWithOld)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	require.Len(t, s.JWKS().Keys, 1)
+	assert.Equal(t, "next", s.JWKS().Keys[0].Kid)
+
+	next.NotAfter = now
+	_, err = NewKeySet(next, nil, clock)
+	assert.Error(t, err, "the signing key can't retire")
+}
+
+func TestNewKeySet(t *testing.T) {
+	k := generateKey(t, "1")
+
+	_, err := NewKeySet(Key{ID: "1", Public: k.Public}, nil, time.Now)
+	assert.Error(t, err, "the signing key must be private")
+	_, err = NewKeySet(k, []Key{{ID: "1", Public: k.Public}}, time.Now)
+	assert.Error(t, err, "the ids must be unique")
+}
+
+func TestVerifyRejectsOtherAlgorithms(t *testing.T) {
+	s := newKeySet(t, time.Now, generateKey(t, "1"))
+
+	for _, token := range []string{
+		"",
+		"a.b",
+		// {"alg":"none","typ":"JWT","kid":"1"}.{"sub":"1","typ":"access","exp":9999999999}.
+		"eyJhbGciOiJub25lIiwidHlwIjoiSldUIiwia2lkIjoiMSJ9.eyJzdWIiOiIxIiwidHlwIjoiYWNjZXNzIiwiZXhwIjo5OTk5OTk5OTk5fQ.",
+		// {"alg":"HS256","typ":"JWT","kid":"1"}.{"sub":"1","typ":"access","exp":9999999999}.
+		"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCIsImtpZCI6IjEifQ.eyJzdWIiOiIxIiwidHlwIjoiYWNjZXNzIiwiZXhwIjo5OTk5OTk5OTk5fQ.c2ln",
+	} {
+		_, err := s.Verify(token)
+		assert.ErrorIs(t, err, ErrInvalidToken, token)
+	}
+}
+
+func TestLoadKey(t *testing.T) {
+	dir := t.TempDir()
+	k := generateKey(t, "")
+	private, err := x509.MarshalPKCS8PrivateKey(k.Private)
+	require.NoError(t, err)
+	public, err := x509.MarshalPKIXPublicKey(k.Public)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "2024-06.pem"), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: private}), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "2024-01.pem"), pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: public}), 0o600))
+
+	got, err := LoadKey(filepath.Join(dir, "2024-06.pem"))
+	require.NoError(t, err)
+	assert.Equal(t, Key{ID: "2024-06", Private: k.Private, Public: k.Public}, got)
+
+	got, err = LoadKey(filepath.Join(dir, "2024-01.pem"))
+	require.NoError(t, err)
+	assert.Equal(t, Key{ID: "2024-01", Public: k.Public}, got)
+
+	_, err = LoadKey(filepath.Join(dir, "missing.pem"))
+	assert.Error(t, err)
+}
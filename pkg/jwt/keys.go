@@ -0,0 +1,114 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Key is an Ed25519 key, Private is nil when the key only verifies the tokens.
+type Key struct {
+	// ID goes to the kid header of the tokens, so the verifier knows which key to take
+	ID      string
+	Private ed25519.PrivateKey
+	Public  ed25519.PublicKey
+	// NotAfter retires a verification key, the tokens it has signed are refused from then on and it's no longer published.
+	// The zero time keeps the key.
+	NotAfter time.Time
+}
+
+// retired reports whether the key no longer verifies the tokens at the moment.
+func (k Key) retired(now time.Time) bool {
+	return !k.NotAfter.IsZero() && !now.Before(k.NotAfter)
+}
+
+// GenerateKey creates a random key, it's meant for the local runs and the tests.
+func GenerateKey(id string) (Key, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return Key{}, fmt.Errorf("GenerateKey: %w", err)
+	}
+
+	return Key{ID: id, Private: private, Public: public}, nil
+}
+
+// LoadKey reads a PEM file with a PKCS #8 private key or a PKIX public key,
+// e.g. made with `openssl genpkey -algorithm ed25519`. The file name without the extension is the key id.
+func LoadKey(path string) (Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Key{}, fmt.Errorf("LoadKey: %w", err)
+	}
+	id := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return Key{}, fmt.Errorf("LoadKey: %s has no PEM block", path)
+	}
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return Key{}, fmt.Errorf("LoadKey: failed to parse %s: %w", path, err)
+		}
+		private, ok := parsed.(ed25519.PrivateKey)
+		if !ok {
+			return Key{}, fmt.Errorf("LoadKey: %s is %T, not an Ed25519 key", path, parsed)
+		}
+		return Key{ID: id, Private: private, Public: private.Public().(ed25519.PublicKey)}, nil
+	case "PUBLIC KEY":
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return Key{}, fmt.Errorf("LoadKey: failed to parse %s: %w", path, err)
+		}
+		public, ok := parsed.(ed25519.PublicKey)
+		if !ok {
+			return Key{}, fmt.Errorf("LoadKey: %s is %T, not an Ed25519 key", path, parsed)
+		}
+		return Key{ID: id, Public: public}, nil
+	default:
+		return Key{}, fmt.Errorf("LoadKey: unexpected PEM block %q in %s", block.Type, path)
+	}
+}
+
+// JWK is the public part of a key, https://www.rfc-editor.org/rfc/rfc8037#section-2.
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+}
+
+// JWKS is the document the other services verify the tokens with, https://www.rfc-editor.org/rfc/rfc7517#section-5.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys of the set but the retired ones, the signing one goes first.
+func (s *KeySet) JWKS() JWKS {
+	res := JWKS{Keys: make([]JWK, 0, len(s.ids))}
+	now := s.now()
+	for _, id := range s.ids {
+		if s.keys[id].retired(now) {
+			continue
+		}
+		res.Keys = append(res.Keys, JWK{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   encode(s.keys[id].Public),
+			Kid: id,
+			Alg: alg,
+			Use: "sig",
+		})
+	}
+
+	return res
+}
@@ -40,7 +40,7 @@ func LoggerFromContext(ctx context.Context) *slog.Logger {
 	v := ctx.Value(logContextKey{})
 	l, ok := v.(*slog.Logger)
 	if !ok {
-		l := NewLogger(DefaultLogWriter, slog.LevelInfo)
+		l = NewLogger(DefaultLogWriter, slog.LevelInfo)
 		l.Info("no logger found in context")
 	}
 	return l
@@ -67,11 +67,40 @@ func NewLogger(w io.Writer, level slog.Level) *slog.Logger {
 	return slog.New(logHandler)
 }
 
-func NewLoggingMiddleware(l *slog.Logger) func(http.Handler) http.Handler {
+type MiddlewareOption func(*middlewareOptions)
+
+type middlewareOptions struct {
+	now        func() time.Time
+	newTraceID func() string
+}
+
+// WithClock replaces time.Now used to measure the request duration.
+func WithClock(now func() time.Time) MiddlewareOption {
+	return func(o *middlewareOptions) {
+		o.now = now
+	}
+}
+
+// WithTraceIDGenerator replaces uuid v4 trace ids.
+func WithTraceIDGenerator(newTraceID func() string) MiddlewareOption {
+	return func(o *middlewareOptions) {
+		o.newTraceID = newTraceID
+	}
+}
+
+func NewLoggingMiddleware(l *slog.Logger, opts ...MiddlewareOption) func(http.Handler) http.Handler {
+	o := &middlewareOptions{
+		now:        time.Now,
+		newTraceID: uuid.NewString,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// all the magic of opentelemetry could be here
-			traceID := uuid.NewString()
+			traceID := o.newTraceID()
 			logger := l.With("service", "userService", "traceID", traceID)
 
 			resp := &response{w, http.StatusOK, nil}
@@ -91,7 +120,7 @@ func NewLoggingMiddleware(l *slog.Logger) func(http.Handler) http.Handler {
 				}
 			}()
 
-			start := time.Now()
+			start := o.now()
 			logger.DebugContext(
 				r.Context(), "request received",
 				"uri", r.RequestURI,
@@ -102,7 +131,7 @@ func NewLoggingMiddleware(l *slog.Logger) func(http.Handler) http.Handler {
 			r = r.WithContext(ctxWithLogger)
 			next.ServeHTTP(resp, r)
 
-			end := time.Now()
+			end := o.now()
 			duration := end.Sub(start)
 			// soon we can log the url pattern and easy to match it to our observability toolings
 			// https://github.com/golang/go/issues/66405
@@ -0,0 +1,135 @@
+// Package lru is a size bounded cache evicting the least recently used entries,
+// the entries expire after the TTL.
+package lru
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+type entry[K comparable, V any] struct {
+	key     K
+	value   V
+	expires time.Time
+}
+
+// Cache is safe for concurrent use.
+type Cache[K comparable, V any] struct {
+	mu    sync.Mutex
+	items map[K]*list.Element
+	// the front is the most recently used
+	order *list.List
+
+	size    int
+	ttl     time.Duration
+	now     func() time.Time
+	onEvict func(key K)
+}
+
+type Option[K comparable, V any] func(*Cache[K, V])
+
+func WithClock[K comparable, V any](now func() time.Time) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		c.now = now
+	}
+}
+
+// WithEvictCallback is called when an entry is dropped to make room for a new one,
+// it's called holding the lock, so it must not use the cache.
+func WithEvictCallback[K comparable, V any](onEvict func(key K)) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		c.onEvict = onEvict
+	}
+}
+
+// New creates the cache keeping up to size entries, ttl 0 means the entries don't expire.
+func New[K comparable, V any](size int, ttl time.Duration, opts ...Option[K, V]) *Cache[K, V] {
+	c := &Cache[K, V]{
+		items: make(map[K]*list.Element, size),
+		order: list.New(),
+		size:  size,
+		ttl:   ttl,
+		now:   time.Now,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// Get returns the value if it's there and not expired.
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var zero V
+	el, ok := c.items[key]
+	if !ok {
+		return zero, false
+	}
+	e := el.Value.(*entry[K, V])
+	if c.ttl > 0 && !c.now().Before(e.expires) {
+		c.remove(el)
+		return zero, false
+	}
+	c.order.MoveToFront(el)
+
+	return e.value, true
+}
+
+// Set adds or replaces the value evicting the least recently used entry if the cache is full.
+func (c *Cache[K, V]) Set(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expires := c.now().Add(c.ttl)
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*entry[K, V])
+		e.value = value
+		e.expires = expires
+		c.order.MoveToFront(el)
+		return
+	}
+
+	if c.order.Len() >= c.size {
+		if oldest := c.order.Back(); oldest != nil {
+			c.remove(oldest)
+			if c.onEvict != nil {
+				c.onEvict(oldest.Value.(*entry[K, V]).key)
+			}
+		}
+	}
+	c.items[key] = c.order.PushFront(&entry[K, V]{key: key, value: value, expires: expires})
+}
+
+func (c *Cache[K, V]) Delete(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+}
+
+// Purge drops all the entries.
+func (c *Cache[K, V]) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.items = make(map[K]*list.Element, c.size)
+	c.order.Init()
+}
+
+func (c *Cache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
+
+func (c *Cache[K, V]) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.items, el.Value.(*entry[K, V]).key)
+}
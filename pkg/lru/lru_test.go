@@ -0,0 +1,52 @@
+package lru
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var evicted []string
+	c := New(2, time.Minute,
+		WithClock[string, int](func() time.Time { return now }),
+		WithEvictCallback[string, int](func(key string) { evicted = append(evicted, key) }),
+	)
+
+	c.Set("a", 1)
+	c.Set("b", 2)
+	v, ok := c.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, v)
+
+	// b is the least recently used
+	c.Set("c", 3)
+	_, ok = c.Get("b")
+	assert.False(t, ok)
+	assert.Equal(t, []string{"b"}, evicted)
+	assert.Equal(t, 2, c.Len())
+
+	// replacing doesn't evict
+	c.Set("a", 10)
+	v, _ = c.Get("a")
+	assert.Equal(t, 10, v)
+	assert.Equal(t, []string{"b"}, evicted)
+
+	c.Delete("a")
+	_, ok = c.Get("a")
+	assert.False(t, ok)
+
+	// expiration
+	now = now.Add(time.Minute)
+	_, ok = c.Get("c")
+	assert.False(t, ok)
+	assert.Equal(t, 0, c.Len())
+
+	c.Set("d", 4)
+	c.Purge()
+	assert.Equal(t, 0, c.Len())
+	// expired and purged entries aren't evictions
+	assert.Equal(t, []string{"b"}, evicted)
+}
@@ -0,0 +1,110 @@
+// Package mail sends the plain text emails of the service, e.g. the verification tokens.
+// The SMTP mailer is meant for production, the file and the log ones for the local runs and tests.
+package mail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var ErrInvalidMessage = errors.New("invalid mail message")
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers the messages, the sender is configured with the mailer.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// compose renders the message in the internet message format, https://www.rfc-editor.org/rfc/rfc5322.
+// The header values are refused with the line breaks, so a recipient can't inject the headers.
+func compose(from string, msg Message, date time.Time) ([]byte, error) {
+	for _, v := range []string{from, msg.To, msg.Subject} {
+		if strings.ContainsAny(v, "\r\n") {
+			return nil, fmt.Errorf("%w: line break in the header %q", ErrInvalidMessage, v)
+		}
+	}
+	if msg.To == "" {
+		return nil, fmt.Errorf("%w: no recipient", ErrInvalidMessage)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	b.WriteString("\r\n")
+	body := strings.ReplaceAll(msg.Body, "\r\n", "\n")
+	b.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	b.WriteString("\r\n")
+	return []byte(b.String()), nil
+}
+
+// File writes every message to a file of its own in the directory, e.g. 1700000000000000000-1.eml.
+type File struct {
+	dir  string
+	from string
+	now  func() time.Time
+	seq  atomic.Uint64
+}
+
+func NewFile(dir, from string, now func() time.Time) *File {
+	return &File{
+		dir:  dir,
+		from: from,
+		now:  now,
+	}
+}
+
+func (f *File) Send(ctx context.Context, msg Message) error {
+	now := f.now()
+	b, err := compose(f.from, msg, now)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(f.dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create mail directory: %w", err)
+	}
+	// the sequence keeps the names of the messages sent within the same clock tick apart
+	name := filepath.Join(f.dir, fmt.Sprintf("%d-%d.eml", now.UnixNano(), f.seq.Add(1)))
+	// the messages carry the tokens, only the owner reads them
+	if err := os.WriteFile(name, b, 0o600); err != nil {
+		return fmt.Errorf("failed to write mail: %w", err)
+	}
+	return nil
+}
+
+// Log writes the messages to the logger instead of sending them,
+// the bodies carry the tokens, so it must not be used beyond the local runs.
+type Log struct {
+	log *slog.Logger
+}
+
+func NewLog(l *slog.Logger) *Log {
+	return &Log{
+		log: l,
+	}
+}
+
+func (l *Log) Send(ctx context.Context, msg Message) error {
+	if _, err := compose("", msg, time.Time{}); err != nil {
+		return err
+	}
+	l.log.InfoContext(ctx, "mail is not sent, it's logged", "to", msg.To, "subject", msg.Subject, "body", msg.Body)
+	return nil
+}
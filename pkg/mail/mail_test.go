@@ -0,0 +1,115 @@
+package mail
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testDate = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestCompose(t *testing.T) {
+	b, err := compose("no-reply@example.com", Message{To: "alice@example.com", Subject: "Grüße", Body: "line 1\nline 2"}, testDate)
+	require.NoError(t, err)
+
+	msg := string(b)
+	assert.Contains(t, msg, "From: no-reply@example.com\r\n")
+	assert.Contains(t, msg, "To: alice@example.com\r\n")
+	assert.Contains(t, msg, "Subject: =?utf-8?q?Gr=C3=BC=C3=9Fe?=\r\n")
+	assert.Contains(t, msg, "Date: Mon, 01 Jan 2024 00:00:00 +0000\r\n")
+	assert.True(t, strings.HasSuffix(msg, "\r\n\r\nline 1\r\nline 2\r\n"))
+
+	_, err = compose("no-reply@example.com", Message{To: "alice@example.com\r\nBcc: eve@example.com", Subject: "hi"}, testDate)
+	assert.ErrorIs(t, err, ErrInvalidMessage)
+	_, err = compose("no-reply@example.com", Message{Subject: "hi"}, testDate)
+	assert.ErrorIs(t, err, ErrInvalidMessage)
+}
+
+func TestFile(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	f := NewFile(dir, "no-reply@example.com", func() time.Time { return testDate })
+
+	require.NoError(t, f.Send(context.Background(), Message{To: "alice@example.com", Subject: "one", Body: "first"}))
+	require.NoError(t, f.Send(context.Background(), Message{To: "bob@example.com", Subject: "two", Body: "second"}))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	b, err := os.ReadFile(filepath.Join(dir, entries[0].Name()))
+	require.NoError(t, err)
+	assert.Contains(t, string(b), "To: alice@example.com\r\n")
+	assert.True(t, strings.HasSuffix(string(b), "first\r\n"))
+}
+
+func TestSMTP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	received := make(chan []string, 1)
+	go serveSMTP(t, l, received)
+
+	s, err := NewSMTP(l.Addr().String(), "", "", "no-reply@example.com", func() time.Time { return testDate })
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, s.Send(ctx, Message{To: "alice@example.com", Subject: "hi", Body: "token"}))
+
+	lines := <-received
+	assert.Contains(t, lines, "MAIL FROM:<no-reply@example.com> BODY=8BITMIME")
+	assert.Contains(t, lines, "RCPT TO:<alice@example.com>")
+	assert.Contains(t, lines, "token")
+}
+
+// serveSMTP accepts a single message and sends the lines the client has written.
+func serveSMTP(t *testing.T, l net.Listener, received chan<- []string) {
+	conn, err := l.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	var lines []string
+	r := bufio.NewReader(conn)
+	reply := func(s string) {
+		_, err := conn.Write([]byte(s + "\r\n"))
+		assert.NoError(t, err)
+	}
+	reply("220 localhost ESMTP")
+	data := false
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			received <- lines
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		lines = append(lines, line)
+		switch {
+		case data && line == ".":
+			data = false
+			reply("250 OK")
+		case data:
+		case strings.HasPrefix(line, "EHLO"):
+			reply("250-localhost")
+			reply("250 8BITMIME")
+		case line == "DATA":
+			data = true
+			reply("354 go ahead")
+		case line == "QUIT":
+			reply("221 bye")
+			received <- lines
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package password
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// the tests don't need the production cost
+var testParams = Params{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func TestHasher(t *testing.T) {
+	h, err := NewHasher(testParams)
+	require.NoError(t, err)
+
+	hash, err := h.Hash("correct horse battery staple")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$"), hash)
+
+	ok, err := h.Verify(hash, "correct horse battery staple")
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = h.Verify(hash, "correct horse battery stapler")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// the salt is random
+	other, err := h.Hash("correct horse battery staple")
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, other)
+}
+
+func TestVerifyKeepsHashParams(t *testing.T) {
+	old, err := NewHasher(testParams)
+	require.NoError(t, err)
+	hash, err := old.Hash("correct horse battery staple")
+	require.NoError(t, err)
+
+	params := testParams
+	params.Iterations = 2
+	h, err := NewHasher(params)
+	require.NoError(t, err)
+
+	ok, err := h.Verify(hash, "correct horse battery staple")
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestVerifyInvalidHash(t *testing.T) {
+	h, err := NewHasher(testParams)
+	require.NoError(t, err)
+
+	for _, hash := range []string{
+		"",
+		"plain text",
+		"$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy",
+		"$argon2id$v=18$m=1024,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=1024,t=1,p=1$!$a2V5",
+	} {
+		_, err := h.Verify(hash, "password")
+		assert.ErrorIs(t, err, ErrInvalidHash, hash)
+	}
+}
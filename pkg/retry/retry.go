@@ -0,0 +1,82 @@
+package retry
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// Policy describes how an operation is retried.
+// Delay grows exponentially from InitialDelay up to MaxDelay,
+// every delay is randomly shortened by up to Jitter (0..1) fraction
+// to avoid a thundering herd of replicas retrying at the same moment.
+type Policy struct {
+	// Attempts is the total amount of calls, 0 means retry until the context is done.
+	Attempts     int
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+	Multiplier   float64
+	Jitter       float64
+
+	// Retryable decides whether the error is worth another attempt, nil retries every error.
+	Retryable func(err error) bool
+}
+
+func (p Policy) delay(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+
+	d := float64(p.InitialDelay) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxDelay > 0 && d > float64(p.MaxDelay) {
+		d = float64(p.MaxDelay)
+	}
+	if p.Jitter > 0 {
+		d -= d * p.Jitter * rand.Float64()
+	}
+
+	return time.Duration(d)
+}
+
+// Do calls fn until it succeeds, the policy is exhausted or ctx is done.
+// Every failed attempt is logged with the given operation name.
+func Do(ctx context.Context, p Policy, l *slog.Logger, op string, fn func(ctx context.Context) error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn(ctx)
+		if err == nil {
+			if attempt > 1 {
+				l.InfoContext(ctx, "operation succeeded after retries", "op", op, "attempt", attempt)
+			}
+			return nil
+		}
+
+		if p.Retryable != nil && !p.Retryable(err) {
+			return err
+		}
+		if p.Attempts > 0 && attempt >= p.Attempts {
+			return fmt.Errorf("%s: gave up after %d attempts: %w", op, attempt, err)
+		}
+
+		delay := p.delay(attempt)
+		l.WarnContext(ctx, "operation failed, retrying",
+			"op", op,
+			"attempt", attempt,
+			"maxAttempts", p.Attempts,
+			"delay", delay.String(),
+			"err", err,
+		)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%s: %w after %d attempts: %w", op, ctx.Err(), attempt, err)
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDo(t *testing.T) {
+	t.Parallel()
+
+	errTemporary := errors.New("temporary")
+	errPermanent := errors.New("permanent")
+
+	type testCase struct {
+		name   string
+		policy Policy
+		// results returned by the operation one by one, the last one is repeated
+		results []error
+
+		expectedCalls int
+		expectedErr   error
+	}
+
+	for _, tt := range []testCase{
+		{
+			name:          "success on the first attempt",
+			policy:        Policy{Attempts: 3, InitialDelay: time.Millisecond},
+			results:       []error{nil},
+			expectedCalls: 1,
+		},
+		{
+			name:          "success after retries",
+			policy:        Policy{Attempts: 3, InitialDelay: time.Millisecond},
+			results:       []error{errTemporary, errTemporary, nil},
+			expectedCalls: 3,
+		},
+		{
+			name:          "attempts exhausted",
+			policy:        Policy{Attempts: 3, InitialDelay: time.Millisecond},
+			results:       []error{errTemporary},
+			expectedCalls: 3,
+			expectedErr:   errTemporary,
+		},
+		{
+			name: "not retryable error",
+			policy: Policy{Attempts: 3, InitialDelay: time.Millisecond, Retryable: func(err error) bool {
+				return !errors.Is(err, errPermanent)
+			}},
+			results:       []error{errTemporary, errPermanent},
+			expectedCalls: 2,
+			expectedErr:   errPermanent,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			l := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+			calls := 0
+			err := Do(context.Background(), tt.policy, l, "test", func(ctx context.Context) error {
+				res := tt.results[min(calls, len(tt.results)-1)]
+				calls++
+				return res
+			})
+
+			assert.Equal(t, tt.expectedCalls, calls)
+			if tt.expectedErr == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.expectedErr)
+			}
+		})
+	}
+}
+
+func TestDoDeadline(t *testing.T) {
+	t.Parallel()
+
+	l := slog.New(slog.NewTextHandler(io.Discard, nil))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	errTemporary := errors.New("temporary")
+	err := Do(ctx, Policy{InitialDelay: 10 * time.Millisecond, MaxDelay: 20 * time.Millisecond}, l, "test", func(ctx context.Context) error {
+		return errTemporary
+	})
+
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.ErrorIs(t, err, errTemporary)
+}
+
+func TestPolicyDelay(t *testing.T) {
+	t.Parallel()
+
+	p := Policy{InitialDelay: 100 * time.Millisecond, MaxDelay: time.Second, Multiplier: 2}
+	assert.Equal(t, 100*time.Millisecond, p.delay(1))
+	assert.Equal(t, 200*time.Millisecond, p.delay(2))
+	assert.Equal(t, 800*time.Millisecond, p.delay(4))
+	assert.Equal(t, time.Second, p.delay(5))
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		d := p.delay(5)
+		assert.GreaterOrEqual(t, d, 500*time.Millisecond)
+		assert.LessOrEqual(t, d, time.Second)
+	}
+}
@@ -0,0 +1,104 @@
+package rwsplit
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Pinger is a connection pool the health check pings.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+type replica[DB Pinger] struct {
+	db      DB
+	name    string
+	healthy atomic.Bool
+}
+
+// ReplicaSet spreads the reads over the healthy replicas round-robin.
+// A replica failing the health check is ejected until it passes again,
+// the reads go to the primary when no replica is healthy.
+type ReplicaSet[DB Pinger] struct {
+	primary  DB
+	replicas []*replica[DB]
+	next     atomic.Uint64
+	log      *slog.Logger
+}
+
+// NewReplicaSet creates the set with all the replicas ejected, see Check.
+// names identify the replicas in the logs, they must not contain the credentials.
+func NewReplicaSet[DB Pinger](primary DB, replicas []DB, names []string, l *slog.Logger) *ReplicaSet[DB] {
+	rs := &ReplicaSet[DB]{
+		primary: primary,
+		log:     l,
+	}
+	for i, db := range replicas {
+		rs.replicas = append(rs.replicas, &replica[DB]{db: db, name: names[i]})
+	}
+
+	return rs
+}
+
+// Reader returns the pool for a read, the primary is used when the context requires it
+// (see WithPrimary) or there is no healthy replica.
+func (rs *ReplicaSet[DB]) Reader(ctx context.Context) DB {
+	if PrimaryRequired(ctx) {
+		return rs.primary
+	}
+
+	n := uint64(len(rs.replicas))
+	start := rs.next.Add(1)
+	for i := uint64(0); i < n; i++ {
+		r := rs.replicas[(start+i)%n]
+		if r.healthy.Load() {
+			return r.db
+		}
+	}
+
+	return rs.primary
+}
+
+// Check pings every replica and ejects or restores it by the result.
+func (rs *ReplicaSet[DB]) Check(ctx context.Context, timeout time.Duration) {
+	var wg sync.WaitGroup
+	for _, r := range rs.replicas {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			err := r.db.Ping(ctx)
+
+			healthy := err == nil
+			if r.healthy.Swap(healthy) == healthy {
+				return
+			}
+			if healthy {
+				rs.log.InfoContext(ctx, "replica is healthy, restored", "replica", r.name)
+			} else {
+				rs.log.WarnContext(ctx, "replica is unhealthy, ejected", "replica", r.name, "err", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Run checks the replicas every interval until ctx is done.
+func (rs *ReplicaSet[DB]) Run(ctx context.Context, interval, timeout time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			rs.Check(ctx, timeout)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package rwsplit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeDB struct {
+	name string
+	down atomic.Bool
+}
+
+func (db *fakeDB) Ping(ctx context.Context) error {
+	if db.down.Load() {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func TestReplicaSet(t *testing.T) {
+	ctx := context.Background()
+	primary, replica1, replica2 := &fakeDB{name: "primary"}, &fakeDB{name: "replica1"}, &fakeDB{name: "replica2"}
+	rs := NewReplicaSet(primary, []*fakeDB{replica1, replica2}, []string{"replica1", "replica2"}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	readFrom := func(ctx context.Context) string {
+		return rs.Reader(ctx).name
+	}
+
+	// the replicas are ejected until the first check
+	assert.Equal(t, "primary", readFrom(ctx))
+
+	rs.Check(ctx, time.Second)
+	first, second := readFrom(ctx), readFrom(ctx)
+	assert.ElementsMatch(t, []string{"replica1", "replica2"}, []string{first, second})
+	assert.Equal(t, first, readFrom(ctx))
+
+	// read-your-writes
+	assert.Equal(t, "primary", readFrom(WithPrimary(ctx)))
+
+	// an unhealthy replica is ejected
+	replica1.down.Store(true)
+	rs.Check(ctx, time.Second)
+	assert.Equal(t, "replica2", readFrom(ctx))
+	assert.Equal(t, "replica2", readFrom(ctx))
+
+	// no healthy replica left
+	replica2.down.Store(true)
+	rs.Check(ctx, time.Second)
+	assert.Equal(t, "primary", readFrom(ctx))
+
+	// and it's restored once it responds again
+	replica1.down.Store(false)
+	rs.Check(ctx, time.Second)
+	assert.Equal(t, "replica1", readFrom(ctx))
+}
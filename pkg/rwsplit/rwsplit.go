@@ -0,0 +1,74 @@
+// Package rwsplit sends the reads to the replicas and keeps the read-your-writes consistency:
+// a client that has just written reads from the primary until the replicas catch up.
+package rwsplit
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// CookieName keeps the unix milliseconds until the client reads from the primary.
+const CookieName = "rw_primary_until"
+
+type primaryContextKey struct{}
+
+// WithPrimary marks the reads made with the context to go to the primary.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryContextKey{}, true)
+}
+
+// PrimaryRequired reports whether the context is marked with WithPrimary.
+func PrimaryRequired(ctx context.Context) bool {
+	primary, _ := ctx.Value(primaryContextKey{}).(bool)
+	return primary
+}
+
+// NewMiddleware marks a write request with a cookie valid for the window,
+// the requests carrying a valid cookie read from the primary.
+// The replication lag is expected to be shorter than the window.
+func NewMiddleware(window time.Duration, now func() time.Time) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isWrite(r.Method) {
+				until := now().Add(window)
+				// the header must be set before the handler writes the response
+				http.SetCookie(w, &http.Cookie{
+					Name:     CookieName,
+					Value:    strconv.FormatInt(until.UnixMilli(), 10),
+					Path:     "/",
+					Expires:  until,
+					HttpOnly: true,
+					SameSite: http.SameSiteLaxMode,
+				})
+				r = r.WithContext(WithPrimary(r.Context()))
+			} else if stickyUntil(r).After(now()) {
+				r = r.WithContext(WithPrimary(r.Context()))
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func stickyUntil(r *http.Request) time.Time {
+	cookie, err := r.Cookie(CookieName)
+	if err != nil {
+		return time.Time{}
+	}
+	ms, err := strconv.ParseInt(cookie.Value, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
+
+func isWrite(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	default:
+		return true
+	}
+}
@@ -0,0 +1,55 @@
+package rwsplit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var primary bool
+	handler := NewMiddleware(5*time.Second, func() time.Time { return now })(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			primary = PrimaryRequired(r.Context())
+		}),
+	)
+
+	// a read without the cookie goes to a replica
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/v1/users", nil))
+	assert.False(t, primary)
+	assert.Empty(t, w.Result().Cookies())
+
+	// a write marks the client
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/v1/users", nil))
+	assert.True(t, primary)
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, CookieName, cookies[0].Name)
+
+	// the next reads within the window go to the primary
+	now = now.Add(4 * time.Second)
+	r := httptest.NewRequest("GET", "/v1/users", nil)
+	r.AddCookie(cookies[0])
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	assert.True(t, primary)
+
+	// and back to a replica after it
+	now = now.Add(2 * time.Second)
+	r = httptest.NewRequest("GET", "/v1/users", nil)
+	r.AddCookie(cookies[0])
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	assert.False(t, primary)
+
+	// a broken cookie is ignored
+	r = httptest.NewRequest("GET", "/v1/users", nil)
+	r.AddCookie(&http.Cookie{Name: CookieName, Value: "forever"})
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	assert.False(t, primary)
+}
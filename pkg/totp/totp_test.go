@@ -0,0 +1,81 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// the SHA1 secret of the test vectors, https://www.rfc-editor.org/rfc/rfc6238#appendix-B
+var rfcSecret = encoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestCode(t *testing.T) {
+	// the vectors have 8 digits, a 6 digit code is their tail
+	cases := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, c := range cases {
+		code, err := Code(rfcSecret, Step(time.Unix(c.unix, 0)))
+		require.NoError(t, err)
+		assert.Equal(t, c.code, code, c.unix)
+	}
+
+	// the apps show the secret in lower case groups
+	code, err := Code(strings.ToLower(rfcSecret[:4]+" "+rfcSecret[4:]), Step(time.Unix(59, 0)))
+	require.NoError(t, err)
+	assert.Equal(t, "287082", code)
+
+	_, err = Code("not base32!", 1)
+	assert.ErrorIs(t, err, ErrInvalidSecret)
+}
+
+func TestValidate(t *testing.T) {
+	at := time.Unix(1111111109, 0)
+	step := Step(at)
+
+	for _, s := range []int64{step - 1, step, step + 1} {
+		code, err := Code(rfcSecret, s)
+		require.NoError(t, err)
+		got, ok, err := Validate(rfcSecret, code, at, 1)
+		require.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, s, got)
+	}
+
+	code, err := Code(rfcSecret, step-2)
+	require.NoError(t, err)
+	_, ok, err := Validate(rfcSecret, code, at, 1)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	_, ok, err = Validate(rfcSecret, "", at, 1)
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestGenerateSecret(t *testing.T) {
+	s, err := GenerateSecret()
+	require.NoError(t, err)
+	assert.Len(t, s, 32)
+	_, err = Code(s, 1)
+	require.NoError(t, err)
+
+	other, err := GenerateSecret()
+	require.NoError(t, err)
+	assert.NotEqual(t, s, other)
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("Users API", "alice", "JBSWY3DPEHPK3PXP")
+	assert.Equal(t, "otpauth://totp/Users%20API:alice?algorithm=SHA1&digits=6&issuer=Users+API&period=30&secret=JBSWY3DPEHPK3PXP", uri)
+}
@@ -0,0 +1,182 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/jmoiron/sqlx"
+)
+
+type APIKeyRepository struct {
+	db *sqlx.DB
+	sq sq.StatementBuilderType
+
+	// now stamps the revocations for sqlite, postgres takes its own clock
+	now func() time.Time
+}
+
+func NewAPIKeyRepository(db *sqlx.DB) *APIKeyRepository {
+	return &APIKeyRepository{
+		db: db,
+		sq: sq.StatementBuilder.PlaceholderFormat(sq.Dollar),
+	}
+}
+
+// NewSQLiteAPIKeyRepository works with the schema of migrations.SQLiteFS.
+func NewSQLiteAPIKeyRepository(db *sqlx.DB, now func() time.Time) *APIKeyRepository {
+	return &APIKeyRepository{
+		db:  db,
+		sq:  sq.StatementBuilder.PlaceholderFormat(sq.Question),
+		now: now,
+	}
+}
+
+var apiKeyColumns = []string{"id", "name", "prefix", "key_hash", "scopes", "createdAt", "expiresAt", "lastUsedAt"}
+
+func (r *APIKeyRepository) CreateAPIKey(ctx context.Context, k domain.APIKey) error {
+	query, args, err := r.sq.Insert("api_keys").
+		Columns(apiKeyColumns...).
+		Values(k.ID, k.Name, k.Prefix, k.Hash, strings.Join(k.Scopes, " "), k.CreatedAt.UTC(), nullTime(k.ExpiresAt), nullTime(k.LastUsedAt)).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("CreateAPIKey: failed to build query: %w", err)
+	}
+
+	if _, err := connFrom(ctx, r.db).ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("CreateAPIKey: failed to insert api key: %w", err)
+	}
+
+	return nil
+}
+
+func (r *APIKeyRepository) GetAPIKeyByPrefix(ctx context.Context, prefix string) (domain.APIKey, error) {
+	query, args, err := r.sq.Select(apiKeyColumns...).
+		From("api_keys").
+		Where(sq.Eq{"prefix": prefix, "revokedAt": nil}).
+		ToSql()
+	if err != nil {
+		return domain.APIKey{}, fmt.Errorf("GetAPIKeyByPrefix: failed to build query: %w", err)
+	}
+
+	k, err := scanAPIKey(connFrom(ctx, r.db).QueryRowxContext(ctx, query, args...))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return k, domain.ErrAPIKeyNotFound
+		}
+		return k, fmt.Errorf("GetAPIKeyByPrefix: failed to get api key: %w", err)
+	}
+
+	return k, nil
+}
+
+func (r *APIKeyRepository) ListAPIKeys(ctx context.Context) ([]domain.APIKey, error) {
+	query, args, err := r.sq.Select(apiKeyColumns...).
+		From("api_keys").
+		Where(sq.Eq{"revokedAt": nil}).
+		OrderBy("createdAt DESC", "id").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("ListAPIKeys: failed to build query: %w", err)
+	}
+
+	rows, err := connFrom(ctx, r.db).QueryxContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("ListAPIKeys: failed to select api keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []domain.APIKey{}
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ListAPIKeys: failed to scan api key: %w", err)
+		}
+		keys = append(keys, k)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ListAPIKeys: failed to read api keys: %w", err)
+	}
+
+	return keys, nil
+}
+
+func (r *APIKeyRepository) RevokeAPIKey(ctx context.Context, id string) error {
+	query, args, err := r.sq.Update("api_keys").
+		Set("revokedAt", currentTime(r.now)).
+		Where(sq.Eq{"id": id, "revokedAt": nil}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("RevokeAPIKey: failed to build query: %w", err)
+	}
+
+	res, err := connFrom(ctx, r.db).ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("RevokeAPIKey: failed to update api key: %w", err)
+	}
+	affectedAmount, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("RevokeAPIKey: failed to get RowsAffected: %w", err)
+	}
+	if affectedAmount == 0 {
+		return domain.ErrAPIKeyNotFound
+	}
+
+	return nil
+}
+
+func (r *APIKeyRepository) TouchAPIKey(ctx context.Context, id string, at time.Time) error {
+	query, args, err := r.sq.Update("api_keys").
+		Set("lastUsedAt", at.UTC()).
+		Where(sq.Eq{"id": id}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("TouchAPIKey: failed to build query: %w", err)
+	}
+
+	if _, err := connFrom(ctx, r.db).ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("TouchAPIKey: failed to update api key: %w", err)
+	}
+
+	return nil
+}
+
+// rowScanner is a single row of sqlx as well as a row of the rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAPIKey(row rowScanner) (domain.APIKey, error) {
+	var k domain.APIKey
+	var scopes string
+	var expiresAt, lastUsedAt sql.NullTime
+	if err := row.Scan(&k.ID, &k.Name, &k.Prefix, &k.Hash, &scopes, &k.CreatedAt, &expiresAt, &lastUsedAt); err != nil {
+		return k, err
+	}
+	k.Scopes = strings.Fields(scopes)
+	k.CreatedAt = k.CreatedAt.UTC()
+	k.ExpiresAt = timePtr(expiresAt)
+	k.LastUsedAt = timePtr(lastUsedAt)
+	return k, nil
+}
+
+// nullTime writes a missing time as NULL.
+func nullTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: t.UTC(), Valid: true}
+}
+
+func timePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	utc := t.Time.UTC()
+	return &utc
+}
@@ -0,0 +1,45 @@
+package cache
+
+import "github.com/prometheus/client_golang/prometheus"
+
+type Metrics struct {
+	hits          prometheus.Counter
+	misses        prometheus.Counter
+	evictions     prometheus.Counter
+	invalidations prometheus.Counter
+}
+
+func NewMetrics(reg prometheus.Registerer) *Metrics {
+	ns := "userService"
+	subsystem := "user_cache"
+	m := &Metrics{
+		hits: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: ns,
+			Subsystem: subsystem,
+			Name:      "hits_total",
+			Help:      "amount of users served from the cache",
+		}),
+		misses: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: ns,
+			Subsystem: subsystem,
+			Name:      "misses_total",
+			Help:      "amount of users not found in the cache",
+		}),
+		evictions: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: ns,
+			Subsystem: subsystem,
+			Name:      "evictions_total",
+			Help:      "amount of users dropped to make room for the new ones",
+		}),
+		invalidations: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: ns,
+			Subsystem: subsystem,
+			Name:      "invalidations_total",
+			Help:      "amount of users dropped because they have changed",
+		}),
+	}
+
+	reg.MustRegister(m.hits, m.misses, m.evictions, m.invalidations)
+
+	return m
+}
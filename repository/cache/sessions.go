@@ -0,0 +1,75 @@
+package cache
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/pkg/lru"
+)
+
+// SessionRepository caches IsSessionActive, every authenticated request asks it.
+// A session revoked on another replica stays active here up to the TTL, the revocations made here apply once committed.
+type SessionRepository struct {
+	domain.SessionRepository
+
+	cache *lru.Cache[string, bool]
+
+	// gen changes on every revocation, a query started before it doesn't fill the cache
+	gen atomic.Uint64
+}
+
+func NewSessionRepository(next domain.SessionRepository, size int, ttl time.Duration, now func() time.Time) *SessionRepository {
+	return &SessionRepository{
+		SessionRepository: next,
+		cache:             lru.New(size, ttl, lru.WithClock[string, bool](now)),
+	}
+}
+
+func (r *SessionRepository) IsSessionActive(ctx context.Context, id string) (bool, error) {
+	// a transaction might see its own revocation not committed yet
+	if domain.InTx(ctx) {
+		return r.SessionRepository.IsSessionActive(ctx, id)
+	}
+	if active, ok := r.cache.Get(id); ok {
+		return active, nil
+	}
+
+	gen := r.gen.Load()
+	active, err := r.SessionRepository.IsSessionActive(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	if r.gen.Load() == gen {
+		r.cache.Set(id, active)
+	}
+	return active, nil
+}
+
+func (r *SessionRepository) RevokeSession(ctx context.Context, userID, id string) error {
+	err := r.SessionRepository.RevokeSession(ctx, userID, id)
+	if err == nil {
+		r.forget(ctx, id)
+	}
+	return err
+}
+
+func (r *SessionRepository) RevokeOtherSessions(ctx context.Context, userID, exceptID string) ([]string, error) {
+	ids, err := r.SessionRepository.RevokeOtherSessions(ctx, userID, exceptID)
+	if err == nil {
+		r.forget(ctx, ids...)
+	}
+	return ids, err
+}
+
+// forget drops the sessions once the revocation is committed, a check between the revocation and the commit
+// reads the session still active and would cache it.
+func (r *SessionRepository) forget(ctx context.Context, ids ...string) {
+	domain.AfterCommit(ctx, func() {
+		r.gen.Add(1)
+		for _, id := range ids {
+			r.cache.Delete(id)
+		}
+	})
+}
@@ -0,0 +1,95 @@
+package cache_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/domain/mocks"
+	"github.com/dennypenta/go-api-walkthrough/repository/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsSessionActive(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	repo := mocks.NewMockSessionRepository(t)
+	cached := cache.NewSessionRepository(repo, 10, time.Minute, func() time.Time { return now })
+
+	repo.On("IsSessionActive", mock.Anything, "1").Return(true, nil).Once()
+	for i := 0; i < 3; i++ {
+		active, err := cached.IsSessionActive(ctx, "1")
+		require.NoError(t, err)
+		assert.True(t, active)
+	}
+
+	// the revocation here is seen at once without a transaction
+	repo.On("RevokeSession", mock.Anything, "user", "1").Return(nil).Once()
+	require.NoError(t, cached.RevokeSession(ctx, "user", "1"))
+	repo.On("IsSessionActive", mock.Anything, "1").Return(false, nil).Once()
+	active, err := cached.IsSessionActive(ctx, "1")
+	require.NoError(t, err)
+	assert.False(t, active)
+
+	// the revocation elsewhere is seen after the TTL
+	repo.On("IsSessionActive", mock.Anything, "2").Return(true, nil).Once()
+	active, err = cached.IsSessionActive(ctx, "2")
+	require.NoError(t, err)
+	assert.True(t, active)
+	now = now.Add(time.Minute + time.Second)
+	repo.On("IsSessionActive", mock.Anything, "2").Return(false, nil).Once()
+	active, err = cached.IsSessionActive(ctx, "2")
+	require.NoError(t, err)
+	assert.False(t, active)
+
+	repo.On("IsSessionActive", mock.Anything, "3").Return(true, nil).Once()
+	_, err = cached.IsSessionActive(ctx, "3")
+	require.NoError(t, err)
+	repo.On("RevokeOtherSessions", mock.Anything, "user", "").Return([]string{"3"}, nil).Once()
+	_, err = cached.RevokeOtherSessions(ctx, "user", "")
+	require.NoError(t, err)
+	repo.On("IsSessionActive", mock.Anything, "3").Return(false, nil).Once()
+	active, err = cached.IsSessionActive(ctx, "3")
+	require.NoError(t, err)
+	assert.False(t, active)
+}
+
+func TestRevokeInTx(t *testing.T) {
+	t.Parallel()
+
+	repo := mocks.NewMockSessionRepository(t)
+	cached := cache.NewSessionRepository(repo, 10, time.Minute, time.Now)
+	txCtx, commit := domain.ContextWithTx(context.Background())
+
+	repo.On("RevokeOtherSessions", mock.Anything, "user", "").Return([]string{"1", "2"}, nil).Once()
+	_, err := cached.RevokeOtherSessions(txCtx, "user", "")
+	require.NoError(t, err)
+
+	// the revocation isn't committed, the others still read the sessions active
+	repo.On("IsSessionActive", mock.Anything, "1").Return(true, nil).Once()
+	active, err := cached.IsSessionActive(context.Background(), "1")
+	require.NoError(t, err)
+	assert.True(t, active)
+	// the check is on the way while the revocation is committed
+	repo.On("IsSessionActive", mock.Anything, "2").
+		Return(func(context.Context, string) (bool, error) {
+			commit()
+			return true, nil
+		}).Once()
+	active, err = cached.IsSessionActive(context.Background(), "2")
+	require.NoError(t, err)
+	assert.True(t, active)
+
+	// the commit drops what has been cached meanwhile
+	for _, id := range []string{"1", "2"} {
+		repo.On("IsSessionActive", mock.Anything, id).Return(false, nil).Once()
+		active, err := cached.IsSessionActive(context.Background(), id)
+		require.NoError(t, err)
+		assert.False(t, active)
+	}
+}
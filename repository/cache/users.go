@@ -0,0 +1,146 @@
+// Package cache keeps the hot users and sessions in memory in front of the storage.
+package cache
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/pkg/log"
+	"github.com/dennypenta/go-api-walkthrough/pkg/lru"
+	"github.com/dennypenta/go-api-walkthrough/pkg/rwsplit"
+	"golang.org/x/sync/singleflight"
+)
+
+// Invalidator tells the other replicas to drop the user from their caches.
+type Invalidator interface {
+	Invalidate(ctx context.Context, id string) error
+}
+
+// UserRepository caches GetUserByID, the writes go through and drop the user from the cache once they are committed.
+// The concurrent misses of the same user make a single query, it reads from the primary,
+// so a lagging replica doesn't put back the user a write has just dropped.
+// The reads in a transaction and the reads sent to the primary by rwsplit skip the cache.
+type UserRepository struct {
+	domain.UserRepository
+
+	cache       *lru.Cache[string, domain.User]
+	group       singleflight.Group
+	invalidator Invalidator
+	metrics     *Metrics
+
+	// gen changes on every invalidation, a query started before it doesn't fill the cache
+	gen atomic.Uint64
+}
+
+func NewUserRepository(next domain.UserRepository, size int, ttl time.Duration, now func() time.Time, m *Metrics) *UserRepository {
+	return &UserRepository{
+		UserRepository: next,
+		cache: lru.New(size, ttl,
+			lru.WithClock[string, domain.User](now),
+			lru.WithEvictCallback[string, domain.User](func(string) { m.evictions.Inc() }),
+		),
+		metrics: m,
+	}
+}
+
+// WithInvalidator makes the writes invalidate the user on the other replicas as well.
+func (r *UserRepository) WithInvalidator(inv Invalidator) *UserRepository {
+	r.invalidator = inv
+	return r
+}
+
+func (r *UserRepository) GetUserByID(ctx context.Context, id string) (domain.User, error) {
+	// a transaction might see its own rows not committed yet, they must not be shared
+	if domain.InTx(ctx) || rwsplit.PrimaryRequired(ctx) {
+		return r.UserRepository.GetUserByID(ctx, id)
+	}
+	if user, ok := r.cache.Get(id); ok {
+		r.metrics.hits.Inc()
+		return user, nil
+	}
+	r.metrics.misses.Inc()
+
+	user, err, _ := r.group.Do(id, func() (interface{}, error) {
+		gen := r.gen.Load()
+		// the query is shared by the callers, one of them going away must not fail the others
+		user, err := r.UserRepository.GetUserByID(rwsplit.WithPrimary(context.WithoutCancel(ctx)), id)
+		if err != nil {
+			return user, err
+		}
+		if r.gen.Load() == gen {
+			r.cache.Set(id, user)
+		}
+		return user, nil
+	})
+
+	return user.(domain.User), err
+}
+
+func (r *UserRepository) UpdateUser(ctx context.Context, user domain.User) (domain.User, error) {
+	user, err := r.UserRepository.UpdateUser(ctx, user)
+	if err == nil {
+		r.invalidate(ctx, user.ID)
+	}
+	return user, err
+}
+
+func (r *UserRepository) UpdateUsername(ctx context.Context, id, username string) (domain.User, error) {
+	user, err := r.UserRepository.UpdateUsername(ctx, id, username)
+	if err == nil {
+		r.invalidate(ctx, id)
+	}
+	return user, err
+}
+
+func (r *UserRepository) DeleteUser(ctx context.Context, id string) error {
+	err := r.UserRepository.DeleteUser(ctx, id)
+	if err == nil {
+		r.invalidate(ctx, id)
+	}
+	return err
+}
+
+func (r *UserRepository) RestoreUser(ctx context.Context, id string) error {
+	err := r.UserRepository.RestoreUser(ctx, id)
+	if err == nil {
+		r.invalidate(ctx, id)
+	}
+	return err
+}
+
+func (r *UserRepository) VerifyEmail(ctx context.Context, id, email string, at time.Time) error {
+	err := r.UserRepository.VerifyEmail(ctx, id, email, at)
+	if err == nil {
+		r.invalidate(ctx, id)
+	}
+	return err
+}
+
+// Forget drops the user from the local cache only, it's called on an invalidation from another replica.
+func (r *UserRepository) Forget(id string) {
+	r.gen.Add(1)
+	r.cache.Delete(id)
+	r.metrics.invalidations.Inc()
+}
+
+// Purge drops all the users, e.g. when the invalidations might have been missed.
+func (r *UserRepository) Purge() {
+	r.gen.Add(1)
+	r.cache.Purge()
+}
+
+// invalidate drops the user once the write is committed, a read between the write and the commit
+// would fill the cache with the row the write replaces.
+func (r *UserRepository) invalidate(ctx context.Context, id string) {
+	domain.AfterCommit(ctx, func() { r.Forget(id) })
+	if r.invalidator == nil {
+		return
+	}
+	// the notification of a transaction is delivered on the commit,
+	// the other replicas catch up on the TTL at worst
+	if err := r.invalidator.Invalidate(ctx, id); err != nil {
+		log.LoggerFromContext(ctx).ErrorContext(ctx, "failed to invalidate cached user", "id", id, "err", err)
+	}
+}
@@ -0,0 +1,235 @@
+package cache_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/domain/mocks"
+	"github.com/dennypenta/go-api-walkthrough/pkg/rwsplit"
+	"github.com/dennypenta/go-api-walkthrough/repository/cache"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type invalidatorFunc func(ctx context.Context, id string) error
+
+func (f invalidatorFunc) Invalidate(ctx context.Context, id string) error {
+	return f(ctx, id)
+}
+
+func newCached(t *testing.T, size int) (*cache.UserRepository, *mocks.MockUserRepository, *prometheus.Registry) {
+	t.Helper()
+
+	repo := mocks.NewMockUserRepository(t)
+	reg := prometheus.NewRegistry()
+	return cache.NewUserRepository(repo, size, time.Minute, time.Now, cache.NewMetrics(reg)), repo, reg
+}
+
+func metric(t *testing.T, reg *prometheus.Registry, name string) float64 {
+	t.Helper()
+
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	for _, f := range families {
+		if f.GetName() == "userService_user_cache_"+name {
+			return f.GetMetric()[0].GetCounter().GetValue()
+		}
+	}
+	t.Fatalf("metric %s not found", name)
+	return 0
+}
+
+func TestGetUserByID(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	user := domain.User{ID: "1", Username: "alice"}
+
+	cached, repo, reg := newCached(t, 10)
+	repo.On("GetUserByID", mock.Anything, "1").Return(user, nil).Once()
+	repo.On("GetUserByID", mock.Anything, "2").Return(domain.User{}, domain.ErrUserNotFound).Twice()
+
+	for i := 0; i < 3; i++ {
+		got, err := cached.GetUserByID(ctx, "1")
+		require.NoError(t, err)
+		assert.Equal(t, user, got)
+	}
+	// not found isn't cached, the user might be created a moment later
+	for i := 0; i < 2; i++ {
+		_, err := cached.GetUserByID(ctx, "2")
+		assert.ErrorIs(t, err, domain.ErrUserNotFound)
+	}
+
+	assert.Equal(t, 2.0, metric(t, reg, "hits_total"))
+	assert.Equal(t, 3.0, metric(t, reg, "misses_total"))
+}
+
+func TestConcurrentMissesMakeOneQuery(t *testing.T) {
+	t.Parallel()
+	user := domain.User{ID: "1", Username: "alice"}
+
+	cached, repo, _ := newCached(t, 10)
+	release := make(chan struct{})
+	repo.On("GetUserByID", mock.Anything, "1").
+		Return(func(context.Context, string) (domain.User, error) {
+			<-release
+			return user, nil
+		}).Once()
+
+	const n = 10
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := cached.GetUserByID(context.Background(), "1")
+			assert.NoError(t, err)
+			assert.Equal(t, user, got)
+		}()
+	}
+	// let the callers pile up on the first query
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+}
+
+func TestWritesInvalidate(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	alice := domain.User{ID: "1", Username: "alice"}
+	bob := domain.User{ID: "1", Username: "bob"}
+
+	cached, repo, reg := newCached(t, 10)
+	var invalidated []string
+	cached.WithInvalidator(invalidatorFunc(func(ctx context.Context, id string) error {
+		invalidated = append(invalidated, id)
+		return nil
+	}))
+	repo.On("GetUserByID", mock.Anything, "1").Return(alice, nil).Once()
+	repo.On("UpdateUser", mock.Anything, bob).Return(bob, nil).Once()
+	repo.On("GetUserByID", mock.Anything, "1").Return(bob, nil).Once()
+	repo.On("DeleteUser", mock.Anything, "1").Return(nil).Once()
+	repo.On("GetUserByID", mock.Anything, "1").Return(domain.User{}, domain.ErrUserNotFound).Once()
+	repo.On("DeleteUser", mock.Anything, "2").Return(domain.ErrUserNotFound).Once()
+
+	got, err := cached.GetUserByID(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, alice, got)
+
+	_, err = cached.UpdateUser(ctx, bob)
+	require.NoError(t, err)
+	got, err = cached.GetUserByID(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, bob, got)
+
+	require.NoError(t, cached.DeleteUser(ctx, "1"))
+	_, err = cached.GetUserByID(ctx, "1")
+	assert.ErrorIs(t, err, domain.ErrUserNotFound)
+
+	// a failed write invalidates nothing
+	assert.ErrorIs(t, cached.DeleteUser(ctx, "2"), domain.ErrUserNotFound)
+
+	assert.Equal(t, []string{"1", "1"}, invalidated)
+	assert.Equal(t, 2.0, metric(t, reg, "invalidations_total"))
+}
+
+func TestInvalidationDuringQueryDoesNotFillCache(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	alice := domain.User{ID: "1", Username: "alice"}
+	bob := domain.User{ID: "1", Username: "bob"}
+
+	cached, repo, _ := newCached(t, 10)
+	// the user is renamed on another replica while the old row is on the way
+	repo.On("GetUserByID", mock.Anything, "1").
+		Return(func(context.Context, string) (domain.User, error) {
+			cached.Forget("1")
+			return alice, nil
+		}).Once()
+	repo.On("GetUserByID", mock.Anything, "1").Return(bob, nil).Once()
+
+	got, err := cached.GetUserByID(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, alice, got)
+
+	got, err = cached.GetUserByID(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, bob, got)
+}
+
+func TestWriteInTxInvalidatesOnCommit(t *testing.T) {
+	t.Parallel()
+	alice := domain.User{ID: "1", Username: "alice"}
+	bob := domain.User{ID: "1", Username: "bob"}
+
+	cached, repo, _ := newCached(t, 10)
+	repo.On("GetUserByID", mock.Anything, "1").Return(alice, nil).Once()
+	repo.On("UpdateUser", mock.Anything, bob).Return(bob, nil).Once()
+	// the reads of the transaction see its write and aren't cached
+	repo.On("GetUserByID", mock.MatchedBy(domain.InTx), "1").Return(bob, nil).Twice()
+	repo.On("GetUserByID", mock.Anything, "1").Return(bob, nil).Once()
+
+	_, err := cached.GetUserByID(context.Background(), "1")
+	require.NoError(t, err)
+
+	txCtx, commit := domain.ContextWithTx(context.Background())
+	_, err = cached.UpdateUser(txCtx, bob)
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		got, err := cached.GetUserByID(txCtx, "1")
+		require.NoError(t, err)
+		assert.Equal(t, bob, got)
+	}
+	// the others see the committed user until the commit
+	got, err := cached.GetUserByID(context.Background(), "1")
+	require.NoError(t, err)
+	assert.Equal(t, alice, got)
+
+	commit()
+	got, err = cached.GetUserByID(context.Background(), "1")
+	require.NoError(t, err)
+	assert.Equal(t, bob, got)
+}
+
+func TestReadsFromPrimary(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	alice := domain.User{ID: "1", Username: "alice"}
+	bob := domain.User{ID: "1", Username: "bob"}
+
+	cached, repo, _ := newCached(t, 10)
+	// a miss is filled from the primary, a lagging replica can't put back the old row
+	repo.On("GetUserByID", mock.MatchedBy(rwsplit.PrimaryRequired), "1").Return(alice, nil).Once()
+	repo.On("GetUserByID", mock.MatchedBy(rwsplit.PrimaryRequired), "1").Return(bob, nil).Once()
+
+	got, err := cached.GetUserByID(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, alice, got)
+
+	// the client that has just written skips the cache
+	got, err = cached.GetUserByID(rwsplit.WithPrimary(ctx), "1")
+	require.NoError(t, err)
+	assert.Equal(t, bob, got)
+	got, err = cached.GetUserByID(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, alice, got)
+}
+
+func TestEvictionMetric(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	cached, repo, reg := newCached(t, 1)
+	repo.On("GetUserByID", mock.Anything, mock.Anything).Return(domain.User{Username: "alice"}, nil)
+
+	for _, id := range []string{"1", "2", "3"} {
+		_, err := cached.GetUserByID(ctx, id)
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, 2.0, metric(t, reg, "evictions_total"))
+}
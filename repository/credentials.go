@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/jmoiron/sqlx"
+)
+
+type CredentialRepository struct {
+	db *sqlx.DB
+	sq sq.StatementBuilderType
+
+	// now stamps the created and updated credentials for sqlite, postgres takes its own clock
+	now func() time.Time
+}
+
+func NewCredentialRepository(db *sqlx.DB) *CredentialRepository {
+	return &CredentialRepository{
+		db: db,
+		sq: sq.StatementBuilder.PlaceholderFormat(sq.Dollar),
+	}
+}
+
+// NewSQLiteCredentialRepository works with the schema of migrations.SQLiteFS.
+func NewSQLiteCredentialRepository(db *sqlx.DB, now func() time.Time) *CredentialRepository {
+	return &CredentialRepository{
+		db:  db,
+		sq:  sq.StatementBuilder.PlaceholderFormat(sq.Question),
+		now: now,
+	}
+}
+
+// SetCredentials inserts the credentials only if the user isn't deleted, no row means there is no such user.
+func (r *CredentialRepository) SetCredentials(ctx context.Context, c domain.Credentials) error {
+	now := currentTime(r.now)
+	query, args, err := r.sq.Insert("user_credentials").
+		Columns("user_id", "login", "password_hash", "createdAt", "updatedAt").
+		Select(r.sq.Select("id").
+			Column("?", c.Login).
+			Column("?", c.PasswordHash).
+			Column(now).
+			Column(now).
+			From("users").
+			Where(sq.Eq{"id": c.UserID, "deletedAt": nil})).
+		Suffix(`ON CONFLICT (user_id) DO UPDATE SET
+			login = EXCLUDED.login,
+			password_hash = EXCLUDED.password_hash,
+			updatedAt = EXCLUDED.updatedAt`).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("SetCredentials: failed to build query: %w", err)
+	}
+
+	res, err := connFrom(ctx, r.db).ExecContext(ctx, query, args...)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return domain.ErrLoginTaken
+		}
+		return fmt.Errorf("SetCredentials: failed to upsert credentials: %w", err)
+	}
+
+	affectedAmount, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("SetCredentials: failed to get RowsAffected: %w", err)
+	}
+	if affectedAmount == 0 {
+		return domain.ErrUserNotFound
+	}
+
+	return nil
+}
+
+func (r *CredentialRepository) GetCredentialsByLogin(ctx context.Context, login string) (domain.Credentials, error) {
+	c := domain.Credentials{Login: login}
+	query, args, err := r.sq.Select("c.user_id", "c.password_hash").
+		From("user_credentials c").
+		Join("users u ON u.id = c.user_id").
+		Where(sq.Eq{"c.login": login, "u.deletedAt": nil}).
+		ToSql()
+	if err != nil {
+		return c, fmt.Errorf("GetCredentialsByLogin: failed to build query: %w", err)
+	}
+
+	err = connFrom(ctx, r.db).QueryRowxContext(ctx, query, args...).Scan(&c.UserID, &c.PasswordHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return c, domain.ErrCredentialsNotFound
+		}
+		return c, fmt.Errorf("GetCredentialsByLogin: failed to get credentials: %w", err)
+	}
+
+	return c, nil
+}
+
+func (r *CredentialRepository) GetCredentials(ctx context.Context, userID string) (domain.Credentials, error) {
+	c := domain.Credentials{UserID: userID}
+	query, args, err := r.sq.Select("c.login", "c.password_hash").
+		From("user_credentials c").
+		Join("users u ON u.id = c.user_id").
+		Where(sq.Eq{"c.user_id": userID, "u.deletedAt": nil}).
+		ToSql()
+	if err != nil {
+		return c, fmt.Errorf("GetCredentials: failed to build query: %w", err)
+	}
+
+	err = connFrom(ctx, r.db).QueryRowxContext(ctx, query, args...).Scan(&c.Login, &c.PasswordHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return c, domain.ErrCredentialsNotFound
+		}
+		return c, fmt.Errorf("GetCredentials: failed to get credentials: %w", err)
+	}
+
+	return c, nil
+}
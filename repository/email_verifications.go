@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/jmoiron/sqlx"
+)
+
+type EmailVerificationRepository struct {
+	db *sqlx.DB
+	sq sq.StatementBuilderType
+}
+
+func NewEmailVerificationRepository(db *sqlx.DB) *EmailVerificationRepository {
+	return &EmailVerificationRepository{
+		db: db,
+		sq: sq.StatementBuilder.PlaceholderFormat(sq.Dollar),
+	}
+}
+
+// NewSQLiteEmailVerificationRepository works with the schema of migrations.SQLiteFS.
+func NewSQLiteEmailVerificationRepository(db *sqlx.DB) *EmailVerificationRepository {
+	return &EmailVerificationRepository{
+		db: db,
+		sq: sq.StatementBuilder.PlaceholderFormat(sq.Question),
+	}
+}
+
+func (r *EmailVerificationRepository) CreateEmailVerification(ctx context.Context, v domain.EmailVerification) error {
+	query, args, err := r.sq.Delete("email_verifications").
+		Where(sq.Eq{"user_id": v.UserID}).
+		Where(sq.LtOrEq{"expiresAt": v.CreatedAt.UTC()}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("CreateEmailVerification: failed to build query: %w", err)
+	}
+	if _, err := connFrom(ctx, r.db).ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("CreateEmailVerification: failed to delete expired verifications: %w", err)
+	}
+
+	query, args, err = r.sq.Insert("email_verifications").
+		Columns("id", "user_id", "email", "token_hash", "createdAt", "expiresAt").
+		Values(v.ID, v.UserID, v.Email, v.Hash, v.CreatedAt.UTC(), v.ExpiresAt.UTC()).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("CreateEmailVerification: failed to build query: %w", err)
+	}
+	if _, err := connFrom(ctx, r.db).ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("CreateEmailVerification: failed to insert verification: %w", err)
+	}
+
+	return nil
+}
+
+func (r *EmailVerificationRepository) RecentEmailVerifications(ctx context.Context, userID string, since time.Time) ([]time.Time, error) {
+	query, args, err := r.sq.Select("createdAt").
+		From("email_verifications").
+		Where(sq.Eq{"user_id": userID}).
+		Where(sq.Gt{"createdAt": since.UTC()}).
+		OrderBy("createdAt").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("RecentEmailVerifications: failed to build query: %w", err)
+	}
+
+	rows, err := connFrom(ctx, r.db).QueryxContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("RecentEmailVerifications: failed to list verifications: %w", err)
+	}
+	defer rows.Close()
+
+	var times []time.Time
+	for rows.Next() {
+		var t time.Time
+		if err := rows.Scan(&t); err != nil {
+			return nil, fmt.Errorf("RecentEmailVerifications: failed to scan verification: %w", err)
+		}
+		times = append(times, t.UTC())
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("RecentEmailVerifications: failed to list verifications: %w", err)
+	}
+
+	return times, nil
+}
+
+func (r *EmailVerificationRepository) ConsumeEmailVerification(ctx context.Context, hash string, at time.Time) (domain.EmailVerification, error) {
+	v := domain.EmailVerification{Hash: hash}
+	query, args, err := r.sq.Delete("email_verifications").
+		Where(sq.Eq{"token_hash": hash}).
+		Where(sq.Gt{"expiresAt": at.UTC()}).
+		Suffix("RETURNING id, user_id, email, createdAt, expiresAt").
+		ToSql()
+	if err != nil {
+		return v, fmt.Errorf("ConsumeEmailVerification: failed to build query: %w", err)
+	}
+
+	err = connFrom(ctx, r.db).QueryRowxContext(ctx, query, args...).
+		Scan(&v.ID, &v.UserID, &v.Email, &v.CreatedAt, &v.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return v, domain.ErrEmailVerificationNotFound
+		}
+		return v, fmt.Errorf("ConsumeEmailVerification: failed to delete verification: %w", err)
+	}
+	v.CreatedAt = v.CreatedAt.UTC()
+	v.ExpiresAt = v.ExpiresAt.UTC()
+
+	return v, nil
+}
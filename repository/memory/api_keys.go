@@ -0,0 +1,99 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+)
+
+// APIKeyRepository keeps the api keys, they don't belong to the users.
+type APIKeyRepository struct {
+	mu sync.RWMutex
+	// by the id
+	keys     map[string]apiKey
+	byPrefix map[string]string
+}
+
+type apiKey struct {
+	domain.APIKey
+	revoked bool
+}
+
+func NewAPIKeyRepository() *APIKeyRepository {
+	return &APIKeyRepository{
+		keys:     make(map[string]apiKey),
+		byPrefix: make(map[string]string),
+	}
+}
+
+func (r *APIKeyRepository) CreateAPIKey(ctx context.Context, k domain.APIKey) error {
+	k.Scopes = slices.Clone(k.Scopes)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.keys[k.ID] = apiKey{APIKey: k}
+	r.byPrefix[k.Prefix] = k.ID
+	return nil
+}
+
+func (r *APIKeyRepository) GetAPIKeyByPrefix(ctx context.Context, prefix string) (domain.APIKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	k, ok := r.keys[r.byPrefix[prefix]]
+	if !ok || k.revoked {
+		return domain.APIKey{}, domain.ErrAPIKeyNotFound
+	}
+	return k.APIKey, nil
+}
+
+func (r *APIKeyRepository) ListAPIKeys(ctx context.Context) ([]domain.APIKey, error) {
+	r.mu.RLock()
+	keys := []domain.APIKey{}
+	for _, k := range r.keys {
+		if !k.revoked {
+			keys = append(keys, k.APIKey)
+		}
+	}
+	r.mu.RUnlock()
+
+	slices.SortFunc(keys, func(a, b domain.APIKey) int {
+		if c := b.CreatedAt.Compare(a.CreatedAt); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return keys, nil
+}
+
+func (r *APIKeyRepository) RevokeAPIKey(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	k, ok := r.keys[id]
+	if !ok || k.revoked {
+		return domain.ErrAPIKeyNotFound
+	}
+	k.revoked = true
+	r.keys[id] = k
+	return nil
+}
+
+func (r *APIKeyRepository) TouchAPIKey(ctx context.Context, id string, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	k, ok := r.keys[id]
+	if !ok {
+		return nil
+	}
+	at = at.UTC()
+	k.LastUsedAt = &at
+	r.keys[id] = k
+	return nil
+}
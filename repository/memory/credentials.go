@@ -0,0 +1,87 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+)
+
+// CredentialRepository keeps the credentials of the users of the given repository,
+// so it goes along with any storage given to the app.
+type CredentialRepository struct {
+	mu sync.RWMutex
+	// by the user id
+	creds map[string]domain.Credentials
+	users domain.UserRepository
+}
+
+func NewCredentialRepository(users domain.UserRepository) *CredentialRepository {
+	return &CredentialRepository{
+		creds: make(map[string]domain.Credentials),
+		users: users,
+	}
+}
+
+func (r *CredentialRepository) SetCredentials(ctx context.Context, c domain.Credentials) error {
+	if _, err := r.users.GetUserByID(ctx, c.UserID); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for userID, other := range r.creds {
+		if other.Login == c.Login && userID != c.UserID {
+			return domain.ErrLoginTaken
+		}
+	}
+	r.creds[c.UserID] = c
+
+	return nil
+}
+
+func (r *CredentialRepository) GetCredentialsByLogin(ctx context.Context, login string) (domain.Credentials, error) {
+	r.mu.RLock()
+	var c domain.Credentials
+	var ok bool
+	for _, other := range r.creds {
+		if other.Login == login {
+			c, ok = other, true
+			break
+		}
+	}
+	r.mu.RUnlock()
+	if !ok {
+		return domain.Credentials{}, domain.ErrCredentialsNotFound
+	}
+
+	// the deleted user can't sign in
+	if _, err := r.users.GetUserByID(ctx, c.UserID); err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			return domain.Credentials{}, domain.ErrCredentialsNotFound
+		}
+		return domain.Credentials{}, err
+	}
+
+	return c, nil
+}
+
+func (r *CredentialRepository) GetCredentials(ctx context.Context, userID string) (domain.Credentials, error) {
+	r.mu.RLock()
+	c, ok := r.creds[userID]
+	r.mu.RUnlock()
+	if !ok {
+		return domain.Credentials{}, domain.ErrCredentialsNotFound
+	}
+
+	if _, err := r.users.GetUserByID(ctx, userID); err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			return domain.Credentials{}, domain.ErrCredentialsNotFound
+		}
+		return domain.Credentials{}, err
+	}
+
+	return c, nil
+}
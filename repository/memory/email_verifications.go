@@ -0,0 +1,71 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+)
+
+// EmailVerificationRepository keeps the email verifications of the users of the given repository.
+type EmailVerificationRepository struct {
+	mu sync.Mutex
+	// by the hash
+	verifications map[string]domain.EmailVerification
+	users         domain.UserRepository
+}
+
+func NewEmailVerificationRepository(users domain.UserRepository) *EmailVerificationRepository {
+	return &EmailVerificationRepository{
+		verifications: make(map[string]domain.EmailVerification),
+		users:         users,
+	}
+}
+
+func (r *EmailVerificationRepository) CreateEmailVerification(ctx context.Context, v domain.EmailVerification) error {
+	if _, err := r.users.GetUserByID(ctx, v.UserID); err != nil {
+		return err
+	}
+
+	v.CreatedAt = v.CreatedAt.UTC()
+	v.ExpiresAt = v.ExpiresAt.UTC()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for hash, other := range r.verifications {
+		if other.UserID == v.UserID && !other.ExpiresAt.After(v.CreatedAt) {
+			delete(r.verifications, hash)
+		}
+	}
+	r.verifications[v.Hash] = v
+	return nil
+}
+
+func (r *EmailVerificationRepository) RecentEmailVerifications(ctx context.Context, userID string, since time.Time) ([]time.Time, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var times []time.Time
+	for _, v := range r.verifications {
+		if v.UserID == userID && v.CreatedAt.After(since) {
+			times = append(times, v.CreatedAt)
+		}
+	}
+	slices.SortFunc(times, time.Time.Compare)
+	return times, nil
+}
+
+func (r *EmailVerificationRepository) ConsumeEmailVerification(ctx context.Context, hash string, at time.Time) (domain.EmailVerification, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	v, ok := r.verifications[hash]
+	if !ok || !at.Before(v.ExpiresAt) {
+		return domain.EmailVerification{Hash: hash}, domain.ErrEmailVerificationNotFound
+	}
+	delete(r.verifications, hash)
+	return v, nil
+}
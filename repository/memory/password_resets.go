@@ -0,0 +1,89 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+)
+
+// PasswordResetRepository keeps the password resets of the users of the given repository.
+type PasswordResetRepository struct {
+	mu sync.Mutex
+	// by the user id
+	resets map[string]domain.PasswordReset
+	users  domain.UserRepository
+}
+
+func NewPasswordResetRepository(users domain.UserRepository) *PasswordResetRepository {
+	return &PasswordResetRepository{
+		resets: make(map[string]domain.PasswordReset),
+		users:  users,
+	}
+}
+
+func (r *PasswordResetRepository) CreatePasswordReset(ctx context.Context, reset domain.PasswordReset) error {
+	if _, err := r.users.GetUserByID(ctx, reset.UserID); err != nil {
+		return err
+	}
+
+	reset.CreatedAt = reset.CreatedAt.UTC()
+	reset.ExpiresAt = reset.ExpiresAt.UTC()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.resets[reset.UserID] = reset
+	return nil
+}
+
+func (r *PasswordResetRepository) GetPasswordReset(ctx context.Context, hash string) (domain.PasswordReset, error) {
+	r.mu.Lock()
+	var reset domain.PasswordReset
+	var ok bool
+	for _, other := range r.resets {
+		if other.Hash == hash {
+			reset, ok = other, true
+			break
+		}
+	}
+	r.mu.Unlock()
+	if !ok {
+		return domain.PasswordReset{Hash: hash}, domain.ErrPasswordResetNotFound
+	}
+
+	// the deleted user can't reset the password
+	if _, err := r.users.GetUserByID(ctx, reset.UserID); err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			return domain.PasswordReset{Hash: hash}, domain.ErrPasswordResetNotFound
+		}
+		return domain.PasswordReset{Hash: hash}, err
+	}
+
+	return reset, nil
+}
+
+func (r *PasswordResetRepository) GetUserPasswordReset(ctx context.Context, userID string) (domain.PasswordReset, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	reset, ok := r.resets[userID]
+	if !ok {
+		return domain.PasswordReset{UserID: userID}, domain.ErrPasswordResetNotFound
+	}
+	return reset, nil
+}
+
+func (r *PasswordResetRepository) UsePasswordReset(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for userID, reset := range r.resets {
+		if reset.ID == id {
+			delete(r.resets, userID)
+			return nil
+		}
+	}
+	return domain.ErrPasswordResetNotFound
+}
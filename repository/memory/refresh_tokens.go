@@ -0,0 +1,85 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+)
+
+// RefreshTokenRepository keeps the refresh tokens of the users and the sessions of the given repositories.
+type RefreshTokenRepository struct {
+	mu sync.Mutex
+	// by the hash
+	tokens   map[string]domain.RefreshToken
+	users    domain.UserRepository
+	sessions domain.SessionRepository
+}
+
+func NewRefreshTokenRepository(users domain.UserRepository, sessions domain.SessionRepository) *RefreshTokenRepository {
+	return &RefreshTokenRepository{
+		tokens:   make(map[string]domain.RefreshToken),
+		users:    users,
+		sessions: sessions,
+	}
+}
+
+func (r *RefreshTokenRepository) CreateRefreshToken(ctx context.Context, t domain.RefreshToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.tokens[t.Hash] = t
+	return nil
+}
+
+func (r *RefreshTokenRepository) GetRefreshToken(ctx context.Context, hash string) (domain.RefreshToken, error) {
+	r.mu.Lock()
+	t, ok := r.tokens[hash]
+	r.mu.Unlock()
+	if !ok {
+		return domain.RefreshToken{}, domain.ErrRefreshTokenNotFound
+	}
+
+	// the tokens of a deleted user can't be exchanged
+	if _, err := r.users.GetUserByID(ctx, t.UserID); err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			return domain.RefreshToken{}, domain.ErrRefreshTokenNotFound
+		}
+		return domain.RefreshToken{}, err
+	}
+
+	active, err := r.sessions.IsSessionActive(ctx, t.SessionID)
+	if err != nil {
+		return domain.RefreshToken{}, err
+	}
+	t.Revoked = !active
+
+	return t, nil
+}
+
+func (r *RefreshTokenRepository) UseRefreshToken(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for hash, t := range r.tokens {
+		if t.ID != id {
+			continue
+		}
+		if t.Used {
+			return domain.ErrRefreshTokenReused
+		}
+		active, err := r.sessions.IsSessionActive(ctx, t.SessionID)
+		if err != nil {
+			return err
+		}
+		if !active {
+			return domain.ErrRefreshTokenReused
+		}
+		t.Used = true
+		r.tokens[hash] = t
+		return nil
+	}
+
+	return domain.ErrRefreshTokenReused
+}
@@ -0,0 +1,46 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+)
+
+// RoleRepository keeps the roles of the users of the given repository.
+type RoleRepository struct {
+	mu sync.RWMutex
+	// by the user id
+	roles map[string][]string
+	users domain.UserRepository
+}
+
+func NewRoleRepository(users domain.UserRepository) *RoleRepository {
+	return &RoleRepository{
+		roles: make(map[string][]string),
+		users: users,
+	}
+}
+
+func (r *RoleRepository) GetRoles(ctx context.Context, userID string) ([]string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return slices.Clone(r.roles[userID]), nil
+}
+
+func (r *RoleRepository) SetRoles(ctx context.Context, userID string, roles []string) error {
+	if _, err := r.users.GetUserByID(ctx, userID); err != nil {
+		return err
+	}
+
+	roles = slices.Clone(roles)
+	slices.Sort(roles)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.roles[userID] = roles
+	return nil
+}
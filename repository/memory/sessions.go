@@ -0,0 +1,136 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+)
+
+// SessionRepository keeps the sessions of the users of the given repository.
+type SessionRepository struct {
+	mu sync.RWMutex
+	// by the id
+	sessions map[string]session
+	users    domain.UserRepository
+}
+
+type session struct {
+	domain.Session
+	revoked bool
+}
+
+func NewSessionRepository(users domain.UserRepository) *SessionRepository {
+	return &SessionRepository{
+		sessions: make(map[string]session),
+		users:    users,
+	}
+}
+
+func (r *SessionRepository) CreateSession(ctx context.Context, s domain.Session) error {
+	if _, err := r.users.GetUserByID(ctx, s.UserID); err != nil {
+		return err
+	}
+
+	s.CreatedAt = s.CreatedAt.UTC()
+	s.LastSeenAt = s.LastSeenAt.UTC()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.sessions[s.ID] = session{Session: s}
+	return nil
+}
+
+func (r *SessionRepository) TouchSession(ctx context.Context, id string, client domain.Client, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.sessions[id]
+	if !ok || s.revoked {
+		return domain.ErrSessionNotFound
+	}
+	s.UserAgent = client.UserAgent
+	s.IP = client.IP
+	s.LastSeenAt = at.UTC()
+	r.sessions[id] = s
+	return nil
+}
+
+func (r *SessionRepository) IsSessionActive(ctx context.Context, id string) (bool, error) {
+	r.mu.RLock()
+	s, ok := r.sessions[id]
+	r.mu.RUnlock()
+	if !ok || s.revoked {
+		return false, nil
+	}
+
+	// the sessions of a deleted user are gone with the user
+	if _, err := r.users.GetUserByID(ctx, s.UserID); err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (r *SessionRepository) ListSessions(ctx context.Context, userID string) ([]domain.Session, error) {
+	if _, err := r.users.GetUserByID(ctx, userID); err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			return []domain.Session{}, nil
+		}
+		return nil, err
+	}
+
+	r.mu.RLock()
+	sessions := []domain.Session{}
+	for _, s := range r.sessions {
+		if s.UserID == userID && !s.revoked {
+			sessions = append(sessions, s.Session)
+		}
+	}
+	r.mu.RUnlock()
+
+	slices.SortFunc(sessions, func(a, b domain.Session) int {
+		if c := b.LastSeenAt.Compare(a.LastSeenAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	return sessions, nil
+}
+
+func (r *SessionRepository) RevokeSession(ctx context.Context, userID, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.sessions[id]
+	if !ok || s.revoked || s.UserID != userID {
+		return domain.ErrSessionNotFound
+	}
+	s.revoked = true
+	r.sessions[id] = s
+	return nil
+}
+
+func (r *SessionRepository) RevokeOtherSessions(ctx context.Context, userID, exceptID string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ids := []string{}
+	for id, s := range r.sessions {
+		if s.UserID != userID || s.revoked || id == exceptID {
+			continue
+		}
+		s.revoked = true
+		r.sessions[id] = s
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
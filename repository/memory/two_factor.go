@@ -0,0 +1,154 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+)
+
+// TwoFactorRepository keeps the second factor of the users of the given repository.
+type TwoFactorRepository struct {
+	mu sync.Mutex
+	// by the user id
+	totp map[string]domain.TOTP
+	// the unused codes by the user id and the hash
+	recoveryCodes map[string]map[string]struct{}
+	// by the hash
+	challenges map[string]domain.TwoFactorChallenge
+	users      domain.UserRepository
+}
+
+func NewTwoFactorRepository(users domain.UserRepository) *TwoFactorRepository {
+	return &TwoFactorRepository{
+		totp:          make(map[string]domain.TOTP),
+		recoveryCodes: make(map[string]map[string]struct{}),
+		challenges:    make(map[string]domain.TwoFactorChallenge),
+		users:         users,
+	}
+}
+
+func (r *TwoFactorRepository) SetTOTPSecret(ctx context.Context, userID, secret string) error {
+	if _, err := r.users.GetUserByID(ctx, userID); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.totp[userID].Enabled() {
+		return domain.ErrTOTPEnabled
+	}
+	r.totp[userID] = domain.TOTP{UserID: userID, Secret: secret}
+	return nil
+}
+
+func (r *TwoFactorRepository) GetTOTP(ctx context.Context, userID string) (domain.TOTP, error) {
+	if _, err := r.users.GetUserByID(ctx, userID); err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			return domain.TOTP{UserID: userID}, domain.ErrTOTPNotFound
+		}
+		return domain.TOTP{UserID: userID}, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.totp[userID]
+	if !ok {
+		return domain.TOTP{UserID: userID}, domain.ErrTOTPNotFound
+	}
+	return t, nil
+}
+
+func (r *TwoFactorRepository) EnableTOTP(ctx context.Context, userID string, at time.Time, recoveryCodeHashes []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.totp[userID]
+	if !ok || t.Enabled() {
+		return domain.ErrTOTPEnabled
+	}
+	at = at.UTC()
+	t.EnabledAt = &at
+	r.totp[userID] = t
+
+	codes := make(map[string]struct{}, len(recoveryCodeHashes))
+	for _, hash := range recoveryCodeHashes {
+		codes[hash] = struct{}{}
+	}
+	r.recoveryCodes[userID] = codes
+	return nil
+}
+
+func (r *TwoFactorRepository) UseTOTPStep(ctx context.Context, userID string, step int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.totp[userID]
+	if !ok || t.LastUsedStep >= step {
+		return domain.ErrTOTPCodeUsed
+	}
+	t.LastUsedStep = step
+	r.totp[userID] = t
+	return nil
+}
+
+func (r *TwoFactorRepository) UseRecoveryCode(ctx context.Context, userID, hash string, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.recoveryCodes[userID][hash]; !ok {
+		return domain.ErrRecoveryCodeNotFound
+	}
+	delete(r.recoveryCodes[userID], hash)
+	return nil
+}
+
+func (r *TwoFactorRepository) CreateTwoFactorChallenge(ctx context.Context, c domain.TwoFactorChallenge) error {
+	if _, err := r.users.GetUserByID(ctx, c.UserID); err != nil {
+		return err
+	}
+
+	c.CreatedAt = c.CreatedAt.UTC()
+	c.ExpiresAt = c.ExpiresAt.UTC()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for hash, other := range r.challenges {
+		if other.UserID == c.UserID && !other.ExpiresAt.After(c.CreatedAt) {
+			delete(r.challenges, hash)
+		}
+	}
+	r.challenges[c.Hash] = c
+	return nil
+}
+
+func (r *TwoFactorRepository) AttemptTwoFactorChallenge(ctx context.Context, hash string, at time.Time, maxAttempts int) (domain.TwoFactorChallenge, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, ok := r.challenges[hash]
+	if !ok || !at.Before(c.ExpiresAt) || c.Attempts >= maxAttempts {
+		return domain.TwoFactorChallenge{Hash: hash}, domain.ErrTwoFactorChallengeNotFound
+	}
+	c.Attempts++
+	r.challenges[hash] = c
+	return c, nil
+}
+
+func (r *TwoFactorRepository) DeleteTwoFactorChallenge(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for hash, c := range r.challenges {
+		if c.ID == id {
+			delete(r.challenges, hash)
+			return nil
+		}
+	}
+	return domain.ErrTwoFactorChallengeNotFound
+}
@@ -0,0 +1,11 @@
+package memory
+
+import "context"
+
+// TxManager only calls fn, the memory storage has no rollback,
+// the writes made before a failure stay.
+type TxManager struct{}
+
+func (TxManager) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
@@ -0,0 +1,200 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+)
+
+// UserRepository keeps the users in the process memory.
+// It's meant for local runs and tests, the data is lost on restart.
+type UserRepository struct {
+	mu    sync.RWMutex
+	users map[string]domain.UserRecord
+
+	now   func() time.Time
+	newID func() string
+}
+
+func NewUserRepository(now func() time.Time, newID func() string) *UserRepository {
+	return &UserRepository{
+		users: make(map[string]domain.UserRecord),
+		now:   now,
+		newID: newID,
+	}
+}
+
+func (r *UserRepository) CreateUser(ctx context.Context, user domain.User) (domain.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.emailTaken(user.Email, "") {
+		return user, domain.ErrEmailTaken
+	}
+	now := r.now().UTC()
+	user.ID = r.newID()
+	r.users[user.ID] = domain.UserRecord{
+		User:      user,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	return user, nil
+}
+
+func (r *UserRepository) GetUserByID(ctx context.Context, id string) (domain.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	rec, ok := r.users[id]
+	if !ok || rec.DeletedAt != nil {
+		return domain.User{}, domain.ErrUserNotFound
+	}
+
+	return rec.User, nil
+}
+
+func (r *UserRepository) UpdateUser(ctx context.Context, user domain.User) (domain.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rec, ok := r.users[user.ID]
+	if !ok {
+		return user, domain.ErrUserNotFound
+	}
+	if r.emailTaken(user.Email, user.ID) {
+		return user, domain.ErrEmailTaken
+	}
+	if rec.Email != user.Email {
+		rec.EmailVerifiedAt = nil
+	}
+	rec.Username = user.Username
+	rec.Email = user.Email
+	rec.UpdatedAt = r.now().UTC()
+	r.users[user.ID] = rec
+
+	user.EmailVerifiedAt = rec.EmailVerifiedAt
+	return user, nil
+}
+
+func (r *UserRepository) UpdateUsername(ctx context.Context, id, username string) (domain.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rec, ok := r.users[id]
+	if !ok {
+		return domain.User{ID: id, Username: username}, domain.ErrUserNotFound
+	}
+	rec.Username = username
+	rec.UpdatedAt = r.now().UTC()
+	r.users[id] = rec
+
+	return rec.User, nil
+}
+
+func (r *UserRepository) DeleteUser(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rec, ok := r.users[id]
+	if !ok {
+		return domain.ErrUserNotFound
+	}
+	now := r.now().UTC()
+	rec.DeletedAt = &now
+	r.users[id] = rec
+
+	return nil
+}
+
+func (r *UserRepository) RestoreUser(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rec, ok := r.users[id]
+	if !ok || rec.DeletedAt == nil {
+		return domain.ErrUserNotFound
+	}
+	if r.emailTaken(rec.Email, id) {
+		return domain.ErrEmailTaken
+	}
+	rec.DeletedAt = nil
+	rec.UpdatedAt = r.now().UTC()
+	r.users[id] = rec
+
+	return nil
+}
+
+func (r *UserRepository) VerifyEmail(ctx context.Context, id, email string, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rec, ok := r.users[id]
+	if !ok || rec.DeletedAt != nil || rec.Email == "" || rec.Email != email {
+		return domain.ErrUserNotFound
+	}
+	if rec.EmailVerifiedAt == nil {
+		at = at.UTC()
+		rec.EmailVerifiedAt = &at
+		r.users[id] = rec
+	}
+
+	return nil
+}
+
+// emailTaken tells whether a not deleted user other than the one with the id has the email.
+func (r *UserRepository) emailTaken(email, id string) bool {
+	if email == "" {
+		return false
+	}
+	for _, rec := range r.users {
+		if rec.Email == email && rec.ID != id && rec.DeletedAt == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// ListUsers returns the page of not deleted users, the newest first.
+func (r *UserRepository) ListUsers(ctx context.Context, filter domain.UserFilter) ([]domain.User, int, error) {
+	r.mu.RLock()
+	records := make([]domain.UserRecord, 0, len(r.users))
+	for _, rec := range r.users {
+		if rec.DeletedAt == nil {
+			records = append(records, rec)
+		}
+	}
+	r.mu.RUnlock()
+
+	slices.SortFunc(records, func(a, b domain.UserRecord) int {
+		if c := b.CreatedAt.Compare(a.CreatedAt); c != 0 {
+			return c
+		}
+		// the map iteration order is random, make the ties stable
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	var users []domain.User
+	for i := filter.Offset; i < len(records) && i < filter.Offset+filter.Limit; i++ {
+		users = append(users, records[i].User)
+	}
+	return users, len(records), nil
+}
+
+// SeedUsers inserts the records as is or overwrites the existing ones with the same id.
+func (r *UserRepository) SeedUsers(ctx context.Context, records []domain.UserRecord) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, rec := range records {
+		rec.CreatedAt = rec.CreatedAt.UTC()
+		rec.UpdatedAt = rec.UpdatedAt.UTC()
+		r.users[rec.ID] = rec
+	}
+
+	return nil
+}
@@ -0,0 +1,91 @@
+package memory_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/repository/memory"
+	"github.com/dennypenta/go-api-walkthrough/repository/repotest"
+	"github.com/google/uuid"
+)
+
+func TestUserRepository(t *testing.T) {
+	t.Parallel()
+
+	repotest.TestUserRepository(t, func(t *testing.T) repotest.UserRepository {
+		return memory.NewUserRepository(time.Now, uuid.NewString)
+	})
+}
+
+func TestCredentialRepository(t *testing.T) {
+	t.Parallel()
+
+	repotest.TestCredentialRepository(t, func(t *testing.T) (repotest.UserRepository, domain.CredentialRepository) {
+		users := memory.NewUserRepository(time.Now, uuid.NewString)
+		return users, memory.NewCredentialRepository(users)
+	})
+}
+
+func TestRefreshTokenRepository(t *testing.T) {
+	t.Parallel()
+
+	repotest.TestRefreshTokenRepository(t, func(t *testing.T) (repotest.UserRepository, domain.SessionRepository, domain.RefreshTokenRepository) {
+		users := memory.NewUserRepository(time.Now, uuid.NewString)
+		sessions := memory.NewSessionRepository(users)
+		return users, sessions, memory.NewRefreshTokenRepository(users, sessions)
+	})
+}
+
+func TestSessionRepository(t *testing.T) {
+	t.Parallel()
+
+	repotest.TestSessionRepository(t, func(t *testing.T) (repotest.UserRepository, domain.SessionRepository) {
+		users := memory.NewUserRepository(time.Now, uuid.NewString)
+		return users, memory.NewSessionRepository(users)
+	})
+}
+
+func TestTwoFactorRepository(t *testing.T) {
+	t.Parallel()
+
+	repotest.TestTwoFactorRepository(t, func(t *testing.T) (repotest.UserRepository, domain.TwoFactorRepository) {
+		users := memory.NewUserRepository(time.Now, uuid.NewString)
+		return users, memory.NewTwoFactorRepository(users)
+	})
+}
+
+func TestEmailVerificationRepository(t *testing.T) {
+	t.Parallel()
+
+	repotest.TestEmailVerificationRepository(t, func(t *testing.T) (repotest.UserRepository, domain.EmailVerificationRepository) {
+		users := memory.NewUserRepository(time.Now, uuid.NewString)
+		return users, memory.NewEmailVerificationRepository(users)
+	})
+}
+
+func TestPasswordResetRepository(t *testing.T) {
+	t.Parallel()
+
+	repotest.TestPasswordResetRepository(t, func(t *testing.T) (repotest.UserRepository, domain.PasswordResetRepository) {
+		users := memory.NewUserRepository(time.Now, uuid.NewString)
+		return users, memory.NewPasswordResetRepository(users)
+	})
+}
+
+func TestAPIKeyRepository(t *testing.T) {
+	t.Parallel()
+
+	repotest.TestAPIKeyRepository(t, func(t *testing.T) domain.APIKeyRepository {
+		return memory.NewAPIKeyRepository()
+	})
+}
+
+func TestRoleRepository(t *testing.T) {
+	t.Parallel()
+
+	repotest.TestRoleRepository(t, func(t *testing.T) (repotest.UserRepository, domain.RoleRepository) {
+		users := memory.NewUserRepository(time.Now, uuid.NewString)
+		return users, memory.NewRoleRepository(users)
+	})
+}
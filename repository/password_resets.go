@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/jmoiron/sqlx"
+)
+
+type PasswordResetRepository struct {
+	db *sqlx.DB
+	sq sq.StatementBuilderType
+}
+
+func NewPasswordResetRepository(db *sqlx.DB) *PasswordResetRepository {
+	return &PasswordResetRepository{
+		db: db,
+		sq: sq.StatementBuilder.PlaceholderFormat(sq.Dollar),
+	}
+}
+
+// NewSQLitePasswordResetRepository works with the schema of migrations.SQLiteFS.
+func NewSQLitePasswordResetRepository(db *sqlx.DB) *PasswordResetRepository {
+	return &PasswordResetRepository{
+		db: db,
+		sq: sq.StatementBuilder.PlaceholderFormat(sq.Question),
+	}
+}
+
+func (r *PasswordResetRepository) CreatePasswordReset(ctx context.Context, reset domain.PasswordReset) error {
+	query, args, err := r.sq.Insert("password_resets").
+		Columns("id", "user_id", "login", "token_hash", "createdAt", "expiresAt").
+		Values(reset.ID, reset.UserID, reset.Login, reset.Hash, reset.CreatedAt.UTC(), reset.ExpiresAt.UTC()).
+		Suffix(`ON CONFLICT (user_id) DO UPDATE SET
+			id = EXCLUDED.id,
+			login = EXCLUDED.login,
+			token_hash = EXCLUDED.token_hash,
+			createdAt = EXCLUDED.createdAt,
+			expiresAt = EXCLUDED.expiresAt`).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("CreatePasswordReset: failed to build query: %w", err)
+	}
+	if _, err := connFrom(ctx, r.db).ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("CreatePasswordReset: failed to upsert reset: %w", err)
+	}
+
+	return nil
+}
+
+func (r *PasswordResetRepository) GetPasswordReset(ctx context.Context, hash string) (domain.PasswordReset, error) {
+	reset := domain.PasswordReset{Hash: hash}
+	query, args, err := r.sq.Select("r.id", "r.user_id", "r.login", "r.createdAt", "r.expiresAt").
+		From("password_resets r").
+		Join("users u ON u.id = r.user_id").
+		Where(sq.Eq{"r.token_hash": hash, "u.deletedAt": nil}).
+		ToSql()
+	if err != nil {
+		return reset, fmt.Errorf("GetPasswordReset: failed to build query: %w", err)
+	}
+
+	err = connFrom(ctx, r.db).QueryRowxContext(ctx, query, args...).
+		Scan(&reset.ID, &reset.UserID, &reset.Login, &reset.CreatedAt, &reset.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return reset, domain.ErrPasswordResetNotFound
+		}
+		return reset, fmt.Errorf("GetPasswordReset: failed to get reset: %w", err)
+	}
+	reset.CreatedAt = reset.CreatedAt.UTC()
+	reset.ExpiresAt = reset.ExpiresAt.UTC()
+
+	return reset, nil
+}
+
+func (r *PasswordResetRepository) GetUserPasswordReset(ctx context.Context, userID string) (domain.PasswordReset, error) {
+	reset := domain.PasswordReset{UserID: userID}
+	query, args, err := r.sq.Select("id", "login", "token_hash", "createdAt", "expiresAt").
+		From("password_resets").
+		Where(sq.Eq{"user_id": userID}).
+		ToSql()
+	if err != nil {
+		return reset, fmt.Errorf("GetUserPasswordReset: failed to build query: %w", err)
+	}
+
+	err = connFrom(ctx, r.db).QueryRowxContext(ctx, query, args...).
+		Scan(&reset.ID, &reset.Login, &reset.Hash, &reset.CreatedAt, &reset.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return reset, domain.ErrPasswordResetNotFound
+		}
+		return reset, fmt.Errorf("GetUserPasswordReset: failed to get reset: %w", err)
+	}
+	reset.CreatedAt = reset.CreatedAt.UTC()
+	reset.ExpiresAt = reset.ExpiresAt.UTC()
+
+	return reset, nil
+}
+
+func (r *PasswordResetRepository) UsePasswordReset(ctx context.Context, id string) error {
+	query, args, err := r.sq.Delete("password_resets").
+		Where(sq.Eq{"id": id}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("UsePasswordReset: failed to build query: %w", err)
+	}
+
+	res, err := connFrom(ctx, r.db).ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("UsePasswordReset: failed to delete reset: %w", err)
+	}
+	affectedAmount, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("UsePasswordReset: failed to get RowsAffected: %w", err)
+	}
+	if affectedAmount == 0 {
+		return domain.ErrPasswordResetNotFound
+	}
+
+	return nil
+}
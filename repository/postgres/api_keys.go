@@ -0,0 +1,139 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	createAPIKeyQuery = `INSERT INTO api_keys (id, name, prefix, key_hash, scopes, createdAt, expiresAt, lastUsedAt)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+
+	getAPIKeyByPrefixQuery = `SELECT id, name, prefix, key_hash, scopes, createdAt, expiresAt, lastUsedAt
+		FROM api_keys
+		WHERE prefix = $1 AND revokedAt IS NULL`
+
+	listAPIKeysQuery = `SELECT id, name, prefix, key_hash, scopes, createdAt, expiresAt, lastUsedAt
+		FROM api_keys
+		WHERE revokedAt IS NULL
+		ORDER BY createdAt DESC, id`
+
+	revokeAPIKeyQuery = `UPDATE api_keys SET revokedAt = now() WHERE id = $1 AND revokedAt IS NULL`
+
+	touchAPIKeyQuery = `UPDATE api_keys SET lastUsedAt = $2 WHERE id = $1`
+)
+
+type APIKeyRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewAPIKeyRepository(pool *pgxpool.Pool) *APIKeyRepository {
+	return &APIKeyRepository{
+		pool: pool,
+	}
+}
+
+func (r *APIKeyRepository) CreateAPIKey(ctx context.Context, k domain.APIKey) error {
+	id, ok := parseUUID(k.ID)
+	if !ok {
+		return fmt.Errorf("CreateAPIKey: invalid id %q", k.ID)
+	}
+
+	_, err := connFrom(ctx, r.pool).Exec(ctx, createAPIKeyQuery, id, k.Name, k.Prefix, k.Hash, strings.Join(k.Scopes, " "),
+		timestamp(&k.CreatedAt), timestamp(k.ExpiresAt), timestamp(k.LastUsedAt))
+	if err != nil {
+		return fmt.Errorf("CreateAPIKey: failed to insert api key: %w", err)
+	}
+
+	return nil
+}
+
+func (r *APIKeyRepository) GetAPIKeyByPrefix(ctx context.Context, prefix string) (domain.APIKey, error) {
+	k, err := scanAPIKey(connFrom(ctx, r.pool).QueryRow(ctx, getAPIKeyByPrefixQuery, prefix))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return k, domain.ErrAPIKeyNotFound
+		}
+		return k, fmt.Errorf("GetAPIKeyByPrefix: failed to get api key: %w", err)
+	}
+
+	return k, nil
+}
+
+func (r *APIKeyRepository) ListAPIKeys(ctx context.Context) ([]domain.APIKey, error) {
+	rows, err := connFrom(ctx, r.pool).Query(ctx, listAPIKeysQuery)
+	if err != nil {
+		return nil, fmt.Errorf("ListAPIKeys: failed to select api keys: %w", err)
+	}
+	keys, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (domain.APIKey, error) {
+		return scanAPIKey(row)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ListAPIKeys: failed to scan api keys: %w", err)
+	}
+
+	return keys, nil
+}
+
+func (r *APIKeyRepository) RevokeAPIKey(ctx context.Context, id string) error {
+	pgID, ok := parseUUID(id)
+	if !ok {
+		return domain.ErrAPIKeyNotFound
+	}
+
+	tag, err := connFrom(ctx, r.pool).Exec(ctx, revokeAPIKeyQuery, pgID)
+	if err != nil {
+		return fmt.Errorf("RevokeAPIKey: failed to update api key: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrAPIKeyNotFound
+	}
+
+	return nil
+}
+
+func (r *APIKeyRepository) TouchAPIKey(ctx context.Context, id string, at time.Time) error {
+	pgID, ok := parseUUID(id)
+	if !ok {
+		return nil
+	}
+
+	if _, err := connFrom(ctx, r.pool).Exec(ctx, touchAPIKeyQuery, pgID, timestamp(&at)); err != nil {
+		return fmt.Errorf("TouchAPIKey: failed to update api key: %w", err)
+	}
+
+	return nil
+}
+
+func scanAPIKey(row pgx.Row) (domain.APIKey, error) {
+	var k domain.APIKey
+	var id pgtype.UUID
+	var scopes string
+	var createdAt, expiresAt, lastUsedAt pgtype.Timestamp
+	if err := row.Scan(&id, &k.Name, &k.Prefix, &k.Hash, &scopes, &createdAt, &expiresAt, &lastUsedAt); err != nil {
+		return k, err
+	}
+	k.ID = uuidString(id)
+	k.Scopes = strings.Fields(scopes)
+	k.CreatedAt = createdAt.Time.UTC()
+	k.ExpiresAt = timeOf(expiresAt)
+	k.LastUsedAt = timeOf(lastUsedAt)
+	return k, nil
+}
+
+// timeOf is the reverse of timestamp, NULL is nil.
+func timeOf(t pgtype.Timestamp) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	utc := t.Time.UTC()
+	return &utc
+}
@@ -0,0 +1,89 @@
+//go:build integration
+
+package postgres_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/repository"
+	"github.com/dennypenta/go-api-walkthrough/repository/postgres"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+// The benchmarks compare the database/sql repository building the queries with squirrel (before)
+// to the native pool with the static queries (after), run them with
+//
+//	go test -tags integration -run '^$' -bench . -benchmem ./repository/postgres
+func benchRepositories(b *testing.B) map[string]domain.UserRepository {
+	b.Helper()
+
+	dsn := template.New(b)
+	db, err := sqlx.Connect("pgx", dsn)
+	require.NoError(b, err)
+	b.Cleanup(func() {
+		db.Close()
+	})
+
+	records := make([]domain.UserRecord, 0, 100)
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < cap(records); i++ {
+		createdAt := base.Add(time.Duration(i) * time.Second)
+		records = append(records, domain.UserRecord{
+			User:      domain.User{ID: uuid.NewString(), Username: fmt.Sprintf("user-%d", i)},
+			CreatedAt: createdAt,
+			UpdatedAt: createdAt,
+		})
+	}
+	require.NoError(b, repository.NewUserRepository(db).SeedUsers(context.Background(), records))
+
+	return map[string]domain.UserRepository{
+		"sqlx+squirrel":        repository.NewUserRepository(db),
+		"pgxpool":              postgres.NewUserRepository(newPool(b, dsn, pgx.QueryExecModeCacheStatement)),
+		"pgxpool simple proto": postgres.NewUserRepository(newPool(b, dsn, pgx.QueryExecModeSimpleProtocol)),
+	}
+}
+
+func BenchmarkGetUserByID(b *testing.B) {
+	repos := benchRepositories(b)
+	ctx := context.Background()
+
+	for name, repo := range repos {
+		users, _, err := repo.ListUsers(ctx, domain.UserFilter{Limit: 1})
+		require.NoError(b, err)
+		id := users[0].ID
+
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := repo.GetUserByID(ctx, id); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkListUsers(b *testing.B) {
+	repos := benchRepositories(b)
+	ctx := context.Background()
+	filter := domain.UserFilter{Limit: 20, Offset: 40}
+
+	for name, repo := range repos {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, _, err := repo.ListUsers(ctx, filter); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
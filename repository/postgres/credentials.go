@@ -0,0 +1,105 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// https://www.postgresql.org/docs/current/errcodes-appendix.html
+const pgUniqueViolation = "23505"
+
+// isUniqueViolation reports whether the statement broke a unique index.
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation
+}
+
+const (
+	// the credentials are inserted only if the user isn't deleted, no row means there is no such user
+	setCredentialsQuery = `INSERT INTO user_credentials (user_id, login, password_hash)
+		SELECT id, $2, $3 FROM users WHERE id = $1 AND deletedAt IS NULL
+		ON CONFLICT (user_id) DO UPDATE SET
+			login = EXCLUDED.login,
+			password_hash = EXCLUDED.password_hash,
+			updatedAt = now()`
+
+	getCredentialsByLoginQuery = `SELECT c.user_id, c.password_hash
+		FROM user_credentials c
+		JOIN users u ON u.id = c.user_id
+		WHERE c.login = $1 AND u.deletedAt IS NULL`
+
+	getCredentialsQuery = `SELECT c.login, c.password_hash
+		FROM user_credentials c
+		JOIN users u ON u.id = c.user_id
+		WHERE c.user_id = $1 AND u.deletedAt IS NULL`
+)
+
+type CredentialRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewCredentialRepository(pool *pgxpool.Pool) *CredentialRepository {
+	return &CredentialRepository{
+		pool: pool,
+	}
+}
+
+func (r *CredentialRepository) SetCredentials(ctx context.Context, c domain.Credentials) error {
+	id, ok := parseUUID(c.UserID)
+	if !ok {
+		return domain.ErrUserNotFound
+	}
+
+	tag, err := connFrom(ctx, r.pool).Exec(ctx, setCredentialsQuery, id, c.Login, c.PasswordHash)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return domain.ErrLoginTaken
+		}
+		return fmt.Errorf("SetCredentials: failed to upsert credentials: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrUserNotFound
+	}
+
+	return nil
+}
+
+func (r *CredentialRepository) GetCredentialsByLogin(ctx context.Context, login string) (domain.Credentials, error) {
+	c := domain.Credentials{Login: login}
+	var id pgtype.UUID
+	err := connFrom(ctx, r.pool).QueryRow(ctx, getCredentialsByLoginQuery, login).Scan(&id, &c.PasswordHash)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return c, domain.ErrCredentialsNotFound
+		}
+		return c, fmt.Errorf("GetCredentialsByLogin: failed to get credentials: %w", err)
+	}
+
+	c.UserID = uuidString(id)
+	return c, nil
+}
+
+func (r *CredentialRepository) GetCredentials(ctx context.Context, userID string) (domain.Credentials, error) {
+	c := domain.Credentials{UserID: userID}
+	id, ok := parseUUID(userID)
+	if !ok {
+		return c, domain.ErrCredentialsNotFound
+	}
+
+	err := connFrom(ctx, r.pool).QueryRow(ctx, getCredentialsQuery, id).Scan(&c.Login, &c.PasswordHash)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return c, domain.ErrCredentialsNotFound
+		}
+		return c, fmt.Errorf("GetCredentials: failed to get credentials: %w", err)
+	}
+
+	return c, nil
+}
@@ -0,0 +1,107 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	deleteExpiredEmailVerificationsQuery = `DELETE FROM email_verifications WHERE user_id = $1 AND expiresAt <= $2`
+
+	createEmailVerificationQuery = `INSERT INTO email_verifications (id, user_id, email, token_hash, createdAt, expiresAt)
+		VALUES ($1, $2, $3, $4, $5, $6)`
+
+	recentEmailVerificationsQuery = `SELECT createdAt FROM email_verifications
+		WHERE user_id = $1 AND createdAt > $2
+		ORDER BY createdAt`
+
+	consumeEmailVerificationQuery = `DELETE FROM email_verifications
+		WHERE token_hash = $1 AND expiresAt > $2
+		RETURNING id, user_id, email, createdAt, expiresAt`
+)
+
+type EmailVerificationRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewEmailVerificationRepository(pool *pgxpool.Pool) *EmailVerificationRepository {
+	return &EmailVerificationRepository{
+		pool: pool,
+	}
+}
+
+func (r *EmailVerificationRepository) CreateEmailVerification(ctx context.Context, v domain.EmailVerification) error {
+	id, ok := parseUUID(v.ID)
+	if !ok {
+		return fmt.Errorf("CreateEmailVerification: invalid id %q", v.ID)
+	}
+	userID, ok := parseUUID(v.UserID)
+	if !ok {
+		return domain.ErrUserNotFound
+	}
+
+	if _, err := connFrom(ctx, r.pool).Exec(ctx, deleteExpiredEmailVerificationsQuery, userID, timestamp(&v.CreatedAt)); err != nil {
+		return fmt.Errorf("CreateEmailVerification: failed to delete expired verifications: %w", err)
+	}
+	_, err := connFrom(ctx, r.pool).Exec(ctx, createEmailVerificationQuery, id, userID, v.Email, v.Hash,
+		timestamp(&v.CreatedAt), timestamp(&v.ExpiresAt))
+	if err != nil {
+		return fmt.Errorf("CreateEmailVerification: failed to insert verification: %w", err)
+	}
+
+	return nil
+}
+
+func (r *EmailVerificationRepository) RecentEmailVerifications(ctx context.Context, userID string, since time.Time) ([]time.Time, error) {
+	id, ok := parseUUID(userID)
+	if !ok {
+		return nil, nil
+	}
+
+	rows, err := connFrom(ctx, r.pool).Query(ctx, recentEmailVerificationsQuery, id, timestamp(&since))
+	if err != nil {
+		return nil, fmt.Errorf("RecentEmailVerifications: failed to list verifications: %w", err)
+	}
+	defer rows.Close()
+
+	var times []time.Time
+	for rows.Next() {
+		var t pgtype.Timestamp
+		if err := rows.Scan(&t); err != nil {
+			return nil, fmt.Errorf("RecentEmailVerifications: failed to scan verification: %w", err)
+		}
+		times = append(times, t.Time.UTC())
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("RecentEmailVerifications: failed to list verifications: %w", err)
+	}
+
+	return times, nil
+}
+
+func (r *EmailVerificationRepository) ConsumeEmailVerification(ctx context.Context, hash string, at time.Time) (domain.EmailVerification, error) {
+	v := domain.EmailVerification{Hash: hash}
+	var id, userID pgtype.UUID
+	var createdAt, expiresAt pgtype.Timestamp
+	err := connFrom(ctx, r.pool).QueryRow(ctx, consumeEmailVerificationQuery, hash, timestamp(&at)).
+		Scan(&id, &userID, &v.Email, &createdAt, &expiresAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return v, domain.ErrEmailVerificationNotFound
+		}
+		return v, fmt.Errorf("ConsumeEmailVerification: failed to delete verification: %w", err)
+	}
+	v.ID = uuidString(id)
+	v.UserID = uuidString(userID)
+	v.CreatedAt = createdAt.Time.UTC()
+	v.ExpiresAt = expiresAt.Time.UTC()
+
+	return v, nil
+}
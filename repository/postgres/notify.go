@@ -0,0 +1,80 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// invalidationChannel carries the ids of the changed users between the replicas.
+const invalidationChannel = "users_invalidated"
+
+// Notifier spreads the cache invalidations over the replicas with LISTEN/NOTIFY.
+// LISTEN needs a session, it doesn't work through PgBouncer in the transaction pooling mode.
+type Notifier struct {
+	pool           *pgxpool.Pool
+	log            *slog.Logger
+	reconnectDelay time.Duration
+}
+
+func NewNotifier(pool *pgxpool.Pool, reconnectDelay time.Duration, l *slog.Logger) *Notifier {
+	return &Notifier{
+		pool:           pool,
+		log:            l,
+		reconnectDelay: reconnectDelay,
+	}
+}
+
+// Invalidate notifies all the listeners including this replica.
+// Within WithinTx the notification is delivered on commit and dropped on rollback.
+func (n *Notifier) Invalidate(ctx context.Context, id string) error {
+	if _, err := connFrom(ctx, n.pool).Exec(ctx, "SELECT pg_notify($1, $2)", invalidationChannel, id); err != nil {
+		return fmt.Errorf("Invalidate: failed to notify: %w", err)
+	}
+	return nil
+}
+
+// Listen calls onInvalidate with every id notified until ctx is done.
+// A broken connection is reestablished, the notifications sent meanwhile are lost,
+// so onSubscribe is called on every subscription to drop everything cached.
+func (n *Notifier) Listen(ctx context.Context, onInvalidate func(id string), onSubscribe func()) error {
+	for {
+		err := n.listen(ctx, onInvalidate, onSubscribe)
+		if ctx.Err() != nil {
+			return nil
+		}
+		n.log.WarnContext(ctx, "invalidation listener failed, reconnecting", "err", err, "delay", n.reconnectDelay.String())
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(n.reconnectDelay):
+		}
+	}
+}
+
+func (n *Notifier) listen(ctx context.Context, onInvalidate func(id string), onSubscribe func()) error {
+	pooled, err := n.pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	// the session keeps listening, it must not go back to the pool
+	conn := pooled.Hijack()
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+invalidationChannel); err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+	onSubscribe()
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		onInvalidate(notification.Payload)
+	}
+}
@@ -0,0 +1,44 @@
+//go:build integration
+
+package postgres_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/pkg/log"
+	"github.com/dennypenta/go-api-walkthrough/repository/postgres"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotifier(t *testing.T) {
+	t.Parallel()
+
+	pool := newPool(t, template.New(t), pgx.QueryExecModeCacheStatement)
+	notifier := postgres.NewNotifier(pool, 10*time.Millisecond, log.NewLogger(io.Discard, slog.LevelInfo))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	subscribed := make(chan struct{}, 1)
+	invalidated := make(chan string, 1)
+	go notifier.Listen(ctx, func(id string) { invalidated <- id }, func() { subscribed <- struct{}{} })
+
+	select {
+	case <-subscribed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("listener hasn't subscribed")
+	}
+	require.NoError(t, notifier.Invalidate(ctx, "8da80ba8-81c6-4336-bba3-ba8ea50541b0"))
+
+	select {
+	case id := <-invalidated:
+		assert.Equal(t, "8da80ba8-81c6-4336-bba3-ba8ea50541b0", id)
+	case <-time.After(5 * time.Second):
+		t.Fatal("invalidation hasn't been delivered")
+	}
+}
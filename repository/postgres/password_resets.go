@@ -0,0 +1,123 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	createPasswordResetQuery = `INSERT INTO password_resets (id, user_id, login, token_hash, createdAt, expiresAt)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (user_id) DO UPDATE SET
+			id = EXCLUDED.id,
+			login = EXCLUDED.login,
+			token_hash = EXCLUDED.token_hash,
+			createdAt = EXCLUDED.createdAt,
+			expiresAt = EXCLUDED.expiresAt`
+
+	getPasswordResetQuery = `SELECT r.id, r.user_id, r.login, r.createdAt, r.expiresAt
+		FROM password_resets r
+		JOIN users u ON u.id = r.user_id
+		WHERE r.token_hash = $1 AND u.deletedAt IS NULL`
+
+	getUserPasswordResetQuery = `SELECT id, login, token_hash, createdAt, expiresAt
+		FROM password_resets WHERE user_id = $1`
+
+	usePasswordResetQuery = `DELETE FROM password_resets WHERE id = $1`
+)
+
+type PasswordResetRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewPasswordResetRepository(pool *pgxpool.Pool) *PasswordResetRepository {
+	return &PasswordResetRepository{
+		pool: pool,
+	}
+}
+
+func (r *PasswordResetRepository) CreatePasswordReset(ctx context.Context, reset domain.PasswordReset) error {
+	id, ok := parseUUID(reset.ID)
+	if !ok {
+		return fmt.Errorf("CreatePasswordReset: invalid id %q", reset.ID)
+	}
+	userID, ok := parseUUID(reset.UserID)
+	if !ok {
+		return domain.ErrUserNotFound
+	}
+
+	_, err := connFrom(ctx, r.pool).Exec(ctx, createPasswordResetQuery, id, userID, reset.Login, reset.Hash,
+		timestamp(&reset.CreatedAt), timestamp(&reset.ExpiresAt))
+	if err != nil {
+		return fmt.Errorf("CreatePasswordReset: failed to upsert reset: %w", err)
+	}
+
+	return nil
+}
+
+func (r *PasswordResetRepository) GetPasswordReset(ctx context.Context, hash string) (domain.PasswordReset, error) {
+	reset := domain.PasswordReset{Hash: hash}
+	var id, userID pgtype.UUID
+	var createdAt, expiresAt pgtype.Timestamp
+	err := connFrom(ctx, r.pool).QueryRow(ctx, getPasswordResetQuery, hash).
+		Scan(&id, &userID, &reset.Login, &createdAt, &expiresAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return reset, domain.ErrPasswordResetNotFound
+		}
+		return reset, fmt.Errorf("GetPasswordReset: failed to get reset: %w", err)
+	}
+	reset.ID = uuidString(id)
+	reset.UserID = uuidString(userID)
+	reset.CreatedAt = createdAt.Time.UTC()
+	reset.ExpiresAt = expiresAt.Time.UTC()
+
+	return reset, nil
+}
+
+func (r *PasswordResetRepository) GetUserPasswordReset(ctx context.Context, userID string) (domain.PasswordReset, error) {
+	reset := domain.PasswordReset{UserID: userID}
+	uid, ok := parseUUID(userID)
+	if !ok {
+		return reset, domain.ErrPasswordResetNotFound
+	}
+
+	var id pgtype.UUID
+	var createdAt, expiresAt pgtype.Timestamp
+	err := connFrom(ctx, r.pool).QueryRow(ctx, getUserPasswordResetQuery, uid).
+		Scan(&id, &reset.Login, &reset.Hash, &createdAt, &expiresAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return reset, domain.ErrPasswordResetNotFound
+		}
+		return reset, fmt.Errorf("GetUserPasswordReset: failed to get reset: %w", err)
+	}
+	reset.ID = uuidString(id)
+	reset.CreatedAt = createdAt.Time.UTC()
+	reset.ExpiresAt = expiresAt.Time.UTC()
+
+	return reset, nil
+}
+
+func (r *PasswordResetRepository) UsePasswordReset(ctx context.Context, id string) error {
+	resetID, ok := parseUUID(id)
+	if !ok {
+		return domain.ErrPasswordResetNotFound
+	}
+
+	tag, err := connFrom(ctx, r.pool).Exec(ctx, usePasswordResetQuery, resetID)
+	if err != nil {
+		return fmt.Errorf("UsePasswordReset: failed to delete reset: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrPasswordResetNotFound
+	}
+
+	return nil
+}
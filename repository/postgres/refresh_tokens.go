@@ -0,0 +1,97 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	createRefreshTokenQuery = `INSERT INTO refresh_tokens (id, session_id, user_id, token_hash, expiresAt)
+		VALUES ($1, $2, $3, $4, $5)`
+
+	getRefreshTokenQuery = `SELECT t.id, t.session_id, t.user_id, t.expiresAt, t.usedAt IS NOT NULL, s.revokedAt IS NOT NULL
+		FROM refresh_tokens t
+		JOIN sessions s ON s.id = t.session_id
+		JOIN users u ON u.id = t.user_id
+		WHERE t.token_hash = $1 AND u.deletedAt IS NULL`
+
+	// no row means the token is used or its session is revoked, another exchange has won
+	useRefreshTokenQuery = `UPDATE refresh_tokens t SET usedAt = now()
+		FROM sessions s
+		WHERE t.id = $1 AND t.usedAt IS NULL AND s.id = t.session_id AND s.revokedAt IS NULL`
+)
+
+type RefreshTokenRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewRefreshTokenRepository(pool *pgxpool.Pool) *RefreshTokenRepository {
+	return &RefreshTokenRepository{
+		pool: pool,
+	}
+}
+
+func (r *RefreshTokenRepository) CreateRefreshToken(ctx context.Context, t domain.RefreshToken) error {
+	id, ok := parseUUID(t.ID)
+	if !ok {
+		return fmt.Errorf("CreateRefreshToken: invalid id %q", t.ID)
+	}
+	sessionID, ok := parseUUID(t.SessionID)
+	if !ok {
+		return fmt.Errorf("CreateRefreshToken: invalid session id %q", t.SessionID)
+	}
+	userID, ok := parseUUID(t.UserID)
+	if !ok {
+		return domain.ErrUserNotFound
+	}
+
+	_, err := connFrom(ctx, r.pool).Exec(ctx, createRefreshTokenQuery, id, sessionID, userID, t.Hash, timestamp(&t.ExpiresAt))
+	if err != nil {
+		return fmt.Errorf("CreateRefreshToken: failed to insert refresh token: %w", err)
+	}
+
+	return nil
+}
+
+func (r *RefreshTokenRepository) GetRefreshToken(ctx context.Context, hash string) (domain.RefreshToken, error) {
+	t := domain.RefreshToken{Hash: hash}
+	var id, sessionID, userID pgtype.UUID
+	var expiresAt pgtype.Timestamp
+	err := connFrom(ctx, r.pool).QueryRow(ctx, getRefreshTokenQuery, hash).
+		Scan(&id, &sessionID, &userID, &expiresAt, &t.Used, &t.Revoked)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return t, domain.ErrRefreshTokenNotFound
+		}
+		return t, fmt.Errorf("GetRefreshToken: failed to get refresh token: %w", err)
+	}
+
+	t.ID = uuidString(id)
+	t.SessionID = uuidString(sessionID)
+	t.UserID = uuidString(userID)
+	t.ExpiresAt = expiresAt.Time.UTC()
+	return t, nil
+}
+
+func (r *RefreshTokenRepository) UseRefreshToken(ctx context.Context, id string) error {
+	pgID, ok := parseUUID(id)
+	if !ok {
+		return domain.ErrRefreshTokenReused
+	}
+
+	tag, err := connFrom(ctx, r.pool).Exec(ctx, useRefreshTokenQuery, pgID)
+	if err != nil {
+		return fmt.Errorf("UseRefreshToken: failed to update refresh token: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrRefreshTokenReused
+	}
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	getRolesQuery = `SELECT role FROM user_roles WHERE user_id = $1 ORDER BY role`
+
+	deleteRolesQuery = `DELETE FROM user_roles WHERE user_id = $1`
+
+	// the roles are inserted only if the user isn't deleted, no row means there is no such user
+	insertRolesQuery = `INSERT INTO user_roles (user_id, role)
+		SELECT u.id, r.role FROM users u, unnest($2::text[]) AS r(role)
+		WHERE u.id = $1 AND u.deletedAt IS NULL`
+)
+
+type RoleRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewRoleRepository(pool *pgxpool.Pool) *RoleRepository {
+	return &RoleRepository{
+		pool: pool,
+	}
+}
+
+func (r *RoleRepository) GetRoles(ctx context.Context, userID string) ([]string, error) {
+	id, ok := parseUUID(userID)
+	if !ok {
+		return []string{}, nil
+	}
+
+	rows, err := connFrom(ctx, r.pool).Query(ctx, getRolesQuery, id)
+	if err != nil {
+		return nil, fmt.Errorf("GetRoles: failed to select roles: %w", err)
+	}
+	roles, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("GetRoles: failed to scan roles: %w", err)
+	}
+
+	return roles, nil
+}
+
+// SetRoles must run in a transaction, the roles are deleted and inserted again.
+func (r *RoleRepository) SetRoles(ctx context.Context, userID string, roles []string) error {
+	id, ok := parseUUID(userID)
+	if !ok {
+		return domain.ErrUserNotFound
+	}
+
+	conn := connFrom(ctx, r.pool)
+	if _, err := conn.Exec(ctx, deleteRolesQuery, id); err != nil {
+		return fmt.Errorf("SetRoles: failed to delete roles: %w", err)
+	}
+	tag, err := conn.Exec(ctx, insertRolesQuery, id, roles)
+	if err != nil {
+		return fmt.Errorf("SetRoles: failed to insert roles: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrUserNotFound
+	}
+
+	return nil
+}
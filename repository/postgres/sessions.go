@@ -0,0 +1,172 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	createSessionQuery = `INSERT INTO sessions (id, user_id, device, user_agent, ip, createdAt, lastSeenAt)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+	touchSessionQuery = `UPDATE sessions SET user_agent = $2, ip = $3, lastSeenAt = $4
+		WHERE id = $1 AND revokedAt IS NULL`
+
+	isSessionActiveQuery = `SELECT EXISTS (SELECT 1 FROM sessions s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.id = $1 AND s.revokedAt IS NULL AND u.deletedAt IS NULL)`
+
+	listSessionsQuery = `SELECT s.id, s.device, s.user_agent, s.ip, s.createdAt, s.lastSeenAt
+		FROM sessions s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.user_id = $1 AND s.revokedAt IS NULL AND u.deletedAt IS NULL
+		ORDER BY s.lastSeenAt DESC, s.id`
+
+	revokeSessionQuery = `UPDATE sessions SET revokedAt = now()
+		WHERE id = $2 AND user_id = $1 AND revokedAt IS NULL`
+
+	// the except id is null when every session is revoked
+	revokeOtherSessionsQuery = `UPDATE sessions SET revokedAt = now()
+		WHERE user_id = $1 AND revokedAt IS NULL AND id IS DISTINCT FROM $2
+		RETURNING id`
+)
+
+type SessionRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewSessionRepository(pool *pgxpool.Pool) *SessionRepository {
+	return &SessionRepository{
+		pool: pool,
+	}
+}
+
+func (r *SessionRepository) CreateSession(ctx context.Context, s domain.Session) error {
+	id, ok := parseUUID(s.ID)
+	if !ok {
+		return fmt.Errorf("CreateSession: invalid id %q", s.ID)
+	}
+	userID, ok := parseUUID(s.UserID)
+	if !ok {
+		return domain.ErrUserNotFound
+	}
+
+	_, err := connFrom(ctx, r.pool).Exec(ctx, createSessionQuery, id, userID, s.Device, s.UserAgent, s.IP,
+		timestamp(&s.CreatedAt), timestamp(&s.LastSeenAt))
+	if err != nil {
+		return fmt.Errorf("CreateSession: failed to insert session: %w", err)
+	}
+
+	return nil
+}
+
+func (r *SessionRepository) TouchSession(ctx context.Context, id string, client domain.Client, at time.Time) error {
+	pgID, ok := parseUUID(id)
+	if !ok {
+		return domain.ErrSessionNotFound
+	}
+
+	tag, err := connFrom(ctx, r.pool).Exec(ctx, touchSessionQuery, pgID, client.UserAgent, client.IP, timestamp(&at))
+	if err != nil {
+		return fmt.Errorf("TouchSession: failed to update session: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrSessionNotFound
+	}
+
+	return nil
+}
+
+func (r *SessionRepository) IsSessionActive(ctx context.Context, id string) (bool, error) {
+	pgID, ok := parseUUID(id)
+	if !ok {
+		return false, nil
+	}
+
+	var active bool
+	if err := connFrom(ctx, r.pool).QueryRow(ctx, isSessionActiveQuery, pgID).Scan(&active); err != nil {
+		return false, fmt.Errorf("IsSessionActive: failed to check session: %w", err)
+	}
+
+	return active, nil
+}
+
+func (r *SessionRepository) ListSessions(ctx context.Context, userID string) ([]domain.Session, error) {
+	pgUserID, ok := parseUUID(userID)
+	if !ok {
+		return []domain.Session{}, nil
+	}
+
+	rows, err := connFrom(ctx, r.pool).Query(ctx, listSessionsQuery, pgUserID)
+	if err != nil {
+		return nil, fmt.Errorf("ListSessions: failed to select sessions: %w", err)
+	}
+	sessions, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (domain.Session, error) {
+		s := domain.Session{UserID: userID}
+		var id pgtype.UUID
+		var createdAt, lastSeenAt pgtype.Timestamp
+		if err := row.Scan(&id, &s.Device, &s.UserAgent, &s.IP, &createdAt, &lastSeenAt); err != nil {
+			return s, err
+		}
+		s.ID = uuidString(id)
+		s.CreatedAt = createdAt.Time.UTC()
+		s.LastSeenAt = lastSeenAt.Time.UTC()
+		return s, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ListSessions: failed to scan sessions: %w", err)
+	}
+
+	return sessions, nil
+}
+
+func (r *SessionRepository) RevokeSession(ctx context.Context, userID, id string) error {
+	pgUserID, ok := parseUUID(userID)
+	if !ok {
+		return domain.ErrSessionNotFound
+	}
+	pgID, ok := parseUUID(id)
+	if !ok {
+		return domain.ErrSessionNotFound
+	}
+
+	tag, err := connFrom(ctx, r.pool).Exec(ctx, revokeSessionQuery, pgUserID, pgID)
+	if err != nil {
+		return fmt.Errorf("RevokeSession: failed to update session: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrSessionNotFound
+	}
+
+	return nil
+}
+
+func (r *SessionRepository) RevokeOtherSessions(ctx context.Context, userID, exceptID string) ([]string, error) {
+	pgUserID, ok := parseUUID(userID)
+	if !ok {
+		return []string{}, nil
+	}
+	// an invalid except id is no session at all
+	pgExceptID, _ := parseUUID(exceptID)
+
+	rows, err := connFrom(ctx, r.pool).Query(ctx, revokeOtherSessionsQuery, pgUserID, pgExceptID)
+	if err != nil {
+		return nil, fmt.Errorf("RevokeOtherSessions: failed to update sessions: %w", err)
+	}
+	ids, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (string, error) {
+		var id pgtype.UUID
+		err := row.Scan(&id)
+		return uuidString(id), err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("RevokeOtherSessions: failed to scan sessions: %w", err)
+	}
+
+	return ids, nil
+}
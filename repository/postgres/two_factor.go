@@ -0,0 +1,220 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// the secret is inserted only if the user isn't deleted and replaced only if it isn't enabled, no row means one of them
+	setTOTPSecretQuery = `INSERT INTO totp_secrets (user_id, secret)
+		SELECT id, $2 FROM users WHERE id = $1 AND deletedAt IS NULL
+		ON CONFLICT (user_id) DO UPDATE SET
+			secret = EXCLUDED.secret,
+			last_used_step = 0,
+			createdAt = now()
+			WHERE totp_secrets.enabledAt IS NULL`
+
+	getTOTPQuery = `SELECT t.secret, t.enabledAt, t.last_used_step
+		FROM totp_secrets t
+		JOIN users u ON u.id = t.user_id
+		WHERE t.user_id = $1 AND u.deletedAt IS NULL`
+
+	enableTOTPQuery = `UPDATE totp_secrets SET enabledAt = $2
+		WHERE user_id = $1 AND enabledAt IS NULL`
+
+	insertRecoveryCodesQuery = `INSERT INTO recovery_codes (user_id, code_hash, createdAt)
+		SELECT $1, unnest($2::text[]), $3`
+
+	useTOTPStepQuery = `UPDATE totp_secrets SET last_used_step = $2
+		WHERE user_id = $1 AND last_used_step < $2`
+
+	useRecoveryCodeQuery = `UPDATE recovery_codes SET usedAt = $3
+		WHERE user_id = $1 AND code_hash = $2 AND usedAt IS NULL`
+
+	deleteExpiredChallengesQuery = `DELETE FROM two_factor_challenges WHERE user_id = $1 AND expiresAt <= $2`
+
+	createChallengeQuery = `INSERT INTO two_factor_challenges (id, user_id, token_hash, device, attempts, createdAt, expiresAt)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+	attemptChallengeQuery = `UPDATE two_factor_challenges SET attempts = attempts + 1
+		WHERE token_hash = $1 AND expiresAt > $2 AND attempts < $3
+		RETURNING id, user_id, device, attempts, createdAt, expiresAt`
+
+	deleteChallengeQuery = `DELETE FROM two_factor_challenges WHERE id = $1`
+)
+
+type TwoFactorRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewTwoFactorRepository(pool *pgxpool.Pool) *TwoFactorRepository {
+	return &TwoFactorRepository{
+		pool: pool,
+	}
+}
+
+func (r *TwoFactorRepository) SetTOTPSecret(ctx context.Context, userID, secret string) error {
+	id, ok := parseUUID(userID)
+	if !ok {
+		return domain.ErrUserNotFound
+	}
+
+	tag, err := connFrom(ctx, r.pool).Exec(ctx, setTOTPSecretQuery, id, secret)
+	if err != nil {
+		return fmt.Errorf("SetTOTPSecret: failed to upsert secret: %w", err)
+	}
+	if tag.RowsAffected() > 0 {
+		return nil
+	}
+
+	t, err := r.GetTOTP(ctx, userID)
+	if err == nil && t.Enabled() {
+		return domain.ErrTOTPEnabled
+	}
+	if err != nil && !errors.Is(err, domain.ErrTOTPNotFound) {
+		return err
+	}
+	return domain.ErrUserNotFound
+}
+
+func (r *TwoFactorRepository) GetTOTP(ctx context.Context, userID string) (domain.TOTP, error) {
+	t := domain.TOTP{UserID: userID}
+	id, ok := parseUUID(userID)
+	if !ok {
+		return t, domain.ErrTOTPNotFound
+	}
+
+	var enabledAt pgtype.Timestamp
+	err := connFrom(ctx, r.pool).QueryRow(ctx, getTOTPQuery, id).Scan(&t.Secret, &enabledAt, &t.LastUsedStep)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return t, domain.ErrTOTPNotFound
+		}
+		return t, fmt.Errorf("GetTOTP: failed to get secret: %w", err)
+	}
+	t.EnabledAt = timeOf(enabledAt)
+
+	return t, nil
+}
+
+func (r *TwoFactorRepository) EnableTOTP(ctx context.Context, userID string, at time.Time, recoveryCodeHashes []string) error {
+	id, ok := parseUUID(userID)
+	if !ok {
+		return domain.ErrTOTPEnabled
+	}
+
+	tag, err := connFrom(ctx, r.pool).Exec(ctx, enableTOTPQuery, id, timestamp(&at))
+	if err != nil {
+		return fmt.Errorf("EnableTOTP: failed to update secret: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrTOTPEnabled
+	}
+
+	if _, err := connFrom(ctx, r.pool).Exec(ctx, insertRecoveryCodesQuery, id, recoveryCodeHashes, timestamp(&at)); err != nil {
+		return fmt.Errorf("EnableTOTP: failed to insert recovery codes: %w", err)
+	}
+
+	return nil
+}
+
+func (r *TwoFactorRepository) UseTOTPStep(ctx context.Context, userID string, step int64) error {
+	id, ok := parseUUID(userID)
+	if !ok {
+		return domain.ErrTOTPCodeUsed
+	}
+
+	tag, err := connFrom(ctx, r.pool).Exec(ctx, useTOTPStepQuery, id, step)
+	if err != nil {
+		return fmt.Errorf("UseTOTPStep: failed to update secret: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrTOTPCodeUsed
+	}
+
+	return nil
+}
+
+func (r *TwoFactorRepository) UseRecoveryCode(ctx context.Context, userID, hash string, at time.Time) error {
+	id, ok := parseUUID(userID)
+	if !ok {
+		return domain.ErrRecoveryCodeNotFound
+	}
+
+	tag, err := connFrom(ctx, r.pool).Exec(ctx, useRecoveryCodeQuery, id, hash, timestamp(&at))
+	if err != nil {
+		return fmt.Errorf("UseRecoveryCode: failed to update recovery code: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrRecoveryCodeNotFound
+	}
+
+	return nil
+}
+
+func (r *TwoFactorRepository) CreateTwoFactorChallenge(ctx context.Context, c domain.TwoFactorChallenge) error {
+	id, ok := parseUUID(c.ID)
+	if !ok {
+		return fmt.Errorf("CreateTwoFactorChallenge: invalid id %q", c.ID)
+	}
+	userID, ok := parseUUID(c.UserID)
+	if !ok {
+		return domain.ErrUserNotFound
+	}
+
+	if _, err := connFrom(ctx, r.pool).Exec(ctx, deleteExpiredChallengesQuery, userID, timestamp(&c.CreatedAt)); err != nil {
+		return fmt.Errorf("CreateTwoFactorChallenge: failed to delete expired challenges: %w", err)
+	}
+	_, err := connFrom(ctx, r.pool).Exec(ctx, createChallengeQuery, id, userID, c.Hash, c.Device, c.Attempts,
+		timestamp(&c.CreatedAt), timestamp(&c.ExpiresAt))
+	if err != nil {
+		return fmt.Errorf("CreateTwoFactorChallenge: failed to insert challenge: %w", err)
+	}
+
+	return nil
+}
+
+func (r *TwoFactorRepository) AttemptTwoFactorChallenge(ctx context.Context, hash string, at time.Time, maxAttempts int) (domain.TwoFactorChallenge, error) {
+	c := domain.TwoFactorChallenge{Hash: hash}
+	var id, userID pgtype.UUID
+	var createdAt, expiresAt pgtype.Timestamp
+	err := connFrom(ctx, r.pool).QueryRow(ctx, attemptChallengeQuery, hash, timestamp(&at), maxAttempts).
+		Scan(&id, &userID, &c.Device, &c.Attempts, &createdAt, &expiresAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return c, domain.ErrTwoFactorChallengeNotFound
+		}
+		return c, fmt.Errorf("AttemptTwoFactorChallenge: failed to update challenge: %w", err)
+	}
+	c.ID = uuidString(id)
+	c.UserID = uuidString(userID)
+	c.CreatedAt = createdAt.Time.UTC()
+	c.ExpiresAt = expiresAt.Time.UTC()
+
+	return c, nil
+}
+
+func (r *TwoFactorRepository) DeleteTwoFactorChallenge(ctx context.Context, id string) error {
+	pgID, ok := parseUUID(id)
+	if !ok {
+		return domain.ErrTwoFactorChallengeNotFound
+	}
+
+	tag, err := connFrom(ctx, r.pool).Exec(ctx, deleteChallengeQuery, pgID)
+	if err != nil {
+		return fmt.Errorf("DeleteTwoFactorChallenge: failed to delete challenge: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrTwoFactorChallengeNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,118 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/pkg/retry"
+	"github.com/dennypenta/go-api-walkthrough/repository"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// querier is what the pool and a transaction have in common.
+type querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults
+}
+
+type txKey struct{}
+
+// TxManager runs the repository calls in one transaction, see repository.TxManager.
+type TxManager struct {
+	pool   *pgxpool.Pool
+	opts   pgx.TxOptions
+	policy retry.Policy
+	log    *slog.Logger
+}
+
+// NewTxManager creates the manager, the transactions failed on serialization or a deadlock
+// are retried with the given policy, its Retryable is replaced.
+func NewTxManager(pool *pgxpool.Pool, isolation sql.IsolationLevel, policy retry.Policy, l *slog.Logger) *TxManager {
+	policy.Retryable = repository.IsRetryableTxError
+	opts := pgx.TxOptions{}
+	if isolation != sql.LevelDefault {
+		// pgx spells the levels as postgres does
+		opts.IsoLevel = pgx.TxIsoLevel(strings.ToLower(isolation.String()))
+	}
+
+	return &TxManager{
+		pool:   pool,
+		opts:   opts,
+		policy: policy,
+		log:    l,
+	}
+}
+
+// WithinTx commits the transaction if fn returns nil and rolls it back otherwise.
+// A nested call joins the outer transaction, the outer one decides on the commit and the retries.
+func (m *TxManager) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return fn(ctx)
+	}
+
+	return retry.Do(ctx, m.policy, m.log, "transaction", func(ctx context.Context) error {
+		return m.run(ctx, fn)
+	})
+}
+
+func (m *TxManager) run(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	tx, err := m.pool.BeginTx(ctx, m.opts)
+	if err != nil {
+		return fmt.Errorf("WithinTx: failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback(context.Background())
+			panic(p)
+		}
+		if err != nil {
+			// the context might be cancelled already, the rollback must get through anyway
+			if rbErr := tx.Rollback(context.Background()); rbErr != nil && !errors.Is(rbErr, pgx.ErrTxClosed) {
+				err = errors.Join(err, fmt.Errorf("WithinTx: failed to rollback: %w", rbErr))
+			}
+		}
+	}()
+
+	ctx, committed := domain.ContextWithTx(ctx)
+	if err := fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("WithinTx: failed to commit: %w", err)
+	}
+	committed()
+
+	return nil
+}
+
+// conn is the transaction of WithinTx if there is one, the pool otherwise.
+func (r *UserRepository) conn(ctx context.Context) querier {
+	return connFrom(ctx, r.pool)
+}
+
+func connFrom(ctx context.Context, pool *pgxpool.Pool) querier {
+	if tx, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return tx
+	}
+	return pool
+}
+
+// reader is like conn, but goes to a replica when there are ones.
+func (r *UserRepository) reader(ctx context.Context) querier {
+	if tx, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return tx
+	}
+	if r.replicas != nil {
+		return r.replicas.Reader(ctx)
+	}
+	return r.pool
+}
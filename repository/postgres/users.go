@@ -0,0 +1,337 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/pkg/rwsplit"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// The queries are static, so pgx prepares every one once per connection and reuses it,
+// the arguments and the results go in the binary format.
+const (
+	// the id and the timestamps are the database ones unless the app gives them
+	createUserQuery = `INSERT INTO users (id, username, email, createdAt, updatedAt)
+		VALUES (COALESCE($3::uuid, uuid_generate_v4()), $1, $2, COALESCE($4::timestamp, now()::timestamp), COALESCE($4::timestamp, now()::timestamp))
+		RETURNING id`
+
+	getUserByIDQuery = `SELECT username, email, emailVerifiedAt FROM users WHERE id = $1 AND deletedAt IS NULL`
+
+	// the right side sees the row before the update, the verification is dropped with the old email
+	updateUserQuery = `UPDATE users SET
+			username = $2,
+			email = $3,
+			emailVerifiedAt = CASE WHEN email = $3 THEN emailVerifiedAt END,
+			updatedAt = COALESCE($4::timestamp, now()::timestamp)
+		WHERE id = $1
+		RETURNING emailVerifiedAt`
+
+	updateUsernameQuery = `UPDATE users SET
+			username = $2,
+			updatedAt = COALESCE($3::timestamp, now()::timestamp)
+		WHERE id = $1
+		RETURNING email, emailVerifiedAt`
+
+	verifyEmailQuery = `UPDATE users SET emailVerifiedAt = COALESCE(emailVerifiedAt, $3)
+		WHERE id = $1 AND email = $2 AND deletedAt IS NULL`
+
+	deleteUserQuery = `UPDATE users SET deletedAt = COALESCE($2::timestamp, now()::timestamp) WHERE id = $1`
+
+	restoreUserQuery = `UPDATE users SET deletedAt = NULL, updatedAt = COALESCE($2::timestamp, now()::timestamp)
+		WHERE id = $1 AND deletedAt IS NOT NULL`
+
+	listUsersQuery = `SELECT id, username, email, emailVerifiedAt, COUNT(*) OVER () AS total
+		FROM users
+		WHERE deletedAt IS NULL
+		ORDER BY createdAt DESC
+		LIMIT $1 OFFSET $2`
+
+	countUsersQuery = `SELECT COUNT(*) FROM users WHERE deletedAt IS NULL`
+
+	seedUserQuery = `INSERT INTO users (id, username, email, emailVerifiedAt, createdAt, updatedAt, deletedAt)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (id) DO UPDATE SET
+			username = EXCLUDED.username,
+			email = EXCLUDED.email,
+			emailVerifiedAt = EXCLUDED.emailVerifiedAt,
+			createdAt = EXCLUDED.createdAt,
+			updatedAt = EXCLUDED.updatedAt,
+			deletedAt = EXCLUDED.deletedAt`
+)
+
+// UserRepository works on the native pgx pool.
+type UserRepository struct {
+	pool     *pgxpool.Pool
+	replicas *rwsplit.ReplicaSet[*pgxpool.Pool]
+
+	// now and newID replace the database clock and uuid_generate_v4 when they are set
+	now   func() time.Time
+	newID func() string
+}
+
+func NewUserRepository(pool *pgxpool.Pool) *UserRepository {
+	return &UserRepository{
+		pool: pool,
+	}
+}
+
+// WithReplicas makes GetUserByID and ListUsers read from the replicas, the writes stay on the primary.
+func (r *UserRepository) WithReplicas(replicas *rwsplit.ReplicaSet[*pgxpool.Pool]) *UserRepository {
+	r.replicas = replicas
+	return r
+}
+
+// WithClock stamps the created, updated, deleted and restored users with the clock instead of the database one.
+func (r *UserRepository) WithClock(now func() time.Time) *UserRepository {
+	r.now = now
+	return r
+}
+
+// WithIDGenerator makes the created users take the ids of newID instead of the database ones, they must be uuids.
+func (r *UserRepository) WithIDGenerator(newID func() string) *UserRepository {
+	r.newID = newID
+	return r
+}
+
+func (r *UserRepository) CreateUser(ctx context.Context, user domain.User) (domain.User, error) {
+	var id pgtype.UUID
+	if r.newID != nil {
+		var ok bool
+		if id, ok = parseUUID(r.newID()); !ok {
+			return user, errors.New("CreateUser: the generated id isn't a uuid")
+		}
+	}
+	if err := r.conn(ctx).QueryRow(ctx, createUserQuery, user.Username, text(user.Email), id, r.currentTime()).Scan(&id); err != nil {
+		if isUniqueViolation(err) {
+			return user, domain.ErrEmailTaken
+		}
+		return user, fmt.Errorf("CreateUser: failed to insert user: %w", err)
+	}
+
+	user.ID = uuidString(id)
+	return user, nil
+}
+
+func (r *UserRepository) GetUserByID(ctx context.Context, id string) (domain.User, error) {
+	var user domain.User
+	pgID, ok := parseUUID(id)
+	if !ok {
+		// no user can have such an id
+		return user, domain.ErrUserNotFound
+	}
+
+	var email pgtype.Text
+	var verifiedAt pgtype.Timestamp
+	err := r.reader(ctx).QueryRow(ctx, getUserByIDQuery, pgID).Scan(&user.Username, &email, &verifiedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return user, domain.ErrUserNotFound
+		}
+		return user, err
+	}
+
+	user.ID = id
+	user.Email = email.String
+	user.EmailVerifiedAt = timeOf(verifiedAt)
+	return user, nil
+}
+
+func (r *UserRepository) UpdateUser(ctx context.Context, user domain.User) (domain.User, error) {
+	id, ok := parseUUID(user.ID)
+	if !ok {
+		return user, domain.ErrUserNotFound
+	}
+
+	var verifiedAt pgtype.Timestamp
+	err := r.conn(ctx).QueryRow(ctx, updateUserQuery, id, user.Username, text(user.Email), r.currentTime()).Scan(&verifiedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return user, domain.ErrUserNotFound
+		}
+		if isUniqueViolation(err) {
+			return user, domain.ErrEmailTaken
+		}
+		return user, fmt.Errorf("UpdateUser: failed to update user: %w", err)
+	}
+
+	user.EmailVerifiedAt = timeOf(verifiedAt)
+	return user, nil
+}
+
+func (r *UserRepository) UpdateUsername(ctx context.Context, id, username string) (domain.User, error) {
+	user := domain.User{ID: id, Username: username}
+	pgID, ok := parseUUID(id)
+	if !ok {
+		return user, domain.ErrUserNotFound
+	}
+
+	var email pgtype.Text
+	var verifiedAt pgtype.Timestamp
+	err := r.conn(ctx).QueryRow(ctx, updateUsernameQuery, pgID, username, r.currentTime()).Scan(&email, &verifiedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return user, domain.ErrUserNotFound
+		}
+		return user, fmt.Errorf("UpdateUsername: failed to update user: %w", err)
+	}
+
+	user.Email = email.String
+	user.EmailVerifiedAt = timeOf(verifiedAt)
+	return user, nil
+}
+
+func (r *UserRepository) DeleteUser(ctx context.Context, id string) error {
+	pgID, ok := parseUUID(id)
+	if !ok {
+		return domain.ErrUserNotFound
+	}
+
+	tag, err := r.conn(ctx).Exec(ctx, deleteUserQuery, pgID, r.currentTime())
+	if err != nil {
+		return fmt.Errorf("DeleteUser: failed to delete user: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrUserNotFound
+	}
+
+	return nil
+}
+
+func (r *UserRepository) RestoreUser(ctx context.Context, id string) error {
+	pgID, ok := parseUUID(id)
+	if !ok {
+		return domain.ErrUserNotFound
+	}
+
+	tag, err := r.conn(ctx).Exec(ctx, restoreUserQuery, pgID, r.currentTime())
+	if err != nil {
+		if isUniqueViolation(err) {
+			return domain.ErrEmailTaken
+		}
+		return fmt.Errorf("RestoreUser: failed to restore user: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrUserNotFound
+	}
+
+	return nil
+}
+
+func (r *UserRepository) VerifyEmail(ctx context.Context, id, email string, at time.Time) error {
+	pgID, ok := parseUUID(id)
+	if !ok {
+		return domain.ErrUserNotFound
+	}
+
+	tag, err := r.conn(ctx).Exec(ctx, verifyEmailQuery, pgID, email, timestamp(&at))
+	if err != nil {
+		return fmt.Errorf("VerifyEmail: failed to update user: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrUserNotFound
+	}
+
+	return nil
+}
+
+// SeedUsers inserts the records as is or overwrites the existing ones with the same id.
+// The records are sent in one batch, it's a single round trip.
+func (r *UserRepository) SeedUsers(ctx context.Context, records []domain.UserRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	batch := &pgx.Batch{}
+	for _, rec := range records {
+		id, ok := parseUUID(rec.ID)
+		if !ok {
+			return fmt.Errorf("SeedUsers: invalid id %q", rec.ID)
+		}
+		batch.Queue(seedUserQuery, id, rec.Username, text(rec.Email), timestamp(rec.EmailVerifiedAt),
+			timestamp(&rec.CreatedAt), timestamp(&rec.UpdatedAt), timestamp(rec.DeletedAt))
+	}
+
+	if err := r.conn(ctx).SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("SeedUsers: failed to insert users: %w", err)
+	}
+
+	return nil
+}
+
+func (r *UserRepository) ListUsers(ctx context.Context, filter domain.UserFilter) ([]domain.User, int, error) {
+	var count int
+	var users []domain.User
+
+	rows, err := r.reader(ctx).Query(ctx, listUsersQuery, filter.Limit, filter.Offset)
+	if err != nil {
+		return users, 0, fmt.Errorf("ListUsers: failed to list users: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id pgtype.UUID
+		var email pgtype.Text
+		var verifiedAt pgtype.Timestamp
+		var user domain.User
+		if err := rows.Scan(&id, &user.Username, &email, &verifiedAt, &count); err != nil {
+			return users, 0, fmt.Errorf("ListUsers: failed to scan user: %w", err)
+		}
+		user.ID = uuidString(id)
+		user.Email = email.String
+		user.EmailVerifiedAt = timeOf(verifiedAt)
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return users, 0, fmt.Errorf("ListUsers: failed to list users: %w", err)
+	}
+	// the window count comes with the rows, a page past the end needs its own
+	if len(users) == 0 && filter.Offset > 0 {
+		if err := r.reader(ctx).QueryRow(ctx, countUsersQuery).Scan(&count); err != nil {
+			return nil, 0, fmt.Errorf("ListUsers: failed to count users: %w", err)
+		}
+		return nil, count, nil
+	}
+
+	return users, count, nil
+}
+
+func parseUUID(id string) (pgtype.UUID, bool) {
+	u, err := uuid.Parse(id)
+	if err != nil {
+		return pgtype.UUID{}, false
+	}
+	return pgtype.UUID{Bytes: u, Valid: true}, true
+}
+
+func uuidString(id pgtype.UUID) string {
+	return uuid.UUID(id.Bytes).String()
+}
+
+// currentTime is the timestamp to write, NULL leaves it to the database clock.
+func (r *UserRepository) currentTime() pgtype.Timestamp {
+	if r.now == nil {
+		return pgtype.Timestamp{}
+	}
+	now := r.now()
+	return timestamp(&now)
+}
+
+// text writes an empty string as NULL, e.g. the users without an email don't collide on the unique index.
+func text(s string) pgtype.Text {
+	return pgtype.Text{String: s, Valid: s != ""}
+}
+
+// timestamp converts to the column type, it's TIMESTAMP without a time zone keeping UTC.
+func timestamp(t *time.Time) pgtype.Timestamp {
+	if t == nil {
+		return pgtype.Timestamp{}
+	}
+	return pgtype.Timestamp{Time: t.UTC(), Valid: true}
+}
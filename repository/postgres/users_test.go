@@ -0,0 +1,177 @@
+//go:build integration
+
+package postgres_test
+
+import (
+	"context"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/migrations"
+	"github.com/dennypenta/go-api-walkthrough/pkg/testdb"
+	"github.com/dennypenta/go-api-walkthrough/repository/postgres"
+	"github.com/dennypenta/go-api-walkthrough/repository/repotest"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var template *testdb.Template
+
+func TestMain(m *testing.M) {
+	tpl, err := testdb.NewTemplate(context.Background(), testdb.AdminDSN(), migrations.FS)
+	if err != nil {
+		log.Fatalln("failed to create template database:", err)
+	}
+	template = tpl
+
+	code := m.Run()
+
+	if err := tpl.Close(); err != nil {
+		log.Println("failed to drop template database:", err)
+	}
+	os.Exit(code)
+}
+
+func newPool(tb testing.TB, dsn string, mode pgx.QueryExecMode) *pgxpool.Pool {
+	tb.Helper()
+
+	conf, err := pgxpool.ParseConfig(dsn)
+	require.NoError(tb, err)
+	conf.ConnConfig.DefaultQueryExecMode = mode
+	pool, err := pgxpool.NewWithConfig(context.Background(), conf)
+	require.NoError(tb, err)
+	tb.Cleanup(pool.Close)
+
+	return pool
+}
+
+func TestUserRepository(t *testing.T) {
+	t.Parallel()
+
+	for name, mode := range map[string]pgx.QueryExecMode{
+		"statement cache": pgx.QueryExecModeCacheStatement,
+		// PgBouncer compatible mode
+		"simple protocol": pgx.QueryExecModeSimpleProtocol,
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			repotest.TestUserRepository(t, func(t *testing.T) repotest.UserRepository {
+				return postgres.NewUserRepository(newPool(t, template.New(t), mode))
+			})
+		})
+	}
+
+	t.Run("app clock and ids", func(t *testing.T) {
+		t.Parallel()
+
+		repotest.TestUserRepository(t, func(t *testing.T) repotest.UserRepository {
+			pool := newPool(t, template.New(t), pgx.QueryExecModeCacheStatement)
+			return postgres.NewUserRepository(pool).WithClock(time.Now).WithIDGenerator(uuid.NewString)
+		})
+	})
+}
+
+func TestUserRepositoryIDGenerator(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	id := uuid.NewString()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	repo := postgres.NewUserRepository(newPool(t, template.New(t), pgx.QueryExecModeCacheStatement)).
+		WithClock(func() time.Time { return now }).
+		WithIDGenerator(func() string { return id })
+
+	user, err := repo.CreateUser(ctx, domain.User{Username: "alice"})
+	require.NoError(t, err)
+	assert.Equal(t, id, user.ID)
+
+	// the users created later by the clock come first whatever the database clock says
+	now = now.Add(time.Hour)
+	id = uuid.NewString()
+	bob, err := repo.CreateUser(ctx, domain.User{Username: "bob"})
+	require.NoError(t, err)
+	users, _, err := repo.ListUsers(ctx, domain.UserFilter{Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, []domain.User{bob, user}, users)
+
+	repo.WithIDGenerator(func() string { return "not a uuid" })
+	_, err = repo.CreateUser(ctx, domain.User{Username: "carol"})
+	assert.Error(t, err)
+}
+
+func TestCredentialRepository(t *testing.T) {
+	t.Parallel()
+
+	repotest.TestCredentialRepository(t, func(t *testing.T) (repotest.UserRepository, domain.CredentialRepository) {
+		pool := newPool(t, template.New(t), pgx.QueryExecModeCacheStatement)
+		return postgres.NewUserRepository(pool), postgres.NewCredentialRepository(pool)
+	})
+}
+
+func TestRefreshTokenRepository(t *testing.T) {
+	t.Parallel()
+
+	repotest.TestRefreshTokenRepository(t, func(t *testing.T) (repotest.UserRepository, domain.SessionRepository, domain.RefreshTokenRepository) {
+		pool := newPool(t, template.New(t), pgx.QueryExecModeCacheStatement)
+		return postgres.NewUserRepository(pool), postgres.NewSessionRepository(pool), postgres.NewRefreshTokenRepository(pool)
+	})
+}
+
+func TestSessionRepository(t *testing.T) {
+	t.Parallel()
+
+	repotest.TestSessionRepository(t, func(t *testing.T) (repotest.UserRepository, domain.SessionRepository) {
+		pool := newPool(t, template.New(t), pgx.QueryExecModeCacheStatement)
+		return postgres.NewUserRepository(pool), postgres.NewSessionRepository(pool)
+	})
+}
+
+func TestTwoFactorRepository(t *testing.T) {
+	t.Parallel()
+
+	repotest.TestTwoFactorRepository(t, func(t *testing.T) (repotest.UserRepository, domain.TwoFactorRepository) {
+		pool := newPool(t, template.New(t), pgx.QueryExecModeCacheStatement)
+		return postgres.NewUserRepository(pool), postgres.NewTwoFactorRepository(pool)
+	})
+}
+
+func TestEmailVerificationRepository(t *testing.T) {
+	t.Parallel()
+
+	repotest.TestEmailVerificationRepository(t, func(t *testing.T) (repotest.UserRepository, domain.EmailVerificationRepository) {
+		pool := newPool(t, template.New(t), pgx.QueryExecModeCacheStatement)
+		return postgres.NewUserRepository(pool), postgres.NewEmailVerificationRepository(pool)
+	})
+}
+
+func TestPasswordResetRepository(t *testing.T) {
+	t.Parallel()
+
+	repotest.TestPasswordResetRepository(t, func(t *testing.T) (repotest.UserRepository, domain.PasswordResetRepository) {
+		pool := newPool(t, template.New(t), pgx.QueryExecModeCacheStatement)
+		return postgres.NewUserRepository(pool), postgres.NewPasswordResetRepository(pool)
+	})
+}
+
+func TestAPIKeyRepository(t *testing.T) {
+	t.Parallel()
+
+	repotest.TestAPIKeyRepository(t, func(t *testing.T) domain.APIKeyRepository {
+		return postgres.NewAPIKeyRepository(newPool(t, template.New(t), pgx.QueryExecModeCacheStatement))
+	})
+}
+
+func TestRoleRepository(t *testing.T) {
+	t.Parallel()
+
+	repotest.TestRoleRepository(t, func(t *testing.T) (repotest.UserRepository, domain.RoleRepository) {
+		pool := newPool(t, template.New(t), pgx.QueryExecModeCacheStatement)
+		return postgres.NewUserRepository(pool), postgres.NewRoleRepository(pool)
+	})
+}
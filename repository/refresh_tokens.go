@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/jmoiron/sqlx"
+)
+
+type RefreshTokenRepository struct {
+	db *sqlx.DB
+	sq sq.StatementBuilderType
+
+	// now stamps the issued and the used tokens for sqlite, postgres takes its own clock
+	now func() time.Time
+}
+
+func NewRefreshTokenRepository(db *sqlx.DB) *RefreshTokenRepository {
+	return &RefreshTokenRepository{
+		db: db,
+		sq: sq.StatementBuilder.PlaceholderFormat(sq.Dollar),
+	}
+}
+
+// NewSQLiteRefreshTokenRepository works with the schema of migrations.SQLiteFS.
+func NewSQLiteRefreshTokenRepository(db *sqlx.DB, now func() time.Time) *RefreshTokenRepository {
+	return &RefreshTokenRepository{
+		db:  db,
+		sq:  sq.StatementBuilder.PlaceholderFormat(sq.Question),
+		now: now,
+	}
+}
+
+func (r *RefreshTokenRepository) CreateRefreshToken(ctx context.Context, t domain.RefreshToken) error {
+	query, args, err := r.sq.Insert("refresh_tokens").
+		Columns("id", "session_id", "user_id", "token_hash", "expiresAt", "createdAt").
+		Values(t.ID, t.SessionID, t.UserID, t.Hash, t.ExpiresAt, currentTime(r.now)).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("CreateRefreshToken: failed to build query: %w", err)
+	}
+
+	if _, err := connFrom(ctx, r.db).ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("CreateRefreshToken: failed to insert refresh token: %w", err)
+	}
+
+	return nil
+}
+
+func (r *RefreshTokenRepository) GetRefreshToken(ctx context.Context, hash string) (domain.RefreshToken, error) {
+	t := domain.RefreshToken{Hash: hash}
+	query, args, err := r.sq.Select("t.id", "t.session_id", "t.user_id", "t.expiresAt", "t.usedAt IS NOT NULL", "s.revokedAt IS NOT NULL").
+		From("refresh_tokens t").
+		Join("sessions s ON s.id = t.session_id").
+		Join("users u ON u.id = t.user_id").
+		Where(sq.Eq{"t.token_hash": hash, "u.deletedAt": nil}).
+		ToSql()
+	if err != nil {
+		return t, fmt.Errorf("GetRefreshToken: failed to build query: %w", err)
+	}
+
+	err = connFrom(ctx, r.db).QueryRowxContext(ctx, query, args...).
+		Scan(&t.ID, &t.SessionID, &t.UserID, &t.ExpiresAt, &t.Used, &t.Revoked)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return t, domain.ErrRefreshTokenNotFound
+		}
+		return t, fmt.Errorf("GetRefreshToken: failed to get refresh token: %w", err)
+	}
+
+	t.ExpiresAt = t.ExpiresAt.UTC()
+	return t, nil
+}
+
+// UseRefreshToken updates the token only if it's neither used nor its session is revoked, no row means another exchange has won.
+func (r *RefreshTokenRepository) UseRefreshToken(ctx context.Context, id string) error {
+	query, args, err := r.sq.Update("refresh_tokens").
+		Set("usedAt", currentTime(r.now)).
+		Where(sq.Eq{"id": id, "usedAt": nil}).
+		Where("session_id IN (SELECT id FROM sessions WHERE revokedAt IS NULL)").
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("UseRefreshToken: failed to build query: %w", err)
+	}
+
+	res, err := connFrom(ctx, r.db).ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("UseRefreshToken: failed to update refresh token: %w", err)
+	}
+
+	affectedAmount, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("UseRefreshToken: failed to get RowsAffected: %w", err)
+	}
+	if affectedAmount == 0 {
+		return domain.ErrRefreshTokenReused
+	}
+
+	return nil
+}
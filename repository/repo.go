@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"time"
 
 	sq "github.com/Masterminds/squirrel"
 	"github.com/dennypenta/go-api-walkthrough/domain"
@@ -14,6 +15,11 @@ import (
 type UserRepository struct {
 	db *sqlx.DB
 	sq sq.StatementBuilderType
+
+	// now and newID are set when the database can't generate the ids and timestamps itself
+	// or the app wants its own ones, see WithClock and WithIDGenerator
+	now   func() time.Time
+	newID func() string
 }
 
 func NewUserRepository(db *sqlx.DB) *UserRepository {
@@ -23,10 +29,38 @@ func NewUserRepository(db *sqlx.DB) *UserRepository {
 	}
 }
 
+// NewSQLiteUserRepository works with the schema of migrations.SQLiteFS,
+// the ids and timestamps are generated by the app there.
+func NewSQLiteUserRepository(db *sqlx.DB, now func() time.Time, newID func() string) *UserRepository {
+	return &UserRepository{
+		db:    db,
+		sq:    sq.StatementBuilder.PlaceholderFormat(sq.Question),
+		now:   now,
+		newID: newID,
+	}
+}
+
+// WithClock stamps the created, updated, deleted and restored users with the clock instead of the database one.
+func (r *UserRepository) WithClock(now func() time.Time) *UserRepository {
+	r.now = now
+	return r
+}
+
+// WithIDGenerator makes the created users take the ids of newID instead of the database ones, they must be uuids on postgres.
+func (r *UserRepository) WithIDGenerator(newID func() string) *UserRepository {
+	r.newID = newID
+	return r
+}
+
 func (r *UserRepository) CreateUser(ctx context.Context, user domain.User) (domain.User, error) {
+	if r.newID != nil {
+		return r.insertUser(ctx, user)
+	}
+
+	now := currentTime(r.now)
 	query, args, err := r.sq.Insert("users").
-		Columns("username").
-		Values(user.Username).
+		Columns("username", "email", "createdAt", "updatedAt").
+		Values(user.Username, nullString(user.Email), now, now).
 		Suffix("RETURNING id").
 		ToSql()
 	if err != nil {
@@ -34,7 +68,10 @@ func (r *UserRepository) CreateUser(ctx context.Context, user domain.User) (doma
 	}
 
 	var id string
-	if err := r.db.QueryRowxContext(ctx, query, args...).Scan(&id); err != nil {
+	if err := r.conn(ctx).QueryRowxContext(ctx, query, args...).Scan(&id); err != nil {
+		if isUniqueViolation(err) {
+			return user, domain.ErrEmailTaken
+		}
 		return user, fmt.Errorf("CreateUser: failed to insert user: %w", err)
 	}
 
@@ -42,9 +79,45 @@ func (r *UserRepository) CreateUser(ctx context.Context, user domain.User) (doma
 	return user, nil
 }
 
+// insertUser creates the user with the id and timestamps generated by the app.
+func (r *UserRepository) insertUser(ctx context.Context, user domain.User) (domain.User, error) {
+	user.ID = r.newID()
+	now := currentTime(r.now)
+	query, args, err := r.sq.Insert("users").
+		Columns("id", "username", "email", "createdAt", "updatedAt").
+		Values(user.ID, user.Username, nullString(user.Email), now, now).
+		ToSql()
+	if err != nil {
+		return domain.User{Username: user.Username, Email: user.Email}, fmt.Errorf("CreateUser: failed to build query: %w", err)
+	}
+
+	if _, err := r.conn(ctx).ExecContext(ctx, query, args...); err != nil {
+		if isUniqueViolation(err) {
+			return domain.User{Username: user.Username, Email: user.Email}, domain.ErrEmailTaken
+		}
+		return domain.User{Username: user.Username, Email: user.Email}, fmt.Errorf("CreateUser: failed to insert user: %w", err)
+	}
+
+	return user, nil
+}
+
+// currentTime is the timestamp to write: the clock of the app when it's given, e.g. for sqlite,
+// the database clock otherwise. It's an expression, so it goes to the selected columns as well.
+func currentTime(now func() time.Time) sq.Sqlizer {
+	if now == nil {
+		return sq.Expr("now()")
+	}
+	return sq.Expr("?", now().UTC())
+}
+
+// nullString writes an empty string as NULL, e.g. the users without an email don't collide on the unique index.
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
 func (r *UserRepository) GetUserByID(ctx context.Context, id string) (domain.User, error) {
 	var user domain.User
-	query, args, err := r.sq.Select("username").
+	query, args, err := r.sq.Select("username", "email", "emailVerifiedAt").
 		From("users").
 		Where(sq.Eq{"id": id, "deletedAt": nil}).
 		ToSql()
@@ -52,7 +125,9 @@ func (r *UserRepository) GetUserByID(ctx context.Context, id string) (domain.Use
 		return user, fmt.Errorf("GetUserByID: failed to build query: %w", err)
 	}
 
-	err = r.db.QueryRowxContext(ctx, query, args...).Scan(&user.Username)
+	var email sql.NullString
+	var verifiedAt sql.NullTime
+	err = r.conn(ctx).QueryRowxContext(ctx, query, args...).Scan(&user.Username, &email, &verifiedAt)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return user, domain.ErrUserNotFound
@@ -61,44 +136,75 @@ func (r *UserRepository) GetUserByID(ctx context.Context, id string) (domain.Use
 	}
 
 	user.ID = id
+	user.Email = email.String
+	user.EmailVerifiedAt = timePtr(verifiedAt)
 	return user, nil
 }
 
 func (r *UserRepository) UpdateUser(ctx context.Context, user domain.User) (domain.User, error) {
 	query, args, err := r.sq.Update("users").
-		Set("username", user.Username).Set("updatedAt", sq.Expr("now()")).
+		Set("username", user.Username).Set("email", nullString(user.Email)).
+		// the right side sees the row before the update, the verification is dropped with the old email
+		Set("emailVerifiedAt", sq.Expr("CASE WHEN email = ? THEN emailVerifiedAt END", nullString(user.Email))).
+		Set("updatedAt", currentTime(r.now)).
 		Where(sq.Eq{"id": user.ID}).
+		Suffix("RETURNING emailVerifiedAt").
 		ToSql()
 	if err != nil {
 		return user, fmt.Errorf("UpdateUser: failed to build query: %w", err)
 	}
 
-	res, err := r.db.ExecContext(ctx, query, args...)
-	if err != nil {
+	var verifiedAt sql.NullTime
+	if err := r.conn(ctx).QueryRowxContext(ctx, query, args...).Scan(&verifiedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return user, domain.ErrUserNotFound
+		}
+		if isUniqueViolation(err) {
+			return user, domain.ErrEmailTaken
+		}
 		return user, fmt.Errorf("UpdateUser: failed to update user: %w", err)
 	}
 
-	affectedAmount, err := res.RowsAffected()
+	user.EmailVerifiedAt = timePtr(verifiedAt)
+	return user, nil
+}
+
+func (r *UserRepository) UpdateUsername(ctx context.Context, id, username string) (domain.User, error) {
+	user := domain.User{ID: id, Username: username}
+	query, args, err := r.sq.Update("users").
+		Set("username", username).
+		Set("updatedAt", currentTime(r.now)).
+		Where(sq.Eq{"id": id}).
+		Suffix("RETURNING email, emailVerifiedAt").
+		ToSql()
 	if err != nil {
-		return user, fmt.Errorf("UpdateUser: failed to get RowsAffected: %w", err)
+		return user, fmt.Errorf("UpdateUsername: failed to build query: %w", err)
 	}
-	if affectedAmount == 0 {
-		return user, domain.ErrUserNotFound
+
+	var email sql.NullString
+	var verifiedAt sql.NullTime
+	if err := r.conn(ctx).QueryRowxContext(ctx, query, args...).Scan(&email, &verifiedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return user, domain.ErrUserNotFound
+		}
+		return user, fmt.Errorf("UpdateUsername: failed to update user: %w", err)
 	}
 
+	user.Email = email.String
+	user.EmailVerifiedAt = timePtr(verifiedAt)
 	return user, nil
 }
 
 func (r *UserRepository) DeleteUser(ctx context.Context, id string) error {
 	query, args, err := r.sq.Update("users").
-		Set("deletedAt", sq.Expr("now()")).
+		Set("deletedAt", currentTime(r.now)).
 		Where(sq.Eq{"id": id}).
 		ToSql()
 	if err != nil {
 		return fmt.Errorf("DeleteUser: failed to build query: %w", err)
 	}
 
-	res, err := r.db.ExecContext(ctx, query, args...)
+	res, err := r.conn(ctx).ExecContext(ctx, query, args...)
 	if err != nil {
 		return fmt.Errorf("DeleteUser: failed to delete user: %w", err)
 	}
@@ -114,21 +220,104 @@ func (r *UserRepository) DeleteUser(ctx context.Context, id string) error {
 	return nil
 }
 
+func (r *UserRepository) RestoreUser(ctx context.Context, id string) error {
+	query, args, err := r.sq.Update("users").
+		Set("deletedAt", nil).Set("updatedAt", currentTime(r.now)).
+		Where(sq.And{sq.Eq{"id": id}, sq.NotEq{"deletedAt": nil}}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("RestoreUser: failed to build query: %w", err)
+	}
+
+	res, err := r.conn(ctx).ExecContext(ctx, query, args...)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return domain.ErrEmailTaken
+		}
+		return fmt.Errorf("RestoreUser: failed to restore user: %w", err)
+	}
+
+	affectedAmount, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("RestoreUser: failed to get RowsAffected: %w", err)
+	}
+	if affectedAmount == 0 {
+		return domain.ErrUserNotFound
+	}
+
+	return nil
+}
+
+func (r *UserRepository) VerifyEmail(ctx context.Context, id, email string, at time.Time) error {
+	query, args, err := r.sq.Update("users").
+		Set("emailVerifiedAt", sq.Expr("COALESCE(emailVerifiedAt, ?)", at.UTC())).
+		Where(sq.Eq{"id": id, "email": email, "deletedAt": nil}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("VerifyEmail: failed to build query: %w", err)
+	}
+
+	res, err := r.conn(ctx).ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("VerifyEmail: failed to update user: %w", err)
+	}
+
+	affectedAmount, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("VerifyEmail: failed to get RowsAffected: %w", err)
+	}
+	if affectedAmount == 0 {
+		return domain.ErrUserNotFound
+	}
+
+	return nil
+}
+
+// SeedUsers inserts the records as is or overwrites the existing ones with the same id.
+func (r *UserRepository) SeedUsers(ctx context.Context, records []domain.UserRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	q := r.sq.Insert("users").
+		Columns("id", "username", "email", "emailVerifiedAt", "createdAt", "updatedAt", "deletedAt")
+	for _, rec := range records {
+		q = q.Values(rec.ID, rec.Username, nullString(rec.Email), nullTime(rec.EmailVerifiedAt), rec.CreatedAt, rec.UpdatedAt, rec.DeletedAt)
+	}
+	query, args, err := q.Suffix(`ON CONFLICT (id) DO UPDATE SET
+		username = EXCLUDED.username,
+		email = EXCLUDED.email,
+		emailVerifiedAt = EXCLUDED.emailVerifiedAt,
+		createdAt = EXCLUDED.createdAt,
+		updatedAt = EXCLUDED.updatedAt,
+		deletedAt = EXCLUDED.deletedAt`).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("SeedUsers: failed to build query: %w", err)
+	}
+
+	if _, err := r.conn(ctx).ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("SeedUsers: failed to insert users: %w", err)
+	}
+
+	return nil
+}
+
 func (r *UserRepository) ListUsers(ctx context.Context, filter domain.UserFilter) ([]domain.User, int, error) {
 	var count int
 	var users []domain.User
-	subQ := r.sq.Select("id", "username", "COUNT(*) OVER () AS total").
+	subQ := r.sq.Select("id", "username", "email", "emailVerifiedAt", "COUNT(*) OVER () AS total").
 		Where(sq.Eq{"deletedAt": nil}).Limit(uint64(filter.Limit)).
 		Offset(uint64(filter.Offset)).
 		OrderBy("createdAt DESC").From("users")
-	query, args, err := r.sq.Select("id", "username", "total").
+	query, args, err := r.sq.Select("id", "username", "email", "emailVerifiedAt", "total").
 		FromSelect(subQ, "sub").
 		ToSql()
 	if err != nil {
 		return users, 0, fmt.Errorf("ListUsers: failed to build query: %w", err)
 	}
 
-	rows, err := r.db.QueryxContext(ctx, query, args...)
+	rows, err := r.conn(ctx).QueryxContext(ctx, query, args...)
 	if err != nil {
 		return users, 0, fmt.Errorf("ListUsers: failed to list users: %w", err)
 	}
@@ -136,11 +325,34 @@ func (r *UserRepository) ListUsers(ctx context.Context, filter domain.UserFilter
 
 	for rows.Next() {
 		var user domain.User
-		if err := rows.Scan(&user.ID, &user.Username, &count); err != nil {
+		var email sql.NullString
+		var verifiedAt sql.NullTime
+		if err := rows.Scan(&user.ID, &user.Username, &email, &verifiedAt, &count); err != nil {
 			return users, 0, fmt.Errorf("ListUsers: failed to scan user: %w", err)
 		}
+		user.Email = email.String
+		user.EmailVerifiedAt = timePtr(verifiedAt)
 		users = append(users, user)
 	}
+	if err := rows.Err(); err != nil {
+		return users, 0, fmt.Errorf("ListUsers: failed to list users: %w", err)
+	}
+	// the window count comes with the rows, a page past the end needs its own
+	if len(users) == 0 && filter.Offset > 0 {
+		return r.countUsers(ctx)
+	}
 
 	return users, count, nil
 }
+
+func (r *UserRepository) countUsers(ctx context.Context) ([]domain.User, int, error) {
+	query, args, err := r.sq.Select("COUNT(*)").From("users").Where(sq.Eq{"deletedAt": nil}).ToSql()
+	if err != nil {
+		return nil, 0, fmt.Errorf("ListUsers: failed to build count query: %w", err)
+	}
+	var count int
+	if err := r.conn(ctx).QueryRowxContext(ctx, query, args...).Scan(&count); err != nil {
+		return nil, 0, fmt.Errorf("ListUsers: failed to count users: %w", err)
+	}
+	return nil, count, nil
+}
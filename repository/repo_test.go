@@ -0,0 +1,177 @@
+//go:build integration
+
+package repository_test
+
+import (
+	"context"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/migrations"
+	"github.com/dennypenta/go-api-walkthrough/pkg/testdb"
+	"github.com/dennypenta/go-api-walkthrough/repository"
+	"github.com/dennypenta/go-api-walkthrough/repository/repotest"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+var template *testdb.Template
+
+func TestMain(m *testing.M) {
+	tpl, err := testdb.NewTemplate(context.Background(), testdb.AdminDSN(), migrations.FS)
+	if err != nil {
+		log.Fatalln("failed to create template database:", err)
+	}
+	template = tpl
+
+	code := m.Run()
+
+	if err := tpl.Close(); err != nil {
+		log.Println("failed to drop template database:", err)
+	}
+	os.Exit(code)
+}
+
+func TestUserRepository(t *testing.T) {
+	t.Parallel()
+
+	repotest.TestUserRepository(t, func(t *testing.T) repotest.UserRepository {
+		db, err := sqlx.Connect("pgx", template.New(t))
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			db.Close()
+		})
+
+		return repository.NewUserRepository(db)
+	})
+
+	t.Run("app clock and ids", func(t *testing.T) {
+		t.Parallel()
+
+		repotest.TestUserRepository(t, func(t *testing.T) repotest.UserRepository {
+			db, err := sqlx.Connect("pgx", template.New(t))
+			require.NoError(t, err)
+			t.Cleanup(func() {
+				db.Close()
+			})
+
+			return repository.NewUserRepository(db).WithClock(time.Now).WithIDGenerator(uuid.NewString)
+		})
+	})
+}
+
+func TestCredentialRepository(t *testing.T) {
+	t.Parallel()
+
+	repotest.TestCredentialRepository(t, func(t *testing.T) (repotest.UserRepository, domain.CredentialRepository) {
+		db, err := sqlx.Connect("pgx", template.New(t))
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			db.Close()
+		})
+
+		return repository.NewUserRepository(db), repository.NewCredentialRepository(db)
+	})
+}
+
+func TestRefreshTokenRepository(t *testing.T) {
+	t.Parallel()
+
+	repotest.TestRefreshTokenRepository(t, func(t *testing.T) (repotest.UserRepository, domain.SessionRepository, domain.RefreshTokenRepository) {
+		db, err := sqlx.Connect("pgx", template.New(t))
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			db.Close()
+		})
+
+		return repository.NewUserRepository(db), repository.NewSessionRepository(db), repository.NewRefreshTokenRepository(db)
+	})
+}
+
+func TestSessionRepository(t *testing.T) {
+	t.Parallel()
+
+	repotest.TestSessionRepository(t, func(t *testing.T) (repotest.UserRepository, domain.SessionRepository) {
+		db, err := sqlx.Connect("pgx", template.New(t))
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			db.Close()
+		})
+
+		return repository.NewUserRepository(db), repository.NewSessionRepository(db)
+	})
+}
+
+func TestTwoFactorRepository(t *testing.T) {
+	t.Parallel()
+
+	repotest.TestTwoFactorRepository(t, func(t *testing.T) (repotest.UserRepository, domain.TwoFactorRepository) {
+		db, err := sqlx.Connect("pgx", template.New(t))
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			db.Close()
+		})
+
+		return repository.NewUserRepository(db), repository.NewTwoFactorRepository(db)
+	})
+}
+
+func TestEmailVerificationRepository(t *testing.T) {
+	t.Parallel()
+
+	repotest.TestEmailVerificationRepository(t, func(t *testing.T) (repotest.UserRepository, domain.EmailVerificationRepository) {
+		db, err := sqlx.Connect("pgx", template.New(t))
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			db.Close()
+		})
+
+		return repository.NewUserRepository(db), repository.NewEmailVerificationRepository(db)
+	})
+}
+
+func TestPasswordResetRepository(t *testing.T) {
+	t.Parallel()
+
+	repotest.TestPasswordResetRepository(t, func(t *testing.T) (repotest.UserRepository, domain.PasswordResetRepository) {
+		db, err := sqlx.Connect("pgx", template.New(t))
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			db.Close()
+		})
+
+		return repository.NewUserRepository(db), repository.NewPasswordResetRepository(db)
+	})
+}
+
+func TestAPIKeyRepository(t *testing.T) {
+	t.Parallel()
+
+	repotest.TestAPIKeyRepository(t, func(t *testing.T) domain.APIKeyRepository {
+		db, err := sqlx.Connect("pgx", template.New(t))
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			db.Close()
+		})
+
+		return repository.NewAPIKeyRepository(db)
+	})
+}
+
+func TestRoleRepository(t *testing.T) {
+	t.Parallel()
+
+	repotest.TestRoleRepository(t, func(t *testing.T) (repotest.UserRepository, domain.RoleRepository) {
+		db, err := sqlx.Connect("pgx", template.New(t))
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			db.Close()
+		})
+
+		return repository.NewUserRepository(db), repository.NewRoleRepository(db)
+	})
+}
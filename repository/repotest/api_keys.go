@@ -0,0 +1,97 @@
+package repotest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newAPIKey(name string, createdAt time.Time) domain.APIKey {
+	return domain.APIKey{
+		ID:        uuid.NewString(),
+		Name:      name,
+		Prefix:    uuid.NewString()[:12],
+		Hash:      uuid.NewString(),
+		Scopes:    []string{domain.ActionListUsers, domain.ActionReadUser},
+		CreatedAt: createdAt,
+	}
+}
+
+// TestAPIKeyRepository runs the api key cases, newRepo must return an empty repository.
+func TestAPIKeyRepository(t *testing.T, newRepo func(t *testing.T) domain.APIKeyRepository) {
+	t.Run("create and get", func(t *testing.T) {
+		t.Parallel()
+		keys := newRepo(t)
+		ctx := context.Background()
+
+		expiresAt := baseTime.Add(time.Hour)
+		key := newAPIKey("batch", baseTime)
+		key.ExpiresAt = &expiresAt
+		require.NoError(t, keys.CreateAPIKey(ctx, key))
+
+		got, err := keys.GetAPIKeyByPrefix(ctx, key.Prefix)
+		require.NoError(t, err)
+		assert.Equal(t, key, got)
+
+		_, err = keys.GetAPIKeyByPrefix(ctx, "unknown")
+		assert.ErrorIs(t, err, domain.ErrAPIKeyNotFound)
+	})
+
+	t.Run("list", func(t *testing.T) {
+		t.Parallel()
+		keys := newRepo(t)
+		ctx := context.Background()
+
+		older := newAPIKey("older", baseTime)
+		newer := newAPIKey("newer", baseTime.Add(time.Minute))
+		for _, k := range []domain.APIKey{older, newer} {
+			require.NoError(t, keys.CreateAPIKey(ctx, k))
+		}
+
+		got, err := keys.ListAPIKeys(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []domain.APIKey{newer, older}, got)
+	})
+
+	t.Run("touch", func(t *testing.T) {
+		t.Parallel()
+		keys := newRepo(t)
+		ctx := context.Background()
+
+		key := newAPIKey("batch", baseTime)
+		require.NoError(t, keys.CreateAPIKey(ctx, key))
+
+		usedAt := baseTime.Add(time.Hour)
+		require.NoError(t, keys.TouchAPIKey(ctx, key.ID, usedAt))
+		got, err := keys.GetAPIKeyByPrefix(ctx, key.Prefix)
+		require.NoError(t, err)
+		require.NotNil(t, got.LastUsedAt)
+		assert.Equal(t, usedAt, *got.LastUsedAt)
+	})
+
+	t.Run("revoke", func(t *testing.T) {
+		t.Parallel()
+		keys := newRepo(t)
+		ctx := context.Background()
+
+		key, other := newAPIKey("batch", baseTime), newAPIKey("other", baseTime)
+		for _, k := range []domain.APIKey{key, other} {
+			require.NoError(t, keys.CreateAPIKey(ctx, k))
+		}
+
+		require.NoError(t, keys.RevokeAPIKey(ctx, key.ID))
+		_, err := keys.GetAPIKeyByPrefix(ctx, key.Prefix)
+		assert.ErrorIs(t, err, domain.ErrAPIKeyNotFound)
+		got, err := keys.ListAPIKeys(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []domain.APIKey{other}, got)
+
+		assert.ErrorIs(t, keys.RevokeAPIKey(ctx, key.ID), domain.ErrAPIKeyNotFound)
+		assert.ErrorIs(t, keys.RevokeAPIKey(ctx, uuid.NewString()), domain.ErrAPIKeyNotFound)
+	})
+}
@@ -0,0 +1,77 @@
+package repotest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCredentialRepository runs the credential cases, newRepos must return empty repositories sharing the storage.
+func TestCredentialRepository(t *testing.T, newRepos func(t *testing.T) (UserRepository, domain.CredentialRepository)) {
+	t.Run("set and get", func(t *testing.T) {
+		t.Parallel()
+		users, creds := newRepos(t)
+		ctx := context.Background()
+		records := seed(t, users, "alice")
+
+		c := domain.Credentials{UserID: records[0].ID, Login: "alice", PasswordHash: "hash"}
+		require.NoError(t, creds.SetCredentials(ctx, c))
+		got, err := creds.GetCredentialsByLogin(ctx, "alice")
+		require.NoError(t, err)
+		assert.Equal(t, c, got)
+		got, err = creds.GetCredentials(ctx, records[0].ID)
+		require.NoError(t, err)
+		assert.Equal(t, c, got)
+
+		// the login and the password are replaced
+		c = domain.Credentials{UserID: records[0].ID, Login: "alice2", PasswordHash: "hash2"}
+		require.NoError(t, creds.SetCredentials(ctx, c))
+		got, err = creds.GetCredentialsByLogin(ctx, "alice2")
+		require.NoError(t, err)
+		assert.Equal(t, c, got)
+		_, err = creds.GetCredentialsByLogin(ctx, "alice")
+		assert.ErrorIs(t, err, domain.ErrCredentialsNotFound)
+	})
+
+	t.Run("unknown user", func(t *testing.T) {
+		t.Parallel()
+		_, creds := newRepos(t)
+
+		err := creds.SetCredentials(context.Background(), domain.Credentials{UserID: uuid.NewString(), Login: "alice", PasswordHash: "hash"})
+		assert.ErrorIs(t, err, domain.ErrUserNotFound)
+		_, err = creds.GetCredentials(context.Background(), uuid.NewString())
+		assert.ErrorIs(t, err, domain.ErrCredentialsNotFound)
+	})
+
+	t.Run("login taken", func(t *testing.T) {
+		t.Parallel()
+		users, creds := newRepos(t)
+		ctx := context.Background()
+		records := seed(t, users, "alice", "bob")
+
+		require.NoError(t, creds.SetCredentials(ctx, domain.Credentials{UserID: records[0].ID, Login: "alice", PasswordHash: "hash"}))
+		err := creds.SetCredentials(ctx, domain.Credentials{UserID: records[1].ID, Login: "alice", PasswordHash: "hash"})
+		assert.ErrorIs(t, err, domain.ErrLoginTaken)
+	})
+
+	t.Run("deleted user can't sign in", func(t *testing.T) {
+		t.Parallel()
+		users, creds := newRepos(t)
+		ctx := context.Background()
+		records := seed(t, users, "alice")
+
+		require.NoError(t, creds.SetCredentials(ctx, domain.Credentials{UserID: records[0].ID, Login: "alice", PasswordHash: "hash"}))
+		require.NoError(t, users.DeleteUser(ctx, records[0].ID))
+
+		_, err := creds.GetCredentialsByLogin(ctx, "alice")
+		assert.ErrorIs(t, err, domain.ErrCredentialsNotFound)
+		_, err = creds.GetCredentials(ctx, records[0].ID)
+		assert.ErrorIs(t, err, domain.ErrCredentialsNotFound)
+		err = creds.SetCredentials(ctx, domain.Credentials{UserID: records[0].ID, Login: "alice", PasswordHash: "hash"})
+		assert.ErrorIs(t, err, domain.ErrUserNotFound)
+	})
+}
@@ -0,0 +1,85 @@
+package repotest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newEmailVerification(userID, hash string, createdAt time.Time) domain.EmailVerification {
+	return domain.EmailVerification{
+		ID:        uuid.NewString(),
+		UserID:    userID,
+		Email:     "alice@example.com",
+		Hash:      hash,
+		CreatedAt: createdAt,
+		ExpiresAt: createdAt.Add(24 * time.Hour),
+	}
+}
+
+// TestEmailVerificationRepository runs the email verification cases,
+// newRepos must return empty repositories sharing the storage.
+func TestEmailVerificationRepository(t *testing.T, newRepos func(t *testing.T) (UserRepository, domain.EmailVerificationRepository)) {
+	t.Run("consume once", func(t *testing.T) {
+		t.Parallel()
+		users, repo := newRepos(t)
+		ctx := context.Background()
+		records := seed(t, users, "alice")
+		v := newEmailVerification(records[0].ID, "hash", baseTime)
+		require.NoError(t, repo.CreateEmailVerification(ctx, v))
+
+		got, err := repo.ConsumeEmailVerification(ctx, "hash", baseTime.Add(time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, v, got)
+
+		_, err = repo.ConsumeEmailVerification(ctx, "hash", baseTime.Add(time.Hour))
+		assert.ErrorIs(t, err, domain.ErrEmailVerificationNotFound)
+		_, err = repo.ConsumeEmailVerification(ctx, "unknown", baseTime)
+		assert.ErrorIs(t, err, domain.ErrEmailVerificationNotFound)
+	})
+
+	t.Run("expires", func(t *testing.T) {
+		t.Parallel()
+		users, repo := newRepos(t)
+		ctx := context.Background()
+		records := seed(t, users, "alice")
+		expired := newEmailVerification(records[0].ID, "expired", baseTime)
+		require.NoError(t, repo.CreateEmailVerification(ctx, expired))
+
+		_, err := repo.ConsumeEmailVerification(ctx, "expired", expired.ExpiresAt)
+		assert.ErrorIs(t, err, domain.ErrEmailVerificationNotFound)
+
+		// a new verification takes the expired ones away
+		fresh := newEmailVerification(records[0].ID, "fresh", expired.ExpiresAt)
+		require.NoError(t, repo.CreateEmailVerification(ctx, fresh))
+		got, err := repo.RecentEmailVerifications(ctx, records[0].ID, baseTime.Add(-time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, []time.Time{fresh.CreatedAt}, got)
+	})
+
+	t.Run("recent", func(t *testing.T) {
+		t.Parallel()
+		users, repo := newRepos(t)
+		ctx := context.Background()
+		records := seed(t, users, "alice", "bob")
+		alice, bob := records[0].ID, records[1].ID
+		for i, at := range []time.Time{baseTime.Add(2 * time.Minute), baseTime, baseTime.Add(time.Minute)} {
+			require.NoError(t, repo.CreateEmailVerification(ctx, newEmailVerification(alice, fmt.Sprintf("alice-%d", i), at)))
+		}
+		require.NoError(t, repo.CreateEmailVerification(ctx, newEmailVerification(bob, "bob", baseTime.Add(time.Minute))))
+
+		got, err := repo.RecentEmailVerifications(ctx, alice, baseTime)
+		require.NoError(t, err)
+		assert.Equal(t, []time.Time{baseTime.Add(time.Minute), baseTime.Add(2 * time.Minute)}, got)
+
+		got, err = repo.RecentEmailVerifications(ctx, uuid.NewString(), baseTime)
+		require.NoError(t, err)
+		assert.Empty(t, got)
+	})
+}
@@ -0,0 +1,89 @@
+package repotest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newPasswordReset(userID, hash string, createdAt time.Time) domain.PasswordReset {
+	return domain.PasswordReset{
+		ID:        uuid.NewString(),
+		UserID:    userID,
+		Login:     "alice",
+		Hash:      hash,
+		CreatedAt: createdAt,
+		ExpiresAt: createdAt.Add(time.Hour),
+	}
+}
+
+// TestPasswordResetRepository runs the password reset cases,
+// newRepos must return empty repositories sharing the storage.
+func TestPasswordResetRepository(t *testing.T, newRepos func(t *testing.T) (UserRepository, domain.PasswordResetRepository)) {
+	t.Run("use once", func(t *testing.T) {
+		t.Parallel()
+		users, repo := newRepos(t)
+		ctx := context.Background()
+		records := seed(t, users, "alice")
+		r := newPasswordReset(records[0].ID, "hash", baseTime)
+		require.NoError(t, repo.CreatePasswordReset(ctx, r))
+
+		got, err := repo.GetPasswordReset(ctx, "hash")
+		require.NoError(t, err)
+		assert.Equal(t, r, got)
+		got, err = repo.GetUserPasswordReset(ctx, records[0].ID)
+		require.NoError(t, err)
+		assert.Equal(t, r, got)
+
+		require.NoError(t, repo.UsePasswordReset(ctx, r.ID))
+		assert.ErrorIs(t, repo.UsePasswordReset(ctx, r.ID), domain.ErrPasswordResetNotFound)
+		_, err = repo.GetPasswordReset(ctx, "hash")
+		assert.ErrorIs(t, err, domain.ErrPasswordResetNotFound)
+		_, err = repo.GetUserPasswordReset(ctx, records[0].ID)
+		assert.ErrorIs(t, err, domain.ErrPasswordResetNotFound)
+	})
+
+	t.Run("replaced", func(t *testing.T) {
+		t.Parallel()
+		users, repo := newRepos(t)
+		ctx := context.Background()
+		records := seed(t, users, "alice", "bob")
+		first := newPasswordReset(records[0].ID, "first", baseTime)
+		require.NoError(t, repo.CreatePasswordReset(ctx, first))
+		bob := newPasswordReset(records[1].ID, "bob", baseTime)
+		require.NoError(t, repo.CreatePasswordReset(ctx, bob))
+
+		second := newPasswordReset(records[0].ID, "second", baseTime.Add(time.Minute))
+		require.NoError(t, repo.CreatePasswordReset(ctx, second))
+		_, err := repo.GetPasswordReset(ctx, "first")
+		assert.ErrorIs(t, err, domain.ErrPasswordResetNotFound)
+		assert.ErrorIs(t, repo.UsePasswordReset(ctx, first.ID), domain.ErrPasswordResetNotFound)
+		got, err := repo.GetUserPasswordReset(ctx, records[0].ID)
+		require.NoError(t, err)
+		assert.Equal(t, second, got)
+
+		// the other users keep theirs
+		got, err = repo.GetPasswordReset(ctx, "bob")
+		require.NoError(t, err)
+		assert.Equal(t, bob, got)
+	})
+
+	t.Run("deleted user", func(t *testing.T) {
+		t.Parallel()
+		users, repo := newRepos(t)
+		ctx := context.Background()
+		records := seed(t, users, "alice")
+		require.NoError(t, repo.CreatePasswordReset(ctx, newPasswordReset(records[0].ID, "hash", baseTime)))
+		require.NoError(t, users.DeleteUser(ctx, records[0].ID))
+
+		_, err := repo.GetPasswordReset(ctx, "hash")
+		assert.ErrorIs(t, err, domain.ErrPasswordResetNotFound)
+		_, err = repo.GetUserPasswordReset(ctx, uuid.NewString())
+		assert.ErrorIs(t, err, domain.ErrPasswordResetNotFound)
+	})
+}
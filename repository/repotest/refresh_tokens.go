@@ -0,0 +1,100 @@
+package repotest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRefreshTokenRepository runs the refresh token cases, newRepos must return empty repositories sharing the storage.
+func TestRefreshTokenRepository(t *testing.T, newRepos func(t *testing.T) (UserRepository, domain.SessionRepository, domain.RefreshTokenRepository)) {
+	// newToken issues the token under a new session unless one is given
+	newToken := func(t *testing.T, sessions domain.SessionRepository, userID, sessionID string) domain.RefreshToken {
+		if sessionID == "" {
+			s := newSession(userID, baseTime)
+			require.NoError(t, sessions.CreateSession(context.Background(), s))
+			sessionID = s.ID
+		}
+		return domain.RefreshToken{
+			ID:        uuid.NewString(),
+			SessionID: sessionID,
+			UserID:    userID,
+			Hash:      uuid.NewString(),
+			ExpiresAt: baseTime.Add(time.Hour),
+		}
+	}
+
+	t.Run("create and use", func(t *testing.T) {
+		t.Parallel()
+		users, sessions, tokens := newRepos(t)
+		ctx := context.Background()
+		records := seed(t, users, "alice")
+
+		token := newToken(t, sessions, records[0].ID, "")
+		require.NoError(t, tokens.CreateRefreshToken(ctx, token))
+		got, err := tokens.GetRefreshToken(ctx, token.Hash)
+		require.NoError(t, err)
+		assert.Equal(t, token, got)
+
+		require.NoError(t, tokens.UseRefreshToken(ctx, token.ID))
+		got, err = tokens.GetRefreshToken(ctx, token.Hash)
+		require.NoError(t, err)
+		assert.True(t, got.Used)
+
+		// only the first exchange wins
+		assert.ErrorIs(t, tokens.UseRefreshToken(ctx, token.ID), domain.ErrRefreshTokenReused)
+	})
+
+	t.Run("unknown token", func(t *testing.T) {
+		t.Parallel()
+		_, _, tokens := newRepos(t)
+
+		_, err := tokens.GetRefreshToken(context.Background(), "unknown")
+		assert.ErrorIs(t, err, domain.ErrRefreshTokenNotFound)
+	})
+
+	t.Run("revoke session", func(t *testing.T) {
+		t.Parallel()
+		users, sessions, tokens := newRepos(t)
+		ctx := context.Background()
+		records := seed(t, users, "alice")
+
+		first := newToken(t, sessions, records[0].ID, "")
+		second := newToken(t, sessions, records[0].ID, first.SessionID)
+		other := newToken(t, sessions, records[0].ID, "")
+		for _, token := range []domain.RefreshToken{first, second, other} {
+			require.NoError(t, tokens.CreateRefreshToken(ctx, token))
+		}
+
+		require.NoError(t, sessions.RevokeSession(ctx, records[0].ID, first.SessionID))
+		for _, token := range []domain.RefreshToken{first, second} {
+			got, err := tokens.GetRefreshToken(ctx, token.Hash)
+			require.NoError(t, err)
+			assert.True(t, got.Revoked)
+		}
+		assert.ErrorIs(t, tokens.UseRefreshToken(ctx, second.ID), domain.ErrRefreshTokenReused)
+
+		got, err := tokens.GetRefreshToken(ctx, other.Hash)
+		require.NoError(t, err)
+		assert.False(t, got.Revoked)
+	})
+
+	t.Run("deleted user", func(t *testing.T) {
+		t.Parallel()
+		users, sessions, tokens := newRepos(t)
+		ctx := context.Background()
+		records := seed(t, users, "alice")
+
+		token := newToken(t, sessions, records[0].ID, "")
+		require.NoError(t, tokens.CreateRefreshToken(ctx, token))
+		require.NoError(t, users.DeleteUser(ctx, records[0].ID))
+
+		_, err := tokens.GetRefreshToken(ctx, token.Hash)
+		assert.ErrorIs(t, err, domain.ErrRefreshTokenNotFound)
+	})
+}
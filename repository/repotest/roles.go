@@ -0,0 +1,59 @@
+package repotest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRoleRepository runs the role cases, newRepos must return empty repositories sharing the storage.
+func TestRoleRepository(t *testing.T, newRepos func(t *testing.T) (UserRepository, domain.RoleRepository)) {
+	t.Run("set and get", func(t *testing.T) {
+		t.Parallel()
+		users, roles := newRepos(t)
+		ctx := context.Background()
+		records := seed(t, users, "alice", "bob")
+
+		got, err := roles.GetRoles(ctx, records[0].ID)
+		require.NoError(t, err)
+		assert.Empty(t, got)
+
+		require.NoError(t, roles.SetRoles(ctx, records[0].ID, []string{domain.RoleSupport, domain.RoleAdmin}))
+		got, err = roles.GetRoles(ctx, records[0].ID)
+		require.NoError(t, err)
+		assert.Equal(t, []string{domain.RoleAdmin, domain.RoleSupport}, got)
+
+		// the roles are replaced
+		require.NoError(t, roles.SetRoles(ctx, records[0].ID, []string{domain.RoleMember}))
+		got, err = roles.GetRoles(ctx, records[0].ID)
+		require.NoError(t, err)
+		assert.Equal(t, []string{domain.RoleMember}, got)
+
+		got, err = roles.GetRoles(ctx, records[1].ID)
+		require.NoError(t, err)
+		assert.Empty(t, got)
+	})
+
+	t.Run("unknown user", func(t *testing.T) {
+		t.Parallel()
+		_, roles := newRepos(t)
+
+		err := roles.SetRoles(context.Background(), uuid.NewString(), []string{domain.RoleAdmin})
+		assert.ErrorIs(t, err, domain.ErrUserNotFound)
+	})
+
+	t.Run("deleted user", func(t *testing.T) {
+		t.Parallel()
+		users, roles := newRepos(t)
+		ctx := context.Background()
+		records := seed(t, users, "alice")
+		require.NoError(t, users.DeleteUser(ctx, records[0].ID))
+
+		err := roles.SetRoles(ctx, records[0].ID, []string{domain.RoleAdmin})
+		assert.ErrorIs(t, err, domain.ErrUserNotFound)
+	})
+}
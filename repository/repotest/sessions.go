@@ -0,0 +1,160 @@
+package repotest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newSession(userID string, lastSeenAt time.Time) domain.Session {
+	return domain.Session{
+		ID:         uuid.NewString(),
+		UserID:     userID,
+		Device:     "laptop",
+		UserAgent:  "curl/8.0",
+		IP:         "192.0.2.1",
+		CreatedAt:  baseTime,
+		LastSeenAt: lastSeenAt,
+	}
+}
+
+// TestSessionRepository runs the session cases, newRepos must return empty repositories sharing the storage.
+func TestSessionRepository(t *testing.T, newRepos func(t *testing.T) (UserRepository, domain.SessionRepository)) {
+	t.Run("create and list", func(t *testing.T) {
+		t.Parallel()
+		users, sessions := newRepos(t)
+		ctx := context.Background()
+		records := seed(t, users, "alice", "bob")
+
+		older := newSession(records[0].ID, baseTime)
+		newer := newSession(records[0].ID, baseTime.Add(time.Minute))
+		other := newSession(records[1].ID, baseTime)
+		for _, s := range []domain.Session{older, newer, other} {
+			require.NoError(t, sessions.CreateSession(ctx, s))
+		}
+
+		got, err := sessions.ListSessions(ctx, records[0].ID)
+		require.NoError(t, err)
+		assert.Equal(t, []domain.Session{newer, older}, got)
+
+		active, err := sessions.IsSessionActive(ctx, older.ID)
+		require.NoError(t, err)
+		assert.True(t, active)
+	})
+
+	t.Run("touch", func(t *testing.T) {
+		t.Parallel()
+		users, sessions := newRepos(t)
+		ctx := context.Background()
+		records := seed(t, users, "alice")
+
+		s := newSession(records[0].ID, baseTime)
+		require.NoError(t, sessions.CreateSession(ctx, s))
+
+		seenAt := baseTime.Add(time.Hour)
+		client := domain.Client{Device: "renamed", UserAgent: "Firefox", IP: "198.51.100.7"}
+		require.NoError(t, sessions.TouchSession(ctx, s.ID, client, seenAt))
+
+		got, err := sessions.ListSessions(ctx, records[0].ID)
+		require.NoError(t, err)
+		require.Len(t, got, 1)
+		// the device is named on sign in only
+		assert.Equal(t, "laptop", got[0].Device)
+		assert.Equal(t, "Firefox", got[0].UserAgent)
+		assert.Equal(t, "198.51.100.7", got[0].IP)
+		assert.Equal(t, seenAt, got[0].LastSeenAt)
+
+		err = sessions.TouchSession(ctx, uuid.NewString(), client, seenAt)
+		assert.ErrorIs(t, err, domain.ErrSessionNotFound)
+	})
+
+	t.Run("revoke", func(t *testing.T) {
+		t.Parallel()
+		users, sessions := newRepos(t)
+		ctx := context.Background()
+		records := seed(t, users, "alice", "bob")
+
+		s := newSession(records[0].ID, baseTime)
+		require.NoError(t, sessions.CreateSession(ctx, s))
+
+		// the session of another user isn't found
+		assert.ErrorIs(t, sessions.RevokeSession(ctx, records[1].ID, s.ID), domain.ErrSessionNotFound)
+
+		require.NoError(t, sessions.RevokeSession(ctx, records[0].ID, s.ID))
+		active, err := sessions.IsSessionActive(ctx, s.ID)
+		require.NoError(t, err)
+		assert.False(t, active)
+
+		got, err := sessions.ListSessions(ctx, records[0].ID)
+		require.NoError(t, err)
+		assert.Empty(t, got)
+
+		assert.ErrorIs(t, sessions.RevokeSession(ctx, records[0].ID, s.ID), domain.ErrSessionNotFound)
+		assert.ErrorIs(t, sessions.TouchSession(ctx, s.ID, domain.Client{}, baseTime), domain.ErrSessionNotFound)
+	})
+
+	t.Run("revoke others", func(t *testing.T) {
+		t.Parallel()
+		users, sessions := newRepos(t)
+		ctx := context.Background()
+		records := seed(t, users, "alice", "bob")
+
+		current := newSession(records[0].ID, baseTime)
+		first := newSession(records[0].ID, baseTime)
+		second := newSession(records[0].ID, baseTime)
+		other := newSession(records[1].ID, baseTime)
+		for _, s := range []domain.Session{current, first, second, other} {
+			require.NoError(t, sessions.CreateSession(ctx, s))
+		}
+
+		ids, err := sessions.RevokeOtherSessions(ctx, records[0].ID, current.ID)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{first.ID, second.ID}, ids)
+
+		got, err := sessions.ListSessions(ctx, records[0].ID)
+		require.NoError(t, err)
+		assert.Equal(t, []domain.Session{current}, got)
+
+		active, err := sessions.IsSessionActive(ctx, other.ID)
+		require.NoError(t, err)
+		assert.True(t, active)
+
+		// without a session to keep every one goes
+		ids, err = sessions.RevokeOtherSessions(ctx, records[0].ID, "")
+		require.NoError(t, err)
+		assert.Equal(t, []string{current.ID}, ids)
+	})
+
+	t.Run("unknown session", func(t *testing.T) {
+		t.Parallel()
+		_, sessions := newRepos(t)
+
+		active, err := sessions.IsSessionActive(context.Background(), uuid.NewString())
+		require.NoError(t, err)
+		assert.False(t, active)
+	})
+
+	t.Run("deleted user", func(t *testing.T) {
+		t.Parallel()
+		users, sessions := newRepos(t)
+		ctx := context.Background()
+		records := seed(t, users, "alice")
+
+		s := newSession(records[0].ID, baseTime)
+		require.NoError(t, sessions.CreateSession(ctx, s))
+		require.NoError(t, users.DeleteUser(ctx, records[0].ID))
+
+		active, err := sessions.IsSessionActive(ctx, s.ID)
+		require.NoError(t, err)
+		assert.False(t, active)
+
+		got, err := sessions.ListSessions(ctx, records[0].ID)
+		require.NoError(t, err)
+		assert.Empty(t, got)
+	})
+}
@@ -0,0 +1,138 @@
+package repotest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newChallenge(userID, hash string, createdAt time.Time) domain.TwoFactorChallenge {
+	return domain.TwoFactorChallenge{
+		ID:        uuid.NewString(),
+		UserID:    userID,
+		Hash:      hash,
+		Device:    "phone",
+		CreatedAt: createdAt,
+		ExpiresAt: createdAt.Add(5 * time.Minute),
+	}
+}
+
+// TestTwoFactorRepository runs the second factor cases, newRepos must return empty repositories sharing the storage.
+func TestTwoFactorRepository(t *testing.T, newRepos func(t *testing.T) (UserRepository, domain.TwoFactorRepository)) {
+	t.Run("enroll and enable", func(t *testing.T) {
+		t.Parallel()
+		users, repo := newRepos(t)
+		ctx := context.Background()
+		records := seed(t, users, "alice")
+		userID := records[0].ID
+
+		_, err := repo.GetTOTP(ctx, userID)
+		assert.ErrorIs(t, err, domain.ErrTOTPNotFound)
+
+		require.NoError(t, repo.SetTOTPSecret(ctx, userID, "FIRST"))
+		// the enrollment starts again until it's confirmed
+		require.NoError(t, repo.SetTOTPSecret(ctx, userID, "SECOND"))
+		got, err := repo.GetTOTP(ctx, userID)
+		require.NoError(t, err)
+		assert.Equal(t, domain.TOTP{UserID: userID, Secret: "SECOND"}, got)
+
+		require.NoError(t, repo.EnableTOTP(ctx, userID, baseTime, []string{"hash1", "hash2"}))
+		got, err = repo.GetTOTP(ctx, userID)
+		require.NoError(t, err)
+		require.NotNil(t, got.EnabledAt)
+		assert.Equal(t, baseTime, *got.EnabledAt)
+		assert.Equal(t, "SECOND", got.Secret)
+
+		assert.ErrorIs(t, repo.EnableTOTP(ctx, userID, baseTime, nil), domain.ErrTOTPEnabled)
+		assert.ErrorIs(t, repo.SetTOTPSecret(ctx, userID, "THIRD"), domain.ErrTOTPEnabled)
+		assert.ErrorIs(t, repo.SetTOTPSecret(ctx, uuid.NewString(), "THIRD"), domain.ErrUserNotFound)
+		assert.ErrorIs(t, repo.EnableTOTP(ctx, uuid.NewString(), baseTime, nil), domain.ErrTOTPEnabled)
+
+		require.NoError(t, users.DeleteUser(ctx, userID))
+		_, err = repo.GetTOTP(ctx, userID)
+		assert.ErrorIs(t, err, domain.ErrTOTPNotFound)
+	})
+
+	t.Run("a step is used once", func(t *testing.T) {
+		t.Parallel()
+		users, repo := newRepos(t)
+		ctx := context.Background()
+		records := seed(t, users, "alice")
+		userID := records[0].ID
+		require.NoError(t, repo.SetTOTPSecret(ctx, userID, "SECRET"))
+
+		require.NoError(t, repo.UseTOTPStep(ctx, userID, 100))
+		assert.ErrorIs(t, repo.UseTOTPStep(ctx, userID, 100), domain.ErrTOTPCodeUsed)
+		// an earlier code is older than the accepted one
+		assert.ErrorIs(t, repo.UseTOTPStep(ctx, userID, 99), domain.ErrTOTPCodeUsed)
+		require.NoError(t, repo.UseTOTPStep(ctx, userID, 101))
+
+		got, err := repo.GetTOTP(ctx, userID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(101), got.LastUsedStep)
+		assert.ErrorIs(t, repo.UseTOTPStep(ctx, uuid.NewString(), 1), domain.ErrTOTPCodeUsed)
+	})
+
+	t.Run("a recovery code is used once", func(t *testing.T) {
+		t.Parallel()
+		users, repo := newRepos(t)
+		ctx := context.Background()
+		records := seed(t, users, "alice", "bob")
+		alice, bob := records[0].ID, records[1].ID
+		require.NoError(t, repo.SetTOTPSecret(ctx, alice, "SECRET"))
+		require.NoError(t, repo.EnableTOTP(ctx, alice, baseTime, []string{"hash1", "hash2"}))
+
+		require.NoError(t, repo.UseRecoveryCode(ctx, alice, "hash1", baseTime))
+		assert.ErrorIs(t, repo.UseRecoveryCode(ctx, alice, "hash1", baseTime), domain.ErrRecoveryCodeNotFound)
+		assert.ErrorIs(t, repo.UseRecoveryCode(ctx, bob, "hash2", baseTime), domain.ErrRecoveryCodeNotFound)
+		assert.ErrorIs(t, repo.UseRecoveryCode(ctx, alice, "unknown", baseTime), domain.ErrRecoveryCodeNotFound)
+		require.NoError(t, repo.UseRecoveryCode(ctx, alice, "hash2", baseTime))
+	})
+
+	t.Run("challenge attempts", func(t *testing.T) {
+		t.Parallel()
+		users, repo := newRepos(t)
+		ctx := context.Background()
+		records := seed(t, users, "alice")
+		c := newChallenge(records[0].ID, "challenge", baseTime)
+		require.NoError(t, repo.CreateTwoFactorChallenge(ctx, c))
+
+		for attempt := 1; attempt <= 3; attempt++ {
+			got, err := repo.AttemptTwoFactorChallenge(ctx, "challenge", baseTime.Add(time.Minute), 3)
+			require.NoError(t, err)
+			c.Attempts = attempt
+			assert.Equal(t, c, got)
+		}
+		_, err := repo.AttemptTwoFactorChallenge(ctx, "challenge", baseTime.Add(time.Minute), 3)
+		assert.ErrorIs(t, err, domain.ErrTwoFactorChallengeNotFound)
+		_, err = repo.AttemptTwoFactorChallenge(ctx, "unknown", baseTime, 3)
+		assert.ErrorIs(t, err, domain.ErrTwoFactorChallengeNotFound)
+
+		require.NoError(t, repo.DeleteTwoFactorChallenge(ctx, c.ID))
+		assert.ErrorIs(t, repo.DeleteTwoFactorChallenge(ctx, c.ID), domain.ErrTwoFactorChallengeNotFound)
+	})
+
+	t.Run("challenge expires", func(t *testing.T) {
+		t.Parallel()
+		users, repo := newRepos(t)
+		ctx := context.Background()
+		records := seed(t, users, "alice")
+		expired := newChallenge(records[0].ID, "expired", baseTime)
+		require.NoError(t, repo.CreateTwoFactorChallenge(ctx, expired))
+
+		_, err := repo.AttemptTwoFactorChallenge(ctx, "expired", expired.ExpiresAt, 5)
+		assert.ErrorIs(t, err, domain.ErrTwoFactorChallengeNotFound)
+
+		// a new challenge takes the expired ones away
+		fresh := newChallenge(records[0].ID, "fresh", expired.ExpiresAt)
+		require.NoError(t, repo.CreateTwoFactorChallenge(ctx, fresh))
+		assert.ErrorIs(t, repo.DeleteTwoFactorChallenge(ctx, expired.ID), domain.ErrTwoFactorChallengeNotFound)
+		_, err = repo.AttemptTwoFactorChallenge(ctx, "fresh", expired.ExpiresAt, 5)
+		require.NoError(t, err)
+	})
+}
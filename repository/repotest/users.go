@@ -0,0 +1,326 @@
+package repotest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// UserRepository is what a storage implements to pass the suite,
+// seeding is required to set up the known timestamps.
+type UserRepository interface {
+	domain.UserRepository
+	SeedUsers(ctx context.Context, records []domain.UserRecord) error
+}
+
+var baseTime = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// TestUserRepository runs the same cases against any domain.UserRepository implementation,
+// so the storages can't drift apart. newRepo must return an empty repository.
+func TestUserRepository(t *testing.T, newRepo func(t *testing.T) UserRepository) {
+	t.Run("create and get", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		created, err := repo.CreateUser(ctx, domain.User{Username: "alice"})
+		require.NoError(t, err)
+		assert.Len(t, created.ID, 36)
+		assert.Equal(t, "alice", created.Username)
+
+		user, err := repo.GetUserByID(ctx, created.ID)
+		require.NoError(t, err)
+		assert.Equal(t, created, user)
+	})
+
+	t.Run("get unknown user", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+
+		_, err := repo.GetUserByID(context.Background(), uuid.NewString())
+		assert.ErrorIs(t, err, domain.ErrUserNotFound)
+	})
+
+	t.Run("update", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		ctx := context.Background()
+		records := seed(t, repo, "alice")
+
+		updated, err := repo.UpdateUser(ctx, domain.User{ID: records[0].ID, Username: "bob"})
+		require.NoError(t, err)
+		assert.Equal(t, domain.User{ID: records[0].ID, Username: "bob"}, updated)
+
+		user, err := repo.GetUserByID(ctx, records[0].ID)
+		require.NoError(t, err)
+		assert.Equal(t, "bob", user.Username)
+
+		_, err = repo.UpdateUser(ctx, domain.User{ID: uuid.NewString(), Username: "bob"})
+		assert.ErrorIs(t, err, domain.ErrUserNotFound)
+	})
+
+	t.Run("email", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		alice, err := repo.CreateUser(ctx, domain.User{Username: "alice", Email: "alice@example.com"})
+		require.NoError(t, err)
+		_, err = repo.CreateUser(ctx, domain.User{Username: "alice2", Email: "alice@example.com"})
+		assert.ErrorIs(t, err, domain.ErrEmailTaken)
+		// the users without an email don't collide
+		bob, err := repo.CreateUser(ctx, domain.User{Username: "bob"})
+		require.NoError(t, err)
+		_, err = repo.CreateUser(ctx, domain.User{Username: "carol"})
+		require.NoError(t, err)
+
+		bob.Email = "alice@example.com"
+		_, err = repo.UpdateUser(ctx, bob)
+		assert.ErrorIs(t, err, domain.ErrEmailTaken)
+
+		user, err := repo.GetUserByID(ctx, alice.ID)
+		require.NoError(t, err)
+		assert.Equal(t, alice, user)
+		assert.Nil(t, user.EmailVerifiedAt)
+
+		users, _, err := repo.ListUsers(ctx, domain.UserFilter{Limit: 10})
+		require.NoError(t, err)
+		assert.Contains(t, users, alice)
+	})
+
+	t.Run("verify email", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		ctx := context.Background()
+		alice, err := repo.CreateUser(ctx, domain.User{Username: "alice", Email: "alice@example.com"})
+		require.NoError(t, err)
+
+		assert.ErrorIs(t, repo.VerifyEmail(ctx, alice.ID, "other@example.com", baseTime), domain.ErrUserNotFound)
+		assert.ErrorIs(t, repo.VerifyEmail(ctx, uuid.NewString(), "alice@example.com", baseTime), domain.ErrUserNotFound)
+		require.NoError(t, repo.VerifyEmail(ctx, alice.ID, "alice@example.com", baseTime))
+		// the first verification stays
+		require.NoError(t, repo.VerifyEmail(ctx, alice.ID, "alice@example.com", baseTime.Add(time.Hour)))
+
+		user, err := repo.GetUserByID(ctx, alice.ID)
+		require.NoError(t, err)
+		require.NotNil(t, user.EmailVerifiedAt)
+		assert.Equal(t, baseTime, *user.EmailVerifiedAt)
+
+		// renamed with the same email it's still verified
+		updated, err := repo.UpdateUser(ctx, domain.User{ID: alice.ID, Username: "alicia", Email: "alice@example.com"})
+		require.NoError(t, err)
+		require.NotNil(t, updated.EmailVerifiedAt)
+		assert.Equal(t, baseTime, *updated.EmailVerifiedAt)
+
+		updated, err = repo.UpdateUser(ctx, domain.User{ID: alice.ID, Username: "alicia", Email: "alicia@example.com"})
+		require.NoError(t, err)
+		assert.Nil(t, updated.EmailVerifiedAt)
+		user, err = repo.GetUserByID(ctx, alice.ID)
+		require.NoError(t, err)
+		assert.Equal(t, updated, user)
+
+		require.NoError(t, repo.DeleteUser(ctx, alice.ID))
+		assert.ErrorIs(t, repo.VerifyEmail(ctx, alice.ID, "alicia@example.com", baseTime), domain.ErrUserNotFound)
+	})
+
+	t.Run("update username keeps the email", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		ctx := context.Background()
+		alice, err := repo.CreateUser(ctx, domain.User{Username: "alice", Email: "alice@example.com"})
+		require.NoError(t, err)
+		require.NoError(t, repo.VerifyEmail(ctx, alice.ID, "alice@example.com", baseTime))
+
+		updated, err := repo.UpdateUsername(ctx, alice.ID, "alicia")
+		require.NoError(t, err)
+		assert.Equal(t, "alicia", updated.Username)
+		assert.Equal(t, "alice@example.com", updated.Email)
+		require.NotNil(t, updated.EmailVerifiedAt)
+		assert.True(t, baseTime.Equal(*updated.EmailVerifiedAt))
+		user, err := repo.GetUserByID(ctx, alice.ID)
+		require.NoError(t, err)
+		assert.Equal(t, updated, user)
+
+		_, err = repo.UpdateUsername(ctx, uuid.NewString(), "bob")
+		assert.ErrorIs(t, err, domain.ErrUserNotFound)
+	})
+
+	t.Run("update without the email clears it", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		ctx := context.Background()
+		alice, err := repo.CreateUser(ctx, domain.User{Username: "alice", Email: "alice@example.com"})
+		require.NoError(t, err)
+		require.NoError(t, repo.VerifyEmail(ctx, alice.ID, "alice@example.com", baseTime))
+
+		updated, err := repo.UpdateUser(ctx, domain.User{ID: alice.ID, Username: "alicia"})
+		require.NoError(t, err)
+		assert.Equal(t, domain.User{ID: alice.ID, Username: "alicia"}, updated)
+		user, err := repo.GetUserByID(ctx, alice.ID)
+		require.NoError(t, err)
+		assert.Equal(t, updated, user)
+	})
+
+	t.Run("deleted user gives the email up", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		ctx := context.Background()
+		alice, err := repo.CreateUser(ctx, domain.User{Username: "alice", Email: "alice@example.com"})
+		require.NoError(t, err)
+		require.NoError(t, repo.DeleteUser(ctx, alice.ID))
+
+		alicia, err := repo.CreateUser(ctx, domain.User{Username: "alicia", Email: "alice@example.com"})
+		require.NoError(t, err)
+		assert.ErrorIs(t, repo.RestoreUser(ctx, alice.ID), domain.ErrEmailTaken)
+		_, err = repo.GetUserByID(ctx, alice.ID)
+		assert.ErrorIs(t, err, domain.ErrUserNotFound)
+
+		alicia.Email = ""
+		_, err = repo.UpdateUser(ctx, alicia)
+		require.NoError(t, err)
+		require.NoError(t, repo.RestoreUser(ctx, alice.ID))
+		user, err := repo.GetUserByID(ctx, alice.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "alice@example.com", user.Email)
+	})
+
+	t.Run("soft delete and restore", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		ctx := context.Background()
+		records := seed(t, repo, "alice", "bob")
+		id := records[0].ID
+
+		require.NoError(t, repo.DeleteUser(ctx, id))
+		_, err := repo.GetUserByID(ctx, id)
+		assert.ErrorIs(t, err, domain.ErrUserNotFound)
+
+		users, total, err := repo.ListUsers(ctx, domain.UserFilter{Limit: 10})
+		require.NoError(t, err)
+		assert.Equal(t, 1, total)
+		assert.Equal(t, []domain.User{records[1].User}, users)
+
+		require.NoError(t, repo.RestoreUser(ctx, id))
+		user, err := repo.GetUserByID(ctx, id)
+		require.NoError(t, err)
+		assert.Equal(t, records[0].User, user)
+
+		// only a deleted user can be restored
+		assert.ErrorIs(t, repo.RestoreUser(ctx, id), domain.ErrUserNotFound)
+		assert.ErrorIs(t, repo.RestoreUser(ctx, uuid.NewString()), domain.ErrUserNotFound)
+		assert.ErrorIs(t, repo.DeleteUser(ctx, uuid.NewString()), domain.ErrUserNotFound)
+	})
+
+	t.Run("list is ordered by creation time, the newest first", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		ctx := context.Background()
+		records := seed(t, repo, "user-0", "user-1", "user-2", "user-3", "user-4")
+
+		users, total, err := repo.ListUsers(ctx, domain.UserFilter{Limit: 10})
+		require.NoError(t, err)
+		assert.Equal(t, 5, total)
+		assert.Equal(t, []domain.User{records[4].User, records[3].User, records[2].User, records[1].User, records[0].User}, users)
+	})
+
+	t.Run("list pagination", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		ctx := context.Background()
+		records := seed(t, repo, "user-0", "user-1", "user-2", "user-3", "user-4")
+		require.NoError(t, repo.DeleteUser(ctx, records[2].ID))
+
+		users, total, err := repo.ListUsers(ctx, domain.UserFilter{Limit: 2, Offset: 0})
+		require.NoError(t, err)
+		assert.Equal(t, 4, total)
+		assert.Equal(t, []domain.User{records[4].User, records[3].User}, users)
+
+		users, total, err = repo.ListUsers(ctx, domain.UserFilter{Limit: 2, Offset: 2})
+		require.NoError(t, err)
+		assert.Equal(t, 4, total)
+		assert.Equal(t, []domain.User{records[1].User, records[0].User}, users)
+
+		users, total, err = repo.ListUsers(ctx, domain.UserFilter{Limit: 2, Offset: 3})
+		require.NoError(t, err)
+		assert.Equal(t, 4, total)
+		assert.Equal(t, []domain.User{records[0].User}, users)
+
+		users, total, err = repo.ListUsers(ctx, domain.UserFilter{Limit: 2, Offset: 4})
+		require.NoError(t, err)
+		assert.Equal(t, 4, total)
+		assert.Empty(t, users)
+	})
+
+	t.Run("empty list", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+
+		users, total, err := repo.ListUsers(context.Background(), domain.UserFilter{Limit: 10})
+		require.NoError(t, err)
+		assert.Equal(t, 0, total)
+		assert.Empty(t, users)
+	})
+
+	t.Run("seed overwrites the records with the same id", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		ctx := context.Background()
+		records := seed(t, repo, "alice")
+
+		verifiedAt := baseTime.Add(time.Hour)
+		records[0].Username = "bob"
+		records[0].Email = "bob@example.com"
+		records[0].EmailVerifiedAt = &verifiedAt
+		require.NoError(t, repo.SeedUsers(ctx, records))
+		user, err := repo.GetUserByID(ctx, records[0].ID)
+		require.NoError(t, err)
+		assert.Equal(t, records[0].User, user)
+	})
+
+	t.Run("concurrent writes", func(t *testing.T) {
+		t.Parallel()
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		const n = 20
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := repo.CreateUser(ctx, domain.User{Username: fmt.Sprintf("user-%d", i)})
+				assert.NoError(t, err)
+			}()
+		}
+		wg.Wait()
+
+		_, total, err := repo.ListUsers(ctx, domain.UserFilter{Limit: 1})
+		require.NoError(t, err)
+		assert.Equal(t, n, total)
+	})
+}
+
+// seed stores the users created a second one after another in the given order.
+func seed(t *testing.T, repo UserRepository, usernames ...string) []domain.UserRecord {
+	t.Helper()
+
+	records := make([]domain.UserRecord, 0, len(usernames))
+	for i, username := range usernames {
+		createdAt := baseTime.Add(time.Duration(i) * time.Second)
+		records = append(records, domain.UserRecord{
+			User:      domain.User{ID: uuid.NewString(), Username: username},
+			CreatedAt: createdAt,
+			UpdatedAt: createdAt,
+		})
+	}
+	require.NoError(t, repo.SeedUsers(context.Background(), records))
+
+	return records
+}
@@ -0,0 +1,43 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var errBulkheadFull = errors.New("too many concurrent calls")
+
+// bulkhead limits the calls running at once, so the slow reads can't take all the connections from the writes.
+type bulkhead chan struct{}
+
+func newBulkhead(size int) bulkhead {
+	return make(bulkhead, size)
+}
+
+// acquire takes a slot waiting up to wait for one, every acquired slot must be released.
+func (b bulkhead) acquire(ctx context.Context, wait time.Duration) error {
+	select {
+	case b <- struct{}{}:
+		return nil
+	default:
+	}
+	if wait <= 0 {
+		return errBulkheadFull
+	}
+
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case b <- struct{}{}:
+		return nil
+	case <-t.C:
+		return errBulkheadFull
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b bulkhead) release() {
+	<-b
+}
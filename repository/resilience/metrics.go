@@ -0,0 +1,38 @@
+package resilience
+
+import (
+	"github.com/dennypenta/go-api-walkthrough/pkg/breaker"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type Metrics struct {
+	rejected *prometheus.CounterVec
+	state    prometheus.Gauge
+}
+
+func NewMetrics(reg prometheus.Registerer) *Metrics {
+	ns := "userService"
+	m := &Metrics{
+		rejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: ns,
+			Subsystem: "user_storage",
+			Name:      "rejected_total",
+			Help:      "amount of the storage calls failed fast, the reason is breaker, bulkhead or timeout",
+		}, []string{"op", "reason"}),
+		state: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: ns,
+			Subsystem: "user_storage",
+			Name:      "breaker_state",
+			Help:      "state of the storage circuit breaker: 0 closed, 1 open, 2 half-open",
+		}),
+	}
+
+	reg.MustRegister(m.rejected, m.state)
+
+	return m
+}
+
+// ObserveState is meant to be given to breaker.WithStateChange.
+func (m *Metrics) ObserveState(s breaker.State) {
+	m.state.Set(float64(s))
+}
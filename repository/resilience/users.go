@@ -0,0 +1,172 @@
+// Package resilience keeps the service responsive when the storage slows down or fails:
+// every call has a timeout, the concurrent calls are limited and a circuit breaker
+// stops calling the storage that keeps failing.
+package resilience
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/pkg/breaker"
+)
+
+// retryAfter is suggested to the clients rejected by the bulkhead or a timeout, the load might go down by then.
+const retryAfter = time.Second
+
+var errTimeout = errors.New("storage call timed out")
+
+// Limits of the storage calls, the reads and the writes have separate bulkheads.
+type Limits struct {
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	// the calls running at once, the others wait up to QueueWait for a slot
+	MaxReads  int
+	MaxWrites int
+	QueueWait time.Duration
+}
+
+// UserRepository fails fast with domain.ErrUnavailable instead of piling up the calls on the slow storage.
+type UserRepository struct {
+	next    domain.UserRepository
+	breaker *breaker.Breaker
+	limits  Limits
+	reads   bulkhead
+	writes  bulkhead
+	metrics *Metrics
+}
+
+// NewUserRepository wraps the storage, the breaker is expected to use IsFailure.
+func NewUserRepository(next domain.UserRepository, b *breaker.Breaker, limits Limits, m *Metrics) *UserRepository {
+	return &UserRepository{
+		next:    next,
+		breaker: b,
+		limits:  limits,
+		reads:   newBulkhead(limits.MaxReads),
+		writes:  newBulkhead(limits.MaxWrites),
+		metrics: m,
+	}
+}
+
+// IsFailure tells the errors meaning the storage is in trouble,
+// the domain errors and the calls the caller has given up on are not.
+func IsFailure(err error) bool {
+	switch {
+	case errors.Is(err, domain.ErrUserNotFound), errors.Is(err, domain.ErrInvalidUsername), errors.Is(err, domain.ErrEmailTaken),
+		errors.Is(err, context.Canceled):
+		return false
+	case errors.Is(err, context.DeadlineExceeded):
+		// only the own timeout tells about the storage, the caller's deadline might be just short
+		return errors.Is(err, errTimeout)
+	}
+	return true
+}
+
+func (r *UserRepository) CreateUser(ctx context.Context, user domain.User) (domain.User, error) {
+	err := r.write(ctx, "CreateUser", func(ctx context.Context) error {
+		var err error
+		user, err = r.next.CreateUser(ctx, user)
+		return err
+	})
+	return user, err
+}
+
+func (r *UserRepository) GetUserByID(ctx context.Context, id string) (domain.User, error) {
+	var user domain.User
+	err := r.read(ctx, "GetUserByID", func(ctx context.Context) error {
+		var err error
+		user, err = r.next.GetUserByID(ctx, id)
+		return err
+	})
+	return user, err
+}
+
+func (r *UserRepository) UpdateUser(ctx context.Context, user domain.User) (domain.User, error) {
+	err := r.write(ctx, "UpdateUser", func(ctx context.Context) error {
+		var err error
+		user, err = r.next.UpdateUser(ctx, user)
+		return err
+	})
+	return user, err
+}
+
+func (r *UserRepository) UpdateUsername(ctx context.Context, id, username string) (domain.User, error) {
+	var user domain.User
+	err := r.write(ctx, "UpdateUsername", func(ctx context.Context) error {
+		var err error
+		user, err = r.next.UpdateUsername(ctx, id, username)
+		return err
+	})
+	return user, err
+}
+
+func (r *UserRepository) DeleteUser(ctx context.Context, id string) error {
+	return r.write(ctx, "DeleteUser", func(ctx context.Context) error {
+		return r.next.DeleteUser(ctx, id)
+	})
+}
+
+func (r *UserRepository) RestoreUser(ctx context.Context, id string) error {
+	return r.write(ctx, "RestoreUser", func(ctx context.Context) error {
+		return r.next.RestoreUser(ctx, id)
+	})
+}
+
+func (r *UserRepository) VerifyEmail(ctx context.Context, id, email string, at time.Time) error {
+	return r.write(ctx, "VerifyEmail", func(ctx context.Context) error {
+		return r.next.VerifyEmail(ctx, id, email, at)
+	})
+}
+
+func (r *UserRepository) ListUsers(ctx context.Context, filter domain.UserFilter) ([]domain.User, int, error) {
+	var users []domain.User
+	var total int
+	err := r.read(ctx, "ListUsers", func(ctx context.Context) error {
+		var err error
+		users, total, err = r.next.ListUsers(ctx, filter)
+		return err
+	})
+	return users, total, err
+}
+
+func (r *UserRepository) read(ctx context.Context, op string, fn func(ctx context.Context) error) error {
+	return r.call(ctx, op, r.reads, r.limits.ReadTimeout, fn)
+}
+
+func (r *UserRepository) write(ctx context.Context, op string, fn func(ctx context.Context) error) error {
+	return r.call(ctx, op, r.writes, r.limits.WriteTimeout, fn)
+}
+
+func (r *UserRepository) call(ctx context.Context, op string, b bulkhead, timeout time.Duration, fn func(ctx context.Context) error) error {
+	if err := b.acquire(ctx, r.limits.QueueWait); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		r.metrics.rejected.WithLabelValues(op, "bulkhead").Inc()
+		return &domain.UnavailableError{RetryAfter: retryAfter, Err: fmt.Errorf("%s: %w", op, err)}
+	}
+	defer b.release()
+
+	err := r.breaker.Do(func() error {
+		callCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		err := fn(callCtx)
+		if err != nil && ctx.Err() == nil && errors.Is(callCtx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("%w after %s: %w", errTimeout, timeout, err)
+		}
+		return err
+	})
+
+	switch {
+	case errors.Is(err, breaker.ErrOpen):
+		r.metrics.rejected.WithLabelValues(op, "breaker").Inc()
+		return &domain.UnavailableError{RetryAfter: r.breaker.Remaining(), Err: fmt.Errorf("%s: %w", op, err)}
+	case errors.Is(err, errTimeout):
+		r.metrics.rejected.WithLabelValues(op, "timeout").Inc()
+		return &domain.UnavailableError{RetryAfter: retryAfter, Err: fmt.Errorf("%s: %w", op, err)}
+	}
+	return err
+}
@@ -0,0 +1,127 @@
+package resilience_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/domain/mocks"
+	"github.com/dennypenta/go-api-walkthrough/pkg/breaker"
+	"github.com/dennypenta/go-api-walkthrough/repository/resilience"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+var errDown = errors.New("connection refused")
+
+func newResilient(t *testing.T, limits resilience.Limits) (*resilience.UserRepository, *mocks.MockUserRepository, *breaker.Breaker) {
+	t.Helper()
+
+	repo := mocks.NewMockUserRepository(t)
+	b := breaker.New(2, time.Minute, breaker.WithFailure(resilience.IsFailure))
+	return resilience.NewUserRepository(repo, b, limits, resilience.NewMetrics(prometheus.NewRegistry())), repo, b
+}
+
+var limits = resilience.Limits{
+	ReadTimeout:  time.Second,
+	WriteTimeout: time.Second,
+	MaxReads:     1,
+	MaxWrites:    1,
+}
+
+func TestBreakerOpens(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	r, repo, b := newResilient(t, limits)
+
+	repo.On("GetUserByID", mock.Anything, "1").Return(domain.User{}, domain.ErrUserNotFound).Twice()
+	repo.On("DeleteUser", mock.Anything, "1").Return(errDown).Twice()
+
+	// not found means the storage is fine
+	for i := 0; i < 2; i++ {
+		_, err := r.GetUserByID(ctx, "1")
+		assert.ErrorIs(t, err, domain.ErrUserNotFound)
+	}
+	for i := 0; i < 2; i++ {
+		assert.ErrorIs(t, r.DeleteUser(ctx, "1"), errDown)
+	}
+	assert.Equal(t, breaker.Open, b.State())
+
+	// the reads and the writes fail fast without calling the storage
+	_, err := r.GetUserByID(ctx, "1")
+	var unavailable *domain.UnavailableError
+	require.ErrorAs(t, err, &unavailable)
+	assert.ErrorIs(t, err, domain.ErrUnavailable)
+	assert.InDelta(t, time.Minute, unavailable.RetryAfter, float64(time.Second))
+	_, err = r.UpdateUser(ctx, domain.User{ID: "1", Username: "alice"})
+	assert.ErrorIs(t, err, domain.ErrUnavailable)
+}
+
+func TestBulkheadSeparatesReadsAndWrites(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	r, repo, _ := newResilient(t, resilience.Limits{
+		ReadTimeout:  time.Second,
+		WriteTimeout: time.Second,
+		MaxReads:     1,
+		MaxWrites:    1,
+		QueueWait:    10 * time.Millisecond,
+	})
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	repo.On("ListUsers", mock.Anything, mock.Anything).Run(func(mock.Arguments) {
+		close(started)
+		<-release
+	}).Return(nil, 0, nil).Once()
+	repo.On("CreateUser", mock.Anything, domain.User{Username: "alice"}).Return(domain.User{ID: "1", Username: "alice"}, nil).Once()
+
+	done := make(chan error)
+	go func() {
+		_, _, err := r.ListUsers(ctx, domain.UserFilter{Limit: 10})
+		done <- err
+	}()
+	<-started
+
+	// the slow read takes the only read slot, the next read is rejected and the writes still go
+	_, err := r.GetUserByID(ctx, "1")
+	assert.ErrorIs(t, err, domain.ErrUnavailable)
+	_, err = r.CreateUser(ctx, domain.User{Username: "alice"})
+	assert.NoError(t, err)
+
+	close(release)
+	assert.NoError(t, <-done)
+}
+
+func TestTimeout(t *testing.T) {
+	t.Parallel()
+	r, repo, b := newResilient(t, resilience.Limits{
+		ReadTimeout:  10 * time.Millisecond,
+		WriteTimeout: time.Second,
+		MaxReads:     2,
+		MaxWrites:    1,
+	})
+
+	hang := func(args mock.Arguments) {
+		<-args.Get(0).(context.Context).Done()
+	}
+	repo.On("GetUserByID", mock.Anything, "1").Run(hang).Return(domain.User{}, context.DeadlineExceeded)
+
+	// the caller's own deadline isn't the storage failure
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	_, err := r.GetUserByID(ctx, "1")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.NotErrorIs(t, err, domain.ErrUnavailable)
+	assert.Equal(t, breaker.Closed, b.State())
+
+	for i := 0; i < 2; i++ {
+		_, err = r.GetUserByID(context.Background(), "1")
+		assert.ErrorIs(t, err, domain.ErrUnavailable)
+	}
+	assert.Equal(t, breaker.Open, b.State())
+}
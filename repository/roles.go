@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/jmoiron/sqlx"
+)
+
+type RoleRepository struct {
+	db *sqlx.DB
+	sq sq.StatementBuilderType
+}
+
+func NewRoleRepository(db *sqlx.DB) *RoleRepository {
+	return &RoleRepository{
+		db: db,
+		sq: sq.StatementBuilder.PlaceholderFormat(sq.Dollar),
+	}
+}
+
+// NewSQLiteRoleRepository works with the schema of migrations.SQLiteFS.
+func NewSQLiteRoleRepository(db *sqlx.DB) *RoleRepository {
+	return &RoleRepository{
+		db: db,
+		sq: sq.StatementBuilder.PlaceholderFormat(sq.Question),
+	}
+}
+
+func (r *RoleRepository) GetRoles(ctx context.Context, userID string) ([]string, error) {
+	query, args, err := r.sq.Select("role").
+		From("user_roles").
+		Where(sq.Eq{"user_id": userID}).
+		OrderBy("role").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("GetRoles: failed to build query: %w", err)
+	}
+
+	roles := []string{}
+	if err := sqlx.SelectContext(ctx, connFrom(ctx, r.db), &roles, query, args...); err != nil {
+		return nil, fmt.Errorf("GetRoles: failed to select roles: %w", err)
+	}
+
+	return roles, nil
+}
+
+// SetRoles must run in a transaction, the roles are deleted and inserted again.
+// They are inserted only if the user isn't deleted, no row means there is no such user.
+func (r *RoleRepository) SetRoles(ctx context.Context, userID string, roles []string) error {
+	query, args, err := r.sq.Delete("user_roles").
+		Where(sq.Eq{"user_id": userID}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("SetRoles: failed to build query: %w", err)
+	}
+	if _, err := connFrom(ctx, r.db).ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("SetRoles: failed to delete roles: %w", err)
+	}
+
+	for _, role := range roles {
+		query, args, err := r.sq.Insert("user_roles").
+			Columns("user_id", "role").
+			Select(r.sq.Select("id").
+				Column("?", role).
+				From("users").
+				Where(sq.Eq{"id": userID, "deletedAt": nil})).
+			ToSql()
+		if err != nil {
+			return fmt.Errorf("SetRoles: failed to build query: %w", err)
+		}
+
+		res, err := connFrom(ctx, r.db).ExecContext(ctx, query, args...)
+		if err != nil {
+			return fmt.Errorf("SetRoles: failed to insert role: %w", err)
+		}
+		affectedAmount, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("SetRoles: failed to get RowsAffected: %w", err)
+		}
+		if affectedAmount == 0 {
+			return domain.ErrUserNotFound
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,167 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/jmoiron/sqlx"
+)
+
+type SessionRepository struct {
+	db *sqlx.DB
+	sq sq.StatementBuilderType
+
+	// now stamps the revocations for sqlite, postgres takes its own clock
+	now func() time.Time
+}
+
+func NewSessionRepository(db *sqlx.DB) *SessionRepository {
+	return &SessionRepository{
+		db: db,
+		sq: sq.StatementBuilder.PlaceholderFormat(sq.Dollar),
+	}
+}
+
+// NewSQLiteSessionRepository works with the schema of migrations.SQLiteFS.
+func NewSQLiteSessionRepository(db *sqlx.DB, now func() time.Time) *SessionRepository {
+	return &SessionRepository{
+		db:  db,
+		sq:  sq.StatementBuilder.PlaceholderFormat(sq.Question),
+		now: now,
+	}
+}
+
+func (r *SessionRepository) CreateSession(ctx context.Context, s domain.Session) error {
+	query, args, err := r.sq.Insert("sessions").
+		Columns("id", "user_id", "device", "user_agent", "ip", "createdAt", "lastSeenAt").
+		Values(s.ID, s.UserID, s.Device, s.UserAgent, s.IP, s.CreatedAt.UTC(), s.LastSeenAt.UTC()).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("CreateSession: failed to build query: %w", err)
+	}
+
+	if _, err := connFrom(ctx, r.db).ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("CreateSession: failed to insert session: %w", err)
+	}
+
+	return nil
+}
+
+func (r *SessionRepository) TouchSession(ctx context.Context, id string, client domain.Client, at time.Time) error {
+	query, args, err := r.sq.Update("sessions").
+		Set("user_agent", client.UserAgent).
+		Set("ip", client.IP).
+		Set("lastSeenAt", at.UTC()).
+		Where(sq.Eq{"id": id, "revokedAt": nil}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("TouchSession: failed to build query: %w", err)
+	}
+
+	return r.execOne(ctx, "TouchSession", query, args)
+}
+
+func (r *SessionRepository) IsSessionActive(ctx context.Context, id string) (bool, error) {
+	query, args, err := r.sq.Select("count(*)").
+		From("sessions s").
+		Join("users u ON u.id = s.user_id").
+		Where(sq.Eq{"s.id": id, "s.revokedAt": nil, "u.deletedAt": nil}).
+		ToSql()
+	if err != nil {
+		return false, fmt.Errorf("IsSessionActive: failed to build query: %w", err)
+	}
+
+	var count int
+	if err := connFrom(ctx, r.db).QueryRowxContext(ctx, query, args...).Scan(&count); err != nil {
+		return false, fmt.Errorf("IsSessionActive: failed to count sessions: %w", err)
+	}
+
+	return count > 0, nil
+}
+
+func (r *SessionRepository) ListSessions(ctx context.Context, userID string) ([]domain.Session, error) {
+	query, args, err := r.sq.Select("s.id", "s.device", "s.user_agent", "s.ip", "s.createdAt", "s.lastSeenAt").
+		From("sessions s").
+		Join("users u ON u.id = s.user_id").
+		Where(sq.Eq{"s.user_id": userID, "s.revokedAt": nil, "u.deletedAt": nil}).
+		OrderBy("s.lastSeenAt DESC", "s.id").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("ListSessions: failed to build query: %w", err)
+	}
+
+	rows, err := connFrom(ctx, r.db).QueryxContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("ListSessions: failed to select sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []domain.Session{}
+	for rows.Next() {
+		s := domain.Session{UserID: userID}
+		if err := rows.Scan(&s.ID, &s.Device, &s.UserAgent, &s.IP, &s.CreatedAt, &s.LastSeenAt); err != nil {
+			return nil, fmt.Errorf("ListSessions: failed to scan session: %w", err)
+		}
+		s.CreatedAt = s.CreatedAt.UTC()
+		s.LastSeenAt = s.LastSeenAt.UTC()
+		sessions = append(sessions, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ListSessions: failed to read sessions: %w", err)
+	}
+
+	return sessions, nil
+}
+
+func (r *SessionRepository) RevokeSession(ctx context.Context, userID, id string) error {
+	query, args, err := r.sq.Update("sessions").
+		Set("revokedAt", currentTime(r.now)).
+		Where(sq.Eq{"id": id, "user_id": userID, "revokedAt": nil}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("RevokeSession: failed to build query: %w", err)
+	}
+
+	return r.execOne(ctx, "RevokeSession", query, args)
+}
+
+func (r *SessionRepository) RevokeOtherSessions(ctx context.Context, userID, exceptID string) ([]string, error) {
+	q := r.sq.Update("sessions").
+		Set("revokedAt", currentTime(r.now)).
+		Where(sq.Eq{"user_id": userID, "revokedAt": nil})
+	// an empty id isn't a uuid postgres could compare, there is just nothing to keep
+	if exceptID != "" {
+		q = q.Where(sq.NotEq{"id": exceptID})
+	}
+	query, args, err := q.Suffix("RETURNING id").ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("RevokeOtherSessions: failed to build query: %w", err)
+	}
+
+	ids := []string{}
+	if err := sqlx.SelectContext(ctx, connFrom(ctx, r.db), &ids, query, args...); err != nil {
+		return nil, fmt.Errorf("RevokeOtherSessions: failed to revoke sessions: %w", err)
+	}
+
+	return ids, nil
+}
+
+// execOne runs the update of a single active session, no row means there is no such session.
+func (r *SessionRepository) execOne(ctx context.Context, op, query string, args []interface{}) error {
+	res, err := connFrom(ctx, r.db).ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("%s: failed to update session: %w", op, err)
+	}
+	affectedAmount, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: failed to get RowsAffected: %w", op, err)
+	}
+	if affectedAmount == 0 {
+		return domain.ErrSessionNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package repository_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/migrations"
+	"github.com/dennypenta/go-api-walkthrough/repository"
+	"github.com/dennypenta/go-api-walkthrough/repository/repotest"
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/sqlite"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+// sqlite needs no server, so unlike postgres it runs without the integration tag
+func TestSQLiteUserRepository(t *testing.T) {
+	t.Parallel()
+
+	repotest.TestUserRepository(t, func(t *testing.T) repotest.UserRepository {
+		return repository.NewSQLiteUserRepository(newSQLiteDB(t), time.Now, uuid.NewString)
+	})
+}
+
+func TestSQLiteCredentialRepository(t *testing.T) {
+	t.Parallel()
+
+	repotest.TestCredentialRepository(t, func(t *testing.T) (repotest.UserRepository, domain.CredentialRepository) {
+		db := newSQLiteDB(t)
+		return repository.NewSQLiteUserRepository(db, time.Now, uuid.NewString), repository.NewSQLiteCredentialRepository(db, time.Now)
+	})
+}
+
+func TestSQLiteRefreshTokenRepository(t *testing.T) {
+	t.Parallel()
+
+	repotest.TestRefreshTokenRepository(t, func(t *testing.T) (repotest.UserRepository, domain.SessionRepository, domain.RefreshTokenRepository) {
+		db := newSQLiteDB(t)
+		return repository.NewSQLiteUserRepository(db, time.Now, uuid.NewString),
+			repository.NewSQLiteSessionRepository(db, time.Now),
+			repository.NewSQLiteRefreshTokenRepository(db, time.Now)
+	})
+}
+
+func TestSQLiteSessionRepository(t *testing.T) {
+	t.Parallel()
+
+	repotest.TestSessionRepository(t, func(t *testing.T) (repotest.UserRepository, domain.SessionRepository) {
+		db := newSQLiteDB(t)
+		return repository.NewSQLiteUserRepository(db, time.Now, uuid.NewString), repository.NewSQLiteSessionRepository(db, time.Now)
+	})
+}
+
+func TestSQLiteTwoFactorRepository(t *testing.T) {
+	t.Parallel()
+
+	repotest.TestTwoFactorRepository(t, func(t *testing.T) (repotest.UserRepository, domain.TwoFactorRepository) {
+		db := newSQLiteDB(t)
+		return repository.NewSQLiteUserRepository(db, time.Now, uuid.NewString), repository.NewSQLiteTwoFactorRepository(db, time.Now)
+	})
+}
+
+func TestSQLiteEmailVerificationRepository(t *testing.T) {
+	t.Parallel()
+
+	repotest.TestEmailVerificationRepository(t, func(t *testing.T) (repotest.UserRepository, domain.EmailVerificationRepository) {
+		db := newSQLiteDB(t)
+		return repository.NewSQLiteUserRepository(db, time.Now, uuid.NewString), repository.NewSQLiteEmailVerificationRepository(db)
+	})
+}
+
+func TestSQLitePasswordResetRepository(t *testing.T) {
+	t.Parallel()
+
+	repotest.TestPasswordResetRepository(t, func(t *testing.T) (repotest.UserRepository, domain.PasswordResetRepository) {
+		db := newSQLiteDB(t)
+		return repository.NewSQLiteUserRepository(db, time.Now, uuid.NewString), repository.NewSQLitePasswordResetRepository(db)
+	})
+}
+
+func TestSQLiteRoleRepository(t *testing.T) {
+	t.Parallel()
+
+	repotest.TestRoleRepository(t, func(t *testing.T) (repotest.UserRepository, domain.RoleRepository) {
+		db := newSQLiteDB(t)
+		return repository.NewSQLiteUserRepository(db, time.Now, uuid.NewString), repository.NewSQLiteRoleRepository(db)
+	})
+}
+
+func TestSQLiteAPIKeyRepository(t *testing.T) {
+	t.Parallel()
+
+	repotest.TestAPIKeyRepository(t, func(t *testing.T) domain.APIKeyRepository {
+		return repository.NewSQLiteAPIKeyRepository(newSQLiteDB(t), time.Now)
+	})
+}
+
+// newSQLiteDB creates a migrated database removed along with the test temp dir.
+func newSQLiteDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.db")
+
+	src, err := iofs.New(migrations.SQLiteFS, ".")
+	require.NoError(t, err)
+	m, err := migrate.NewWithSourceInstance("iofs", src, "sqlite://"+path)
+	require.NoError(t, err)
+	require.NoError(t, m.Up())
+	srcErr, dbErr := m.Close()
+	require.NoError(t, srcErr)
+	require.NoError(t, dbErr)
+
+	db, err := sqlx.Connect("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate&_time_format=sqlite")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	return db
+}
@@ -0,0 +1,22 @@
+package stale
+
+import "github.com/prometheus/client_golang/prometheus"
+
+type Metrics struct {
+	served prometheus.Counter
+}
+
+func NewMetrics(reg prometheus.Registerer) *Metrics {
+	m := &Metrics{
+		served: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "userService",
+			Subsystem: "user_storage",
+			Name:      "stale_responses_total",
+			Help:      "amount of the last known users served while the storage is unavailable",
+		}),
+	}
+
+	reg.MustRegister(m.served)
+
+	return m
+}
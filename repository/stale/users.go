@@ -0,0 +1,110 @@
+// Package stale serves the last known users while the storage is unavailable.
+package stale
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/pkg/lru"
+	"github.com/dennypenta/go-api-walkthrough/repository/resilience"
+)
+
+type page struct {
+	users []domain.User
+	total int
+}
+
+// UserRepository remembers the successful reads. When a read fails because the storage is in trouble
+// (resilience.IsFailure, e.g. the circuit breaker is open) GetUserByID and ListUsers return
+// the remembered value and mark the response stale (domain.MarkStale), the writes go through as is.
+type UserRepository struct {
+	domain.UserRepository
+
+	users   *lru.Cache[string, domain.User]
+	pages   *lru.Cache[domain.UserFilter, page]
+	metrics *Metrics
+}
+
+// NewUserRepository keeps up to size users and pages, maxAge is how old a value might be served.
+func NewUserRepository(next domain.UserRepository, size int, maxAge time.Duration, now func() time.Time, m *Metrics) *UserRepository {
+	return &UserRepository{
+		UserRepository: next,
+		users:          lru.New(size, maxAge, lru.WithClock[string, domain.User](now)),
+		pages:          lru.New(size, maxAge, lru.WithClock[domain.UserFilter, page](now)),
+		metrics:        m,
+	}
+}
+
+func (r *UserRepository) GetUserByID(ctx context.Context, id string) (domain.User, error) {
+	user, err := r.UserRepository.GetUserByID(ctx, id)
+	switch {
+	case err == nil:
+		r.users.Set(id, user)
+		return user, nil
+	case !resilience.IsFailure(err):
+		if errors.Is(err, domain.ErrUserNotFound) {
+			r.users.Delete(id)
+		}
+		return user, err
+	}
+
+	if last, ok := r.users.Get(id); ok {
+		r.metrics.served.Inc()
+		domain.MarkStale(ctx)
+		return last, nil
+	}
+	return user, err
+}
+
+func (r *UserRepository) UpdateUser(ctx context.Context, user domain.User) (domain.User, error) {
+	user, err := r.UserRepository.UpdateUser(ctx, user)
+	if err == nil {
+		r.users.Set(user.ID, user)
+	}
+	return user, err
+}
+
+func (r *UserRepository) UpdateUsername(ctx context.Context, id, username string) (domain.User, error) {
+	user, err := r.UserRepository.UpdateUsername(ctx, id, username)
+	if err == nil {
+		r.users.Set(user.ID, user)
+	}
+	return user, err
+}
+
+func (r *UserRepository) DeleteUser(ctx context.Context, id string) error {
+	err := r.UserRepository.DeleteUser(ctx, id)
+	if err == nil {
+		r.users.Delete(id)
+	}
+	return err
+}
+
+// VerifyEmail drops the last known user, it's read again on the next success.
+func (r *UserRepository) VerifyEmail(ctx context.Context, id, email string, at time.Time) error {
+	err := r.UserRepository.VerifyEmail(ctx, id, email, at)
+	if err == nil {
+		r.users.Delete(id)
+	}
+	return err
+}
+
+func (r *UserRepository) ListUsers(ctx context.Context, filter domain.UserFilter) ([]domain.User, int, error) {
+	users, total, err := r.UserRepository.ListUsers(ctx, filter)
+	switch {
+	case err == nil:
+		r.pages.Set(filter, page{users: users, total: total})
+		return users, total, nil
+	case !resilience.IsFailure(err):
+		return users, total, err
+	}
+
+	if last, ok := r.pages.Get(filter); ok {
+		r.metrics.served.Inc()
+		domain.MarkStale(ctx)
+		return last.users, last.total, nil
+	}
+	return users, total, err
+}
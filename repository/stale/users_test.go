@@ -0,0 +1,117 @@
+package stale_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/domain/mocks"
+	"github.com/dennypenta/go-api-walkthrough/pkg/breaker"
+	"github.com/dennypenta/go-api-walkthrough/repository/resilience"
+	"github.com/dennypenta/go-api-walkthrough/repository/stale"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+var errDown = errors.New("connection refused")
+
+type fixture struct {
+	service *domain.UserService
+	repo    *mocks.MockUserRepository
+	now     time.Time
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+
+	f := &fixture{
+		repo: mocks.NewMockUserRepository(t),
+		now:  time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	now := func() time.Time { return f.now }
+	reg := prometheus.NewRegistry()
+	b := breaker.New(2, time.Minute, breaker.WithClock(now), breaker.WithFailure(resilience.IsFailure))
+	limits := resilience.Limits{ReadTimeout: time.Second, WriteTimeout: time.Second, MaxReads: 1, MaxWrites: 1}
+	repo := stale.NewUserRepository(resilience.NewUserRepository(f.repo, b, limits, resilience.NewMetrics(reg)), 10, time.Hour, now, stale.NewMetrics(reg))
+	f.service = domain.NewUserService(repo, mocks.NewMockTxManager(t))
+	return f
+}
+
+func TestGetUserByID(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	user := domain.User{ID: "1", Username: "alice"}
+	f := newFixture(t)
+
+	f.repo.On("GetUserByID", mock.Anything, "1").Return(user, nil).Once()
+	got, err := f.service.GetUserByID(ctx, "1")
+	require.NoError(t, err)
+	assert.False(t, got.Stale)
+
+	// the failures open the breaker, the last known user is served all the time
+	f.repo.On("GetUserByID", mock.Anything, "1").Return(domain.User{}, errDown).Twice()
+	for i := 0; i < 3; i++ {
+		got, err = f.service.GetUserByID(ctx, "1")
+		require.NoError(t, err)
+		assert.Equal(t, domain.User{ID: "1", Username: "alice", Stale: true}, got)
+	}
+	// the unknown user is an error, the storage isn't called while the breaker is open
+	_, err = f.service.GetUserByID(ctx, "2")
+	assert.ErrorIs(t, err, domain.ErrUnavailable)
+
+	// the half-open probe closes the breaker
+	f.now = f.now.Add(time.Minute)
+	f.repo.On("GetUserByID", mock.Anything, "1").Return(domain.User{ID: "1", Username: "bob"}, nil).Once()
+	got, err = f.service.GetUserByID(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, domain.User{ID: "1", Username: "bob"}, got)
+}
+
+func TestNotFoundIsNotAFailure(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	f := newFixture(t)
+
+	f.repo.On("GetUserByID", mock.Anything, "1").Return(domain.User{ID: "1", Username: "alice"}, nil).Once()
+	f.repo.On("GetUserByID", mock.Anything, "1").Return(domain.User{}, domain.ErrUserNotFound).Times(3)
+	f.repo.On("GetUserByID", mock.Anything, "1").Return(domain.User{}, errDown).Once()
+
+	_, err := f.service.GetUserByID(ctx, "1")
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		_, err = f.service.GetUserByID(ctx, "1")
+		assert.ErrorIs(t, err, domain.ErrUserNotFound)
+	}
+	// the deleted user is forgotten
+	_, err = f.service.GetUserByID(ctx, "1")
+	assert.ErrorIs(t, err, errDown)
+}
+
+func TestListUsers(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	users := []domain.User{{ID: "1", Username: "alice"}}
+	filter := domain.UserFilter{Limit: 10}
+	f := newFixture(t)
+
+	f.repo.On("ListUsers", mock.Anything, filter).Return(users, 1, nil).Once()
+	f.repo.On("ListUsers", mock.Anything, mock.Anything).Return(nil, 0, errDown)
+
+	list, err := f.service.ListUsers(ctx, filter)
+	require.NoError(t, err)
+	assert.False(t, list.Stale)
+
+	list, err = f.service.ListUsers(ctx, filter)
+	require.NoError(t, err)
+	assert.True(t, list.Stale)
+	assert.Equal(t, users, list.Users)
+	assert.Equal(t, 1, list.Total)
+
+	// another page isn't known
+	_, err = f.service.ListUsers(ctx, domain.UserFilter{Limit: 10, Offset: 10})
+	assert.ErrorIs(t, err, errDown)
+}
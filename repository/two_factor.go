@@ -0,0 +1,240 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/jmoiron/sqlx"
+)
+
+type TwoFactorRepository struct {
+	db *sqlx.DB
+	sq sq.StatementBuilderType
+
+	// now stamps the new secrets for sqlite, postgres takes its own clock
+	now func() time.Time
+}
+
+func NewTwoFactorRepository(db *sqlx.DB) *TwoFactorRepository {
+	return &TwoFactorRepository{
+		db: db,
+		sq: sq.StatementBuilder.PlaceholderFormat(sq.Dollar),
+	}
+}
+
+// NewSQLiteTwoFactorRepository works with the schema of migrations.SQLiteFS.
+func NewSQLiteTwoFactorRepository(db *sqlx.DB, now func() time.Time) *TwoFactorRepository {
+	return &TwoFactorRepository{
+		db:  db,
+		sq:  sq.StatementBuilder.PlaceholderFormat(sq.Question),
+		now: now,
+	}
+}
+
+// SetTOTPSecret inserts the secret only if the user isn't deleted and replaces it only if it isn't enabled,
+// no row means one of them.
+func (r *TwoFactorRepository) SetTOTPSecret(ctx context.Context, userID, secret string) error {
+	now := currentTime(r.now)
+	query, args, err := r.sq.Insert("totp_secrets").
+		Columns("user_id", "secret", "createdAt").
+		Select(r.sq.Select("id").
+			Column("?", secret).
+			Column(now).
+			From("users").
+			Where(sq.Eq{"id": userID, "deletedAt": nil})).
+		Suffix(`ON CONFLICT (user_id) DO UPDATE SET
+			secret = EXCLUDED.secret,
+			last_used_step = 0,
+			createdAt = EXCLUDED.createdAt
+			WHERE totp_secrets.enabledAt IS NULL`).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("SetTOTPSecret: failed to build query: %w", err)
+	}
+
+	res, err := connFrom(ctx, r.db).ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("SetTOTPSecret: failed to upsert secret: %w", err)
+	}
+	affectedAmount, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("SetTOTPSecret: failed to get RowsAffected: %w", err)
+	}
+	if affectedAmount > 0 {
+		return nil
+	}
+
+	t, err := r.GetTOTP(ctx, userID)
+	if err == nil && t.Enabled() {
+		return domain.ErrTOTPEnabled
+	}
+	if err != nil && !errors.Is(err, domain.ErrTOTPNotFound) {
+		return err
+	}
+	return domain.ErrUserNotFound
+}
+
+func (r *TwoFactorRepository) GetTOTP(ctx context.Context, userID string) (domain.TOTP, error) {
+	t := domain.TOTP{UserID: userID}
+	query, args, err := r.sq.Select("t.secret", "t.enabledAt", "t.last_used_step").
+		From("totp_secrets t").
+		Join("users u ON u.id = t.user_id").
+		Where(sq.Eq{"t.user_id": userID, "u.deletedAt": nil}).
+		ToSql()
+	if err != nil {
+		return t, fmt.Errorf("GetTOTP: failed to build query: %w", err)
+	}
+
+	var enabledAt sql.NullTime
+	err = connFrom(ctx, r.db).QueryRowxContext(ctx, query, args...).Scan(&t.Secret, &enabledAt, &t.LastUsedStep)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return t, domain.ErrTOTPNotFound
+		}
+		return t, fmt.Errorf("GetTOTP: failed to get secret: %w", err)
+	}
+	t.EnabledAt = timePtr(enabledAt)
+
+	return t, nil
+}
+
+func (r *TwoFactorRepository) EnableTOTP(ctx context.Context, userID string, at time.Time, recoveryCodeHashes []string) error {
+	query, args, err := r.sq.Update("totp_secrets").
+		Set("enabledAt", at.UTC()).
+		Where(sq.Eq{"user_id": userID, "enabledAt": nil}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("EnableTOTP: failed to build query: %w", err)
+	}
+	if err := r.execOne(ctx, "EnableTOTP", query, args, domain.ErrTOTPEnabled); err != nil {
+		return err
+	}
+	if len(recoveryCodeHashes) == 0 {
+		return nil
+	}
+
+	q := r.sq.Insert("recovery_codes").Columns("user_id", "code_hash", "createdAt")
+	for _, hash := range recoveryCodeHashes {
+		q = q.Values(userID, hash, at.UTC())
+	}
+	query, args, err = q.ToSql()
+	if err != nil {
+		return fmt.Errorf("EnableTOTP: failed to build query: %w", err)
+	}
+	if _, err := connFrom(ctx, r.db).ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("EnableTOTP: failed to insert recovery codes: %w", err)
+	}
+
+	return nil
+}
+
+func (r *TwoFactorRepository) UseTOTPStep(ctx context.Context, userID string, step int64) error {
+	query, args, err := r.sq.Update("totp_secrets").
+		Set("last_used_step", step).
+		Where(sq.Eq{"user_id": userID}).
+		Where(sq.Lt{"last_used_step": step}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("UseTOTPStep: failed to build query: %w", err)
+	}
+
+	return r.execOne(ctx, "UseTOTPStep", query, args, domain.ErrTOTPCodeUsed)
+}
+
+func (r *TwoFactorRepository) UseRecoveryCode(ctx context.Context, userID, hash string, at time.Time) error {
+	query, args, err := r.sq.Update("recovery_codes").
+		Set("usedAt", at.UTC()).
+		Where(sq.Eq{"user_id": userID, "code_hash": hash, "usedAt": nil}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("UseRecoveryCode: failed to build query: %w", err)
+	}
+
+	return r.execOne(ctx, "UseRecoveryCode", query, args, domain.ErrRecoveryCodeNotFound)
+}
+
+func (r *TwoFactorRepository) CreateTwoFactorChallenge(ctx context.Context, c domain.TwoFactorChallenge) error {
+	query, args, err := r.sq.Delete("two_factor_challenges").
+		Where(sq.Eq{"user_id": c.UserID}).
+		Where(sq.LtOrEq{"expiresAt": c.CreatedAt.UTC()}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("CreateTwoFactorChallenge: failed to build query: %w", err)
+	}
+	if _, err := connFrom(ctx, r.db).ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("CreateTwoFactorChallenge: failed to delete expired challenges: %w", err)
+	}
+
+	query, args, err = r.sq.Insert("two_factor_challenges").
+		Columns("id", "user_id", "token_hash", "device", "attempts", "createdAt", "expiresAt").
+		Values(c.ID, c.UserID, c.Hash, c.Device, c.Attempts, c.CreatedAt.UTC(), c.ExpiresAt.UTC()).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("CreateTwoFactorChallenge: failed to build query: %w", err)
+	}
+	if _, err := connFrom(ctx, r.db).ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("CreateTwoFactorChallenge: failed to insert challenge: %w", err)
+	}
+
+	return nil
+}
+
+func (r *TwoFactorRepository) AttemptTwoFactorChallenge(ctx context.Context, hash string, at time.Time, maxAttempts int) (domain.TwoFactorChallenge, error) {
+	c := domain.TwoFactorChallenge{Hash: hash}
+	query, args, err := r.sq.Update("two_factor_challenges").
+		Set("attempts", sq.Expr("attempts + 1")).
+		Where(sq.Eq{"token_hash": hash}).
+		Where(sq.Gt{"expiresAt": at.UTC()}).
+		Where(sq.Lt{"attempts": maxAttempts}).
+		Suffix("RETURNING id, user_id, device, attempts, createdAt, expiresAt").
+		ToSql()
+	if err != nil {
+		return c, fmt.Errorf("AttemptTwoFactorChallenge: failed to build query: %w", err)
+	}
+
+	err = connFrom(ctx, r.db).QueryRowxContext(ctx, query, args...).
+		Scan(&c.ID, &c.UserID, &c.Device, &c.Attempts, &c.CreatedAt, &c.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return c, domain.ErrTwoFactorChallengeNotFound
+		}
+		return c, fmt.Errorf("AttemptTwoFactorChallenge: failed to update challenge: %w", err)
+	}
+	c.CreatedAt = c.CreatedAt.UTC()
+	c.ExpiresAt = c.ExpiresAt.UTC()
+
+	return c, nil
+}
+
+func (r *TwoFactorRepository) DeleteTwoFactorChallenge(ctx context.Context, id string) error {
+	query, args, err := r.sq.Delete("two_factor_challenges").
+		Where(sq.Eq{"id": id}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("DeleteTwoFactorChallenge: failed to build query: %w", err)
+	}
+
+	return r.execOne(ctx, "DeleteTwoFactorChallenge", query, args, domain.ErrTwoFactorChallengeNotFound)
+}
+
+// execOne runs the statement of a single row, no row is the notFound error.
+func (r *TwoFactorRepository) execOne(ctx context.Context, op, query string, args []interface{}, notFound error) error {
+	res, err := connFrom(ctx, r.db).ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("%s: failed to exec: %w", op, err)
+	}
+	affectedAmount, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: failed to get RowsAffected: %w", op, err)
+	}
+	if affectedAmount == 0 {
+		return notFound
+	}
+
+	return nil
+}
@@ -0,0 +1,146 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/pkg/retry"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jmoiron/sqlx"
+	"modernc.org/sqlite"
+)
+
+const (
+	// https://www.postgresql.org/docs/current/errcodes-appendix.html
+	pgSerializationFailure = "40001"
+	pgDeadlockDetected     = "40P01"
+
+	pgUniqueViolation = "23505"
+
+	// https://www.sqlite.org/rescode.html#busy
+	sqliteBusy = 5
+	// https://www.sqlite.org/rescode.html#constraint_unique
+	sqliteConstraintUnique = 2067
+)
+
+type txKey struct{}
+
+// TxManager runs the repository calls in one transaction.
+// The transaction travels in the context, so the repositories don't change their signatures.
+type TxManager struct {
+	db     *sqlx.DB
+	opts   *sql.TxOptions
+	policy retry.Policy
+	log    *slog.Logger
+}
+
+// NewTxManager creates the manager, the transactions failed on serialization or a deadlock
+// are retried with the given policy, its Retryable is replaced.
+func NewTxManager(db *sqlx.DB, isolation sql.IsolationLevel, policy retry.Policy, l *slog.Logger) *TxManager {
+	policy.Retryable = IsRetryableTxError
+	return &TxManager{
+		db:     db,
+		opts:   &sql.TxOptions{Isolation: isolation},
+		policy: policy,
+		log:    l,
+	}
+}
+
+// WithinTx commits the transaction if fn returns nil and rolls it back otherwise.
+// A nested call joins the outer transaction, the outer one decides on the commit and the retries.
+func (m *TxManager) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*sqlx.Tx); ok {
+		return fn(ctx)
+	}
+
+	return retry.Do(ctx, m.policy, m.log, "transaction", func(ctx context.Context) error {
+		return m.run(ctx, fn)
+	})
+}
+
+func (m *TxManager) run(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	tx, err := m.db.BeginTxx(ctx, m.opts)
+	if err != nil {
+		return fmt.Errorf("WithinTx: failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+		if err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil && !errors.Is(rbErr, sql.ErrTxDone) {
+				err = errors.Join(err, fmt.Errorf("WithinTx: failed to rollback: %w", rbErr))
+			}
+		}
+	}()
+
+	ctx, committed := domain.ContextWithTx(ctx)
+	if err := fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("WithinTx: failed to commit: %w", err)
+	}
+	committed()
+
+	return nil
+}
+
+// IsRetryableTxError reports whether the transaction failed because of the concurrent ones
+// and might succeed if it's run again. It's shared with the native postgres repository.
+func IsRetryableTxError(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == pgSerializationFailure || pgErr.Code == pgDeadlockDetected
+	}
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		// the extended codes keep the primary one in the lower byte
+		return sqliteErr.Code()&0xff == sqliteBusy
+	}
+	return false
+}
+
+// isUniqueViolation reports whether the statement broke a unique index.
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == pgUniqueViolation
+	}
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code() == sqliteConstraintUnique
+	}
+	return false
+}
+
+// ParseIsolationLevel accepts the level names as postgres spells them, e.g. "read committed".
+func ParseIsolationLevel(name string) (sql.IsolationLevel, error) {
+	if name == "" || strings.EqualFold(name, "default") {
+		return sql.LevelDefault, nil
+	}
+	for level := sql.LevelReadUncommitted; level <= sql.LevelLinearizable; level++ {
+		if strings.EqualFold(level.String(), name) {
+			return level, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown isolation level %q", name)
+}
+
+// conn is the transaction of WithinTx if there is one, the connection pool otherwise.
+func (r *UserRepository) conn(ctx context.Context) sqlx.ExtContext {
+	return connFrom(ctx, r.db)
+}
+
+func connFrom(ctx context.Context, db *sqlx.DB) sqlx.ExtContext {
+	if tx, ok := ctx.Value(txKey{}).(*sqlx.Tx); ok {
+		return tx
+	}
+	return db
+}
@@ -0,0 +1,136 @@
+package repository_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/pkg/log"
+	"github.com/dennypenta/go-api-walkthrough/pkg/retry"
+	"github.com/dennypenta/go-api-walkthrough/repository"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTxManager(t *testing.T) {
+	t.Parallel()
+
+	setup := func(t *testing.T) (*repository.TxManager, *repository.UserRepository) {
+		db := newSQLiteDB(t)
+		policy := retry.Policy{Attempts: 3, InitialDelay: time.Millisecond}
+		l := log.NewLogger(io.Discard, slog.LevelInfo)
+		return repository.NewTxManager(db, sql.LevelDefault, policy, l),
+			repository.NewSQLiteUserRepository(db, time.Now, uuid.NewString)
+	}
+
+	t.Run("commit", func(t *testing.T) {
+		t.Parallel()
+		txm, repo := setup(t)
+		ctx := context.Background()
+
+		var created domain.User
+		err := txm.WithinTx(ctx, func(ctx context.Context) error {
+			var err error
+			created, err = repo.CreateUser(ctx, domain.User{Username: "alice"})
+			if err != nil {
+				return err
+			}
+			_, err = repo.UpdateUser(ctx, domain.User{ID: created.ID, Username: "bob"})
+			return err
+		})
+		require.NoError(t, err)
+
+		user, err := repo.GetUserByID(ctx, created.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "bob", user.Username)
+	})
+
+	t.Run("rollback on error", func(t *testing.T) {
+		t.Parallel()
+		txm, repo := setup(t)
+		ctx := context.Background()
+
+		err := txm.WithinTx(ctx, func(ctx context.Context) error {
+			if _, err := repo.CreateUser(ctx, domain.User{Username: "alice"}); err != nil {
+				return err
+			}
+			return repo.DeleteUser(ctx, uuid.NewString())
+		})
+		assert.ErrorIs(t, err, domain.ErrUserNotFound)
+
+		_, total, err := repo.ListUsers(ctx, domain.UserFilter{Limit: 10})
+		require.NoError(t, err)
+		assert.Equal(t, 0, total)
+	})
+
+	t.Run("nested call joins the outer transaction", func(t *testing.T) {
+		t.Parallel()
+		txm, repo := setup(t)
+		ctx := context.Background()
+
+		err := txm.WithinTx(ctx, func(ctx context.Context) error {
+			err := txm.WithinTx(ctx, func(ctx context.Context) error {
+				_, err := repo.CreateUser(ctx, domain.User{Username: "alice"})
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			return assert.AnError
+		})
+		assert.ErrorIs(t, err, assert.AnError)
+
+		_, total, err := repo.ListUsers(ctx, domain.UserFilter{Limit: 10})
+		require.NoError(t, err)
+		assert.Equal(t, 0, total)
+	})
+
+	t.Run("only concurrency failures are retried", func(t *testing.T) {
+		t.Parallel()
+		txm, _ := setup(t)
+
+		calls := 0
+		err := txm.WithinTx(context.Background(), func(ctx context.Context) error {
+			calls++
+			return assert.AnError
+		})
+		assert.ErrorIs(t, err, assert.AnError)
+		assert.Equal(t, 1, calls)
+	})
+}
+
+func TestParseIsolationLevel(t *testing.T) {
+	t.Parallel()
+
+	for name, expected := range map[string]sql.IsolationLevel{
+		"":                sql.LevelDefault,
+		"default":         sql.LevelDefault,
+		"read committed":  sql.LevelReadCommitted,
+		"Repeatable Read": sql.LevelRepeatableRead,
+		"SERIALIZABLE":    sql.LevelSerializable,
+	} {
+		level, err := repository.ParseIsolationLevel(name)
+		require.NoError(t, err, name)
+		assert.Equal(t, expected, level, name)
+	}
+
+	_, err := repository.ParseIsolationLevel("snapshot-ish")
+	assert.Error(t, err)
+}
+
+func TestIsRetryableTxError(t *testing.T) {
+	t.Parallel()
+
+	assert.True(t, repository.IsRetryableTxError(fmt.Errorf("wrapped: %w", &pgconn.PgError{Code: "40001"})))
+	assert.True(t, repository.IsRetryableTxError(&pgconn.PgError{Code: "40P01"}))
+	assert.False(t, repository.IsRetryableTxError(&pgconn.PgError{Code: "23505"}))
+	assert.False(t, repository.IsRetryableTxError(assert.AnError))
+	assert.False(t, repository.IsRetryableTxError(fmt.Errorf("wrapped: %w", domain.ErrUserNotFound)))
+}
@@ -0,0 +1,73 @@
+//go:build integration
+
+package tests_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/handlers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogin(t *testing.T) {
+	t.Parallel()
+	app := newTestApp(t)
+	set := app.load(t, "users.yaml")
+	id := set.Users[0].ID
+	other := set.Users[1].ID
+
+	status, body := app.do(t, "PUT", "/users/"+id+"/credentials", `{"login": "alice", "password": "short"}`)
+	require.Equal(t, http.StatusBadRequest, status)
+	requireErrorCode(t, handlers.Error{Code: "weak_password"}, body)
+
+	status, _ = app.do(t, "PUT", "/users/"+id+"/credentials", `{"login": "alice", "password": "correct horse battery staple"}`)
+	require.Equal(t, http.StatusNoContent, status)
+
+	status, body = app.do(t, "PUT", "/users/"+other+"/credentials", `{"login": "ALICE", "password": "correct horse battery staple"}`)
+	require.Equal(t, http.StatusConflict, status)
+	requireErrorCode(t, handlers.ErrLoginTaken, body)
+
+	status, body = app.do(t, "POST", "/auth/login", `{"login": "alice", "password": "correct horse battery staple"}`)
+	require.Equal(t, http.StatusOK, status)
+	var tokens domain.TokenPair
+	require.NoError(t, json.Unmarshal(body, &tokens))
+	assert.NotEmpty(t, tokens.AccessToken)
+	assert.NotEmpty(t, tokens.RefreshToken)
+
+	// the signed in member may read itself but not delete the others
+	status, _ = app.doAs(t, tokens.AccessToken, "GET", "/users/"+id, "")
+	require.Equal(t, http.StatusOK, status)
+	status, body = app.doAs(t, tokens.AccessToken, "DELETE", "/users/"+other, "")
+	require.Equal(t, http.StatusForbidden, status)
+	requireErrorCode(t, handlers.ErrForbidden, body)
+
+	status, _ = app.do(t, "POST", "/auth/refresh", `{"refresh_token": "`+tokens.RefreshToken+`"}`)
+	require.Equal(t, http.StatusOK, status)
+	status, body = app.do(t, "POST", "/auth/refresh", `{"refresh_token": "`+tokens.RefreshToken+`"}`)
+	require.Equal(t, http.StatusUnauthorized, status)
+	requireErrorCode(t, handlers.ErrInvalidRefreshToken, body)
+
+	// the session lives on in the database, signing it out refuses the access token
+	status, body = app.doAs(t, tokens.AccessToken, "GET", "/me/sessions", "")
+	require.Equal(t, http.StatusOK, status)
+	var sessions struct {
+		Sessions []domain.Session `json:"sessions"`
+	}
+	require.NoError(t, json.Unmarshal(body, &sessions))
+	require.Len(t, sessions.Sessions, 1)
+	assert.True(t, sessions.Sessions[0].Current)
+	status, _ = app.doAs(t, tokens.AccessToken, "DELETE", "/me/sessions?except=current", "")
+	require.Equal(t, http.StatusNoContent, status)
+	status, _ = app.doAs(t, tokens.AccessToken, "DELETE", "/me/sessions", "")
+	require.Equal(t, http.StatusNoContent, status)
+	status, _ = app.doAs(t, tokens.AccessToken, "GET", "/users/"+id, "")
+	require.Equal(t, http.StatusUnauthorized, status)
+
+	status, body = app.do(t, "POST", "/auth/login", `{"login": "alice", "password": "wrong horse battery staple"}`)
+	require.Equal(t, http.StatusUnauthorized, status)
+	requireErrorCode(t, handlers.ErrInvalidCredentials, body)
+}
@@ -0,0 +1,148 @@
+//go:build integration
+
+package tests_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dennypenta/go-api-walkthrough/assembly"
+	"github.com/dennypenta/go-api-walkthrough/auth"
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/fixtures"
+	"github.com/dennypenta/go-api-walkthrough/handlers"
+	"github.com/dennypenta/go-api-walkthrough/pkg/jwt"
+	"github.com/dennypenta/go-api-walkthrough/repository/postgres"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/require"
+)
+
+// testApp is the whole app served in-process against its own database.
+type testApp struct {
+	baseURL  string
+	fixtures *fixtures.Loader
+	// token is an admin access token the requests are sent with
+	token string
+}
+
+func newTestApp(t *testing.T) *testApp {
+	t.Helper()
+
+	dsn := template.New(t)
+	conf, err := assembly.NewConfig()
+	require.NoError(t, err)
+	conf.PostresDsn = dsn
+	// the tests don't need the production password hashing cost
+	conf.PasswordHashMemory = 1024
+	conf.PasswordHashIterations = 1
+	token := adminToken(t, &conf)
+
+	ctx := context.Background()
+	pool, err := pgxpool.New(ctx, dsn)
+	require.NoError(t, err)
+
+	// the app and the fixtures share the pool
+	app, err := assembly.NewApp(ctx, conf, assembly.WithPool(pool))
+	require.NoError(t, err)
+	server := httptest.NewServer(app.Mux)
+
+	t.Cleanup(func() {
+		server.Close()
+		app.Close(ctx)
+		pool.Close()
+	})
+
+	return &testApp{
+		baseURL:  server.URL + "/v1",
+		fixtures: fixtures.NewLoader(postgres.NewUserRepository(pool), os.DirFS("testdata")),
+		token:    token,
+	}
+}
+
+// adminToken makes the app sign with a key of the test, so the test signs an admin token itself.
+func adminToken(t *testing.T, conf *assembly.Config) string {
+	t.Helper()
+
+	k, err := jwt.GenerateKey("test")
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(k.Private)
+	require.NoError(t, err)
+	conf.AuthSigningKeyFile = filepath.Join(t.TempDir(), "test.pem")
+	require.NoError(t, os.WriteFile(conf.AuthSigningKeyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600))
+
+	keys, err := jwt.NewKeySet(k, nil, time.Now)
+	require.NoError(t, err)
+	token, err := keys.Sign(jwt.Claims{
+		Issuer:    conf.AuthIssuer,
+		Subject:   uuid.NewString(),
+		Type:      auth.TokenTypeAccess,
+		ExpiresAt: time.Now().Add(time.Hour).Unix(),
+		Roles:     []string{domain.RoleAdmin},
+	})
+	require.NoError(t, err)
+	return token
+}
+
+func (a *testApp) load(t *testing.T, names ...string) fixtures.Set {
+	t.Helper()
+
+	set, err := a.fixtures.Load(context.Background(), names...)
+	require.NoError(t, err)
+	return set
+}
+
+// do sends the request as an admin and returns the status and the response body.
+func (a *testApp) do(t *testing.T, method, path, body string) (int, []byte) {
+	t.Helper()
+
+	return a.doAs(t, a.token, method, path, body)
+}
+
+// doAs sends the request with the access token, an empty one makes the request anonymous.
+func (a *testApp) doAs(t *testing.T, token, method, path, body string) (int, []byte) {
+	t.Helper()
+
+	var reqBody io.Reader
+	if body != "" {
+		reqBody = bytes.NewBufferString(body)
+	}
+	req, err := http.NewRequest(method, a.baseURL+path, reqBody)
+	require.NoError(t, err)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, respBody
+}
+
+func requireErrorCode(t *testing.T, expected handlers.Error, body []byte) {
+	t.Helper()
+
+	httpErr := handlers.Error{}
+	require.NoError(t, json.Unmarshal(body, &httpErr))
+	require.Equal(t, expected.Code, httpErr.Code)
+}
+
+func readTestdata(t *testing.T, name string) string {
+	t.Helper()
+
+	data, err := os.ReadFile("testdata/" + name)
+	require.NoError(t, err)
+	return string(data)
+}
@@ -0,0 +1,31 @@
+//go:build integration
+
+package tests_test
+
+import (
+	"context"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/dennypenta/go-api-walkthrough/migrations"
+	"github.com/dennypenta/go-api-walkthrough/pkg/testdb"
+)
+
+// template is migrated once, every test gets a copy of it
+var template *testdb.Template
+
+func TestMain(m *testing.M) {
+	tpl, err := testdb.NewTemplate(context.Background(), testdb.AdminDSN(), migrations.FS)
+	if err != nil {
+		log.Fatalln("failed to create template database:", err)
+	}
+	template = tpl
+
+	code := m.Run()
+
+	if err := tpl.Close(); err != nil {
+		log.Println("failed to drop template database:", err)
+	}
+	os.Exit(code)
+}
@@ -0,0 +1,81 @@
+//go:build integration
+
+package tests_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dennypenta/go-api-walkthrough/assembly"
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/handlers"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateUser(t *testing.T) {
+	t.Parallel()
+	app := newTestApp(t)
+
+	status, body := app.do(t, "POST", "/users", `{"username": "new-user"}`)
+	require.Equal(t, http.StatusOK, status)
+	var created domain.User
+	require.NoError(t, json.Unmarshal(body, &created))
+	// uuid v4 is 36 characters
+	assert.Len(t, created.ID, 36)
+	assert.Equal(t, "new-user", created.Username)
+
+	// the created user is readable
+	status, body = app.do(t, "GET", "/users/"+created.ID, "")
+	require.Equal(t, http.StatusOK, status)
+	assert.JSONEq(t, string(mustMarshal(t, created)), string(body))
+
+	status, body = app.do(t, "POST", "/users", `{"username": ""}`)
+	require.Equal(t, http.StatusBadRequest, status)
+	requireErrorCode(t, handlers.ErrInvalidUsername, body)
+
+	status, body = app.do(t, "POST", "/users", `{`)
+	require.Equal(t, http.StatusBadRequest, status)
+	requireErrorCode(t, handlers.ErrFailedMarshal, body)
+}
+
+func TestCreateUserWithDB(t *testing.T) {
+	t.Parallel()
+
+	conf, err := assembly.NewConfig()
+	require.NoError(t, err)
+	token := adminToken(t, &conf)
+	ctx := context.Background()
+	db, err := sqlx.Connect("pgx", template.New(t))
+	require.NoError(t, err)
+	defer db.Close()
+	id := uuid.NewString()
+
+	// the database given to the app takes the ids of the app as the pool does
+	app, err := assembly.NewApp(ctx, conf, assembly.WithDB(db), assembly.WithIDGenerator(func() string { return id }))
+	require.NoError(t, err)
+	defer app.Close(ctx)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/v1/users", strings.NewReader(`{"username": "new-user"}`))
+	req.Header.Set("Authorization", "Bearer "+token)
+	app.Mux.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var created domain.User
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, id, created.ID)
+}
+
+func mustMarshal(t *testing.T, v interface{}) []byte {
+	t.Helper()
+
+	data, err := json.Marshal(v)
+	require.NoError(t, err)
+	return data
+}
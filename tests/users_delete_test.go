@@ -0,0 +1,47 @@
+//go:build integration
+
+package tests_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/handlers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeleteUser(t *testing.T) {
+	t.Parallel()
+	app := newTestApp(t)
+	set := app.load(t, "users.yaml")
+	id := set.Users[0].ID
+
+	status, body := app.doAs(t, "", "DELETE", "/users/"+id, "")
+	require.Equal(t, http.StatusUnauthorized, status)
+	requireErrorCode(t, handlers.ErrUnauthorized, body)
+
+	status, _ = app.do(t, "DELETE", "/users/"+id, "")
+	require.Equal(t, http.StatusOK, status)
+
+	status, body = app.do(t, "GET", "/users/"+id, "")
+	require.Equal(t, http.StatusBadRequest, status)
+	requireErrorCode(t, handlers.ErrUserNotFound, body)
+
+	// deleted user is not in the list
+	status, body = app.do(t, "GET", "/users?limit=30&offset=0", "")
+	require.Equal(t, http.StatusOK, status)
+	list := domain.PaginatedUserList{}
+	require.NoError(t, json.Unmarshal(body, &list))
+	assert.Len(t, list.Users, 29)
+	assert.Equal(t, 29, list.Total)
+	assert.Equal(t, 1, list.Pages)
+	assert.Equal(t, 1, list.Page)
+	assert.Equal(t, "", list.Next)
+	assert.Equal(t, "", list.Prev)
+	for _, u := range list.Users {
+		assert.NotEqual(t, id, u.ID)
+	}
+}
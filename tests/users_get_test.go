@@ -0,0 +1,27 @@
+//go:build integration
+
+package tests_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/dennypenta/go-api-walkthrough/handlers"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetUser(t *testing.T) {
+	t.Parallel()
+	app := newTestApp(t)
+	set := app.load(t, "users.yaml")
+
+	status, body := app.do(t, "GET", "/users/"+set.Users[5].ID, "")
+	require.Equal(t, http.StatusOK, status)
+	assert.JSONEq(t, readTestdata(t, "get_user.json"), string(body))
+
+	status, body = app.do(t, "GET", "/users/"+uuid.NewString(), "")
+	require.Equal(t, http.StatusBadRequest, status)
+	requireErrorCode(t, handlers.ErrUserNotFound, body)
+}
@@ -0,0 +1,37 @@
+//go:build integration
+
+package tests_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListUsers(t *testing.T) {
+	t.Parallel()
+	app := newTestApp(t)
+	app.load(t, "users.yaml")
+
+	// the last page holds the oldest users
+	status, body := app.do(t, "GET", "/users?limit=10&offset=20", "")
+	require.Equal(t, http.StatusOK, status)
+	assert.JSONEq(t, readTestdata(t, "list_users_page3.json"), string(body))
+
+	// default pagination
+	status, body = app.do(t, "GET", "/users", "")
+	require.Equal(t, http.StatusOK, status)
+	list := domain.PaginatedUserList{}
+	require.NoError(t, json.Unmarshal(body, &list))
+	require.Len(t, list.Users, 10)
+	assert.Equal(t, "user-29", list.Users[0].Username)
+	assert.Equal(t, 30, list.Total)
+	assert.Equal(t, 1, list.Page)
+	assert.Equal(t, 3, list.Pages)
+	assert.Equal(t, "limit=10&offset=10", list.Next)
+	assert.Equal(t, "", list.Prev)
+}
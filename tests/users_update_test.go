@@ -0,0 +1,39 @@
+//go:build integration
+
+package tests_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/dennypenta/go-api-walkthrough/domain"
+	"github.com/dennypenta/go-api-walkthrough/handlers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateUser(t *testing.T) {
+	t.Parallel()
+	app := newTestApp(t)
+	set := app.load(t, "users.yaml")
+	id := set.Users[0].ID
+
+	status, body := app.do(t, "PUT", "/users/"+id, `{"username": ""}`)
+	require.Equal(t, http.StatusBadRequest, status)
+	requireErrorCode(t, handlers.ErrInvalidUsername, body)
+
+	status, body = app.do(t, "PUT", "/users/"+id, `{"username": "updated-user-0"}`)
+	require.Equal(t, http.StatusOK, status)
+	var updated domain.User
+	require.NoError(t, json.Unmarshal(body, &updated))
+	assert.Equal(t, domain.User{ID: id, Username: "updated-user-0"}, updated)
+
+	// update doesn't change the order, the user is still the oldest one
+	status, body = app.do(t, "GET", "/users?limit=10&offset=20", "")
+	require.Equal(t, http.StatusOK, status)
+	list := domain.PaginatedUserList{}
+	require.NoError(t, json.Unmarshal(body, &list))
+	require.Len(t, list.Users, 10)
+	assert.Equal(t, updated, list.Users[9])
+}